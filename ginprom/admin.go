@@ -0,0 +1,110 @@
+package ginprom
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminSettings is the JSON document of AdminHandler, the omitted settings being unchanged
+// by the updates
+type adminSettings struct {
+	Filters              *FilterRules   `json:"filters,omitempty"`
+	SampleRates          map[string]int `json:"sample_rates"`
+	SlowRequestThreshold *string        `json:"slow_request_threshold,omitempty"`
+}
+
+// AdminHandler returns a gin.HandlerFunc viewing the settings s on GET, and changing them
+// on PUT or PATCH with a JSON document like
+//
+//	{"filters": {"exclude_paths": ["/healthz"]}, "sample_rates": {"/search": 10}, "slow_request_threshold": "750ms"}
+//
+// whose omitted settings are unchanged, the filters being replaced as a whole. It answers
+// 401 to the requests auth rejects, to be mounted on an internal group like
+// internal.Any("/ginprom", ginprom.AdminHandler(settings, auth)). It panics when s is nil
+// or auth is empty, see NewAdminHandler
+func AdminHandler(s *Settings, auth HandlerAuth) gin.HandlerFunc {
+	h, err := NewAdminHandler(s, auth)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// NewAdminHandler is like AdminHandler but returns an error when s is nil or auth is empty
+func NewAdminHandler(s *Settings, auth HandlerAuth) (gin.HandlerFunc, error) {
+	if s == nil {
+		return nil, errors.New("ginprom: the admin handler needs settings")
+	}
+	if err := auth.validate(); err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		if !auth.authenticate(c.Request) {
+			auth.reject(c, "ginprom")
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut, http.MethodPatch:
+			if err := s.update(c.Request); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		default:
+			c.Header("Allow", strings.Join([]string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch}, ", "))
+			c.AbortWithStatus(http.StatusMethodNotAllowed)
+			return
+		}
+		c.JSON(http.StatusOK, s.admin())
+	}, nil
+}
+
+// admin returns the adminSettings of s
+func (s *Settings) admin() adminSettings {
+	rules := s.filters.Rules()
+	threshold := s.SlowRequestThreshold().String()
+	return adminSettings{Filters: &rules, SampleRates: s.SampleRates(), SlowRequestThreshold: &threshold}
+}
+
+// update changes s as the adminSettings of r tell, nothing being changed when one is invalid
+func (s *Settings) update(r *http.Request) error {
+	var update adminSettings
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		return errors.New("ginprom: invalid settings: " + err.Error())
+	}
+
+	var compiled *compiledFilters
+	if update.Filters != nil {
+		var err error
+		if compiled, err = compileFilters(*update.Filters); err != nil {
+			return err
+		}
+	}
+	var threshold time.Duration
+	if update.SlowRequestThreshold != nil {
+		var err error
+		if threshold, err = time.ParseDuration(*update.SlowRequestThreshold); err != nil {
+			return errors.New("ginprom: invalid slow request threshold: " + err.Error())
+		}
+	}
+	if update.SampleRates != nil {
+		if err := s.SetSampleRates(update.SampleRates); err != nil {
+			return err
+		}
+	}
+	if compiled != nil {
+		s.filters.compiled.Store(compiled)
+	}
+	if update.SlowRequestThreshold != nil {
+		s.SetSlowRequestThreshold(threshold)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package ginprom
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// adminRequest sends body to the admin handler of r with the credentials of auth
+func adminRequest(r http.Handler, method, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/internal/ginprom", strings.NewReader(body))
+	req.SetBasicAuth("admin", "s3cret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		body          string
+		wantStatus    int
+		wantFilters   FilterRules
+		wantRates     map[string]int
+		wantThreshold time.Duration
+	}{
+		{"view", http.MethodGet, "", http.StatusOK,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/search": 2}, time.Second},
+		{"filters", http.MethodPatch, `{"filters": {"exclude_paths": ["/healthz"]}}`, http.StatusOK,
+			FilterRules{ExcludePaths: []string{"/healthz"}}, map[string]int{"/search": 2}, time.Second},
+		{"sample rates", http.MethodPut, `{"sample_rates": {"/users": 10}}`, http.StatusOK,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/users": 10}, time.Second},
+		{"cleared sample rates", http.MethodPatch, `{"sample_rates": {}}`, http.StatusOK,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{}, time.Second},
+		{"threshold", http.MethodPatch, `{"slow_request_threshold": "250ms"}`, http.StatusOK,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/search": 2}, 250 * time.Millisecond},
+		{"invalid json", http.MethodPatch, `{"filters":`, http.StatusBadRequest,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/search": 2}, time.Second},
+		{"unknown setting", http.MethodPatch, `{"sample_rate": 2}`, http.StatusBadRequest,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/search": 2}, time.Second},
+		{"invalid regex", http.MethodPatch, `{"filters": {"exclude_status": "(5"}, "slow_request_threshold": "2s"}`, http.StatusBadRequest,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/search": 2}, time.Second},
+		{"invalid threshold", http.MethodPatch, `{"sample_rates": {"/a": 3}, "slow_request_threshold": "slow"}`, http.StatusBadRequest,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/search": 2}, time.Second},
+		{"negative rate", http.MethodPatch, `{"sample_rates": {"/a": -3}}`, http.StatusBadRequest,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/search": 2}, time.Second},
+		{"method", http.MethodDelete, "", http.StatusMethodNotAllowed,
+			FilterRules{ExcludeRegexMethod: "OPTIONS"}, map[string]int{"/search": 2}, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.ExcludeRegexMethod = "OPTIONS"
+			opts.SampleRates = map[string]int{"/search": 2}
+			opts.SlowRequestThreshold = time.Second
+			settings, err := NewSettings(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := gin.New()
+			r.Any("/internal/ginprom", AdminHandler(settings, HandlerAuth{Username: "admin", Password: "s3cret"}))
+
+			w := adminRequest(r, tt.method, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := settings.Filters().Rules(); !reflect.DeepEqual(got, tt.wantFilters) {
+				t.Errorf("got filters %+v, want %+v", got, tt.wantFilters)
+			}
+			if got := settings.SampleRates(); !reflect.DeepEqual(got, tt.wantRates) {
+				t.Errorf("got sample rates %v, want %v", got, tt.wantRates)
+			}
+			if got := settings.SlowRequestThreshold(); got != tt.wantThreshold {
+				t.Errorf("got slow request threshold %v, want %v", got, tt.wantThreshold)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var view adminSettings
+			if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil {
+				t.Fatal(err)
+			}
+			if *view.SlowRequestThreshold != tt.wantThreshold.String() || !reflect.DeepEqual(view.SampleRates, tt.wantRates) {
+				t.Errorf("got the view %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerAuth(t *testing.T) {
+	settings, err := NewSettings(NewDefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/internal/ginprom", AdminHandler(settings, HandlerAuth{VerifyToken: StaticToken("t0ken")}))
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"token", "t0ken", http.StatusOK},
+		{"wrong token", "token", http.StatusUnauthorized},
+		{"no token", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/internal/ginprom", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAdminHandlerInvalid(t *testing.T) {
+	settings, err := NewSettings(NewDefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		settings *Settings
+		auth     HandlerAuth
+	}{
+		{"no settings", nil, HandlerAuth{Username: "admin"}},
+		{"no auth", settings, HandlerAuth{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if h, err := NewAdminHandler(tt.settings, tt.auth); err == nil || h != nil {
+				t.Errorf("got %v, want an error", err)
+			}
+		})
+	}
+}
+
+func TestPromOptsSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		update   string
+		wantReqs float64
+		wantSlow float64
+	}{
+		{"unchanged", `{}`, 2, 0},
+		{"excluded", `{"filters": {"exclude_paths": ["/slow"]}}`, 1, 0},
+		{"slow", `{"slow_request_threshold": "1ns"}`, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			settings, err := NewSettings(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.Settings = settings
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/slow", func(c *gin.Context) {
+				time.Sleep(time.Millisecond)
+				c.Status(http.StatusOK)
+			})
+			r.PATCH("/internal/ginprom", AdminHandler(settings, HandlerAuth{Username: "admin", Password: "s3cret"}))
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			serve(r, http.MethodGet, "/slow")
+			if w := adminRequest(r, http.MethodPatch, tt.update); w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body)
+			}
+			serve(r, http.MethodGet, "/slow")
+
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues("200", "/slow", http.MethodGet)); got != tt.wantReqs {
+				t.Errorf("got %v requests, want %v", got, tt.wantReqs)
+			}
+			if got := testutil.ToFloat64(m.slowRequests.WithLabelValues("/slow", http.MethodGet)); got != tt.wantSlow {
+				t.Errorf("got %v slow requests, want %v", got, tt.wantSlow)
+			}
+		})
+	}
+}
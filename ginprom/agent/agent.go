@@ -0,0 +1,363 @@
+// Package agent forwards metric deltas to a central collector over gRPC,
+// for fleets where scraping every instance doesn't scale
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 5 * time.Second
+	maxBackoff      = 5 * time.Minute
+)
+
+// Opts represents the agent options
+type Opts struct {
+	// Target is the address of the collector
+	Target string
+	// Instance identifies the agent, defaults to the hostname
+	Instance string
+	// Gatherer is the source of the metrics, defaults to prometheus.DefaultGatherer
+	Gatherer prometheus.Gatherer
+	// Interval between two batches
+	Interval time.Duration
+	// Timeout of a single push
+	Timeout time.Duration
+	// DialOptions are passed to grpc.NewClient, insecure credentials are used if empty
+	DialOptions []grpc.DialOption
+	// OnError is called with gather and push errors, if set
+	OnError func(err error)
+}
+
+type familyState struct {
+	help string
+	typ  string
+	sent bool
+}
+
+type seriesState struct {
+	id     uint64
+	name   string
+	labels map[string]string
+	value  float64
+
+	// defined is set once the collector acknowledged the name and labels of the series
+	defined    bool
+	acked      bool
+	ackedValue float64
+}
+
+// Agent periodically gathers the metrics and sends the series changed since the
+// last acknowledged batch. Counters are sent as cumulative values, so while the
+// collector is unreachable nothing is lost: the next successful batch carries them
+type Agent struct {
+	opts  *Opts
+	conn  *grpc.ClientConn
+	epoch int64
+
+	seq      uint64
+	nextID   uint64
+	families map[string]*familyState
+	series   map[string]*seriesState
+
+	retryAt time.Time
+	backoff time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// New returns a started Agent
+func New(agentOpts *Opts) (*Agent, error) {
+	if agentOpts == nil || agentOpts.Target == "" {
+		return nil, errors.New("agent: collector target is required")
+	}
+	opts := *agentOpts
+	if opts.Instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		opts.Instance = hostname
+	}
+	if opts.Gatherer == nil {
+		opts.Gatherer = prometheus.DefaultGatherer
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	dialOptions := opts.DialOptions
+	if len(dialOptions) == 0 {
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(opts.Target, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newAgent(&opts)
+	a.conn = conn
+	go a.run()
+	return a, nil
+}
+
+func newAgent(opts *Opts) *Agent {
+	return &Agent{
+		opts:     opts,
+		epoch:    time.Now().UnixNano(),
+		families: make(map[string]*familyState),
+		series:   make(map[string]*seriesState),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Stop sends a last batch and closes the connection to the collector
+func (a *Agent) Stop() error {
+	a.once.Do(func() { close(a.stop) })
+	<-a.done
+	return a.conn.Close()
+}
+
+func (a *Agent) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.tick(false)
+		case <-a.stop:
+			a.tick(true)
+			return
+		}
+	}
+}
+
+// tick gathers the metrics and pushes the changes, final ignores the retry backoff
+func (a *Agent) tick(final bool) {
+	if err := a.gather(); err != nil {
+		a.error(err)
+	}
+	if !final && time.Now().Before(a.retryAt) {
+		return
+	}
+
+	batch := a.batch()
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.Timeout)
+	ack, err := push(ctx, a.conn, batch)
+	cancel()
+
+	if err != nil {
+		a.error(err)
+		if a.backoff == 0 {
+			a.backoff = a.opts.Interval
+		} else if a.backoff *= 2; a.backoff > maxBackoff {
+			a.backoff = maxBackoff
+		}
+		a.retryAt = time.Now().Add(a.backoff)
+		return
+	}
+	a.backoff = 0
+	a.retryAt = time.Time{}
+	a.acknowledge(batch, ack)
+}
+
+func (a *Agent) error(err error) {
+	if a.opts.OnError != nil {
+		a.opts.OnError(err)
+	}
+}
+
+// batch builds the next batch from the changes not acknowledged yet
+func (a *Agent) batch() *Batch {
+	a.seq++
+	batch := &Batch{
+		Instance: a.opts.Instance,
+		Epoch:    a.epoch,
+		Seq:      a.seq,
+	}
+
+	for name, f := range a.families {
+		if !f.sent {
+			batch.Families = append(batch.Families, Family{Name: name, Help: f.help, Type: f.typ})
+		}
+	}
+	for _, s := range a.series {
+		switch {
+		case !s.defined:
+			batch.Series = append(batch.Series, Series{ID: s.id, Name: s.name, Labels: s.labels, Value: s.value})
+		case !s.acked || s.value != s.ackedValue:
+			batch.Series = append(batch.Series, Series{ID: s.id, Value: s.value})
+		}
+	}
+
+	sort.Slice(batch.Families, func(i, j int) bool { return batch.Families[i].Name < batch.Families[j].Name })
+	sort.Slice(batch.Series, func(i, j int) bool { return batch.Series[i].ID < batch.Series[j].ID })
+	return batch
+}
+
+// acknowledge records what the collector received
+func (a *Agent) acknowledge(batch *Batch, ack *Ack) {
+	if ack.Resync {
+		for _, f := range a.families {
+			f.sent = false
+		}
+		for _, s := range a.series {
+			s.defined, s.acked = false, false
+		}
+		return
+	}
+
+	for _, f := range batch.Families {
+		if state, ok := a.families[f.Name]; ok {
+			state.sent = true
+		}
+	}
+	byID := make(map[uint64]*seriesState, len(a.series))
+	for _, s := range a.series {
+		byID[s.id] = s
+	}
+	for _, sent := range batch.Series {
+		if s, ok := byID[sent.ID]; ok {
+			s.defined, s.acked, s.ackedValue = true, true, sent.Value
+		}
+	}
+}
+
+// gather updates the state of the series from the gatherer,
+// series which disappeared are forgotten
+func (a *Agent) gather() error {
+	mfs, err := a.opts.Gatherer.Gather()
+	if len(mfs) == 0 {
+		return err
+	}
+
+	seen := make(map[string]bool, len(a.series))
+	set := func(name, help, typ string, labels map[string]string, value float64) {
+		if f, ok := a.families[name]; !ok || f.help != help || f.typ != typ {
+			a.families[name] = &familyState{help: help, typ: typ}
+		}
+
+		key := seriesKey(name, labels)
+		seen[key] = true
+		s, ok := a.series[key]
+		if !ok {
+			a.nextID++
+			s = &seriesState{id: a.nextID, name: name, labels: labels}
+			a.series[key] = s
+		}
+		s.value = value
+	}
+
+	for _, mf := range mfs {
+		name, help := mf.GetName(), mf.GetHelp()
+		for _, m := range mf.GetMetric() {
+			labels := labelMap(m.GetLabel())
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				set(name, help, TypeCounter, labels, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				set(name, help, TypeGauge, labels, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				set(name, help, TypeGauge, labels, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					set(name+"_bucket", help, TypeCounter, withLabel(labels, "le", formatFloat(b.GetUpperBound())), float64(b.GetCumulativeCount()))
+				}
+				set(name+"_bucket", help, TypeCounter, withLabel(labels, "le", "+Inf"), float64(h.GetSampleCount()))
+				set(name+"_sum", help, TypeCounter, labels, h.GetSampleSum())
+				set(name+"_count", help, TypeCounter, labels, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					set(name, help, TypeGauge, withLabel(labels, "quantile", formatFloat(q.GetQuantile())), q.GetValue())
+				}
+				set(name+"_sum", help, TypeCounter, labels, s.GetSampleSum())
+				set(name+"_count", help, TypeCounter, labels, float64(s.GetSampleCount()))
+			}
+		}
+	}
+
+	for key := range a.series {
+		if !seen[key] {
+			delete(a.series, key)
+		}
+	}
+	return err
+}
+
+func labelMap(pairs []*dto.LabelPair) map[string]string {
+	if len(pairs) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(pairs))
+	for _, lp := range pairs {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	return labels
+}
+
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	out := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out[name] = value
+	return out
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// sortedLabels returns the label names in order and their values
+func sortedLabels(labels map[string]string) (names, values []string) {
+	names = make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values = make([]string, len(names))
+	for i, name := range names {
+		values[i] = labels[name]
+	}
+	return names, values
+}
+
+// seriesKey identifies a series by its name and sorted labels
+func seriesKey(name string, labels map[string]string) string {
+	names, values := sortedLabels(labels)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for i := range names {
+		b.WriteByte(0)
+		b.WriteString(names[i])
+		b.WriteByte(0)
+		b.WriteString(values[i])
+	}
+	return b.String()
+}
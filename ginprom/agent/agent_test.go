@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAgentBatch(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"code"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight", Help: "In flight."})
+	reg.MustRegister(counter, gauge)
+
+	a := newAgent(&Opts{Instance: "i1", Gatherer: reg})
+	step := func(ack *Ack) *Batch {
+		t.Helper()
+		if err := a.gather(); err != nil {
+			t.Fatal(err)
+		}
+		batch := a.batch()
+		if ack != nil {
+			a.acknowledge(batch, ack)
+		}
+		return batch
+	}
+
+	counter.WithLabelValues("200").Add(3)
+	gauge.Set(1)
+	first := step(&Ack{})
+	if len(first.Families) != 2 || len(first.Series) != 2 {
+		t.Fatalf("first batch = %+v, want 2 families and 2 series", first)
+	}
+	for _, s := range first.Series {
+		if s.Name == "" {
+			t.Errorf("series %d sent without its definition", s.ID)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		update       func()
+		ack          *Ack
+		wantFamilies int
+		wantSeries   []Series
+	}{
+		{
+			name:       "unchanged series are not sent",
+			update:     func() {},
+			ack:        &Ack{},
+			wantSeries: nil,
+		},
+		{
+			name:       "changed counters are sent by ID with the cumulative value",
+			update:     func() { counter.WithLabelValues("200").Add(2) },
+			wantSeries: []Series{{ID: 2, Value: 5}},
+		},
+		{
+			name:       "unacknowledged series are sent again",
+			update:     func() {},
+			ack:        &Ack{Resync: true},
+			wantSeries: []Series{{ID: 2, Value: 5}},
+		},
+		{
+			name:         "resync sends the definitions again",
+			update:       func() {},
+			ack:          &Ack{},
+			wantFamilies: 2,
+			wantSeries: []Series{
+				{ID: 1, Name: "in_flight", Value: 1},
+				{ID: 2, Name: "requests_total", Labels: map[string]string{"code": "200"}, Value: 5},
+			},
+		},
+		{
+			name:       "new series come with their definition",
+			update:     func() { counter.WithLabelValues("500").Inc() },
+			ack:        &Ack{},
+			wantSeries: []Series{{ID: 3, Name: "requests_total", Labels: map[string]string{"code": "500"}, Value: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.update()
+			batch := step(tt.ack)
+			if len(batch.Families) != tt.wantFamilies {
+				t.Errorf("got %d families, want %d", len(batch.Families), tt.wantFamilies)
+			}
+			if len(batch.Series) != len(tt.wantSeries) {
+				t.Fatalf("got series %+v, want %+v", batch.Series, tt.wantSeries)
+			}
+			for i, want := range tt.wantSeries {
+				got := batch.Series[i]
+				if got.ID != want.ID || got.Name != want.Name || got.Value != want.Value || len(got.Labels) != len(want.Labels) {
+					t.Errorf("series %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+
+	if a.batch().Seq <= first.Seq {
+		t.Error("sequence numbers must increase")
+	}
+}
+
+func TestAgentGatherHistogram(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Help: "Latency.", Buckets: []float64{0.1, 1}})
+	reg.MustRegister(h)
+	h.Observe(0.5)
+
+	a := newAgent(&Opts{Instance: "i1", Gatherer: reg})
+	if err := a.gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]float64{
+		seriesKey("latency_seconds_bucket", map[string]string{"le": "0.1"}):  0,
+		seriesKey("latency_seconds_bucket", map[string]string{"le": "1"}):    1,
+		seriesKey("latency_seconds_bucket", map[string]string{"le": "+Inf"}): 1,
+		seriesKey("latency_seconds_sum", nil):                                0.5,
+		seriesKey("latency_seconds_count", nil):                              1,
+	}
+	if len(a.series) != len(want) {
+		t.Fatalf("got %d series, want %d", len(a.series), len(want))
+	}
+	for key, value := range want {
+		s, ok := a.series[key]
+		if !ok {
+			t.Errorf("missing series %q", key)
+			continue
+		}
+		if s.value != value {
+			t.Errorf("series %q = %v, want %v", key, s.value, value)
+		}
+	}
+}
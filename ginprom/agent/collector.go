@@ -0,0 +1,278 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// InstanceLabel is the label identifying the agent of a series
+const InstanceLabel = "agent_instance"
+
+const defaultInstanceTTL = 10 * time.Minute
+
+// CollectorOpts represents the collector options
+type CollectorOpts struct {
+	// Aggregate drops the instance label so the series of all agents are summed
+	Aggregate bool
+	// InstanceTTL is how long the series of an agent are kept after its last batch,
+	// defaults to 10m
+	InstanceTTL time.Duration
+}
+
+type family struct {
+	help string
+	typ  string
+}
+
+type instanceSeries struct {
+	name   string
+	labels map[string]string
+	key    string
+	typ    string
+	// raw is the last value sent by the agent, total the counter value exported
+	raw   float64
+	total float64
+	seen  bool
+}
+
+type instance struct {
+	epoch    int64
+	seq      uint64
+	lastSeen time.Time
+	series   map[uint64]*instanceSeries
+}
+
+// Collector is the central service receiving the batches of the agents, it implements
+// CollectorServer and exposes the accumulated series as a prometheus.Collector
+type Collector struct {
+	opts CollectorOpts
+
+	mu        sync.Mutex
+	families  map[string]*family
+	instances map[string]*instance
+	// counters holds the aggregated counters, which outlive the instances
+	counters map[string]*instanceSeries
+}
+
+// NewCollector returns a Collector, it still needs to be registered
+func NewCollector(collectorOpts *CollectorOpts) *Collector {
+	var opts CollectorOpts
+	if collectorOpts != nil {
+		opts = *collectorOpts
+	}
+	if opts.InstanceTTL <= 0 {
+		opts.InstanceTTL = defaultInstanceTTL
+	}
+
+	return &Collector{
+		opts:      opts,
+		families:  make(map[string]*family),
+		instances: make(map[string]*instance),
+		counters:  make(map[string]*instanceSeries),
+	}
+}
+
+// Push implements CollectorServer. Invalid batches are rejected as a whole with
+// codes.InvalidArgument, batches already applied are acknowledged as duplicates
+func (c *Collector) Push(_ context.Context, batch *Batch) (*Ack, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.validate(batch); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	c.prune(now)
+
+	inst, ok := c.instances[batch.Instance]
+	if ok && inst.epoch == batch.Epoch && batch.Seq <= inst.seq {
+		inst.lastSeen = now
+		return &Ack{Duplicate: true}, nil
+	}
+	if !ok || inst.epoch != batch.Epoch {
+		inst = &instance{epoch: batch.Epoch, series: make(map[uint64]*instanceSeries)}
+		c.instances[batch.Instance] = inst
+	}
+	inst.seq = batch.Seq
+	inst.lastSeen = now
+
+	// the help text of the first agent wins, a scrape fails on mixed help texts
+	for _, f := range batch.Families {
+		if _, ok := c.families[f.Name]; !ok {
+			c.families[f.Name] = &family{help: f.Help, typ: f.Type}
+		}
+	}
+
+	ack := &Ack{}
+	for _, sample := range batch.Series {
+		s, ok := inst.series[sample.ID]
+		if sample.Name != "" {
+			f, known := c.families[sample.Name]
+			if !known {
+				ack.Resync = true
+				continue
+			}
+			labels := sample.Labels
+			if !c.opts.Aggregate {
+				labels = withLabel(labels, InstanceLabel, batch.Instance)
+			}
+			key := seriesKey(sample.Name, labels)
+			if !ok || s.key != key {
+				s = &instanceSeries{name: sample.Name, labels: labels, key: key, typ: f.typ}
+				inst.series[sample.ID] = s
+			}
+		} else if !ok {
+			// the collector restarted or expired the instance, it needs the definitions again
+			ack.Resync = true
+			continue
+		}
+
+		c.apply(s, sample.Value)
+		ack.Accepted++
+	}
+	return ack, nil
+}
+
+// apply records a value of s, counters are turned into deltas so a counter reset
+// of the agent doesn't decrease the exported value
+func (c *Collector) apply(s *instanceSeries, value float64) {
+	if s.typ != TypeCounter {
+		s.raw, s.total, s.seen = value, value, true
+		return
+	}
+
+	delta := value - s.raw
+	if !s.seen || value < s.raw {
+		delta = value
+	}
+	s.raw, s.seen = value, true
+	s.total += delta
+
+	if c.opts.Aggregate {
+		agg, ok := c.counters[s.key]
+		if !ok {
+			agg = &instanceSeries{name: s.name, labels: s.labels, key: s.key, typ: s.typ}
+			c.counters[s.key] = agg
+		}
+		agg.total += delta
+	}
+}
+
+// validate checks the batch before anything is applied
+func (c *Collector) validate(batch *Batch) error {
+	if batch.Instance == "" {
+		return fmt.Errorf("instance is required")
+	}
+
+	types := make(map[string]string, len(batch.Families))
+	for _, f := range batch.Families {
+		if f.Type != TypeCounter && f.Type != TypeGauge {
+			return fmt.Errorf("metric %q: unknown type %q", f.Name, f.Type)
+		}
+		if err := checkSeries(f.Name, f.Help, nil); err != nil {
+			return err
+		}
+		if known, ok := c.families[f.Name]; ok && known.typ != f.Type {
+			return fmt.Errorf("metric %q: type %s conflicts with %s", f.Name, f.Type, known.typ)
+		}
+		types[f.Name] = f.Type
+	}
+
+	for _, s := range batch.Series {
+		if s.Name == "" {
+			if len(s.Labels) > 0 {
+				return fmt.Errorf("series %d: labels without a name", s.ID)
+			}
+			continue
+		}
+		if _, ok := s.Labels[InstanceLabel]; ok {
+			return fmt.Errorf("metric %q: label %s is reserved", s.Name, InstanceLabel)
+		}
+		if err := checkSeries(s.Name, "", s.Labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSeries reports whether name and labels make a valid metric
+func checkSeries(name, help string, labels map[string]string) error {
+	names, values := sortedLabels(labels)
+	desc := prometheus.NewDesc(name, help, names, nil)
+	if _, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, 0, values...); err != nil {
+		return fmt.Errorf("metric %q: %w", name, err)
+	}
+	return nil
+}
+
+// prune forgets the instances without a batch for longer than the TTL
+func (c *Collector) prune(now time.Time) {
+	for name, inst := range c.instances {
+		if now.Sub(inst.lastSeen) > c.opts.InstanceTTL {
+			delete(c.instances, name)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector, the series are only known once pushed
+func (c *Collector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune(time.Now())
+
+	if !c.opts.Aggregate {
+		for _, inst := range c.instances {
+			for _, s := range inst.series {
+				c.collect(ch, s, s.total)
+			}
+		}
+		return
+	}
+
+	gauges := make(map[string]*instanceSeries)
+	sums := make(map[string]float64)
+	for _, inst := range c.instances {
+		for _, s := range inst.series {
+			if s.typ != TypeGauge {
+				continue
+			}
+			gauges[s.key] = s
+			sums[s.key] += s.total
+		}
+	}
+	for key, s := range gauges {
+		c.collect(ch, s, sums[key])
+	}
+	for _, s := range c.counters {
+		c.collect(ch, s, s.total)
+	}
+}
+
+func (c *Collector) collect(ch chan<- prometheus.Metric, s *instanceSeries, value float64) {
+	f, ok := c.families[s.name]
+	if !ok {
+		return
+	}
+	valueType := prometheus.GaugeValue
+	if s.typ == TypeCounter {
+		valueType = prometheus.CounterValue
+	}
+
+	names, values := sortedLabels(s.labels)
+	m, err := prometheus.NewConstMetric(prometheus.NewDesc(s.name, f.help, names, nil), valueType, value, values...)
+	if err != nil {
+		return
+	}
+	ch <- m
+}
@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var requestsFamily = Family{Name: "requests_total", Help: "Requests.", Type: TypeCounter}
+
+func TestCollectorCounterDeltas(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches []*Batch
+		want    float64
+	}{
+		{
+			name: "cumulative values",
+			batches: []*Batch{
+				{Instance: "i1", Epoch: 1, Seq: 1, Families: []Family{requestsFamily}, Series: []Series{{ID: 1, Name: "requests_total", Value: 3}}},
+				{Instance: "i1", Epoch: 1, Seq: 2, Series: []Series{{ID: 1, Value: 5}}},
+			},
+			want: 5,
+		},
+		{
+			name: "retried batches are ignored",
+			batches: []*Batch{
+				{Instance: "i1", Epoch: 1, Seq: 1, Families: []Family{requestsFamily}, Series: []Series{{ID: 1, Name: "requests_total", Value: 3}}},
+				{Instance: "i1", Epoch: 1, Seq: 2, Series: []Series{{ID: 1, Value: 5}}},
+				{Instance: "i1", Epoch: 1, Seq: 2, Series: []Series{{ID: 1, Value: 5}}},
+			},
+			want: 5,
+		},
+		{
+			name: "counter reset",
+			batches: []*Batch{
+				{Instance: "i1", Epoch: 1, Seq: 1, Families: []Family{requestsFamily}, Series: []Series{{ID: 1, Name: "requests_total", Value: 3}}},
+				{Instance: "i1", Epoch: 1, Seq: 2, Series: []Series{{ID: 1, Value: 1}}},
+			},
+			want: 4,
+		},
+		{
+			name: "agent restart",
+			batches: []*Batch{
+				{Instance: "i1", Epoch: 1, Seq: 5, Families: []Family{requestsFamily}, Series: []Series{{ID: 1, Name: "requests_total", Value: 3}}},
+				{Instance: "i1", Epoch: 2, Seq: 1, Families: []Family{requestsFamily}, Series: []Series{{ID: 1, Name: "requests_total", Value: 2}}},
+			},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCollector(nil)
+			for _, batch := range tt.batches {
+				if _, err := c.Push(context.Background(), batch); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected := `
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{agent_instance="i1"} ` + formatFloat(tt.want) + `
+`
+			if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCollectorAck(t *testing.T) {
+	c := NewCollector(nil)
+	first := &Batch{Instance: "i1", Epoch: 1, Seq: 1, Families: []Family{requestsFamily}, Series: []Series{{ID: 1, Name: "requests_total", Value: 1}}}
+	if _, err := c.Push(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		batch *Batch
+		want  Ack
+	}{
+		{
+			name:  "duplicate",
+			batch: first,
+			want:  Ack{Duplicate: true},
+		},
+		{
+			name:  "known series",
+			batch: &Batch{Instance: "i1", Epoch: 1, Seq: 2, Series: []Series{{ID: 1, Value: 2}}},
+			want:  Ack{Accepted: 1},
+		},
+		{
+			name:  "unknown series",
+			batch: &Batch{Instance: "i1", Epoch: 1, Seq: 3, Series: []Series{{ID: 1, Value: 3}, {ID: 2, Value: 1}}},
+			want:  Ack{Accepted: 1, Resync: true},
+		},
+		{
+			name:  "unknown instance",
+			batch: &Batch{Instance: "i2", Epoch: 1, Seq: 7, Series: []Series{{ID: 1, Value: 1}}},
+			want:  Ack{Resync: true},
+		},
+		{
+			name:  "unknown family",
+			batch: &Batch{Instance: "i1", Epoch: 1, Seq: 4, Series: []Series{{ID: 3, Name: "other_total", Value: 1}}},
+			want:  Ack{Resync: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack, err := c.Push(context.Background(), tt.batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *ack != tt.want {
+				t.Errorf("got %+v, want %+v", *ack, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectorInvalidBatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		batch *Batch
+	}{
+		{
+			name:  "missing instance",
+			batch: &Batch{Epoch: 1, Seq: 1},
+		},
+		{
+			name:  "empty family name",
+			batch: &Batch{Instance: "i1", Epoch: 1, Seq: 1, Families: []Family{{Type: TypeGauge}}},
+		},
+		{
+			name:  "unknown type",
+			batch: &Batch{Instance: "i1", Epoch: 1, Seq: 1, Families: []Family{{Name: "up", Type: "histogram"}}},
+		},
+		{
+			name:  "type conflict",
+			batch: &Batch{Instance: "i1", Epoch: 1, Seq: 1, Families: []Family{{Name: "requests_total", Type: TypeGauge}}},
+		},
+		{
+			name:  "invalid label name",
+			batch: &Batch{Instance: "i1", Epoch: 1, Seq: 1, Series: []Series{{ID: 1, Name: "up", Labels: map[string]string{"": "x"}}}},
+		},
+		{
+			name:  "reserved label",
+			batch: &Batch{Instance: "i1", Epoch: 1, Seq: 1, Series: []Series{{ID: 1, Name: "up", Labels: map[string]string{InstanceLabel: "x"}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCollector(nil)
+			c.families[requestsFamily.Name] = &family{help: requestsFamily.Help, typ: requestsFamily.Type}
+
+			_, err := c.Push(context.Background(), tt.batch)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("got %v, want InvalidArgument", err)
+			}
+			if len(c.instances) != 0 {
+				t.Error("invalid batch must not be applied")
+			}
+		})
+	}
+}
+
+func TestCollectorAggregate(t *testing.T) {
+	c := NewCollector(&CollectorOpts{Aggregate: true, InstanceTTL: time.Hour})
+	families := []Family{requestsFamily, {Name: "in_flight", Help: "In flight.", Type: TypeGauge}}
+	for _, instance := range []string{"i1", "i2"} {
+		help := families
+		if instance == "i2" {
+			// the help of the first agent wins
+			help = []Family{{Name: "requests_total", Help: "Other.", Type: TypeCounter}, families[1]}
+		}
+		batch := &Batch{Instance: instance, Epoch: 1, Seq: 1, Families: help, Series: []Series{
+			{ID: 1, Name: "requests_total", Value: 2},
+			{ID: 2, Name: "in_flight", Value: 3},
+		}}
+		if _, err := c.Push(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `
+# HELP in_flight In flight.
+# TYPE in_flight gauge
+in_flight 6
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total 4
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// counters of expired agents are kept, their gauges are dropped
+	c.mu.Lock()
+	c.prune(time.Now().Add(2 * time.Hour))
+	c.mu.Unlock()
+	if len(c.instances) != 0 {
+		t.Fatalf("got %d instances after the TTL, want 0", len(c.instances))
+	}
+	if got := testutil.CollectAndCount(c, "in_flight"); got != 0 {
+		t.Errorf("got %d in_flight series, want 0", got)
+	}
+	if got := testutil.ToFloat64(prometheus.Collector(c)); got != 4 {
+		t.Errorf("got requests_total %v, want 4", got)
+	}
+}
+
+func TestAgentToCollector(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	c := NewCollector(nil)
+	RegisterCollectorServer(s, c)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."})
+	reg.MustRegister(counter)
+	counter.Add(7)
+
+	a, err := New(&Opts{Target: lis.Addr().String(), Instance: "i1", Gatherer: reg, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{agent_instance="i1"} 7
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// codecName is the gRPC content-subtype of the messages below,
+// they are plain Go structs so no generated protobuf code is needed
+const codecName = "ginprom-json"
+
+const (
+	serviceName    = "ginprom.agent.Collector"
+	pushFullMethod = "/" + serviceName + "/Push"
+)
+
+// Series types
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// Family is the metadata of a metric name, sent once per name and collector
+type Family struct {
+	Name string `json:"n"`
+	Help string `json:"h,omitempty"`
+	Type string `json:"t"`
+}
+
+// Series is a value of a Batch. Name and Labels are only sent the first time an ID
+// is used, later batches refer to the series by ID. Counter values are cumulative,
+// the collector computes the deltas so a batch applied twice doesn't double-count
+type Series struct {
+	ID     uint64            `json:"id"`
+	Name   string            `json:"n,omitempty"`
+	Labels map[string]string `json:"l,omitempty"`
+	Value  float64           `json:"v"`
+}
+
+// Batch holds the series which changed since the last acknowledged batch
+type Batch struct {
+	Instance string `json:"i"`
+	// Epoch identifies the agent process, a new epoch resets the instance on the collector
+	Epoch int64 `json:"e"`
+	// Seq increases with every batch of an epoch, batches already applied are ignored
+	Seq      uint64   `json:"q"`
+	Families []Family `json:"f,omitempty"`
+	Series   []Series `json:"s,omitempty"`
+}
+
+// Ack is the reply of the collector to a Batch
+type Ack struct {
+	Accepted  int  `json:"a"`
+	Duplicate bool `json:"d,omitempty"`
+	// Resync asks the agent to send the families and series definitions again,
+	// e.g. after the collector restarted
+	Resync bool `json:"r,omitempty"`
+}
+
+// CollectorServer is the server API of the collector service
+type CollectorServer interface {
+	Push(ctx context.Context, batch *Batch) (*Ack, error)
+}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return codecName
+}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+func pushHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Batch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CollectorServer).Push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: pushFullMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CollectorServer).Push(ctx, req.(*Batch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*CollectorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Push",
+			Handler:    pushHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ginprom/agent",
+}
+
+// RegisterCollectorServer registers srv on the gRPC server s
+func RegisterCollectorServer(s *grpc.Server, srv CollectorServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// push calls the Push method of the collector service
+func push(ctx context.Context, conn *grpc.ClientConn, batch *Batch) (*Ack, error) {
+	out := new(Ack)
+	err := conn.Invoke(ctx, pushFullMethod, batch, out, grpc.CallContentSubtype(codecName))
+	return out, err
+}
@@ -0,0 +1,436 @@
+// Package aggregator merges the metrics of several instances of a service,
+// e.g. prefork or per-core processes behind one port, into a single /metrics
+package aggregator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	defaultScrapeTimeout = 5 * time.Second
+	defaultPushTTL       = 10 * time.Minute
+	maxPushBytes         = 10 << 20
+	pushPathPrefix       = "/push/"
+
+	// SourceLabel is the label added to the gauges merged with GaugePerSource
+	SourceLabel = "source"
+)
+
+// GaugeStrategy is how the gauges and untyped values of the instances are merged
+type GaugeStrategy int
+
+const (
+	// GaugeSum adds the values, e.g. for in-flight requests or open connections
+	GaugeSum GaugeStrategy = iota
+	// GaugeMax keeps the highest value, e.g. for timestamps and _info metrics
+	GaugeMax
+	// GaugeMin keeps the lowest value, e.g. for start times
+	GaugeMin
+	// GaugePerSource keeps the value of every instance, labelled by SourceLabel
+	GaugePerSource
+)
+
+// defaultGaugeStrategies are the gauges known to be meaningless once summed
+var defaultGaugeStrategies = map[string]GaugeStrategy{
+	"process_start_time_seconds":            GaugeMin,
+	"ginprom_last_scrape_timestamp_seconds": GaugeMax,
+}
+
+// Aggregator is a prometheus.Gatherer merging the metrics scraped from its targets
+// with the ones pushed by instances: counters are summed, gauges and untyped values are
+// merged according to their GaugeStrategy, histogram buckets are merged by upper bound,
+// summaries keep their sum and count only because quantiles can't be aggregated
+type Aggregator struct {
+	// GaugeStrategy applies to the gauges without an entry in GaugeStrategies,
+	// GaugeSum by default
+	GaugeStrategy GaugeStrategy
+	// GaugeStrategies overrides the strategy per metric name. Start times are merged
+	// with GaugeMin, timestamps and _info metrics with GaugeMax unless overridden
+	GaugeStrategies map[string]GaugeStrategy
+	// PushTTL is how long the metrics of an instance are kept after its last push,
+	// defaults to 10m
+	PushTTL time.Duration
+
+	targets []string
+	client  *http.Client
+
+	mu     sync.Mutex
+	pushed map[string]*push
+}
+
+type push struct {
+	mfs []*dto.MetricFamily
+	at  time.Time
+}
+
+// source holds the metrics of one instance, named by its target or push instance
+type source struct {
+	name string
+	mfs  []*dto.MetricFamily
+}
+
+// New returns an Aggregator scraping the metrics URLs in targets
+func New(targets ...string) *Aggregator {
+	return &Aggregator{
+		targets: targets,
+		client:  &http.Client{Timeout: defaultScrapeTimeout},
+		pushed:  make(map[string]*push),
+	}
+}
+
+// Handler returns a http.Handler serving the merged metrics on GET and accepting
+// pushes of an instance on PUT/POST /push/<instance>
+func (a *Aggregator) Handler() http.Handler {
+	metrics := promhttp.HandlerFor(a, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, pushPathPrefix):
+			a.servePush(w, r)
+		case r.Method == http.MethodGet:
+			metrics.ServeHTTP(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// ListenAndServe serves Handler on addr
+func (a *Aggregator) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, a.Handler())
+}
+
+func (a *Aggregator) servePush(w http.ResponseWriter, r *http.Request) {
+	instance := strings.TrimPrefix(r.URL.Path, pushPathPrefix)
+	if instance == "" {
+		http.Error(w, "missing instance", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		format := expfmt.ResponseFormat(r.Header)
+		if format.FormatType() == expfmt.TypeUnknown {
+			format = expfmt.NewFormat(expfmt.TypeTextPlain)
+		}
+		mfs, err := decode(http.MaxBytesReader(w, r.Body, maxPushBytes), format)
+		if err != nil {
+			code := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		a.Push(instance, mfs)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodDelete:
+		a.Forget(instance)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Push replaces the metrics of instance, they are dropped after PushTTL without a new push
+func (a *Aggregator) Push(instance string, mfs []*dto.MetricFamily) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pushed[instance] = &push{mfs: mfs, at: time.Now()}
+}
+
+// Forget drops the metrics pushed by instance
+func (a *Aggregator) Forget(instance string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.pushed, instance)
+}
+
+// Gather implements prometheus.Gatherer
+func (a *Aggregator) Gather() ([]*dto.MetricFamily, error) {
+	sources := make([]source, len(a.targets))
+	errs := make([]error, len(a.targets))
+
+	var wg sync.WaitGroup
+	for i, target := range a.targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			sources[i].name = target
+			sources[i].mfs, errs[i] = a.scrape(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	sources = append(sources, a.pushedSources(time.Now())...)
+
+	merged, err := merge(sources, a.gaugeStrategy)
+	return merged, errors.Join(append(errs, err)...)
+}
+
+// pushedSources returns the pushed metrics, dropping the ones older than PushTTL
+func (a *Aggregator) pushedSources(now time.Time) []source {
+	ttl := a.PushTTL
+	if ttl <= 0 {
+		ttl = defaultPushTTL
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sources := make([]source, 0, len(a.pushed))
+	for instance, p := range a.pushed {
+		if now.Sub(p.at) > ttl {
+			delete(a.pushed, instance)
+			continue
+		}
+		sources = append(sources, source{name: instance, mfs: p.mfs})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].name < sources[j].name })
+	return sources
+}
+
+// gaugeStrategy returns the strategy merging the gauge name
+func (a *Aggregator) gaugeStrategy(name string) GaugeStrategy {
+	if strategy, ok := a.GaugeStrategies[name]; ok {
+		return strategy
+	}
+	if strategy, ok := defaultGaugeStrategies[name]; ok {
+		return strategy
+	}
+	if strings.HasSuffix(name, "_info") || strings.HasSuffix(name, "_timestamp_seconds") {
+		return GaugeMax
+	}
+	return a.GaugeStrategy
+}
+
+func (a *Aggregator) scrape(target string) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeProtoDelim)))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("aggregator: scraping %s: unexpected status %s", target, resp.Status)
+	}
+	return decode(resp.Body, expfmt.ResponseFormat(resp.Header))
+}
+
+func decode(r io.Reader, format expfmt.Format) ([]*dto.MetricFamily, error) {
+	dec := expfmt.NewDecoder(r, format)
+
+	var mfs []*dto.MetricFamily
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); err != nil {
+			if errors.Is(err, io.EOF) {
+				return mfs, nil
+			}
+			return mfs, err
+		}
+		mfs = append(mfs, mf)
+	}
+}
+
+// merge combines the series sharing a name and label set across the sources
+func merge(sources []source, gaugeStrategy func(name string) GaugeStrategy) ([]*dto.MetricFamily, error) {
+	families := make(map[string]*dto.MetricFamily)
+	series := make(map[string]map[string]*dto.Metric)
+
+	var errs []error
+	for _, src := range sources {
+		for _, mf := range src.mfs {
+			name := mf.GetName()
+			family, ok := families[name]
+			if !ok {
+				family = &dto.MetricFamily{
+					Name: mf.Name,
+					Help: mf.Help,
+					Type: mf.Type,
+					Unit: mf.Unit,
+				}
+				families[name] = family
+				series[name] = make(map[string]*dto.Metric)
+			}
+			if family.GetType() != mf.GetType() {
+				errs = append(errs, fmt.Errorf("aggregator: %s has conflicting types %s and %s", name, family.GetType(), mf.GetType()))
+				continue
+			}
+
+			strategy := GaugeSum
+			if typ := family.GetType(); typ == dto.MetricType_GAUGE || typ == dto.MetricType_UNTYPED {
+				strategy = gaugeStrategy(name)
+			}
+			for _, m := range mf.GetMetric() {
+				pairs := m.GetLabel()
+				if strategy == GaugePerSource {
+					pairs = withSource(pairs, src.name)
+				}
+				key := labelsKey(pairs)
+				existing, ok := series[name][key]
+				if !ok {
+					existing = &dto.Metric{Label: pairs}
+					series[name][key] = existing
+					family.Metric = append(family.Metric, existing)
+				}
+				mergeMetric(family.GetType(), strategy, existing, m)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	merged := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		merged = append(merged, families[name])
+	}
+	return merged, errors.Join(errs...)
+}
+
+// withSource returns pairs with the source label, unless the series already has one
+func withSource(pairs []*dto.LabelPair, name string) []*dto.LabelPair {
+	for _, lp := range pairs {
+		if lp.GetName() == SourceLabel {
+			return pairs
+		}
+	}
+	out := make([]*dto.LabelPair, 0, len(pairs)+1)
+	out = append(out, pairs...)
+	return append(out, &dto.LabelPair{Name: stringPtr(SourceLabel), Value: stringPtr(name)})
+}
+
+func mergeMetric(typ dto.MetricType, strategy GaugeStrategy, dst, src *dto.Metric) {
+	switch typ {
+	case dto.MetricType_COUNTER:
+		if dst.Counter == nil {
+			dst.Counter = &dto.Counter{Value: float64Ptr(0)}
+		}
+		*dst.Counter.Value += src.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		if dst.Gauge == nil {
+			dst.Gauge = &dto.Gauge{Value: float64Ptr(src.GetGauge().GetValue())}
+			return
+		}
+		mergeGauge(strategy, dst.Gauge.Value, src.GetGauge().GetValue())
+	case dto.MetricType_UNTYPED:
+		if dst.Untyped == nil {
+			dst.Untyped = &dto.Untyped{Value: float64Ptr(src.GetUntyped().GetValue())}
+			return
+		}
+		mergeGauge(strategy, dst.Untyped.Value, src.GetUntyped().GetValue())
+	case dto.MetricType_SUMMARY:
+		if dst.Summary == nil {
+			dst.Summary = &dto.Summary{SampleCount: uint64Ptr(0), SampleSum: float64Ptr(0)}
+		}
+		*dst.Summary.SampleCount += src.GetSummary().GetSampleCount()
+		*dst.Summary.SampleSum += src.GetSummary().GetSampleSum()
+	case dto.MetricType_HISTOGRAM:
+		mergeHistogram(dst, src.GetHistogram())
+	}
+}
+
+func mergeGauge(strategy GaugeStrategy, dst *float64, value float64) {
+	switch strategy {
+	case GaugeMax:
+		*dst = math.Max(*dst, value)
+	case GaugeMin:
+		*dst = math.Min(*dst, value)
+	default:
+		*dst += value
+	}
+}
+
+// mergeHistogram adds src to dst by upper bound. When the bucket layouts differ, the
+// count of a histogram at a bound it lacks is its count at the closest lower bound,
+// which keeps the merged buckets cumulative
+func mergeHistogram(dst *dto.Metric, src *dto.Histogram) {
+	if dst.Histogram == nil {
+		dst.Histogram = &dto.Histogram{SampleCount: uint64Ptr(0), SampleSum: float64Ptr(0)}
+	}
+	h := dst.Histogram
+	*h.SampleCount += src.GetSampleCount()
+	*h.SampleSum += src.GetSampleSum()
+
+	seen := make(map[float64]bool, len(h.Bucket)+len(src.GetBucket()))
+	bounds := make([]float64, 0, len(h.Bucket)+len(src.GetBucket()))
+	for _, buckets := range [][]*dto.Bucket{h.Bucket, src.GetBucket()} {
+		for _, b := range buckets {
+			if bound := b.GetUpperBound(); !seen[bound] {
+				seen[bound] = true
+				bounds = append(bounds, bound)
+			}
+		}
+	}
+	sort.Float64s(bounds)
+
+	merged := make([]*dto.Bucket, 0, len(bounds))
+	for _, bound := range bounds {
+		merged = append(merged, &dto.Bucket{
+			UpperBound:      float64Ptr(bound),
+			CumulativeCount: uint64Ptr(countAt(h.Bucket, bound) + countAt(src.GetBucket(), bound)),
+		})
+	}
+	h.Bucket = merged
+}
+
+// countAt returns the cumulative count of the sorted buckets at bound
+func countAt(buckets []*dto.Bucket, bound float64) uint64 {
+	var count uint64
+	for _, b := range buckets {
+		if b.GetUpperBound() > bound {
+			break
+		}
+		count = b.GetCumulativeCount()
+	}
+	return count
+}
+
+func labelsKey(pairs []*dto.LabelPair) string {
+	parts := make([]string, 0, len(pairs))
+	for _, lp := range pairs {
+		parts = append(parts, lp.GetName()+"\x00"+lp.GetValue())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\x01")
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func uint64Ptr(u uint64) *uint64 {
+	return &u
+}
+
+var _ prometheus.Gatherer = (*Aggregator)(nil)
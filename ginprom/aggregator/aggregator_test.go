@@ -0,0 +1,244 @@
+package aggregator
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func histogram(count uint64, buckets map[float64]uint64) *dto.Histogram {
+	h := &dto.Histogram{SampleCount: uint64Ptr(count), SampleSum: float64Ptr(1)}
+	var bounds []float64
+	for bound := range buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+	for _, bound := range bounds {
+		h.Bucket = append(h.Bucket, &dto.Bucket{UpperBound: float64Ptr(bound), CumulativeCount: uint64Ptr(buckets[bound])})
+	}
+	return h
+}
+
+func TestMergeHistogram(t *testing.T) {
+	tests := []struct {
+		name string
+		srcs []*dto.Histogram
+		want map[float64]uint64
+	}{
+		{
+			name: "same layout",
+			srcs: []*dto.Histogram{
+				histogram(3, map[float64]uint64{0.1: 1, 1: 3}),
+				histogram(2, map[float64]uint64{0.1: 2, 1: 2}),
+			},
+			want: map[float64]uint64{0.1: 3, 1: 5},
+		},
+		{
+			name: "different layouts carry the counts forward",
+			srcs: []*dto.Histogram{
+				histogram(4, map[float64]uint64{0.1: 1, 1: 4}),
+				histogram(5, map[float64]uint64{0.5: 5}),
+			},
+			want: map[float64]uint64{0.1: 1, 0.5: 6, 1: 9},
+		},
+		{
+			name: "bounds below the first bucket count nothing",
+			srcs: []*dto.Histogram{
+				histogram(2, map[float64]uint64{1: 2}),
+				histogram(1, map[float64]uint64{0.01: 1, 10: 1}),
+			},
+			want: map[float64]uint64{0.01: 1, 1: 3, 10: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := &dto.Metric{}
+			var count uint64
+			for _, src := range tt.srcs {
+				mergeHistogram(dst, src)
+				count += src.GetSampleCount()
+			}
+
+			h := dst.GetHistogram()
+			if h.GetSampleCount() != count {
+				t.Errorf("got sample count %d, want %d", h.GetSampleCount(), count)
+			}
+			if len(h.GetBucket()) != len(tt.want) {
+				t.Fatalf("got %d buckets, want %d", len(h.GetBucket()), len(tt.want))
+			}
+			var previous uint64
+			for _, b := range h.GetBucket() {
+				if got, want := b.GetCumulativeCount(), tt.want[b.GetUpperBound()]; got != want {
+					t.Errorf("bucket %v = %d, want %d", b.GetUpperBound(), got, want)
+				}
+				if b.GetCumulativeCount() < previous {
+					t.Errorf("bucket %v isn't cumulative", b.GetUpperBound())
+				}
+				previous = b.GetCumulativeCount()
+			}
+		})
+	}
+}
+
+func gaugeFamily(name string, value float64) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name:   stringPtr(name),
+		Help:   stringPtr("help"),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: float64Ptr(value)}}},
+	}
+}
+
+func TestGaugeStrategies(t *testing.T) {
+	tests := []struct {
+		name       string
+		metric     string
+		strategies map[string]GaugeStrategy
+		want       map[string]float64
+	}{
+		{
+			name:   "sum by default",
+			metric: "in_flight",
+			want:   map[string]float64{"": 5},
+		},
+		{
+			name:   "start times keep the lowest value",
+			metric: "process_start_time_seconds",
+			want:   map[string]float64{"": 2},
+		},
+		{
+			name:   "info metrics keep the highest value",
+			metric: "go_info",
+			want:   map[string]float64{"": 3},
+		},
+		{
+			name:       "per source",
+			metric:     "in_flight",
+			strategies: map[string]GaugeStrategy{"in_flight": GaugePerSource},
+			want:       map[string]float64{"a": 2, "b": 3},
+		},
+		{
+			name:       "overrides win over the defaults",
+			metric:     "process_start_time_seconds",
+			strategies: map[string]GaugeStrategy{"process_start_time_seconds": GaugeMax},
+			want:       map[string]float64{"": 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New()
+			a.GaugeStrategies = tt.strategies
+			sources := []source{
+				{name: "a", mfs: []*dto.MetricFamily{gaugeFamily(tt.metric, 2)}},
+				{name: "b", mfs: []*dto.MetricFamily{gaugeFamily(tt.metric, 3)}},
+			}
+
+			merged, err := merge(sources, a.gaugeStrategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]float64)
+			for _, m := range merged[0].GetMetric() {
+				var src string
+				for _, lp := range m.GetLabel() {
+					if lp.GetName() == SourceLabel {
+						src = lp.GetValue()
+					}
+				}
+				got[src] = m.GetGauge().GetValue()
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for src, want := range tt.want {
+				if got[src] != want {
+					t.Errorf("source %q = %v, want %v", src, got[src], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPushTTL(t *testing.T) {
+	a := New()
+	a.PushTTL = time.Minute
+	a.Push("a", []*dto.MetricFamily{gaugeFamily("in_flight", 1)})
+
+	if got := len(a.pushedSources(time.Now())); got != 1 {
+		t.Fatalf("got %d sources, want 1", got)
+	}
+	if got := len(a.pushedSources(time.Now().Add(2 * time.Minute))); got != 0 {
+		t.Fatalf("got %d sources after the TTL, want 0", got)
+	}
+	if len(a.pushed) != 0 {
+		t.Error("expired push isn't dropped")
+	}
+}
+
+func TestServePush(t *testing.T) {
+	var body bytes.Buffer
+	enc := expfmt.NewEncoder(&body, expfmt.NewFormat(expfmt.TypeTextPlain))
+	if err := enc.Encode(gaugeFamily("in_flight", 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "push", method: http.MethodPut, path: "/push/a", body: body.String(), want: http.StatusAccepted},
+		{name: "missing instance", method: http.MethodPut, path: "/push/", body: body.String(), want: http.StatusBadRequest},
+		{name: "invalid body", method: http.MethodPost, path: "/push/a", body: "in_flight{", want: http.StatusBadRequest},
+		{name: "too large", method: http.MethodPut, path: "/push/a", body: "# " + strings.Repeat("x", maxPushBytes), want: http.StatusRequestEntityTooLarge},
+		{name: "forget", method: http.MethodDelete, path: "/push/a", want: http.StatusAccepted},
+		{name: "method", method: http.MethodPatch, path: "/push/a", want: http.StatusMethodNotAllowed},
+	}
+
+	a := New()
+	handler := a.Handler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatherTargets(t *testing.T) {
+	var servers []string
+	for _, value := range []float64{1, 2} {
+		reg := prometheus.NewRegistry()
+		c := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."})
+		c.Add(value)
+		reg.MustRegister(c)
+
+		srv := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		defer srv.Close()
+		servers = append(servers, srv.URL)
+	}
+
+	mfs, err := New(servers...).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetMetric()[0].GetCounter().GetValue() != 3 {
+		t.Errorf("got %v, want requests_total 3", mfs)
+	}
+}
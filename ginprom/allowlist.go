@@ -0,0 +1,127 @@
+package ginprom
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IPAllowlist restricts the scrapes of the metrics to the scrapers of some networks, so
+// the metrics served on the port of the API can't be scraped from the internet
+type IPAllowlist struct {
+	// Networks are the CIDR networks, or the IPs, of the allowed scrapers, like PrivateNetworks
+	Networks []string
+	// TrustedProxies are the CIDR networks, or the IPs, of the proxies in front of the
+	// service. The scraper of a request from one of them is the last address of its
+	// X-Forwarded-For which isn't a trusted proxy, the header being ignored otherwise
+	TrustedProxies []string
+}
+
+// IPAllowlistMiddleware returns a middleware answering 403 to the requests from outside
+// allowlist, to be used before PromHandler, it panics when allowlist is invalid, see
+// NewIPAllowlistMiddleware
+func IPAllowlistMiddleware(allowlist IPAllowlist) gin.HandlerFunc {
+	h, err := NewIPAllowlistMiddleware(allowlist)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// NewIPAllowlistMiddleware is like IPAllowlistMiddleware but returns an error when allowlist
+// has no network or an invalid one
+func NewIPAllowlistMiddleware(allowlist IPAllowlist) (gin.HandlerFunc, error) {
+	if len(allowlist.Networks) == 0 {
+		return nil, errors.New("ginprom: the IP allowlist needs a network")
+	}
+	allowed, err := parseNetworks("allowed network", allowlist.Networks)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := parseNetworks("trusted proxy", allowlist.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		addr, ok := scraperAddr(c.Request, trusted)
+		if !ok || !containsAddr(allowed, addr) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// parseNetworks parses the CIDR networks or IPs of cidrs, the errors naming what they are
+func parseNetworks(what string, cidrs []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("ginprom: invalid %s: %w", what, err)
+			}
+			addr = addr.Unmap()
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("ginprom: invalid %s: %w", what, err)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// containsAddr reports whether addr is in one of networks
+func containsAddr(networks []netip.Prefix, addr netip.Addr) bool {
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// scraperAddr returns the address of the client of r, taken from X-Forwarded-For when r
+// comes from a trusted proxy, false when it isn't valid
+func scraperAddr(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !containsAddr(trusted, addr) {
+		return addr, true
+	}
+	// the proxies append the address they got the request from, the last untrusted
+	// one being the client, as the earlier ones can be forged
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		value := strings.TrimSpace(forwarded[i])
+		if value == "" {
+			continue
+		}
+		hop, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = hop.Unmap()
+		if !containsAddr(trusted, addr) {
+			return addr, true
+		}
+	}
+	// only trusted proxies, the first one being the client
+	return addr, true
+}
@@ -0,0 +1,73 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIPAllowlistMiddleware(t *testing.T) {
+	allowlist := IPAllowlist{
+		Networks:       []string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.7"},
+		TrustedProxies: []string{"172.16.0.0/12"},
+	}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantStatus   int
+	}{
+		{"allowed", "10.1.2.3:4567", nil, http.StatusOK},
+		{"allowed ip", "192.0.2.7:4567", nil, http.StatusOK},
+		{"ipv6", "[2001:db8::1]:4567", nil, http.StatusOK},
+		{"ipv4 mapped", "[::ffff:10.0.0.1]:4567", nil, http.StatusOK},
+		{"forbidden", "8.8.8.8:4567", nil, http.StatusForbidden},
+		{"forwarded by an untrusted client", "8.8.8.8:4567", []string{"10.0.0.1"}, http.StatusForbidden},
+		{"forwarded by a trusted proxy", "172.16.0.2:4567", []string{"10.0.0.1"}, http.StatusOK},
+		{"forwarded from outside", "172.16.0.2:4567", []string{"8.8.8.8"}, http.StatusForbidden},
+		{"forged first hop", "172.16.0.2:4567", []string{"10.0.0.1, 8.8.8.8"}, http.StatusForbidden},
+		{"proxy chain", "172.16.0.2:4567", []string{"10.0.0.1", "172.17.0.5"}, http.StatusOK},
+		{"invalid hop", "172.16.0.2:4567", []string{"10.0.0.1, unknown"}, http.StatusForbidden},
+		{"trusted proxy only", "172.16.0.2:4567", nil, http.StatusForbidden},
+		{"invalid remote address", "somewhere", nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/metrics", IPAllowlistMiddleware(allowlist), func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNewIPAllowlistMiddlewareInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist IPAllowlist
+	}{
+		{"no network", IPAllowlist{TrustedProxies: []string{"10.0.0.0/8"}}},
+		{"invalid network", IPAllowlist{Networks: []string{"10.0.0.0/33"}}},
+		{"invalid ip", IPAllowlist{Networks: []string{"internal"}}},
+		{"invalid trusted proxy", IPAllowlist{Networks: PrivateNetworks, TrustedProxies: []string{"lb"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if h, err := NewIPAllowlistMiddleware(tt.allowlist); err == nil || h != nil {
+				t.Errorf("got %v, want an error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package ginprom
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	AnomalySignalLatency   = "latency"
+	AnomalySignalErrorRate = "error_rate"
+
+	// minimal deviations used as the stddev floor, so a perfectly flat
+	// baseline doesn't turn the smallest change into an infinite score
+	minLatencyDeviation   = 0.001
+	minErrorRateDeviation = 0.01
+)
+
+// Anomaly describes a signal deviating from its EWMA baseline
+type Anomaly struct {
+	Endpoint string
+	Signal   string
+	Value    float64
+	Baseline float64
+	Score    float64
+}
+
+// AnomalyCallback is invoked when the score of a signal exceeds the threshold
+type AnomalyCallback func(a Anomaly)
+
+// AnomalyOpts represents the options of AnomalyDetector
+type AnomalyOpts struct {
+	// Alpha is the EWMA smoothing factor in (0, 1]
+	Alpha float64
+	// Threshold is the score (deviation in stddev) above which callbacks fire
+	Threshold float64
+	// Interval is the length of one evaluation window
+	Interval time.Duration
+	// WarmupIntervals is the number of windows needed before an endpoint is scored
+	WarmupIntervals int
+	// MaxIdleIntervals is the number of windows without traffic after which
+	// the baseline of an endpoint is forgotten
+	MaxIdleIntervals int
+}
+
+func NewDefaultAnomalyOpts() *AnomalyOpts {
+	return &AnomalyOpts{
+		Alpha:            0.3,
+		Threshold:        3,
+		Interval:         time.Minute,
+		WarmupIntervals:  5,
+		MaxIdleIntervals: 60,
+	}
+}
+
+type ewma struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// update folds x into the baseline
+func (e *ewma) update(x, alpha float64) {
+	if e.samples == 0 {
+		e.mean = x
+		e.samples++
+		return
+	}
+	diff := x - e.mean
+	e.mean += alpha * diff
+	e.variance = (1 - alpha) * (e.variance + alpha*diff*diff)
+	e.samples++
+}
+
+// score returns the deviation of x from the baseline in stddev
+func (e *ewma) score(x, minDeviation float64) float64 {
+	return math.Abs(x-e.mean) / math.Max(math.Sqrt(e.variance), minDeviation)
+}
+
+type endpointWindow struct {
+	count    float64
+	errors   float64
+	duration float64
+}
+
+type endpointBaseline struct {
+	latency   ewma
+	errorRate ewma
+	// idle is the number of consecutive windows without traffic
+	idle int
+}
+
+// AnomalyDetector is an Observer and Collector maintaining EWMA baselines of
+// per-endpoint latency and error rate, and exporting how far the last window deviates from them
+type AnomalyDetector struct {
+	opts *AnomalyOpts
+
+	mu        sync.Mutex
+	window    map[string]*endpointWindow
+	baselines map[string]*endpointBaseline
+	callbacks []AnomalyCallback
+
+	score *prometheus.GaugeVec
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewAnomalyDetector returns a started AnomalyDetector, it still needs to be registered
+func NewAnomalyDetector(anomalyOpts *AnomalyOpts) *AnomalyDetector {
+	defaults := NewDefaultAnomalyOpts()
+	if anomalyOpts == nil {
+		anomalyOpts = defaults
+	}
+	opts := *anomalyOpts
+	if opts.Alpha <= 0 || opts.Alpha > 1 {
+		opts.Alpha = defaults.Alpha
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = defaults.Threshold
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaults.Interval
+	}
+	if opts.WarmupIntervals < 0 {
+		opts.WarmupIntervals = defaults.WarmupIntervals
+	}
+	if opts.MaxIdleIntervals <= 0 {
+		opts.MaxIdleIntervals = defaults.MaxIdleIntervals
+	}
+
+	d := &AnomalyDetector{
+		opts:      &opts,
+		window:    make(map[string]*endpointWindow),
+		baselines: make(map[string]*endpointBaseline),
+		score: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "anomaly_score",
+			Help:      "Deviation of the last window from the EWMA baseline in standard deviations",
+		}, []string{"endpoint", "signal"}),
+		stop: make(chan struct{}),
+	}
+
+	go d.run()
+	return d
+}
+
+// Describe implements prometheus.Collector
+func (d *AnomalyDetector) Describe(ch chan<- *prometheus.Desc) {
+	d.score.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (d *AnomalyDetector) Collect(ch chan<- prometheus.Metric) {
+	d.score.Collect(ch)
+}
+
+// OnAnomaly registers a callback fired when a score exceeds the threshold
+func (d *AnomalyDetector) OnAnomaly(fn AnomalyCallback) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.callbacks = append(d.callbacks, fn)
+}
+
+// Observe implements Observer
+func (d *AnomalyDetector) Observe(o Observation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, ok := d.window[o.Endpoint]
+	if !ok {
+		w = &endpointWindow{}
+		d.window[o.Endpoint] = w
+	}
+	w.count++
+	w.duration += o.Duration.Seconds()
+	if o.StatusCode >= 500 {
+		w.errors++
+	}
+}
+
+// Stop stops evaluating windows
+func (d *AnomalyDetector) Stop() {
+	d.once.Do(func() { close(d.stop) })
+}
+
+func (d *AnomalyDetector) run() {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.evaluate()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// evaluate scores the finished window against the baselines and then updates them,
+// endpoints without traffic in the window lose their score
+func (d *AnomalyDetector) evaluate() {
+	d.mu.Lock()
+	window := d.window
+	d.window = make(map[string]*endpointWindow, len(window))
+	callbacks := d.callbacks
+
+	for endpoint, b := range d.baselines {
+		if _, ok := window[endpoint]; ok {
+			continue
+		}
+		d.score.DeletePartialMatch(prometheus.Labels{"endpoint": endpoint})
+		if b.idle++; b.idle >= d.opts.MaxIdleIntervals {
+			delete(d.baselines, endpoint)
+		}
+	}
+
+	var anomalies []Anomaly
+	for endpoint, w := range window {
+		b, ok := d.baselines[endpoint]
+		if !ok {
+			b = &endpointBaseline{}
+			d.baselines[endpoint] = b
+		}
+		b.idle = 0
+
+		signals := []struct {
+			name         string
+			value        float64
+			baseline     *ewma
+			minDeviation float64
+		}{
+			{AnomalySignalLatency, w.duration / w.count, &b.latency, minLatencyDeviation},
+			{AnomalySignalErrorRate, w.errors / w.count, &b.errorRate, minErrorRateDeviation},
+		}
+		for _, s := range signals {
+			if s.baseline.samples >= d.opts.WarmupIntervals && s.baseline.samples > 0 {
+				score := s.baseline.score(s.value, s.minDeviation)
+				d.score.WithLabelValues(endpoint, s.name).Set(score)
+				if score > d.opts.Threshold {
+					anomalies = append(anomalies, Anomaly{
+						Endpoint: endpoint,
+						Signal:   s.name,
+						Value:    s.value,
+						Baseline: s.baseline.mean,
+						Score:    score,
+					})
+				}
+			}
+			s.baseline.update(s.value, d.opts.Alpha)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, a := range anomalies {
+		for _, fn := range callbacks {
+			fn(a)
+		}
+	}
+}
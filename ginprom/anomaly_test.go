@@ -0,0 +1,101 @@
+package ginprom
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEWMA(t *testing.T) {
+	tests := []struct {
+		name         string
+		samples      []float64
+		alpha        float64
+		wantMean     float64
+		wantVariance float64
+	}{
+		{"first sample sets the mean", []float64{4}, 0.5, 4, 0},
+		{"flat baseline", []float64{2, 2, 2}, 0.3, 2, 0},
+		{"step", []float64{0, 2}, 0.5, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e ewma
+			for _, x := range tt.samples {
+				e.update(x, tt.alpha)
+			}
+			if math.Abs(e.mean-tt.wantMean) > 1e-9 || math.Abs(e.variance-tt.wantVariance) > 1e-9 {
+				t.Errorf("got mean %v variance %v, want %v %v", e.mean, e.variance, tt.wantMean, tt.wantVariance)
+			}
+			if e.samples != len(tt.samples) {
+				t.Errorf("got %d samples, want %d", e.samples, len(tt.samples))
+			}
+		})
+	}
+}
+
+func TestEWMAScore(t *testing.T) {
+	tests := []struct {
+		name         string
+		e            ewma
+		x            float64
+		minDeviation float64
+		want         float64
+	}{
+		{"deviation in stddev", ewma{mean: 1, variance: 4}, 5, 0.01, 2},
+		{"flat baseline uses the floor", ewma{mean: 0}, 0.05, 0.01, 5},
+		{"no deviation", ewma{mean: 3, variance: 1}, 3, 0.01, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.e.score(tt.x, tt.minDeviation); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnomalyDetectorEvaluate(t *testing.T) {
+	opts := &AnomalyOpts{Threshold: 3, Interval: time.Hour, WarmupIntervals: 2, MaxIdleIntervals: 2}
+	d := NewAnomalyDetector(opts)
+	defer d.Stop()
+
+	if opts.Alpha != 0 {
+		t.Fatal("NewAnomalyDetector modified the caller's options")
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(d)
+
+	var fired []Anomaly
+	d.OnAnomaly(func(a Anomaly) { fired = append(fired, a) })
+
+	for i := 0; i < 3; i++ {
+		d.Observe(Observation{Endpoint: "/a", StatusCode: 200, Duration: 10 * time.Millisecond})
+		d.evaluate()
+	}
+	d.Observe(Observation{Endpoint: "/a", StatusCode: 500, Duration: time.Second})
+	d.evaluate()
+
+	if len(fired) != 2 {
+		t.Fatalf("got %d anomalies, want latency and error rate: %v", len(fired), fired)
+	}
+	if got := testutil.ToFloat64(d.score.WithLabelValues("/a", AnomalySignalLatency)); got <= 3 {
+		t.Errorf("latency score = %v, want > 3", got)
+	}
+
+	// a quiet window drops the score, idle windows drop the baseline
+	d.evaluate()
+	if n := testutil.CollectAndCount(d); n != 0 {
+		t.Errorf("got %d scores after a quiet window, want 0", n)
+	}
+	d.evaluate()
+	if len(d.baselines) != 0 {
+		t.Errorf("got %d baselines after idle windows, want 0", len(d.baselines))
+	}
+}
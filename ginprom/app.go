@@ -0,0 +1,125 @@
+package ginprom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// NewCounter registers an application counter next to the metrics of the default
+// middleware, see PromOpts.NewCounter
+func NewCounter(name, help string, labels ...string) (*prometheus.CounterVec, error) {
+	return NewDefaultOpts().NewCounter(name, help, labels...)
+}
+
+// NewGauge registers an application gauge next to the metrics of the default
+// middleware, see PromOpts.NewGauge
+func NewGauge(name, help string, labels ...string) (*prometheus.GaugeVec, error) {
+	return NewDefaultOpts().NewGauge(name, help, labels...)
+}
+
+// NewHistogram registers an application histogram next to the metrics of the default
+// middleware, see PromOpts.NewHistogram
+func NewHistogram(name, help string, buckets []float64, labels ...string) (*prometheus.HistogramVec, error) {
+	return NewDefaultOpts().NewHistogram(name, help, buckets, labels...)
+}
+
+// NewCounter registers an application counter with the namespace and constant labels
+// of the middleware, name must end with _total. A counter already registered with the
+// same name, help and labels is returned instead
+func (po *PromOpts) NewCounter(name, help string, labels ...string) (*prometheus.CounterVec, error) {
+	if !strings.HasSuffix(name, "_total") {
+		return nil, fmt.Errorf("ginprom: counter %q must end with _total", name)
+	}
+	if err := po.checkAppMetric(name, help, labels, nil); err != nil {
+		return nil, err
+	}
+
+	r := po.registration()
+	c := registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   po.namespace(),
+		Subsystem:   po.Subsystem,
+		ConstLabels: po.constLabels(),
+		Name:        name,
+		Help:        help,
+	}, labels))
+	return c, r.finish()
+}
+
+// NewGauge registers an application gauge with the namespace and constant labels
+// of the middleware. A gauge already registered with the same name, help and labels
+// is returned instead
+func (po *PromOpts) NewGauge(name, help string, labels ...string) (*prometheus.GaugeVec, error) {
+	if err := po.checkAppMetric(name, help, labels, []string{"_total"}); err != nil {
+		return nil, err
+	}
+
+	r := po.registration()
+	g := registerOrReuse(r, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   po.namespace(),
+		Subsystem:   po.Subsystem,
+		ConstLabels: po.constLabels(),
+		Name:        name,
+		Help:        help,
+	}, labels))
+	return g, r.finish()
+}
+
+// NewHistogram registers an application histogram with the namespace and constant labels
+// of the middleware, buckets default to prometheus.DefBuckets. A histogram already
+// registered with the same name, help, labels and buckets is returned instead
+func (po *PromOpts) NewHistogram(name, help string, buckets []float64, labels ...string) (*prometheus.HistogramVec, error) {
+	if err := po.checkAppMetric(name, help, labels, []string{"_total", "_bucket", "_count", "_sum"}); err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		if label == "le" {
+			return nil, fmt.Errorf("ginprom: histogram %q can't have the label le", name)
+		}
+	}
+
+	r := po.registration()
+	h := registerOrReuse(r, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   po.namespace(),
+		Subsystem:   po.Subsystem,
+		ConstLabels: po.constLabels(),
+		Name:        name,
+		Help:        help,
+		Buckets:     buckets,
+	}, labels))
+	return h, r.finish()
+}
+
+// checkAppMetric validates the name, help and labels of an application metric,
+// name must not end with one of the reserved suffixes
+func (po *PromOpts) checkAppMetric(name, help string, labels, reservedSuffixes []string) error {
+	if !model.IsValidLegacyMetricName(name) {
+		return fmt.Errorf("ginprom: invalid metric name %q", name)
+	}
+	for _, suffix := range reservedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return fmt.Errorf("ginprom: metric %q must not end with %s", name, suffix)
+		}
+	}
+	if help == "" {
+		return errors.New("ginprom: help of metric " + name + " is required")
+	}
+
+	constLabels := po.constLabels()
+	seen := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		switch {
+		case !model.LabelName(label).IsValidLegacy() || strings.HasPrefix(label, "__"):
+			return fmt.Errorf("ginprom: metric %q has an invalid label %q", name, label)
+		case seen[label]:
+			return fmt.Errorf("ginprom: metric %q has the label %q twice", name, label)
+		case constLabels[label] != "":
+			return fmt.Errorf("ginprom: label %q of metric %q is already a constant label", label, name)
+		}
+		seen[label] = true
+	}
+	return nil
+}
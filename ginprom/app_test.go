@@ -0,0 +1,150 @@
+package ginprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAppMetricValidation(t *testing.T) {
+	opts := &PromOpts{ConstLabels: prometheus.Labels{"team": "checkout"}}
+
+	tests := []struct {
+		name    string
+		create  func() error
+		wantErr string
+	}{
+		{
+			name: "counter without _total",
+			create: func() error {
+				_, err := opts.NewCounter("orders_created", "Orders.")
+				return err
+			},
+			wantErr: "must end with _total",
+		},
+		{
+			name: "gauge with _total",
+			create: func() error {
+				_, err := opts.NewGauge("queue_total", "Queue.")
+				return err
+			},
+			wantErr: "must not end with _total",
+		},
+		{
+			name: "histogram with _count",
+			create: func() error {
+				_, err := opts.NewHistogram("payment_count", "Payments.", nil)
+				return err
+			},
+			wantErr: "must not end with _count",
+		},
+		{
+			name: "histogram with le",
+			create: func() error {
+				_, err := opts.NewHistogram("payment_seconds", "Payments.", nil, "le")
+				return err
+			},
+			wantErr: "can't have the label le",
+		},
+		{
+			name: "invalid name",
+			create: func() error {
+				_, err := opts.NewGauge("queue-size", "Queue.")
+				return err
+			},
+			wantErr: "invalid metric name",
+		},
+		{
+			name: "missing help",
+			create: func() error {
+				_, err := opts.NewGauge("queue_size", "")
+				return err
+			},
+			wantErr: "help",
+		},
+		{
+			name: "reserved label",
+			create: func() error {
+				_, err := opts.NewGauge("queue_size", "Queue.", "__name")
+				return err
+			},
+			wantErr: "invalid label",
+		},
+		{
+			name: "duplicate label",
+			create: func() error {
+				_, err := opts.NewGauge("queue_size", "Queue.", "queue", "queue")
+				return err
+			},
+			wantErr: "twice",
+		},
+		{
+			name: "constant label",
+			create: func() error {
+				_, err := opts.NewGauge("queue_size", "Queue.", "team")
+				return err
+			},
+			wantErr: "constant label",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.create()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAppMetrics(t *testing.T) {
+	opts := &PromOpts{ConstLabels: prometheus.Labels{"team": "checkout"}}
+
+	orders, err := opts.NewCounter("test_app_orders_created_total", "Orders created.", "channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := opts.NewCounter("test_app_orders_created_total", "Orders created.", "channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != orders {
+		t.Error("the registered counter isn't reused")
+	}
+	if _, err := opts.NewCounter("test_app_orders_created_total", "Other help.", "channel"); err == nil {
+		t.Error("got no error for a conflicting counter")
+	}
+
+	before := testutil.ToFloat64(orders.WithLabelValues("web"))
+	orders.WithLabelValues("web").Inc()
+	if got := testutil.ToFloat64(orders.WithLabelValues("web")) - before; got != 1 {
+		t.Errorf("got %v, want 1", got)
+	}
+
+	queue, err := NewGauge("test_app_queue_size", "Queued jobs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.WithLabelValues().Set(3)
+
+	latency, err := NewHistogram("test_app_payment_seconds", "Payment latency.", []float64{0.1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latency.WithLabelValues().Observe(0.5)
+
+	expected := `
+# HELP service_test_app_queue_size Queued jobs.
+# TYPE service_test_app_queue_size gauge
+service_test_app_queue_size 3
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(expected), "service_test_app_queue_size"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(latency); got != 1 {
+		t.Errorf("got %d histograms, want 1", got)
+	}
+}
@@ -0,0 +1,94 @@
+package ginprom
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// asyncObservation is a request handed to the recording worker
+type asyncObservation struct {
+	m                           *metrics
+	status                      int
+	endpoint, method            string
+	extra                       []string
+	duration, reqSize, respSize float64
+	traceID                     string
+	// countOnly counts the request without observing it
+	countOnly bool
+}
+
+// asyncRecorder records the observations of the requests on a worker goroutine,
+// dropping the ones arriving while its buffer is full
+type asyncRecorder struct {
+	queue   chan asyncObservation
+	dropped prometheus.Counter
+
+	// mu orders the enqueues before the worker stops, stopped is then set
+	// and the observations are recorded directly
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// registerDroppedObservations registers the http_dropped_observations_total counter of promOpts with r
+func registerDroppedObservations(r *registration, promOpts *PromOpts) prometheus.Counter {
+	return registerOrReuse(r, prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   promOpts.namespace(),
+		Subsystem:   promOpts.Subsystem,
+		ConstLabels: promOpts.constLabels(),
+		Name:        "http_dropped_observations_total",
+		Help:        promOpts.help(MetricDroppedObservations, "Total number of http requests not recorded as the recording buffer was full."),
+	}))
+}
+
+// newAsyncRecorder returns a started recorder buffering size observations, stopped by Close
+func newAsyncRecorder(size int, dropped prometheus.Counter) *asyncRecorder {
+	a := &asyncRecorder{queue: make(chan asyncObservation, size), dropped: dropped}
+	goBackground(a.run)
+	return a
+}
+
+// enqueue hands o to the worker, it returns false once the worker stopped
+func (a *asyncRecorder) enqueue(o asyncObservation) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.stopped {
+		return false
+	}
+	select {
+	case a.queue <- o:
+	default:
+		a.dropped.Inc()
+	}
+	return true
+}
+
+// run records the observations until stop, then the ones left in the buffer
+func (a *asyncRecorder) run(stop <-chan struct{}) {
+	for {
+		select {
+		case o := <-a.queue:
+			o.record()
+		case <-stop:
+			a.mu.Lock()
+			a.stopped = true
+			a.mu.Unlock()
+			for {
+				select {
+				case o := <-a.queue:
+					o.record()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (o *asyncObservation) record() {
+	if o.countOnly {
+		o.m.countNow(o.status, o.endpoint, o.method, o.extra)
+		return
+	}
+	o.m.observeNow(o.status, o.endpoint, o.method, o.extra, o.duration, o.reqSize, o.respSize, o.traceID)
+}
@@ -0,0 +1,102 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPromOptsAsyncBuffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     func(opts *PromOpts)
+		path     string
+		extra    []string
+		requests int
+	}{
+		{"requests", func(opts *PromOpts) {}, "/users", nil, 100},
+		{"extra labels", func(opts *PromOpts) {
+			opts.ExtraLabels = map[string]RequestLabelMappingFn{"tenant": func(c *gin.Context) string { return c.Query("tenant") }}
+		}, "/users?tenant=acme", []string{"acme"}, 100},
+		{"sampled", func(opts *PromOpts) { opts.SampleRates = map[string]int{"/users": 1000} }, "/users", nil, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.AsyncBuffer = 1024
+			tt.opts(opts)
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			for i := 0; i < tt.requests; i++ {
+				serve(r, http.MethodGet, tt.path)
+			}
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count := m.reqCount.WithLabelValues(append([]string{"200", "/users", http.MethodGet}, tt.extra...)...)
+			waitFor(t, func() bool { return testutil.ToFloat64(count) == float64(tt.requests) })
+		})
+	}
+}
+
+func TestAsyncRecorder(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int
+		stopped     bool
+		enqueue     int
+		wantQueued  bool
+		wantDropped float64
+	}{
+		{"buffered", 4, false, 4, true, 0},
+		{"full", 2, false, 5, true, 3},
+		{"stopped", 2, true, 1, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dropped := prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped_total", Help: "Dropped."})
+			// no worker consumes the buffer
+			a := &asyncRecorder{queue: make(chan asyncObservation, tt.size), dropped: dropped, stopped: tt.stopped}
+			for i := 0; i < tt.enqueue; i++ {
+				if got := a.enqueue(asyncObservation{}); got != tt.wantQueued {
+					t.Errorf("got enqueued %v, want %v", got, tt.wantQueued)
+				}
+			}
+			if got := testutil.ToFloat64(dropped); got != tt.wantDropped {
+				t.Errorf("got %v dropped, want %v", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestAsyncRecorderClose(t *testing.T) {
+	opts := NewDefaultOpts()
+	opts.Registerer = prometheus.NewRegistry()
+	opts.AsyncBuffer = 1024
+	m, err := newMetrics(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		m.observe(http.StatusOK, "/closed", http.MethodGet, nil, 0.1, 10, 20, "")
+	}
+	Close()
+
+	count := m.reqCount.WithLabelValues("200", "/closed", http.MethodGet)
+	if got := testutil.ToFloat64(count); got != 100 {
+		t.Errorf("got %v requests once closed, want the buffered ones", got)
+	}
+	m.observe(http.StatusOK, "/closed", http.MethodGet, nil, 0.1, 10, 20, "")
+	if got := testutil.ToFloat64(count); got != 101 {
+		t.Errorf("got %v requests, want the later one recorded directly", got)
+	}
+}
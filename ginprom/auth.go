@@ -0,0 +1,104 @@
+package ginprom
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandlerAuth authenticates the scrapes of PromHandlerWithAuth, with basic auth when
+// Username is set and with a bearer token when VerifyToken is, a scrape passing either
+// is served
+type HandlerAuth struct {
+	Username string
+	Password string
+	// VerifyToken reports whether the bearer token of a scrape is valid
+	VerifyToken func(token string) bool
+}
+
+// PromHandlerWithAuth is like PromHandler but answers 401 to the scrapes auth rejects,
+// so the metrics can be served on the port of the API, it panics when auth is empty or
+// its metrics conflict with registered ones, see NewPromHandlerWithAuth
+func PromHandlerWithAuth(handler http.Handler, auth HandlerAuth) gin.HandlerFunc {
+	h, err := NewPromHandlerWithAuth(handler, auth)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// NewPromHandlerWithAuth is like PromHandlerWithAuth but returns an error when auth is
+// empty or its metrics conflict with the collectors registered on the default registerer
+func NewPromHandlerWithAuth(handler http.Handler, auth HandlerAuth) (gin.HandlerFunc, error) {
+	if err := auth.validate(); err != nil {
+		return nil, err
+	}
+	h, err := NewPromHandler(handler)
+	if err != nil {
+		return nil, err
+	}
+	return auth.protect(h), nil
+}
+
+// protect returns h answering 401 to the scrapes auth rejects
+func (auth *HandlerAuth) protect(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.authenticate(c.Request) {
+			auth.reject(c, "metrics")
+			return
+		}
+		h(c)
+	}
+}
+
+// reject answers 401 to c, challenging the client for the credentials of realm
+func (auth *HandlerAuth) reject(c *gin.Context, realm string) {
+	if auth.Username != "" {
+		c.Header("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+	} else {
+		c.Header("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+	}
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+// validate returns an error when auth authenticates no one
+func (auth *HandlerAuth) validate() error {
+	if auth.Username == "" && auth.VerifyToken == nil {
+		return errors.New("ginprom: the handler auth needs a username or a token verification")
+	}
+	return nil
+}
+
+// authenticate reports whether r passes auth
+func (auth *HandlerAuth) authenticate(r *http.Request) bool {
+	if auth.Username != "" {
+		if username, password, ok := r.BasicAuth(); ok &&
+			equalSecrets(username, auth.Username) && equalSecrets(password, auth.Password) {
+			return true
+		}
+	}
+	if auth.VerifyToken != nil {
+		header := r.Header.Get("Authorization")
+		if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+			return auth.VerifyToken(header[len("Bearer "):])
+		}
+	}
+	return false
+}
+
+// equalSecrets compares a and b in a time independent of their content and length
+func equalSecrets(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// StaticToken returns a HandlerAuth.VerifyToken accepting token only
+func StaticToken(token string) func(string) bool {
+	return func(got string) bool {
+		return token != "" && equalSecrets(got, token)
+	}
+}
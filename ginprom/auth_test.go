@@ -0,0 +1,102 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestPromHandlerWithAuth(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "auth_test_total", Help: "help"}))
+	handler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	basic := HandlerAuth{Username: "prometheus", Password: "s3cret"}
+	bearer := HandlerAuth{VerifyToken: StaticToken("t0ken")}
+	both := HandlerAuth{Username: "prometheus", Password: "s3cret", VerifyToken: StaticToken("t0ken")}
+
+	tests := []struct {
+		name          string
+		auth          HandlerAuth
+		authorize     func(r *http.Request)
+		want          int
+		wantChallenge string
+	}{
+		{"basic", basic, func(r *http.Request) { r.SetBasicAuth("prometheus", "s3cret") }, http.StatusOK, ""},
+		{"wrong password", basic, func(r *http.Request) { r.SetBasicAuth("prometheus", "secret") }, http.StatusUnauthorized, "Basic"},
+		{"wrong username", basic, func(r *http.Request) { r.SetBasicAuth("grafana", "s3cret") }, http.StatusUnauthorized, "Basic"},
+		{"no credentials", basic, func(r *http.Request) {}, http.StatusUnauthorized, "Basic"},
+		{"bearer", bearer, func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, http.StatusOK, ""},
+		{"lower case bearer", bearer, func(r *http.Request) { r.Header.Set("Authorization", "bearer t0ken") }, http.StatusOK, ""},
+		{"wrong token", bearer, func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, http.StatusUnauthorized, "Bearer"},
+		{"empty token", bearer, func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, http.StatusUnauthorized, "Bearer"},
+		{"basic for a token", bearer, func(r *http.Request) { r.SetBasicAuth("prometheus", "t0ken") }, http.StatusUnauthorized, "Bearer"},
+		{"either basic", both, func(r *http.Request) { r.SetBasicAuth("prometheus", "s3cret") }, http.StatusOK, ""},
+		{"either bearer", both, func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/metrics", PromHandlerWithAuth(handler, tt.auth))
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			tt.authorize(req)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("got status %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, tt.wantChallenge) || tt.wantChallenge == "" && got != "" {
+				t.Errorf("got challenge %q, want %s", got, tt.wantChallenge)
+			}
+			if got := strings.Contains(w.Body.String(), "auth_test_total"); got != (tt.want == http.StatusOK) {
+				t.Errorf("got the metrics served %v", got)
+			}
+		})
+	}
+}
+
+func TestNewPromHandlerWithAuthEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		auth HandlerAuth
+	}{
+		{"empty", HandlerAuth{}},
+		{"password only", HandlerAuth{Password: "s3cret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if h, err := NewPromHandlerWithAuth(http.NotFoundHandler(), tt.auth); err == nil || h != nil {
+				t.Errorf("got %v, want an error", err)
+			}
+		})
+	}
+}
+
+func TestStaticToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		got   string
+		want  bool
+	}{
+		{"same", "t0ken", "t0ken", true},
+		{"different", "t0ken", "token", false},
+		{"prefix", "t0ken", "t0k", false},
+		{"no token", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StaticToken(tt.token)(tt.got); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
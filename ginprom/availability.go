@@ -0,0 +1,103 @@
+package ginprom
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultAvailabilityWindow = 5 * time.Minute
+	availabilityBuckets       = 60
+)
+
+// AvailabilitySLI is an Observer and Collector exporting the ratio of good
+// requests per endpoint over a sliding window
+type AvailabilitySLI struct {
+	window     time.Duration
+	resolution time.Duration
+	isGood     func(o Observation) bool
+
+	mu       sync.RWMutex
+	counters map[string]*windowCounter
+
+	desc *prometheus.Desc
+}
+
+// NewAvailabilitySLI returns an AvailabilitySLI, isGood defaults to non-5xx requests,
+// it still needs to be registered
+func NewAvailabilitySLI(window time.Duration, isGood func(o Observation) bool) *AvailabilitySLI {
+	if window <= 0 {
+		window = defaultAvailabilityWindow
+	}
+	if isGood == nil {
+		isGood = isNotServerError
+	}
+	resolution := window / availabilityBuckets
+	if resolution < time.Second {
+		resolution = time.Second
+	}
+
+	a := &AvailabilitySLI{
+		window:     window,
+		resolution: resolution,
+		isGood:     isGood,
+		counters:   make(map[string]*windowCounter),
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "availability_sli"),
+			"Ratio of good requests to total requests over the sliding window",
+			[]string{"endpoint"},
+			prometheus.Labels{"window": formatWindow(window)},
+		),
+	}
+
+	return a
+}
+
+// Observe implements Observer
+func (a *AvailabilitySLI) Observe(o Observation) {
+	good, now := a.isGood(o), time.Now()
+
+	// the read lock is held while adding so Collect can't prune the counter meanwhile
+	a.mu.RLock()
+	counter, ok := a.counters[o.Endpoint]
+	if ok {
+		counter.add(good, now)
+	}
+	a.mu.RUnlock()
+	if ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if counter, ok = a.counters[o.Endpoint]; !ok {
+		counter = newWindowCounter(a.window, a.resolution)
+		a.counters[o.Endpoint] = counter
+	}
+	counter.add(good, now)
+}
+
+// Describe implements prometheus.Collector
+func (a *AvailabilitySLI) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.desc
+}
+
+// Collect implements prometheus.Collector, endpoints without requests in the window are dropped
+func (a *AvailabilitySLI) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for endpoint, counter := range a.counters {
+		good, total := counter.sum(a.window, now)
+		if total == 0 {
+			delete(a.counters, endpoint)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(a.desc, prometheus.GaugeValue, good/total, endpoint)
+	}
+}
@@ -0,0 +1,70 @@
+package ginprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAvailabilitySLI(t *testing.T) {
+	tests := []struct {
+		name     string
+		isGood   func(o Observation) bool
+		statuses map[string][]int
+		expected string
+	}{
+		{
+			name:     "default predicate",
+			statuses: map[string][]int{"/a": {200, 404, 500, 200}, "/b": {200}},
+			expected: `
+# HELP service_availability_sli Ratio of good requests to total requests over the sliding window
+# TYPE service_availability_sli gauge
+service_availability_sli{endpoint="/a",window="5m"} 0.75
+service_availability_sli{endpoint="/b",window="5m"} 1
+`,
+		},
+		{
+			name:     "custom predicate",
+			isGood:   func(o Observation) bool { return o.StatusCode < 400 },
+			statuses: map[string][]int{"/a": {200, 404}},
+			expected: `
+# HELP service_availability_sli Ratio of good requests to total requests over the sliding window
+# TYPE service_availability_sli gauge
+service_availability_sli{endpoint="/a",window="5m"} 0.5
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sli := NewAvailabilitySLI(0, tt.isGood)
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(sli)
+
+			for endpoint, statuses := range tt.statuses {
+				for _, status := range statuses {
+					sli.Observe(Observation{Endpoint: endpoint, StatusCode: status})
+				}
+			}
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(tt.expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAvailabilitySLIPrunesIdleEndpoints(t *testing.T) {
+	sli := NewAvailabilitySLI(time.Minute, nil)
+	sli.counters["/gone"] = newWindowCounter(time.Minute, time.Second)
+	sli.counters["/gone"].add(true, time.Now().Add(-2*time.Minute))
+
+	if n := testutil.CollectAndCount(sli); n != 0 {
+		t.Errorf("got %d series, want 0", n)
+	}
+	if len(sli.counters) != 0 {
+		t.Errorf("got %d counters, want the idle endpoint pruned", len(sli.counters))
+	}
+}
@@ -0,0 +1,116 @@
+package ginprom
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxPendingObservations bounds a batch shard, once full observations are recorded directly
+const maxPendingObservations = 4096
+
+type pendingObservation struct {
+	series   *requestSeries
+	duration float64
+	reqSize  float64
+	respSize float64
+	traceID  string
+}
+
+type batchShard struct {
+	mu      sync.Mutex
+	pending []pendingObservation
+	// pad keeps the shards on separate cache lines
+	_ [40]byte
+}
+
+// batcher buffers the observations of the requests in shards and records them
+// into the metric vectors every interval, so concurrent requests don't contend
+// on the same series
+type batcher struct {
+	interval time.Duration
+	shards   []batchShard
+	// stopped is set once the batcher stops, the observations are then recorded directly
+	stopped atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// newBatcher returns a started batcher with a shard per CPU, stopped by Stop or Close
+func newBatcher(interval time.Duration) *batcher {
+	b := &batcher{
+		interval: interval,
+		shards:   make([]batchShard, runtime.GOMAXPROCS(0)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	goBackground(func(stop <-chan struct{}) {
+		select {
+		case <-stop:
+			b.Stop()
+		case <-b.done:
+		}
+	})
+	go b.run()
+	return b
+}
+
+// record buffers an observation of series
+func (b *batcher) record(series *requestSeries, duration, reqSize, respSize float64, traceID string) {
+	shard := &b.shards[rand.Uint32()%uint32(len(b.shards))]
+
+	shard.mu.Lock()
+	// checked under the lock, so the last flush records what was buffered before
+	full := len(shard.pending) >= maxPendingObservations || b.stopped.Load()
+	if !full {
+		shard.pending = append(shard.pending, pendingObservation{series, duration, reqSize, respSize, traceID})
+	}
+	shard.mu.Unlock()
+
+	if full {
+		series.observe(duration, reqSize, respSize, traceID)
+	}
+}
+
+// flush records the buffered observations
+func (b *batcher) flush() {
+	var pending []pendingObservation
+	for i := range b.shards {
+		shard := &b.shards[i]
+		shard.mu.Lock()
+		pending, shard.pending = shard.pending, pending[:0]
+		shard.mu.Unlock()
+
+		for _, o := range pending {
+			o.series.observe(o.duration, o.reqSize, o.respSize, o.traceID)
+		}
+	}
+}
+
+// Stop records the buffered observations and stops the batcher,
+// the later ones being recorded directly
+func (b *batcher) Stop() {
+	b.once.Do(func() { close(b.stop) })
+	<-b.done
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.stop:
+			b.stopped.Store(true)
+			b.flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package ginprom
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBatcher(t *testing.T) {
+	m, err := newMetrics(NewDefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/batched"
+	count := func() float64 {
+		return testutil.ToFloat64(m.reqCount.WithLabelValues("200", path, http.MethodGet))
+	}
+	series := m.series(http.StatusOK, path, http.MethodGet)
+
+	tests := []struct {
+		name       string
+		records    int
+		wantBefore float64
+	}{
+		{"buffered until flushed", 10, 0},
+		{"full shards record directly", maxPendingObservations + 10, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a single shard and no ticks so the test controls the flushes
+			b := &batcher{shards: make([]batchShard, 1)}
+			before := count()
+
+			for i := 0; i < tt.records; i++ {
+				b.record(series, 0.1, 10, 20, "")
+			}
+			if got := count() - before; got != tt.wantBefore {
+				t.Errorf("got %v requests before the flush, want %v", got, tt.wantBefore)
+			}
+			b.flush()
+			if got := count() - before; got != float64(tt.records) {
+				t.Errorf("got %v requests after the flush, want %d", got, tt.records)
+			}
+		})
+	}
+}
+
+func TestBatcherConcurrent(t *testing.T) {
+	m, err := newMetrics(NewDefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/batched-concurrent"
+	series := m.series(http.StatusOK, path, http.MethodGet)
+	before := testutil.ToFloat64(m.reqCount.WithLabelValues("200", path, http.MethodGet))
+
+	b := newBatcher(time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b.record(series, 0.1, 10, 20, "")
+			}
+		}()
+	}
+	wg.Wait()
+	b.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(m.reqCount.WithLabelValues("200", path, http.MethodGet))-before != 8000 {
+		if time.Now().After(deadline) {
+			t.Fatal("the buffered observations weren't recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,65 @@
+package ginprom
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Names of the BucketPresets
+const (
+	BucketsAPIFast = "api-fast"
+	BucketsAPISlow = "api-slow"
+	BucketsBatch   = "batch"
+)
+
+// BucketPresets are the duration buckets selected by PromOpts.DurationBucketPreset, in
+// seconds. They have bounds at the usual latency objectives so the SLOs are computed
+// from the buckets rather than interpolated. More can be added before the middlewares
+// are created
+var BucketPresets = map[string][]float64{
+	// APIs answering within 1s, with objectives like 100ms or 250ms
+	BucketsAPIFast: {.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	// APIs calling slower backends, with objectives from 250ms to 10s
+	BucketsAPISlow: {.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	// batch and report endpoints running from a second to an hour
+	BucketsBatch: {1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+}
+
+// ExponentialDurationBuckets returns count buckets in seconds growing exponentially from
+// min to max, like ExponentialDurationBuckets(time.Millisecond, 10*time.Second, 12) for
+// PromOpts.DurationBuckets. It returns an error rather than panicking like
+// prometheus.ExponentialBucketsRange when min isn't positive, max is less than min
+// or count is less than 2
+func ExponentialDurationBuckets(min, max time.Duration, count int) ([]float64, error) {
+	switch {
+	case min <= 0:
+		return nil, fmt.Errorf("ginprom: the minimal bucket %v isn't positive", min)
+	case max <= min:
+		return nil, fmt.Errorf("ginprom: the maximal bucket %v isn't above the minimal %v", max, min)
+	case count < 2:
+		return nil, fmt.Errorf("ginprom: %d buckets can't range from %v to %v", count, min, max)
+	}
+	return prometheus.ExponentialBucketsRange(min.Seconds(), max.Seconds(), count), nil
+}
+
+// durationBuckets returns DurationBuckets, the buckets of DurationBucketPreset if empty,
+// nil when neither is set
+func (po *PromOpts) durationBuckets() []float64 {
+	if len(po.DurationBuckets) > 0 {
+		return po.DurationBuckets
+	}
+	return BucketPresets[po.DurationBucketPreset]
+}
+
+// validateBucketPreset returns an error when DurationBucketPreset is unknown
+func (po *PromOpts) validateBucketPreset() error {
+	if po.DurationBucketPreset == "" {
+		return nil
+	}
+	if _, ok := BucketPresets[po.DurationBucketPreset]; !ok {
+		return fmt.Errorf("ginprom: unknown bucket preset %q", po.DurationBucketPreset)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package ginprom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExponentialDurationBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		min     time.Duration
+		max     time.Duration
+		count   int
+		want    []float64
+		wantErr bool
+	}{
+		{"milliseconds to seconds", time.Millisecond, time.Second, 4, []float64{.001, .01, .1, 1}, false},
+		{"two", time.Second, time.Minute, 2, []float64{1, 60}, false},
+		{"zero minimum", 0, time.Second, 4, nil, true},
+		{"negative minimum", -time.Second, time.Second, 4, nil, true},
+		{"inverted", time.Second, time.Millisecond, 4, nil, true},
+		{"equal", time.Second, time.Second, 4, nil, true},
+		{"one bucket", time.Millisecond, time.Second, 1, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExponentialDurationBuckets(tt.min, tt.max, tt.count)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want an error %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if d := got[i] - tt.want[i]; d > 1e-9 || d < -1e-9 {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPromOptsDurationBucketPreset(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    func(opts *PromOpts)
+		want    []float64
+		wantErr bool
+	}{
+		{"default", func(opts *PromOpts) {}, prometheus.DefBuckets, false},
+		{"api fast", func(opts *PromOpts) { opts.DurationBucketPreset = BucketsAPIFast }, BucketPresets[BucketsAPIFast], false},
+		{"batch", func(opts *PromOpts) { opts.DurationBucketPreset = BucketsBatch }, BucketPresets[BucketsBatch], false},
+		{"buckets first", func(opts *PromOpts) {
+			opts.DurationBucketPreset, opts.DurationBuckets = BucketsAPISlow, []float64{1, 2}
+		}, []float64{1, 2}, false},
+		{"spec first", func(opts *PromOpts) {
+			opts.DurationBucketPreset = BucketsAPISlow
+			opts.MetricSpecs = MetricSpecs{MetricRequestDuration: {Buckets: []float64{3, 4}}}
+		}, []float64{3, 4}, false},
+		{"unknown", func(opts *PromOpts) { opts.DurationBucketPreset = "api-medium" }, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			tt.opts(opts)
+			_, err := newMetrics(opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want an error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := opts.metricSpec(MetricRequestDuration).Buckets; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got duration buckets %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucketPresetsIncreasing(t *testing.T) {
+	for name, buckets := range BucketPresets {
+		t.Run(name, func(t *testing.T) {
+			if err := checkBuckets(name, buckets); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
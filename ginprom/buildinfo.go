@@ -0,0 +1,66 @@
+package ginprom
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Version, Commit and BuildDate are the defaults of DefaultBuildInfo, meant to be set
+// when building the service, like
+// go build -ldflags "-X ginmetric/ginprom.Version=1.2.0 -X ginmetric/ginprom.Commit=$(git rev-parse HEAD)"
+var (
+	Version   string
+	Commit    string
+	BuildDate string
+)
+
+// BuildInfo is the build of the service, the labels of the build_info gauge
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	GoVersion string
+	BuildDate string
+}
+
+// DefaultBuildInfo returns the build of the service from Version, Commit and BuildDate,
+// falling back to the module version and the VCS stamps the Go toolchain embeds
+func DefaultBuildInfo() *BuildInfo {
+	info := &BuildInfo{Version: Version, Commit: Commit, GoVersion: runtime.Version(), BuildDate: BuildDate}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "" && build.Main.Version != "(devel)" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.BuildDate == "":
+			info.BuildDate = setting.Value
+		}
+	}
+	return info
+}
+
+// registerBuildInfo registers the build_info gauge of promOpts.BuildInfo with r
+func registerBuildInfo(r *registration, promOpts *PromOpts) prometheus.Gauge {
+	info := promOpts.BuildInfo
+	labels := promOpts.constLabels()
+	labels["version"] = info.Version
+	labels["commit"] = info.Commit
+	labels["go_version"] = info.GoVersion
+	labels["build_date"] = info.BuildDate
+	g := registerOrReuse(r, prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   promOpts.namespace(),
+		Subsystem:   promOpts.Subsystem,
+		ConstLabels: labels,
+		Name:        "build_info",
+		Help:        promOpts.help(MetricBuildInfo, "Build of the HTTP service, always 1"),
+	}))
+	g.Set(1)
+	return g
+}
@@ -0,0 +1,82 @@
+package ginprom
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDefaultBuildInfo(t *testing.T) {
+	tests := []struct {
+		name                       string
+		version, commit, buildDate string
+	}{
+		{"ldflags", "1.2.0", "abc123", "2024-01-02T03:04:05Z"},
+		{"defaults", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(v, c, d string) { Version, Commit, BuildDate = v, c, d }(Version, Commit, BuildDate)
+			Version, Commit, BuildDate = tt.version, tt.commit, tt.buildDate
+
+			info := DefaultBuildInfo()
+			if info.GoVersion != runtime.Version() {
+				t.Errorf("got Go version %q, want %q", info.GoVersion, runtime.Version())
+			}
+			if tt.version == "" {
+				return
+			}
+			if info.Version != tt.version || info.Commit != tt.commit || info.BuildDate != tt.buildDate {
+				t.Errorf("got %+v, want the ldflags variables", info)
+			}
+		})
+	}
+}
+
+func TestPromOptsBuildInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(opts *PromOpts)
+		want string
+	}{
+		{"none", func(opts *PromOpts) {}, ""},
+		{"build info", func(opts *PromOpts) {
+			opts.BuildInfo = &BuildInfo{Version: "1.2.0", Commit: "abc123", GoVersion: "go1.23.0", BuildDate: "2024-01-02"}
+		}, `
+# HELP service_build_info Build of the HTTP service, always 1
+# TYPE service_build_info gauge
+service_build_info{build_date="2024-01-02",commit="abc123",go_version="go1.23.0",version="1.2.0"} 1
+`},
+		{"const labels", func(opts *PromOpts) {
+			opts.BuildInfo = &BuildInfo{Version: "1.2.0"}
+			opts.ConstLabels = prometheus.Labels{"region": "eu"}
+		}, `
+# HELP service_build_info Build of the HTTP service, always 1
+# TYPE service_build_info gauge
+service_build_info{build_date="",commit="",go_version="",region="eu",version="1.2.0"} 1
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			tt.opts(opts)
+			if _, err := NewPromMiddleware(opts); err != nil {
+				t.Fatal(err)
+			}
+			// a second middleware reuses the gauge
+			if _, err := NewPromMiddleware(opts); err != nil {
+				t.Fatal(err)
+			}
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(tt.want), "service_build_info"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
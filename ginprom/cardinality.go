@@ -0,0 +1,126 @@
+package ginprom
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cardinalityWatchers holds the cardinality gauges already updated by a ticker
+var cardinalityWatchers sync.Map
+
+// cardinalityMetrics are the gauges of the series and label values of the metrics of
+// the middleware
+type cardinalityMetrics struct {
+	series      *prometheus.GaugeVec
+	labelValues *prometheus.GaugeVec
+
+	// prefix selects the metrics of the middleware, constLabels are left out of the
+	// label values as they have one
+	prefix      string
+	constLabels prometheus.Labels
+	gatherer    prometheus.Gatherer
+
+	// metrics and labels are the label values of the gauges set by the last update
+	metrics map[string]bool
+	labels  map[string]bool
+}
+
+// registerCardinality registers the ginprom_series_count and ginprom_label_values gauges
+// of promOpts with r
+func registerCardinality(r *registration, promOpts *PromOpts) *cardinalityMetrics {
+	constLabels := promOpts.constLabels()
+	return &cardinalityMetrics{
+		series: registerOrReuse(r, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   selfNamespace,
+			ConstLabels: constLabels,
+			Name:        "series_count",
+			Help:        promOpts.help(MetricSeriesCount, "Number of series of the metrics of the middleware"),
+		}, []string{"metric"})),
+		labelValues: registerOrReuse(r, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   selfNamespace,
+			ConstLabels: constLabels,
+			Name:        "label_values",
+			Help:        promOpts.help(MetricLabelValues, "Number of distinct values of the labels of the metrics of the middleware"),
+		}, []string{"label"})),
+		prefix:      promOpts.metricPrefix(),
+		constLabels: constLabels,
+		gatherer:    promOpts.Gatherer(),
+	}
+}
+
+// metricPrefix returns the prefix of the names of the metrics of the middleware
+func (po *PromOpts) metricPrefix() string {
+	if po.Subsystem != "" {
+		return po.namespace() + "_" + po.Subsystem + "_"
+	}
+	return po.namespace() + "_"
+}
+
+// watch updates the gauges every interval until stop is closed
+func (c *cardinalityMetrics) watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	c.update()
+	for {
+		select {
+		case <-ticker.C:
+			c.update()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// update sets the gauges to the series and label values gathered, deleting the ones
+// of the metrics and labels gone since the last update
+func (c *cardinalityMetrics) update() {
+	// the families gathered along an error are still counted
+	families, _ := c.gatherer.Gather()
+	series := map[string]int{}
+	values := map[string]map[string]bool{}
+	for _, mf := range families {
+		name := mf.GetName()
+		if !strings.HasPrefix(name, c.prefix) {
+			continue
+		}
+		series[name] = len(mf.GetMetric())
+		for _, metric := range mf.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				label := pair.GetName()
+				if _, ok := c.constLabels[label]; ok {
+					continue
+				}
+				if values[label] == nil {
+					values[label] = map[string]bool{}
+				}
+				values[label][pair.GetValue()] = true
+			}
+		}
+	}
+
+	metrics := make(map[string]bool, len(series))
+	for name, count := range series {
+		c.series.WithLabelValues(name).Set(float64(count))
+		metrics[name] = true
+	}
+	for name := range c.metrics {
+		if !metrics[name] {
+			c.series.DeleteLabelValues(name)
+		}
+	}
+	labels := make(map[string]bool, len(values))
+	for label, seen := range values {
+		c.labelValues.WithLabelValues(label).Set(float64(len(seen)))
+		labels[label] = true
+	}
+	for label := range c.labels {
+		if !labels[label] {
+			c.labelValues.DeleteLabelValues(label)
+		}
+	}
+	c.metrics, c.labels = metrics, labels
+}
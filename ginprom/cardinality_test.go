@@ -0,0 +1,100 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCardinalityMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		paths      []string
+		wantSeries float64
+		// wantValues are the distinct values by label
+		wantValues map[string]float64
+	}{
+		{"one endpoint", []string{"/users/1", "/users/1"}, 1,
+			map[string]float64{"endpoint": 1, "method": 1, "status": 1}},
+		{"ids in the paths", []string{"/users/1", "/users/2", "/users/3", "/missing"}, 4,
+			map[string]float64{"endpoint": 4, "method": 1, "status": 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.EndpointLabelMappingFn = URLPath
+			opts.ConstLabels = prometheus.Labels{"env": "test"}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users/:id", listUsers)
+			for _, path := range tt.paths {
+				serve(r, http.MethodGet, path)
+			}
+
+			c := registerCardinality(opts.registration(), opts)
+			c.update()
+			if got := testutil.ToFloat64(c.series.WithLabelValues("service_http_request_count_total")); got != tt.wantSeries {
+				t.Errorf("got %v request count series, want %v", got, tt.wantSeries)
+			}
+			for label, want := range tt.wantValues {
+				if got := testutil.ToFloat64(c.labelValues.WithLabelValues(label)); got != want {
+					t.Errorf("got %v values of %s, want %v", got, label, want)
+				}
+			}
+			// the constant labels have a single value, and the self metrics aren't counted
+			if count := testutil.CollectAndCount(c.labelValues); count != len(tt.wantValues) {
+				t.Errorf("got %d labels counted, want %d", count, len(tt.wantValues))
+			}
+
+			// the series deleted since are dropped
+			Reset()
+			c.update()
+			if count := testutil.CollectAndCount(c.labelValues); count != 0 {
+				t.Errorf("got %d labels counted after the reset, want none", count)
+			}
+		})
+	}
+}
+
+func TestPromOptsCardinalityInterval(t *testing.T) {
+	defer Close()
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     int
+	}{
+		{"updated", time.Millisecond, 1},
+		{"disabled", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.CardinalityInterval = tt.interval
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			serve(r, http.MethodGet, "/users")
+
+			if tt.want == 0 {
+				if count, err := testutil.GatherAndCount(reg, "ginprom_series_count"); err != nil || count != 0 {
+					t.Errorf("got %d series counts, want none: %v", count, err)
+				}
+				return
+			}
+			waitFor(t, func() bool {
+				count, err := testutil.GatherAndCount(reg, "ginprom_series_count")
+				return err == nil && count > 0
+			})
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package ginprom
+
+import (
+	"reflect"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// handlerFrameKey is the context key of the innermost instrumented handler running
+const handlerFrameKey = "ginprom.handlerFrame"
+
+// handlerFrame accumulates the time the handlers nested in an instrumented one took
+type handlerFrame struct {
+	nested time.Duration
+}
+
+// registerMiddlewareDuration registers the http_middleware_duration_seconds histogram of promOpts with r
+func registerMiddlewareDuration(r *registration, promOpts *PromOpts) *prometheus.HistogramVec {
+	buckets := promOpts.durationBuckets()
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	return registerOrReuse(r, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   promOpts.namespace(),
+		Subsystem:   promOpts.Subsystem,
+		ConstLabels: promOpts.constLabels(),
+		Name:        "http_middleware_duration_seconds",
+		Help:        promOpts.help(MetricMiddlewareDuration, "Time spent in each http middleware and handler in seconds"),
+		Buckets:     buckets,
+	}, []string{"middleware"}))
+}
+
+// InstrumentChain wraps each handler of chain to observe the time spent in it into
+// http_middleware_duration_seconds, labelled with the name of its function, like
+// gin.LoggerWithConfig.func1, see InstrumentHandler. It panics when the histogram
+// conflicts with a registered one, see NewInstrumentChain
+func InstrumentChain(promOpts *PromOpts, chain ...gin.HandlerFunc) gin.HandlersChain {
+	instrumented, err := NewInstrumentChain(promOpts, chain...)
+	if err != nil {
+		panic(err)
+	}
+	return instrumented
+}
+
+// NewInstrumentChain is like InstrumentChain but returns an error when the histogram
+// conflicts with the collectors registered on PromOpts.Registerer
+func NewInstrumentChain(promOpts *PromOpts, chain ...gin.HandlerFunc) (gin.HandlersChain, error) {
+	instrumented := make(gin.HandlersChain, 0, len(chain))
+	for _, h := range chain {
+		name := shortFuncName(runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name())
+		ih, err := NewInstrumentHandler(promOpts, name, h)
+		if err != nil {
+			return nil, err
+		}
+		instrumented = append(instrumented, ih)
+	}
+	return instrumented, nil
+}
+
+// InstrumentHandler wraps h to observe the time spent in it into
+// http_middleware_duration_seconds, labelled middleware name. The time of the
+// instrumented handlers a middleware runs with gin.Context.Next isn't counted in its
+// own, which separates the auth, logging or compression layers from the business
+// handlers. It panics when the histogram conflicts with a registered one
+func InstrumentHandler(promOpts *PromOpts, name string, h gin.HandlerFunc) gin.HandlerFunc {
+	ih, err := NewInstrumentHandler(promOpts, name, h)
+	if err != nil {
+		panic(err)
+	}
+	return ih
+}
+
+// NewInstrumentHandler is like InstrumentHandler but returns an error when the histogram
+// conflicts with the collectors registered on PromOpts.Registerer
+func NewInstrumentHandler(promOpts *PromOpts, name string, h gin.HandlerFunc) (gin.HandlerFunc, error) {
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	r := promOpts.registration()
+	durations := registerMiddlewareDuration(r, promOpts)
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	observer := durations.WithLabelValues(name)
+
+	return func(c *gin.Context) {
+		parent, _ := c.Value(handlerFrameKey).(*handlerFrame)
+		frame := &handlerFrame{}
+		c.Set(handlerFrameKey, frame)
+		start := time.Now()
+		defer func() {
+			total := time.Since(start)
+			c.Set(handlerFrameKey, parent)
+			if parent != nil {
+				parent.nested += total
+			}
+			observer.Observe((total - frame.nested).Seconds())
+		}()
+		h(c)
+	}, nil
+}
@@ -0,0 +1,138 @@
+package ginprom
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func sleepingHandler(d time.Duration, next bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		time.Sleep(d)
+		if next {
+			c.Next()
+		}
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		// chain are the handlers of the route, the first ones calling gin.Context.Next if next
+		chain []string
+		next  bool
+		// want are the least and most times spent in each handler
+		want map[string][2]time.Duration
+	}{
+		{"nested", []string{"auth", "logger", "handler"}, true, map[string][2]time.Duration{
+			"auth":    {10 * time.Millisecond, 40 * time.Millisecond},
+			"logger":  {10 * time.Millisecond, 40 * time.Millisecond},
+			"handler": {50 * time.Millisecond, time.Second},
+		}},
+		{"sequential", []string{"auth", "handler"}, false, map[string][2]time.Duration{
+			"auth":    {10 * time.Millisecond, 40 * time.Millisecond},
+			"handler": {50 * time.Millisecond, time.Second},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			var chain []gin.HandlerFunc
+			for _, name := range tt.chain {
+				d := 10 * time.Millisecond
+				if name == "handler" {
+					d = 50 * time.Millisecond
+				}
+				chain = append(chain, InstrumentHandler(opts, name, sleepingHandler(d, tt.next && name != "handler")))
+			}
+			r := gin.New()
+			r.GET("/chain", chain...)
+			serve(r, http.MethodGet, "/chain")
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]time.Duration{}
+			for _, mf := range families {
+				if mf.GetName() != "service_http_middleware_duration_seconds" {
+					continue
+				}
+				for _, metric := range mf.GetMetric() {
+					sum := metric.GetHistogram().GetSampleSum()
+					got[metric.GetLabel()[0].GetValue()] = time.Duration(sum * float64(time.Second))
+				}
+			}
+			for name, bounds := range tt.want {
+				if d, ok := got[name]; !ok || d < bounds[0] || d > bounds[1] {
+					t.Errorf("got %v in %s, want between %v and %v", d, name, bounds[0], bounds[1])
+				}
+			}
+		})
+	}
+}
+
+func TestInstrumentChain(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain []gin.HandlerFunc
+		want  []string
+	}{
+		{"functions", []gin.HandlerFunc{listUsers}, []string{"ginprom.listUsers"}},
+		{"closures", []gin.HandlerFunc{sleepingHandler(0, true), listUsers},
+			[]string{"ginprom.sleepingHandler.func1", "ginprom.listUsers"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			r := gin.New()
+			r.GET("/users", InstrumentChain(opts, tt.chain...)...)
+			if w := serve(r, http.MethodGet, "/users"); w.Code != http.StatusOK {
+				t.Fatalf("got status %d", w.Code)
+			}
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, mf := range families {
+				for _, metric := range mf.GetMetric() {
+					got = append(got, metric.GetLabel()[0].GetValue())
+				}
+			}
+			want := append([]string(nil), tt.want...)
+			// the series are gathered sorted by label value
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("got the middlewares %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewInstrumentHandlerConflict(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_http_middleware_duration_seconds",
+		Help: "conflicting",
+	}, []string{"middleware"}))
+
+	if h, err := NewInstrumentHandler(&PromOpts{Registerer: reg}, "auth", listUsers); err == nil || h != nil {
+		t.Errorf("got %v, want a conflict error", err)
+	}
+	if chain, err := NewInstrumentChain(&PromOpts{Registerer: reg}, listUsers); err == nil || chain != nil {
+		t.Errorf("got %v, want a conflict error", err)
+	}
+}
@@ -0,0 +1,70 @@
+package ginprom
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the client labels of ClientNetworks
+const (
+	InternalClientValue = "internal"
+	ExternalClientValue = "external"
+)
+
+// PrivateNetworks are the loopback, private and link-local networks, the internal
+// networks of most deployments
+var PrivateNetworks = []string{
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16",
+	"::1/128", "fc00::/7", "fe80::/10",
+}
+
+// ClientNetworks returns a ClientLabelMappingFn labelling the clients "internal" when their
+// IP, see gin.Context.ClientIP, is in one of the CIDR networks, like PrivateNetworks, and
+// "external" otherwise
+func ClientNetworks(internal ...string) (RequestLabelMappingFn, error) {
+	return ClientNetworkClasses(map[string][]string{InternalClientValue: internal}, ExternalClientValue)
+}
+
+// ClientNetworkClasses returns a ClientLabelMappingFn labelling the clients with the class
+// of the most specific CIDR network their IP is in, like "office" or "vpn", and fallback
+// when it's in none or isn't valid
+func ClientNetworkClasses(classes map[string][]string, fallback string) (RequestLabelMappingFn, error) {
+	type network struct {
+		prefix netip.Prefix
+		class  string
+	}
+	var networks []network
+	for class, cidrs := range classes {
+		for _, cidr := range cidrs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("ginprom: invalid network of client class %q: %w", class, err)
+			}
+			networks = append(networks, network{prefix.Masked(), class})
+		}
+	}
+	// the most specific networks first, then by class for the overlapping ones
+	sort.Slice(networks, func(i, j int) bool {
+		if bi, bj := networks[i].prefix.Bits(), networks[j].prefix.Bits(); bi != bj {
+			return bi > bj
+		}
+		return networks[i].class < networks[j].class
+	})
+
+	return func(c *gin.Context) string {
+		addr, err := netip.ParseAddr(c.ClientIP())
+		if err != nil {
+			return fallback
+		}
+		addr = addr.Unmap()
+		for _, n := range networks {
+			if n.prefix.Contains(addr) {
+				return n.class
+			}
+		}
+		return fallback
+	}, nil
+}
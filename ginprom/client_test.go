@@ -0,0 +1,144 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// clientContext returns a context of a request from remoteAddr
+func clientContext(remoteAddr string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = remoteAddr
+	return c
+}
+
+func TestClientNetworks(t *testing.T) {
+	classify, err := ClientNetworks(PrivateNetworks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{"loopback", "127.0.0.1:1234", InternalClientValue},
+		{"private", "10.1.2.3:1234", InternalClientValue},
+		{"private 172", "172.20.0.1:1234", InternalClientValue},
+		{"public", "8.8.8.8:1234", ExternalClientValue},
+		{"ipv6 loopback", "[::1]:1234", InternalClientValue},
+		{"ipv6 unique local", "[fd00::1]:1234", InternalClientValue},
+		{"ipv6 public", "[2001:4860::8888]:1234", ExternalClientValue},
+		{"ipv4 mapped", "[::ffff:192.168.1.1]:1234", InternalClientValue},
+		{"invalid", "nowhere", ExternalClientValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(clientContext(tt.remoteAddr)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientNetworkClasses(t *testing.T) {
+	classify, err := ClientNetworkClasses(map[string][]string{
+		"corporate": {"10.0.0.0/8"},
+		"office":    {"10.1.0.0/16"},
+		"vpn":       {"10.1.2.0/24", "fd00::/8"},
+	}, "internet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{"least specific", "10.9.0.1:80", "corporate"},
+		{"more specific", "10.1.9.1:80", "office"},
+		{"most specific", "10.1.2.3:80", "vpn"},
+		{"ipv6", "[fd00::2]:80", "vpn"},
+		{"fallback", "1.1.1.1:80", "internet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(clientContext(tt.remoteAddr)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientNetworksInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		cidrs []string
+	}{
+		{"not a network", []string{"internal"}},
+		{"address", []string{"10.0.0.1"}},
+		{"bad mask", []string{"10.0.0.0/33"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if fn, err := ClientNetworks(tt.cidrs...); err == nil || fn != nil {
+				t.Errorf("got %v, want an error", err)
+			}
+		})
+	}
+}
+
+func TestPromOptsClientLabel(t *testing.T) {
+	classify, err := ClientNetworks(PrivateNetworks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		opts       func(opts *PromOpts)
+		remoteAddr string
+		want       []string
+	}{
+		{"internal", func(opts *PromOpts) {}, "10.0.0.1:80",
+			[]string{"200", "/users", http.MethodGet, InternalClientValue}},
+		{"external", func(opts *PromOpts) {}, "8.8.8.8:80",
+			[]string{"200", "/users", http.MethodGet, ExternalClientValue}},
+		{"after the handler", func(opts *PromOpts) { opts.HandlerLabel = true }, "8.8.8.8:80",
+			[]string{"200", "/users", http.MethodGet, "ginprom.listUsers", ExternalClientValue}},
+		{"before the extra labels", func(opts *PromOpts) {
+			opts.ExtraLabels = map[string]RequestLabelMappingFn{"tenant": func(c *gin.Context) string { return "acme" }}
+		}, "10.0.0.1:80", []string{"200", "/users", http.MethodGet, InternalClientValue, "acme"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.ClientLabelMappingFn = classify
+			tt.opts(opts)
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.RemoteAddr = tt.remoteAddr
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.want...)); got != 1 {
+				t.Errorf("got %v requests labelled %v, want 1", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package ginprom
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// coarseClockResolution is how often the coarse clock is updated
+const coarseClockResolution = time.Millisecond
+
+var (
+	// coarseNanos is the unix nano time of the last coarse clock tick
+	coarseNanos   int64
+	coarseRunning atomic.Bool
+	coarseMu      sync.Mutex
+)
+
+// coarseNow returns the time of the last coarse clock tick, which is at most
+// coarseClockResolution old, without a time syscall
+func coarseNow() time.Time {
+	if !coarseRunning.Load() {
+		startCoarseClock()
+	}
+	return time.Unix(0, atomic.LoadInt64(&coarseNanos))
+}
+
+// startCoarseClock starts the coarse clock unless it's running
+func startCoarseClock() {
+	coarseMu.Lock()
+	defer coarseMu.Unlock()
+
+	if coarseRunning.Load() {
+		return
+	}
+	atomic.StoreInt64(&coarseNanos, time.Now().UnixNano())
+	coarseRunning.Store(true)
+	goBackground(runCoarseClock)
+}
+
+func runCoarseClock(stop <-chan struct{}) {
+	ticker := time.NewTicker(coarseClockResolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			atomic.StoreInt64(&coarseNanos, now.UnixNano())
+		case <-stop:
+			coarseMu.Lock()
+			coarseRunning.Store(false)
+			coarseMu.Unlock()
+			return
+		}
+	}
+}
+
+// requestState holds what the middleware tracks during a request,
+// pooled so recording a request doesn't allocate
+type requestState struct {
+	start  time.Time
+	writer responseWriter
+	body   bodyReader
+	obs    Observation
+	// labels holds the values of the extra labels of the request series
+	labels []string
+}
+
+var requestStates = sync.Pool{
+	New: func() interface{} { return new(requestState) },
+}
+
+func getRequestState() *requestState {
+	return requestStates.Get().(*requestState)
+}
+
+func putRequestState(s *requestState) {
+	*s = requestState{labels: s.labels[:0]}
+	requestStates.Put(s)
+}
@@ -0,0 +1,70 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCoarseNow(t *testing.T) {
+	first := coarseNow()
+	if d := time.Since(first); d < 0 || d > time.Second {
+		t.Fatalf("coarse clock is %v away from the wall clock", d)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !coarseNow().After(first) {
+		if time.Now().After(deadline) {
+			t.Fatal("the coarse clock doesn't advance")
+		}
+		time.Sleep(coarseClockResolution)
+	}
+}
+
+type observerFunc func(o Observation)
+
+func (f observerFunc) Observe(o Observation) {
+	f(o)
+}
+
+func TestPromMiddlewareCoarseClock(t *testing.T) {
+	var duration time.Duration
+	opts := NewDefaultOpts()
+	opts.CoarseClock = true
+	opts.Observers = []Observer{observerFunc(func(o Observation) { duration = o.Duration })}
+	path := "/coarse-clock"
+
+	r := gin.New()
+	r.Use(PromMiddleware(opts))
+	r.GET(path, func(c *gin.Context) {
+		time.Sleep(20 * time.Millisecond)
+		c.Status(http.StatusNoContent)
+	})
+
+	m, err := newMetrics(NewDefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := testutil.ToFloat64(m.reqCount.WithLabelValues("204", path, http.MethodGet))
+	serve(r, http.MethodGet, path)
+	if got := testutil.ToFloat64(m.reqCount.WithLabelValues("204", path, http.MethodGet)) - before; got != 1 {
+		t.Errorf("got %v requests, want 1", got)
+	}
+	if duration < 10*time.Millisecond || duration > time.Second {
+		t.Errorf("got duration %v, want about 20ms", duration)
+	}
+}
+
+func TestRequestStatePool(t *testing.T) {
+	s := getRequestState()
+	s.start = time.Now()
+	s.obs.Endpoint = "/pooled"
+	putRequestState(s)
+
+	if !s.start.IsZero() || s.writer.ResponseWriter != nil || s.obs != (Observation{}) {
+		t.Error("the request state isn't reset before reuse")
+	}
+}
@@ -0,0 +1,196 @@
+// Package cloud queries the instance metadata services of AWS (EC2, ECS) and GCP (GCE)
+// to label the metrics with the region, availability zone and instance type
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultTimeout bounds the metadata lookup, it is short so startup isn't
+// delayed noticeably when not running on a cloud instance
+const DefaultTimeout = time.Second
+
+// Label names
+const (
+	LabelProvider     = "cloud"
+	LabelRegion       = "region"
+	LabelZone         = "zone"
+	LabelInstanceType = "instance_type"
+)
+
+// Metadata service endpoints, variables so they can be pointed elsewhere
+var (
+	EC2Endpoint = "http://169.254.169.254"
+	GCEEndpoint = "http://metadata.google.internal"
+)
+
+var errNotFound = errors.New("cloud: metadata not available")
+
+type provider func(ctx context.Context, client *http.Client) (prometheus.Labels, error)
+
+// providers are queried concurrently but their answers are used in this order: EC2 first
+// because it knows the instance type of ECS tasks on EC2, then ECS for Fargate tasks
+var providers = []provider{ec2, ecs, gce}
+
+// Labels returns the cloud, region, zone and instance_type labels of the instance,
+// or empty labels when no metadata service answers within timeout. Labels which
+// the provider doesn't know, like the instance type of Fargate tasks, are left out
+func Labels(timeout time.Duration) prometheus.Labels {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return firstLabels(ctx, &http.Client{}, providers)
+}
+
+// firstLabels returns the labels of the first provider in order which answers
+func firstLabels(ctx context.Context, client *http.Client, providers []provider) prometheus.Labels {
+	results := make([]chan prometheus.Labels, len(providers))
+	for i, p := range providers {
+		results[i] = make(chan prometheus.Labels, 1)
+		go func(p provider, result chan<- prometheus.Labels) {
+			labels, err := p(ctx, client)
+			if err != nil {
+				labels = nil
+			}
+			result <- labels
+		}(p, results[i])
+	}
+
+	for _, result := range results {
+		select {
+		case labels := <-result:
+			if labels != nil {
+				return labels
+			}
+		case <-ctx.Done():
+			return prometheus.Labels{}
+		}
+	}
+	return prometheus.Labels{}
+}
+
+func fetch(ctx context.Context, client *http.Client, method, url string, header http.Header) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cloud: %s %s: unexpected status %s", method, url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return strings.TrimSpace(string(body)), err
+}
+
+// ec2 reads the EC2 instance metadata with an IMDSv2 session token
+func ec2(ctx context.Context, client *http.Client) (prometheus.Labels, error) {
+	token, err := fetch(ctx, client, http.MethodPut, EC2Endpoint+"/latest/api/token",
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"}})
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+
+	labels := prometheus.Labels{LabelProvider: "aws"}
+	for label, path := range map[string]string{
+		LabelRegion:       "/latest/meta-data/placement/region",
+		LabelZone:         "/latest/meta-data/placement/availability-zone",
+		LabelInstanceType: "/latest/meta-data/instance-type",
+	} {
+		value, err := fetch(ctx, client, http.MethodGet, EC2Endpoint+path, header)
+		if err != nil {
+			return nil, err
+		}
+		labels[label] = value
+	}
+	return labels, nil
+}
+
+// ecs reads the ECS task metadata endpoint v4, only available inside ECS tasks
+func ecs(ctx context.Context, client *http.Client) (prometheus.Labels, error) {
+	endpoint := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if endpoint == "" {
+		return nil, errNotFound
+	}
+	body, err := fetch(ctx, client, http.MethodGet, endpoint+"/task", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	task := struct {
+		AvailabilityZone string
+	}{}
+	if err := json.Unmarshal([]byte(body), &task); err != nil {
+		return nil, err
+	}
+	if task.AvailabilityZone == "" {
+		return nil, errNotFound
+	}
+	return prometheus.Labels{
+		LabelProvider: "aws",
+		LabelRegion:   awsRegion(task.AvailabilityZone),
+		LabelZone:     task.AvailabilityZone,
+	}, nil
+}
+
+// gce reads the GCE metadata server
+func gce(ctx context.Context, client *http.Client) (prometheus.Labels, error) {
+	header := http.Header{"Metadata-Flavor": {"Google"}}
+
+	// both are returned as projects/<number>/<kind>/<name>
+	zone, err := fetch(ctx, client, http.MethodGet, GCEEndpoint+"/computeMetadata/v1/instance/zone", header)
+	if err != nil {
+		return nil, err
+	}
+	machineType, err := fetch(ctx, client, http.MethodGet, GCEEndpoint+"/computeMetadata/v1/instance/machine-type", header)
+	if err != nil {
+		return nil, err
+	}
+	zone = lastSegment(zone)
+
+	return prometheus.Labels{
+		LabelProvider:     "gcp",
+		LabelRegion:       gceRegion(zone),
+		LabelZone:         zone,
+		LabelInstanceType: lastSegment(machineType),
+	}, nil
+}
+
+// awsRegion returns the region of an availability zone, e.g. us-east-1 for us-east-1a
+func awsRegion(zone string) string {
+	return strings.TrimRight(zone, "abcdefghijklmnopqrstuvwxyz")
+}
+
+// gceRegion returns the region of a zone, e.g. europe-west1 for europe-west1-b
+func gceRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+func lastSegment(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
@@ -0,0 +1,165 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		region func(zone string) string
+		zone   string
+		want   string
+	}{
+		{name: "aws", region: awsRegion, zone: "us-east-1a", want: "us-east-1"},
+		{name: "aws local zone", region: awsRegion, zone: "us-west-2-lax-1b", want: "us-west-2-lax-1"},
+		{name: "gce", region: gceRegion, zone: "europe-west1-b", want: "europe-west1"},
+		{name: "gce without zone suffix", region: gceRegion, zone: "local", want: "local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.region(tt.zone); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func serve(t *testing.T, routes map[string]string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestProviders(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider provider
+		setup    func(t *testing.T)
+		want     prometheus.Labels
+	}{
+		{
+			name:     "ec2",
+			provider: ec2,
+			setup: func(t *testing.T) {
+				url := serve(t, map[string]string{
+					"PUT /latest/api/token":                             "token",
+					"GET /latest/meta-data/placement/region":            "eu-west-1",
+					"GET /latest/meta-data/placement/availability-zone": "eu-west-1b",
+					"GET /latest/meta-data/instance-type":               "m5.large",
+				})
+				old := EC2Endpoint
+				t.Cleanup(func() { EC2Endpoint = old })
+				EC2Endpoint = url
+			},
+			want: prometheus.Labels{LabelProvider: "aws", LabelRegion: "eu-west-1", LabelZone: "eu-west-1b", LabelInstanceType: "m5.large"},
+		},
+		{
+			name:     "ecs",
+			provider: ecs,
+			setup: func(t *testing.T) {
+				t.Setenv("ECS_CONTAINER_METADATA_URI_V4", serve(t, map[string]string{
+					"GET /task": `{"AvailabilityZone": "us-east-2c", "LaunchType": "FARGATE"}`,
+				}))
+			},
+			want: prometheus.Labels{LabelProvider: "aws", LabelRegion: "us-east-2", LabelZone: "us-east-2c"},
+		},
+		{
+			name:     "gce",
+			provider: gce,
+			setup: func(t *testing.T) {
+				url := serve(t, map[string]string{
+					"GET /computeMetadata/v1/instance/zone":         "projects/123/zones/asia-east1-a",
+					"GET /computeMetadata/v1/instance/machine-type": "projects/123/machineTypes/e2-medium",
+				})
+				old := GCEEndpoint
+				t.Cleanup(func() { GCEEndpoint = old })
+				GCEEndpoint = url
+			},
+			want: prometheus.Labels{LabelProvider: "gcp", LabelRegion: "asia-east1", LabelZone: "asia-east1-a", LabelInstanceType: "e2-medium"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+			got, err := tt.provider(context.Background(), &http.Client{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("label %s = %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFirstLabels(t *testing.T) {
+	answer := func(delay time.Duration, cloud string) provider {
+		return func(ctx context.Context, _ *http.Client) (prometheus.Labels, error) {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if cloud == "" {
+				return nil, errors.New("not found")
+			}
+			return prometheus.Labels{LabelProvider: cloud}, nil
+		}
+	}
+
+	tests := []struct {
+		name      string
+		providers []provider
+		want      string
+	}{
+		{
+			name:      "precedence wins over speed",
+			providers: []provider{answer(20*time.Millisecond, "first"), answer(0, "second")},
+			want:      "first",
+		},
+		{
+			name:      "failed providers are skipped",
+			providers: []provider{answer(0, ""), answer(10*time.Millisecond, "second")},
+			want:      "second",
+		},
+		{
+			name:      "timeout",
+			providers: []provider{answer(time.Hour, "first")},
+			want:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			if got := firstLabels(ctx, &http.Client{}, tt.providers)[LabelProvider]; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
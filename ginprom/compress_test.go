@@ -0,0 +1,89 @@
+package ginprom
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"br, *", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0, br", false},
+		{"identity", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := acceptsGzip(tt.header); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGzipHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "orders_total", Help: "help"}))
+	tests := []struct {
+		name           string
+		handler        http.Handler
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"compressed", OpenMetricsHandler(reg), "gzip", true},
+		{"not accepted", OpenMetricsHandler(reg), "", false},
+		{"refused", OpenMetricsHandler(reg), "gzip;q=0", false},
+		// promhttp compresses itself, its body must not be compressed twice
+		{"compressed by the handler", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}), "gzip", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			GzipHandler(tt.handler).ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+				t.Fatalf("got gzip %v, want %v", got, tt.wantGzip)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("got Vary %q, want Accept-Encoding", got)
+			}
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+				t.Errorf("got content type %q, want the text format", w.Header().Get("Content-Type"))
+			}
+			var body io.Reader = w.Body
+			if tt.wantGzip {
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			text, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(text), "orders_total 0") {
+				t.Errorf("got %q, want the counter", text)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package ginprom
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the middleware configuration managed as a YAML or JSON file, see LoadConfig
+//
+//	namespace: shop
+//	exclude_paths: [/healthz, /static/*]
+//	duration_buckets: [0.01, 0.05, 0.1, 0.5, 1]
+//	const_labels:
+//	  env: production
+//	endpoint_rewrites:
+//	  - {pattern: "^/v[0-9]+/", replacement: /}
+//	metrics_server:
+//	  addr: ":9100"
+//	  tls: {cert_file: server.pem, key_file: server-key.pem, client_ca_file: ca.pem}
+type Config struct {
+	Namespace            string            `yaml:"namespace" json:"namespace"`
+	Subsystem            string            `yaml:"subsystem" json:"subsystem"`
+	ExcludeRegexStatus   string            `yaml:"exclude_status" json:"exclude_status"`
+	ExcludeRegexEndpoint string            `yaml:"exclude_endpoint" json:"exclude_endpoint"`
+	ExcludeRegexMethod   string            `yaml:"exclude_method" json:"exclude_method"`
+	ExcludePaths         []string          `yaml:"exclude_paths" json:"exclude_paths"`
+	IncludeOnlyPaths     []string          `yaml:"include_only_paths" json:"include_only_paths"`
+	DurationBuckets      []float64         `yaml:"duration_buckets" json:"duration_buckets"`
+	DurationBucketPreset string            `yaml:"duration_bucket_preset" json:"duration_bucket_preset"`
+	SizeBuckets          []float64         `yaml:"size_buckets" json:"size_buckets"`
+	ConstLabels          map[string]string `yaml:"const_labels" json:"const_labels"`
+	EndpointRewrites     []EndpointRewrite `yaml:"endpoint_rewrites" json:"endpoint_rewrites"`
+	MetricsServer        struct {
+		Addr     string            `yaml:"addr" json:"addr"`
+		Path     string            `yaml:"path" json:"path"`
+		Compress bool              `yaml:"compress" json:"compress"`
+		TLS      *MetricsServerTLS `yaml:"tls" json:"tls"`
+	} `yaml:"metrics_server" json:"metrics_server"`
+}
+
+// EndpointRewrite is a regex replace rule of the endpoint labels, see RegexpNormalizer
+type EndpointRewrite struct {
+	Pattern     string `yaml:"pattern" json:"pattern"`
+	Replacement string `yaml:"replacement" json:"replacement"`
+}
+
+// LoadConfig reads and validates the configuration file at path
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ginprom: %w", err)
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s", err, path)
+	}
+	return config, nil
+}
+
+// ParseConfig parses and validates a YAML or JSON configuration, the JSON being YAML.
+// The unknown settings are errors rather than silently ignored
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("ginprom: invalid configuration: %w", err)
+	}
+	if _, err := config.PromOpts(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// PromOpts returns the NewDefaultOpts options with the settings of c,
+// an error when they are invalid
+func (c *Config) PromOpts() (*PromOpts, error) {
+	for setting, regex := range map[string]string{
+		"exclude_status":   c.ExcludeRegexStatus,
+		"exclude_endpoint": c.ExcludeRegexEndpoint,
+		"exclude_method":   c.ExcludeRegexMethod,
+	} {
+		if err := checkRegex(setting, regex); err != nil {
+			return nil, err
+		}
+	}
+	for _, rewrite := range c.EndpointRewrites {
+		if err := checkRegex("endpoint_rewrites", rewrite.Pattern); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkBuckets("duration_buckets", c.DurationBuckets); err != nil {
+		return nil, err
+	}
+	if err := checkBuckets("size_buckets", c.SizeBuckets); err != nil {
+		return nil, err
+	}
+
+	opts := NewDefaultOpts()
+	opts.Namespace = c.Namespace
+	opts.Subsystem = c.Subsystem
+	opts.ExcludeRegexStatus = c.ExcludeRegexStatus
+	opts.ExcludeRegexEndpoint = c.ExcludeRegexEndpoint
+	opts.ExcludeRegexMethod = c.ExcludeRegexMethod
+	opts.ExcludePaths = c.ExcludePaths
+	opts.IncludeOnlyPaths = c.IncludeOnlyPaths
+	opts.DurationBuckets = c.DurationBuckets
+	opts.SizeBuckets = c.SizeBuckets
+	opts.DurationBucketPreset = c.DurationBucketPreset
+	if err := opts.validateBucketPreset(); err != nil {
+		return nil, err
+	}
+	if len(c.ConstLabels) > 0 {
+		opts.ConstLabels = prometheus.Labels(c.ConstLabels)
+	}
+	if err := opts.validateConstLabels(); err != nil {
+		return nil, err
+	}
+	for _, rewrite := range c.EndpointRewrites {
+		opts.EndpointNormalizers = append(opts.EndpointNormalizers,
+			RegexpNormalizer(rewrite.Pattern, rewrite.Replacement))
+	}
+	return opts, nil
+}
+
+// MetricsServerOpts returns the options of a MetricsServer listening as configured by c,
+// serving the metrics of promOpts
+func (c *Config) MetricsServerOpts(promOpts *PromOpts) MetricsServerOpts {
+	opts := MetricsServerOpts{
+		Addr:     c.MetricsServer.Addr,
+		Path:     c.MetricsServer.Path,
+		Compress: c.MetricsServer.Compress,
+		TLS:      c.MetricsServer.TLS,
+	}
+	if promOpts != nil {
+		opts.Gatherer = promOpts.Gatherer()
+	}
+	return opts
+}
@@ -0,0 +1,174 @@
+package ginprom
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     func(opts *PromOpts)
+		wantAddr string
+	}{
+		{"empty", "", func(opts *PromOpts) {}, ""},
+		{"yaml", `
+namespace: shop
+subsystem: api
+exclude_status: ^404$
+exclude_paths: [/healthz, /static/*]
+duration_buckets: [0.01, 0.1, 1]
+duration_bucket_preset: batch
+const_labels:
+  env: production
+metrics_server:
+  addr: ":9100"
+  tls: {cert_file: server.pem, key_file: server-key.pem, client_ca_file: ca.pem, client_sans: [prometheus]}
+`, func(opts *PromOpts) {
+			opts.Namespace, opts.Subsystem, opts.ExcludeRegexStatus = "shop", "api", "^404$"
+			opts.ExcludePaths = []string{"/healthz", "/static/*"}
+			opts.DurationBuckets, opts.DurationBucketPreset = []float64{0.01, 0.1, 1}, BucketsBatch
+			opts.ConstLabels = prometheus.Labels{"env": "production"}
+		}, ":9100"},
+		{"json", `{
+	"exclude_method": "OPTIONS",
+	"include_only_paths": ["/api/*"],
+	"size_buckets": [100, 10000],
+	"metrics_server": {"addr": ":2113", "path": "/internal/metrics", "compress": true}
+}`, func(opts *PromOpts) {
+			opts.ExcludeRegexMethod = "OPTIONS"
+			opts.IncludeOnlyPaths = []string{"/api/*"}
+			opts.SizeBuckets = []float64{100, 10000}
+		}, ":2113"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := config.PromOpts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := NewDefaultOpts()
+			tt.want(want)
+			if !reflect.DeepEqual(configOpts(got), configOpts(want)) {
+				t.Errorf("got %+v, want %+v", configOpts(got), configOpts(want))
+			}
+			if addr := config.MetricsServerOpts(nil).Addr; addr != tt.wantAddr {
+				t.Errorf("got metrics server address %q, want %q", addr, tt.wantAddr)
+			}
+		})
+	}
+}
+
+// configOpts returns the options set by Config.PromOpts
+func configOpts(opts *PromOpts) []any {
+	return append(envOpts(opts), opts.ConstLabels)
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"syntax", "namespace: [shop", "invalid configuration"},
+		{"unknown setting", "namespaces: shop", "namespaces"},
+		{"type", "duration_buckets: fast", "invalid configuration"},
+		{"regex", "exclude_endpoint: '[a-'", "exclude_endpoint"},
+		{"unordered buckets", "size_buckets: [1000, 100]", "size_buckets"},
+		{"bucket preset", "duration_bucket_preset: api-medium", "api-medium"},
+		{"const label", "const_labels: {method: GET}", `"method"`},
+		{"invalid const label", "const_labels: {0env: prod}", `"0env"`},
+		{"endpoint rewrite", "endpoint_rewrites: [{pattern: '(x', replacement: y}]", "endpoint_rewrites"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tt.data))
+			if err == nil || config != nil {
+				t.Fatalf("got %v, want an error", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %q, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "ginprom.yaml")
+	if err := os.WriteFile(valid, []byte("namespace: shop\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"size_buckets": [2, 1]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"invalid", invalid, true},
+		{"missing", filepath.Join(dir, "missing.yaml"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadConfig(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want an error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.path) {
+				t.Errorf("got %q, want it to name the file", err)
+			}
+			if err == nil && config.Namespace != "shop" {
+				t.Errorf("got namespace %q, want shop", config.Namespace)
+			}
+		})
+	}
+}
+
+func TestConfigEndpointRewrites(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+endpoint_rewrites:
+  - {pattern: "^/v[0-9]+/", replacement: /}
+  - {pattern: "^/(users|accounts)/", replacement: /people/}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := config.PromOpts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"/v2/users/:id", "/people/:id"},
+		{"/accounts", "/accounts"},
+		{"/v1/orders", "/orders"},
+	}
+	for _, tt := range tests {
+		got := tt.endpoint
+		for _, normalize := range opts.EndpointNormalizers {
+			got = normalize(got)
+		}
+		if got != tt.want {
+			t.Errorf("got %q for %q, want %q", got, tt.endpoint, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package ginprom
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Files the container ID is read from, variables so they can be pointed elsewhere
+var (
+	CgroupFile    = "/proc/self/cgroup"
+	MountinfoFile = "/proc/self/mountinfo"
+)
+
+// ErrNoContainer is returned when the process doesn't seem to run in a container
+var ErrNoContainer = errors.New("ginprom: container ID not found")
+
+var (
+	cgroupContainerID    = regexp.MustCompile(`([0-9a-f]{64})(?:\.scope)?$`)
+	mountinfoContainerID = regexp.MustCompile(`/(?:containers|overlay-containers)/([0-9a-f]{64})/`)
+)
+
+// containerRuntimes maps a marker found next to the container ID to the runtime
+var containerRuntimes = []struct {
+	marker  string
+	runtime string
+}{
+	{"docker", "docker"},
+	{"containerd", "containerd"},
+	{"crio", "cri-o"},
+	{"libpod", "podman"},
+	{"overlay-containers", "podman"},
+}
+
+// ContainerID returns the ID of the container the process runs in and its runtime when
+// known, read from the cgroup paths, or from the mounts for cgroup v2 namespaces which
+// hide the path
+func ContainerID() (id, runtime string, err error) {
+	for _, source := range []struct {
+		file  string
+		parse func(r io.Reader) (string, string)
+	}{
+		{CgroupFile, parseCgroup},
+		{MountinfoFile, parseMountinfo},
+	} {
+		f, err := os.Open(source.file)
+		if err != nil {
+			continue
+		}
+		id, runtime = source.parse(f)
+		f.Close()
+		if id != "" {
+			return id, runtime, nil
+		}
+	}
+	return "", "", ErrNoContainer
+}
+
+// parseCgroup finds the container ID in lines like 0::/system.slice/docker-<id>.scope
+func parseCgroup(r io.Reader) (id, runtime string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if m := cgroupContainerID.FindStringSubmatch(parts[2]); m != nil {
+			return m[1], containerRuntime(parts[2])
+		}
+	}
+	return "", ""
+}
+
+// parseMountinfo finds the container ID in the path of the hostname or resolv.conf mounts,
+// e.g. /var/lib/docker/containers/<id>/hostname
+func parseMountinfo(r io.Reader) (id, runtime string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := mountinfoContainerID.FindStringSubmatch(line); m != nil {
+			return m[1], containerRuntime(line)
+		}
+	}
+	return "", ""
+}
+
+func containerRuntime(path string) string {
+	for _, r := range containerRuntimes {
+		if strings.Contains(path, r.marker) {
+			return r.runtime
+		}
+	}
+	return ""
+}
+
+// NewContainerInfo returns a gauge always 1 labelled with the container_id and runtime
+// of the process, it still needs to be registered
+func NewContainerInfo() (prometheus.Collector, error) {
+	id, runtime, err := ContainerID()
+	if err != nil {
+		return nil, err
+	}
+
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "container_info",
+		Help:        "Container the service runs in, always 1",
+		ConstLabels: prometheus.Labels{"container_id": id, "runtime": runtime},
+	})
+	info.Set(1)
+	return info, nil
+}
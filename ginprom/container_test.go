@@ -0,0 +1,130 @@
+package ginprom
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testContainerID = "4f6c1e0d3b2a19887766554433221100ffeeddccbbaa99887766554433221100"
+
+func TestParseCgroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		cgroup      string
+		wantID      string
+		wantRuntime string
+	}{
+		{
+			name:        "docker cgroup v1",
+			cgroup:      "12:memory:/docker/" + testContainerID + "\n11:cpu:/docker/" + testContainerID,
+			wantID:      testContainerID,
+			wantRuntime: "docker",
+		},
+		{
+			name:        "systemd docker scope",
+			cgroup:      "0::/system.slice/docker-" + testContainerID + ".scope",
+			wantID:      testContainerID,
+			wantRuntime: "docker",
+		},
+		{
+			name:        "kubernetes containerd",
+			cgroup:      "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/cri-containerd-" + testContainerID + ".scope",
+			wantID:      testContainerID,
+			wantRuntime: "containerd",
+		},
+		{
+			name:        "kubernetes cri-o",
+			cgroup:      "0::/kubepods.slice/crio-" + testContainerID + ".scope",
+			wantID:      testContainerID,
+			wantRuntime: "cri-o",
+		},
+		{
+			name:   "cgroup v2 namespace",
+			cgroup: "0::/",
+		},
+		{
+			name:   "host",
+			cgroup: "0::/user.slice/user-1000.slice/session-2.scope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, runtime := parseCgroup(strings.NewReader(tt.cgroup))
+			if id != tt.wantID || runtime != tt.wantRuntime {
+				t.Errorf("got %q, %q, want %q, %q", id, runtime, tt.wantID, tt.wantRuntime)
+			}
+		})
+	}
+}
+
+func TestParseMountinfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		mountinfo   string
+		wantID      string
+		wantRuntime string
+	}{
+		{
+			name:        "docker",
+			mountinfo:   "583 560 254:1 /var/lib/docker/containers/" + testContainerID + "/hostname /etc/hostname rw,relatime - ext4 /dev/vda1 rw",
+			wantID:      testContainerID,
+			wantRuntime: "docker",
+		},
+		{
+			name:        "podman",
+			mountinfo:   "712 690 0:45 /containers/storage/overlay-containers/" + testContainerID + "/userdata/hostname /etc/hostname rw - tmpfs tmpfs rw",
+			wantID:      testContainerID,
+			wantRuntime: "podman",
+		},
+		{
+			name:      "no container mount",
+			mountinfo: "22 1 254:1 / / rw,relatime - ext4 /dev/vda1 rw",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, runtime := parseMountinfo(strings.NewReader(tt.mountinfo))
+			if id != tt.wantID || runtime != tt.wantRuntime {
+				t.Errorf("got %q, %q, want %q, %q", id, runtime, tt.wantID, tt.wantRuntime)
+			}
+		})
+	}
+}
+
+func TestNewContainerInfo(t *testing.T) {
+	dir := t.TempDir()
+	cgroup, mountinfo := filepath.Join(dir, "cgroup"), filepath.Join(dir, "mountinfo")
+	if err := os.WriteFile(cgroup, []byte("0::/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(c, m string) { CgroupFile, MountinfoFile = c, m }(CgroupFile, MountinfoFile)
+	CgroupFile, MountinfoFile = cgroup, mountinfo
+
+	if _, err := NewContainerInfo(); err != ErrNoContainer {
+		t.Fatalf("got %v, want ErrNoContainer", err)
+	}
+
+	line := "583 560 254:1 /var/lib/docker/containers/" + testContainerID + "/hostname /etc/hostname rw - ext4 /dev/vda1 rw\n"
+	if err := os.WriteFile(mountinfo, []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewContainerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP service_container_info Container the service runs in, always 1
+# TYPE service_container_info gauge
+service_container_info{container_id="` + testContainerID + `",runtime="docker"} 1
+`
+	if err := testutil.CollectAndCompare(info, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,132 @@
+package ginprom
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// EngineOpts configures New
+type EngineOpts struct {
+	// PromOpts are the options of the middleware, NewDefaultOpts if nil
+	PromOpts *PromOpts
+	// MetricsPath is the path of the metrics on the engine, /metrics if empty
+	MetricsPath string
+	// Gatherer supplies the metrics served at MetricsPath, the registry of PromOpts if nil,
+	// like the Gatherers of several engines sharing one metrics output
+	Gatherer prometheus.Gatherer
+	// SkipMetricsRoute only installs the middleware, the metrics being served by another
+	// engine or a MetricsServer
+	SkipMetricsRoute bool
+	// Auth protects the metrics when set, see PromHandlerWithAuth
+	Auth *HandlerAuth
+	// Allowlist restricts the metrics to the scrapers of its networks when set, see
+	// IPAllowlistMiddleware
+	Allowlist *IPAllowlist
+	// Collectors are registered with PromOpts.Registerer, like the collectors of the
+	// application or a Maintenance
+	Collectors []prometheus.Collector
+}
+
+// Metrics is the handle of the metrics New installed on an engine
+type Metrics struct {
+	registerer prometheus.Registerer
+	collectors []prometheus.Collector
+	once       sync.Once
+}
+
+// New installs the middleware on engine, serves the metrics it gathers at opts.MetricsPath
+// and registers opts.Collectors, in one call for the services without special needs. The
+// middleware only records the routes added after it, so New is called before them. The
+// scrapes are instrumented by PromHandler rather than recorded as requests. Nothing is
+// installed or left registered when it returns an error
+func New(engine *gin.Engine, opts *EngineOpts) (*Metrics, error) {
+	if opts == nil {
+		opts = &EngineOpts{}
+	}
+	promOpts := opts.PromOpts
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	path := opts.MetricsPath
+	if path == "" {
+		path = defaultMetricsPath
+	}
+
+	r := promOpts.registration()
+	for _, c := range opts.Collectors {
+		registerOrReuse(r, c)
+	}
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	m := &Metrics{registerer: r.registerer(), collectors: r.added}
+
+	// the middleware records the scrapes apart from the requests of the API
+	withoutScrapes := *promOpts
+	if !opts.SkipMetricsRoute {
+		withoutScrapes.ExcludePaths = append(append([]string(nil), promOpts.ExcludePaths...), path)
+	}
+	mw, err := NewPromMiddleware(&withoutScrapes)
+	if err != nil {
+		m.unregister()
+		return nil, err
+	}
+	if opts.SkipMetricsRoute {
+		engine.Use(mw)
+		return m, nil
+	}
+	var handlers []gin.HandlerFunc
+	if opts.Allowlist != nil {
+		allow, err := NewIPAllowlistMiddleware(*opts.Allowlist)
+		if err != nil {
+			m.unregister()
+			return nil, err
+		}
+		handlers = append(handlers, allow)
+	}
+	var auth *HandlerAuth
+	if opts.Auth != nil {
+		copied := *opts.Auth
+		if err := copied.validate(); err != nil {
+			m.unregister()
+			return nil, err
+		}
+		auth = &copied
+	}
+	// the scrapes are instrumented in the registry of the engine
+	scrapes, err := scrapeMetricsFor(promOpts)
+	if err != nil {
+		m.unregister()
+		return nil, err
+	}
+	gatherer := opts.Gatherer
+	if gatherer == nil {
+		gatherer = promOpts.Gatherer()
+	}
+	h := scrapeHandler(registryHandler(gatherer), scrapes)
+	if auth != nil {
+		h = auth.protect(h)
+	}
+
+	engine.Use(mw)
+	engine.GET(path, append(handlers, h)...)
+	return m, nil
+}
+
+// Close unregisters the collectors of EngineOpts.Collectors and stops the goroutines of
+// the middlewares, see Close. The installed middleware keeps recording
+func (m *Metrics) Close() {
+	m.once.Do(func() {
+		m.unregister()
+		Close()
+	})
+}
+
+// unregister unregisters the collectors registered by New
+func (m *Metrics) unregister() {
+	for _, c := range m.collectors {
+		m.registerer.Unregister(c)
+	}
+}
@@ -0,0 +1,208 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       func(opts *EngineOpts)
+		path       string
+		authorize  func(r *http.Request)
+		wantStatus int
+	}{
+		{"default path", func(opts *EngineOpts) {}, "/metrics", func(r *http.Request) {}, http.StatusOK},
+		{"custom path", func(opts *EngineOpts) { opts.MetricsPath = "/internal/metrics" }, "/internal/metrics",
+			func(r *http.Request) {}, http.StatusOK},
+		{"auth", func(opts *EngineOpts) { opts.Auth = &HandlerAuth{VerifyToken: StaticToken("t0ken")} }, "/metrics",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, http.StatusOK},
+		{"unauthorized", func(opts *EngineOpts) { opts.Auth = &HandlerAuth{VerifyToken: StaticToken("t0ken")} }, "/metrics",
+			func(r *http.Request) {}, http.StatusUnauthorized},
+		// httptest requests come from 192.0.2.1
+		{"allowed network", func(opts *EngineOpts) { opts.Allowlist = &IPAllowlist{Networks: []string{"192.0.2.0/24"}} },
+			"/metrics", func(r *http.Request) {}, http.StatusOK},
+		{"forbidden network", func(opts *EngineOpts) { opts.Allowlist = &IPAllowlist{Networks: PrivateNetworks} },
+			"/metrics", func(r *http.Request) {}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			promOpts := NewDefaultOpts()
+			promOpts.Registerer = reg
+			app := prometheus.NewCounter(prometheus.CounterOpts{Name: "app_orders_total", Help: "help"})
+			opts := &EngineOpts{PromOpts: promOpts, Collectors: []prometheus.Collector{app}}
+			tt.opts(opts)
+			r := gin.New()
+			m, err := New(r, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+			r.GET("/users", listUsers)
+			serve(r, http.MethodGet, "/users")
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			tt.authorize(req)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK {
+				for _, want := range []string{`service_http_request_count_total{endpoint="/users"`, "app_orders_total"} {
+					if !strings.Contains(w.Body.String(), want) {
+						t.Errorf("got no %s in the metrics", want)
+					}
+				}
+			}
+			// the scrapes aren't recorded as requests
+			if count, err := testutil.GatherAndCount(reg, "service_http_request_count_total"); err != nil || count != 1 {
+				t.Errorf("got %d request series, want 1: %v", count, err)
+			}
+
+			m.Close()
+			if count, err := testutil.GatherAndCount(reg, "app_orders_total"); err != nil || count != 0 {
+				t.Errorf("got %d series of the collectors once closed, want none: %v", count, err)
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(reg *prometheus.Registry, opts *EngineOpts)
+	}{
+		{"conflicting collector", func(reg *prometheus.Registry, opts *EngineOpts) {
+			reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "app_orders_total", Help: "other"}))
+		}},
+		{"invalid options", func(reg *prometheus.Registry, opts *EngineOpts) {
+			opts.PromOpts.DurationBucketPreset = "api-medium"
+		}},
+		{"empty auth", func(reg *prometheus.Registry, opts *EngineOpts) { opts.Auth = &HandlerAuth{} }},
+		{"invalid allowlist", func(reg *prometheus.Registry, opts *EngineOpts) {
+			opts.Allowlist = &IPAllowlist{Networks: []string{"10.0.0.0/33"}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			promOpts := NewDefaultOpts()
+			promOpts.Registerer = reg
+			// users is registered before orders conflicts
+			users := prometheus.NewCounter(prometheus.CounterOpts{Name: "app_users_total", Help: "help"})
+			orders := prometheus.NewCounter(prometheus.CounterOpts{Name: "app_orders_total", Help: "help"})
+			opts := &EngineOpts{PromOpts: promOpts, Collectors: []prometheus.Collector{users, orders}}
+			tt.opts(reg, opts)
+			r := gin.New()
+			if m, err := New(r, opts); err == nil || m != nil {
+				t.Fatalf("got %v, want an error", err)
+			}
+			if reg.Unregister(users) {
+				t.Error("got the collectors left registered")
+			}
+			if len(r.Handlers) != 0 || len(r.Routes()) != 0 {
+				t.Error("got the middleware or the metrics installed")
+			}
+		})
+	}
+}
+
+func TestNewEngines(t *testing.T) {
+	tests := []struct {
+		name   string
+		shared bool
+		// combined serves the metrics of both engines on the public one
+		combined      bool
+		public, admin func(opts *EngineOpts)
+		adminPath     string
+		wantAdmin     int
+		want, notWant []string
+	}{
+		{"shared registry", true, false, func(opts *EngineOpts) {
+			opts.PromOpts.ConstLabels = prometheus.Labels{"app": "public"}
+		}, func(opts *EngineOpts) {
+			opts.PromOpts.ConstLabels = prometheus.Labels{"app": "admin"}
+			opts.SkipMetricsRoute = true
+		}, "/metrics", http.StatusNotFound, []string{
+			`service_http_request_count_total{app="admin",endpoint="/users"`,
+			`service_http_request_count_total{app="public",endpoint="/users"`,
+		}, nil},
+		{"combined registries", false, true, func(opts *EngineOpts) {
+			opts.PromOpts.Namespace = "public"
+		}, func(opts *EngineOpts) {
+			opts.PromOpts.Namespace = "admin"
+			opts.SkipMetricsRoute = true
+		}, "/metrics", http.StatusNotFound, []string{
+			`public_http_request_count_total{endpoint="/users"`,
+			`admin_http_request_count_total{endpoint="/users"`,
+		}, nil},
+		{"own metrics routes", false, false, func(opts *EngineOpts) {
+			opts.PromOpts.Namespace = "public"
+		}, func(opts *EngineOpts) {
+			opts.PromOpts.Namespace = "admin"
+			opts.MetricsPath = "/admin/metrics"
+		}, "/admin/metrics", http.StatusOK,
+			[]string{`public_http_request_count_total{endpoint="/users"`}, []string{"admin_http"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shared := prometheus.NewRegistry()
+			newOpts := func(configure func(opts *EngineOpts)) *EngineOpts {
+				promOpts := NewDefaultOpts()
+				promOpts.Registerer = shared
+				if !tt.shared {
+					promOpts.Registerer = prometheus.NewRegistry()
+				}
+				opts := &EngineOpts{PromOpts: promOpts}
+				configure(opts)
+				return opts
+			}
+			adminOpts, publicOpts := newOpts(tt.admin), newOpts(tt.public)
+			if tt.combined {
+				publicOpts.Gatherer = Gatherers(publicOpts.PromOpts, adminOpts.PromOpts)
+			}
+			var engines []*gin.Engine
+			for _, opts := range []*EngineOpts{publicOpts, adminOpts} {
+				r := gin.New()
+				m, err := New(r, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer m.Close()
+				r.GET("/users", listUsers)
+				serve(r, http.MethodGet, "/users")
+				engines = append(engines, r)
+			}
+
+			w := serve(engines[0], http.MethodGet, "/metrics")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want 200", w.Code)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("got no %s in the metrics", want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(w.Body.String(), notWant) {
+					t.Errorf("got %s in the metrics", notWant)
+				}
+			}
+			if w := serve(engines[1], http.MethodGet, tt.adminPath); w.Code != tt.wantAdmin {
+				t.Errorf("got status %d for the admin metrics, want %d", w.Code, tt.wantAdmin)
+			}
+		})
+	}
+}
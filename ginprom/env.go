@@ -0,0 +1,116 @@
+package ginprom
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the environment variables of OptsFromEnv and MetricsServerOptsFromEnv
+const (
+	EnvNamespace        = "GINPROM_NAMESPACE"
+	EnvSubsystem        = "GINPROM_SUBSYSTEM"
+	EnvExcludeStatus    = "GINPROM_EXCLUDE_STATUS"
+	EnvExcludeEndpoint  = "GINPROM_EXCLUDE_ENDPOINT"
+	EnvExcludeMethod    = "GINPROM_EXCLUDE_METHOD"
+	EnvExcludePaths     = "GINPROM_EXCLUDE_PATHS"
+	EnvIncludeOnlyPaths = "GINPROM_INCLUDE_ONLY_PATHS"
+	EnvDurationBuckets  = "GINPROM_DURATION_BUCKETS"
+	EnvBucketPreset     = "GINPROM_DURATION_BUCKET_PRESET"
+	EnvSizeBuckets      = "GINPROM_SIZE_BUCKETS"
+	EnvMetricsAddr      = "GINPROM_METRICS_ADDR"
+	EnvMetricsPath      = "GINPROM_METRICS_PATH"
+)
+
+// OptsFromEnv returns the NewDefaultOpts options with the namespace, subsystem, exclude
+// regexes, path lists and buckets set by the GINPROM_* environment variables, like
+// GINPROM_EXCLUDE_PATHS=/healthz,/static/* and GINPROM_DURATION_BUCKETS=0.01,0.1,1,
+// so the containers are tuned without code changes. The lists are comma separated
+func OptsFromEnv() (*PromOpts, error) {
+	opts := NewDefaultOpts()
+	opts.Namespace = os.Getenv(EnvNamespace)
+	opts.Subsystem = os.Getenv(EnvSubsystem)
+
+	for env, regex := range map[string]*string{
+		EnvExcludeStatus:   &opts.ExcludeRegexStatus,
+		EnvExcludeEndpoint: &opts.ExcludeRegexEndpoint,
+		EnvExcludeMethod:   &opts.ExcludeRegexMethod,
+	} {
+		*regex = os.Getenv(env)
+		if err := checkRegex(env, *regex); err != nil {
+			return nil, err
+		}
+	}
+	opts.ExcludePaths = envList(EnvExcludePaths)
+	opts.IncludeOnlyPaths = envList(EnvIncludeOnlyPaths)
+
+	var err error
+	if opts.DurationBuckets, err = envBuckets(EnvDurationBuckets); err != nil {
+		return nil, err
+	}
+	if opts.SizeBuckets, err = envBuckets(EnvSizeBuckets); err != nil {
+		return nil, err
+	}
+	opts.DurationBucketPreset = os.Getenv(EnvBucketPreset)
+	if err := opts.validateBucketPreset(); err != nil {
+		return nil, fmt.Errorf("%w in %s", err, EnvBucketPreset)
+	}
+	return opts, nil
+}
+
+// MetricsServerOptsFromEnv returns the options of a MetricsServer with the address and
+// path set by GINPROM_METRICS_ADDR and GINPROM_METRICS_PATH, serving the metrics of promOpts
+func MetricsServerOptsFromEnv(promOpts *PromOpts) MetricsServerOpts {
+	opts := MetricsServerOpts{Addr: os.Getenv(EnvMetricsAddr), Path: os.Getenv(EnvMetricsPath)}
+	if promOpts != nil {
+		opts.Gatherer = promOpts.Gatherer()
+	}
+	return opts
+}
+
+// envList returns the comma separated values of the environment variable env
+func envList(env string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(env), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envBuckets returns the comma separated buckets of the environment variable env
+func envBuckets(env string) ([]float64, error) {
+	var buckets []float64
+	for _, value := range envList(env) {
+		bucket, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ginprom: %s: invalid bucket %q", env, value)
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err := checkBuckets(env, buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// checkRegex returns an error naming the setting when regex doesn't compile
+func checkRegex(setting, regex string) error {
+	if _, err := regexp.Compile(regex); err != nil {
+		return fmt.Errorf("ginprom: %s: %w", setting, err)
+	}
+	return nil
+}
+
+// checkBuckets returns an error naming the setting when the buckets aren't increasing
+func checkBuckets(setting string, buckets []float64) error {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("ginprom: %s: the buckets must be increasing", setting)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package ginprom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// envOpts returns the options set by OptsFromEnv
+func envOpts(opts *PromOpts) []any {
+	return []any{opts.Namespace, opts.Subsystem, opts.ExcludeRegexStatus, opts.ExcludeRegexEndpoint,
+		opts.ExcludeRegexMethod, opts.ExcludePaths, opts.IncludeOnlyPaths, opts.DurationBuckets, opts.DurationBucketPreset, opts.SizeBuckets}
+}
+
+func TestOptsFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want func(opts *PromOpts)
+	}{
+		{"unset", nil, func(opts *PromOpts) {}},
+		{"namespace", map[string]string{EnvNamespace: "shop", EnvSubsystem: "api"}, func(opts *PromOpts) {
+			opts.Namespace, opts.Subsystem = "shop", "api"
+		}},
+		{"exclude regexes", map[string]string{
+			EnvExcludeStatus:   "^404$",
+			EnvExcludeEndpoint: "^/healthz$",
+			EnvExcludeMethod:   "OPTIONS",
+		}, func(opts *PromOpts) {
+			opts.ExcludeRegexStatus, opts.ExcludeRegexEndpoint, opts.ExcludeRegexMethod = "^404$", "^/healthz$", "OPTIONS"
+		}},
+		{"paths", map[string]string{EnvExcludePaths: "/healthz, /static/*,", EnvIncludeOnlyPaths: "/api/*"}, func(opts *PromOpts) {
+			opts.ExcludePaths, opts.IncludeOnlyPaths = []string{"/healthz", "/static/*"}, []string{"/api/*"}
+		}},
+		{"buckets", map[string]string{EnvDurationBuckets: "0.01, 0.1,1", EnvSizeBuckets: "100,1e4"}, func(opts *PromOpts) {
+			opts.DurationBuckets, opts.SizeBuckets = []float64{0.01, 0.1, 1}, []float64{100, 1e4}
+		}},
+		{"bucket preset", map[string]string{EnvBucketPreset: BucketsAPISlow}, func(opts *PromOpts) {
+			opts.DurationBucketPreset = BucketsAPISlow
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := OptsFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := NewDefaultOpts()
+			tt.want(want)
+			if !reflect.DeepEqual(envOpts(got), envOpts(want)) {
+				t.Errorf("got %+v, want %+v", envOpts(got), envOpts(want))
+			}
+		})
+	}
+}
+
+func TestOptsFromEnvInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		val  string
+	}{
+		{"status regex", EnvExcludeStatus, "(404"},
+		{"endpoint regex", EnvExcludeEndpoint, "[a-"},
+		{"method regex", EnvExcludeMethod, "*GET"},
+		{"bucket", EnvDurationBuckets, "0.1,fast"},
+		{"unordered buckets", EnvDurationBuckets, "1,0.1"},
+		{"duplicate buckets", EnvSizeBuckets, "100,100"},
+		{"bucket preset", EnvBucketPreset, "api-medium"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.env, tt.val)
+			if opts, err := OptsFromEnv(); err == nil || opts != nil {
+				t.Errorf("got %v, want an error", err)
+			}
+		})
+	}
+}
+
+func TestMetricsServerOptsFromEnv(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tests := []struct {
+		name     string
+		env      map[string]string
+		promOpts *PromOpts
+		want     MetricsServerOpts
+	}{
+		{"unset", nil, nil, MetricsServerOpts{}},
+		{"address and path", map[string]string{EnvMetricsAddr: ":9100", EnvMetricsPath: "/internal/metrics"}, nil,
+			MetricsServerOpts{Addr: ":9100", Path: "/internal/metrics"}},
+		{"gatherer", nil, &PromOpts{Registerer: reg}, MetricsServerOpts{Gatherer: reg}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if got := MetricsServerOptsFromEnv(tt.promOpts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package ginprom
+
+import "github.com/gin-gonic/gin"
+
+// errorTypeLabel returns the type label of a gin error, the bind and render failures
+// taking precedence over their visibility
+func errorTypeLabel(t gin.ErrorType) string {
+	switch {
+	case t&gin.ErrorTypeBind != 0:
+		return "bind"
+	case t&gin.ErrorTypeRender != 0:
+		return "render"
+	case t&gin.ErrorTypePublic != 0:
+		return "public"
+	case t&gin.ErrorTypePrivate != 0:
+		return "private"
+	}
+	return "other"
+}
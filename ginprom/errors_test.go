@@ -0,0 +1,84 @@
+package ginprom
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestErrorTypeLabel(t *testing.T) {
+	tests := []struct {
+		typ  gin.ErrorType
+		want string
+	}{
+		{gin.ErrorTypePrivate, "private"},
+		{gin.ErrorTypePublic, "public"},
+		{gin.ErrorTypeBind, "bind"},
+		{gin.ErrorTypeBind | gin.ErrorTypePublic, "bind"},
+		{gin.ErrorTypeRender, "render"},
+		{gin.ErrorTypePublic | gin.ErrorTypePrivate, "public"},
+		{gin.ErrorTypeNu, "public"},
+		{1 << 10, "other"},
+	}
+
+	for _, tt := range tests {
+		if got := errorTypeLabel(tt.typ); got != tt.want {
+			t.Errorf("errorTypeLabel(%d) = %q, want %q", tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestPromOptsCountHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		want    map[string]float64
+	}{
+		{"none", func(c *gin.Context) { c.Status(http.StatusOK) }, map[string]float64{}},
+		{"private with a success", func(c *gin.Context) {
+			c.Error(errors.New("cache miss"))
+			c.Status(http.StatusOK)
+		}, map[string]float64{"private": 1}},
+		{"several", func(c *gin.Context) {
+			c.Error(errors.New("cache miss"))
+			c.Error(errors.New("bad input")).SetType(gin.ErrorTypePublic)
+			c.Error(errors.New("stale")).SetType(gin.ErrorTypePublic)
+			c.Status(http.StatusOK)
+		}, map[string]float64{"private": 1, "public": 2}},
+		{"bind", func(c *gin.Context) {
+			var body struct {
+				Name string `json:"name" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.Error(err).SetType(gin.ErrorTypeBind)
+			}
+			c.Status(http.StatusBadRequest)
+		}, map[string]float64{"bind": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.CountHandlerErrors = true
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/errors", tt.handler)
+			serve(r, http.MethodGet, "/errors")
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, typ := range []string{"bind", "render", "public", "private", "other"} {
+				if got := testutil.ToFloat64(m.handlerErrors.WithLabelValues("/errors", typ)); got != tt.want[typ] {
+					t.Errorf("got %v %s errors, want %v", got, typ, tt.want[typ])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package ginprom
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TraceParentHeader is the W3C trace context header
+const TraceParentHeader = "traceparent"
+
+// ExemplarTraceIDLabel is the label of the trace ID in the exemplars
+const ExemplarTraceIDLabel = "trace_id"
+
+// TraceIDHeader returns a PromOpts.TraceIDFn reading the trace ID of the requests from
+// header, which is parsed when it's TraceParentHeader
+func TraceIDHeader(header string) RequestLabelMappingFn {
+	if strings.EqualFold(header, TraceParentHeader) {
+		return func(c *gin.Context) string {
+			return parseTraceParent(c.GetHeader(TraceParentHeader))
+		}
+	}
+	return func(c *gin.Context) string {
+		return c.GetHeader(header)
+	}
+}
+
+// parseTraceParent returns the trace ID of a traceparent header,
+// like 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01, empty if it's invalid
+func parseTraceParent(value string) string {
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 {
+		return ""
+	}
+	traceID := parts[1]
+	if !isLowerHex(parts[0]) || !isLowerHex(traceID) || strings.Trim(traceID, "0") == "" {
+		return ""
+	}
+	return traceID
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// exemplarLabels returns the exemplar labels of traceID, nil when there is none
+// or it's too long to be an exemplar
+func exemplarLabels(traceID string) prometheus.Labels {
+	if traceID == "" || !utf8.ValidString(traceID) ||
+		utf8.RuneCountInString(traceID)+len(ExemplarTraceIDLabel) > prometheus.ExemplarMaxRunes {
+		return nil
+	}
+	return prometheus.Labels{ExemplarTraceIDLabel: traceID}
+}
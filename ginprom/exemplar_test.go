@@ -0,0 +1,178 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTraceIDHeader(t *testing.T) {
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{"traceparent", TraceParentHeader, "00-" + traceID + "-00f067aa0ba902b7-01", traceID},
+		{"case insensitive header", "Traceparent", "00-" + traceID + "-00f067aa0ba902b7-01", traceID},
+		{"future version", TraceParentHeader, "cc-" + traceID + "-00f067aa0ba902b7-01-extra", traceID},
+		{"invalid version", TraceParentHeader, "ff-" + traceID + "-00f067aa0ba902b7-01", ""},
+		{"zero trace ID", TraceParentHeader, "00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01", ""},
+		{"upper case trace ID", TraceParentHeader, "00-" + strings.ToUpper(traceID) + "-00f067aa0ba902b7-01", ""},
+		{"short trace ID", TraceParentHeader, "00-4bf92f35-00f067aa0ba902b7-01", ""},
+		{"missing", TraceParentHeader, "", ""},
+		{"custom header", "X-Trace-Id", "abc123", "abc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.value != "" {
+				c.Request.Header.Set(tt.header, tt.value)
+			}
+			if got := TraceIDHeader(tt.header)(c); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExemplarLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		traceID string
+		want    bool
+	}{
+		{"trace ID", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"empty", "", false},
+		{"longest", strings.Repeat("a", prometheus.ExemplarMaxRunes-len(ExemplarTraceIDLabel)), true},
+		{"too long", strings.Repeat("a", prometheus.ExemplarMaxRunes), false},
+		{"invalid UTF-8", "\xff", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := exemplarLabels(tt.traceID)
+			if got := labels != nil; got != tt.want {
+				t.Fatalf("got labels %v", labels)
+			}
+			if tt.want && labels[ExemplarTraceIDLabel] != tt.traceID {
+				t.Errorf("got labels %v", labels)
+			}
+		})
+	}
+}
+
+func TestPromOptsTraceIDFn(t *testing.T) {
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name         string
+		opts         func(opts *PromOpts)
+		traced       bool
+		wantExemplar bool
+	}{
+		{"histogram", func(opts *PromOpts) {}, true, true},
+		{"no trace", func(opts *PromOpts) {}, false, false},
+		{"native histogram", func(opts *PromOpts) { opts.DurationType = NativeHistogramMetric }, true, true},
+		{"summary", func(opts *PromOpts) { opts.DurationType = SummaryMetric }, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			var observed string
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.TraceIDFn = TraceIDHeader(TraceParentHeader)
+			opts.Observers = []Observer{observerFunc(func(o Observation) { observed = o.TraceID })}
+			tt.opts(opts)
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/traced", func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/traced", nil)
+			want := ""
+			if tt.traced {
+				req.Header.Set(TraceParentHeader, "00-"+traceID+"-00f067aa0ba902b7-01")
+				want = traceID
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if observed != want {
+				t.Errorf("got observed trace ID %q, want %q", observed, want)
+			}
+			if !tt.wantExemplar {
+				want = ""
+			}
+			checkDurationExemplar(t, reg, want)
+		})
+	}
+}
+
+func TestMetricsObserveExemplar(t *testing.T) {
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name  string
+		batch time.Duration
+	}{
+		{"direct", 0},
+		{"batched", time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.BatchInterval = tt.batch
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.observe(http.StatusOK, "/traced", http.MethodGet, nil, 0.1, 10, 20, traceID)
+			if m.batch != nil {
+				m.batch.flush()
+			}
+			checkDurationExemplar(t, reg, traceID)
+		})
+	}
+}
+
+// checkDurationExemplar checks that reg recorded a duration with the exemplar of traceID,
+// none if it's empty
+func checkDurationExemplar(t *testing.T, reg *prometheus.Registry, traceID string) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	var recorded uint64
+	for _, mf := range families {
+		if mf.GetName() != "service_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			recorded += metric.GetHistogram().GetSampleCount() + metric.GetSummary().GetSampleCount()
+			for _, bucket := range metric.GetHistogram().GetBucket() {
+				for _, lp := range bucket.GetExemplar().GetLabel() {
+					if lp.GetName() == ExemplarTraceIDLabel {
+						got = lp.GetValue()
+					}
+				}
+			}
+		}
+	}
+	if recorded != 1 {
+		t.Errorf("got %d durations, want 1", recorded)
+	}
+	if got != traceID {
+		t.Errorf("got exemplar trace ID %q, want %q", got, traceID)
+	}
+}
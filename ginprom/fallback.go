@@ -0,0 +1,118 @@
+package ginprom
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pusher pushes the metrics to a remote system, *push.Pusher of client_golang satisfies it
+type Pusher interface {
+	Push() error
+}
+
+// PushFallback is a Collector pushing the metrics while a ScrapeWatcher reports a scrape gap,
+// and stops once scrapes resume
+type PushFallback struct {
+	pusher   Pusher
+	interval time.Duration
+	// OnError is called with the errors returned by the pusher, if set
+	OnError func(err error)
+
+	mu      sync.Mutex
+	pushing chan struct{}
+
+	active *prometheus.GaugeVec
+	pushes *prometheus.CounterVec
+}
+
+// NewPushFallback returns a PushFallback hooked to watcher, pushing every interval during gaps,
+// the watcher interval if not positive. It still needs to be registered
+func NewPushFallback(watcher *ScrapeWatcher, pusher Pusher, interval time.Duration) *PushFallback {
+	if interval <= 0 {
+		interval = watcher.interval
+	}
+
+	f := &PushFallback{
+		pusher:   pusher,
+		interval: interval,
+		active: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: selfNamespace,
+			Name:      "push_fallback_active",
+			Help:      "1 while metrics are pushed because scrapes stopped",
+		}, nil),
+		pushes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: selfNamespace,
+			Name:      "push_fallback_pushes_total",
+			Help:      "Total number of pushes made by the push fallback.",
+		}, []string{"result"}),
+	}
+
+	watcher.OnGap(func(time.Time) { f.start() })
+	watcher.OnResume(f.Stop)
+	return f
+}
+
+// Describe implements prometheus.Collector
+func (f *PushFallback) Describe(ch chan<- *prometheus.Desc) {
+	f.active.Describe(ch)
+	f.pushes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (f *PushFallback) Collect(ch chan<- prometheus.Metric) {
+	f.active.Collect(ch)
+	f.pushes.Collect(ch)
+}
+
+// start begins pushing if it isn't already
+func (f *PushFallback) start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pushing != nil {
+		return
+	}
+	f.pushing = make(chan struct{})
+	f.active.WithLabelValues().Set(1)
+	go f.run(f.pushing)
+}
+
+// Stop stops pushing until the next scrape gap
+func (f *PushFallback) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pushing == nil {
+		return
+	}
+	close(f.pushing)
+	f.pushing = nil
+	f.active.WithLabelValues().Set(0)
+}
+
+func (f *PushFallback) run(stop chan struct{}) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		f.push()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (f *PushFallback) push() {
+	if err := f.pusher.Push(); err != nil {
+		f.pushes.WithLabelValues("error").Inc()
+		if f.OnError != nil {
+			f.OnError(err)
+		}
+		return
+	}
+	f.pushes.WithLabelValues("success").Inc()
+}
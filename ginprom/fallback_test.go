@@ -0,0 +1,82 @@
+package ginprom
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakePusher struct {
+	mu     sync.Mutex
+	pushes int
+	err    error
+}
+
+func (p *fakePusher) Push() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pushes++
+	return p.err
+}
+
+func (p *fakePusher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pushes
+}
+
+func TestPushFallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantResult string
+	}{
+		{"successful pushes", nil, "success"},
+		{"failing pushes", errors.New("unreachable"), "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watcher := NewScrapeWatcher(time.Hour, 1)
+			defer watcher.Stop()
+
+			pusher := &fakePusher{err: tt.err}
+			var errs int32
+			f := NewPushFallback(watcher, pusher, 0)
+			f.OnError = func(error) { atomic.AddInt32(&errs, 1) }
+			if f.interval != time.Hour {
+				t.Fatalf("interval = %v, want the watcher interval", f.interval)
+			}
+
+			f.start()
+			deadline := time.Now().Add(time.Second)
+			done := func() bool {
+				return testutil.ToFloat64(f.pushes.WithLabelValues(tt.wantResult)) == 1 &&
+					(tt.err == nil || atomic.LoadInt32(&errs) == 1)
+			}
+			for !done() && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			f.Stop()
+
+			if pusher.count() != 1 {
+				t.Errorf("got %d pushes, want 1", pusher.count())
+			}
+			if got := testutil.ToFloat64(f.pushes.WithLabelValues(tt.wantResult)); got != 1 {
+				t.Errorf("got %v %s pushes, want 1", got, tt.wantResult)
+			}
+			if got := testutil.ToFloat64(f.active); got != 0 {
+				t.Errorf("active = %v after Stop, want 0", got)
+			}
+			if tt.err != nil && atomic.LoadInt32(&errs) != 1 {
+				t.Errorf("OnError called %d times, want 1", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package ginprom
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuxiliaryMethodValue is the method label of the requests collapsed by AuxiliaryMethods
+const AuxiliaryMethodValue = "__auxiliary__"
+
+// DefaultAuxiliaryMethods are the methods collapsed by AuxiliaryMethods when none are set
+var DefaultAuxiliaryMethods = []string{http.MethodOptions, http.MethodHead}
+
+// AuxiliaryMethods records the requests of methods like OPTIONS and HEAD under
+// AuxiliaryMethodValue, or drops them, as they would otherwise double the method
+// cardinality and skew the latencies with their cheap answers
+type AuxiliaryMethods struct {
+	// Methods are the collapsed methods, DefaultAuxiliaryMethods if empty
+	Methods []string
+	// Drop skips the requests instead of recording them
+	Drop bool
+}
+
+// matches reports whether method is one of the auxiliary methods
+func (a *AuxiliaryMethods) matches(method string) bool {
+	methods := a.Methods
+	if len(methods) == 0 {
+		methods = DefaultAuxiliaryMethods
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// pathList matches the request paths against exact paths and, for the entries ending
+// with *, path prefixes
+type pathList struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+// newPathList returns the pathList of paths, nil when there are none
+func newPathList(paths []string) *pathList {
+	if len(paths) == 0 {
+		return nil
+	}
+	l := &pathList{exact: make(map[string]bool, len(paths))}
+	for _, path := range paths {
+		if prefix, ok := strings.CutSuffix(path, "*"); ok {
+			l.prefixes = append(l.prefixes, prefix)
+		} else {
+			l.exact[path] = true
+		}
+	}
+	return l
+}
+
+// matches reports whether path is one of the list
+func (l *pathList) matches(path string) bool {
+	if l.exact[path] {
+		return true
+	}
+	for _, prefix := range l.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProbePaths are the paths of the health probes excluded by ExcludeProbes
+var ProbePaths = []string{"/healthz", "/readyz", "/livez", "/ping"}
+
+// ProbeUserAgents are the user agent prefixes of the health probes excluded by ExcludeProbes
+var ProbeUserAgents = []string{"kube-probe/"}
+
+// ExcludeProbes returns a PromOpts.ExcludeFn excluding the requests of ProbePaths and of
+// ProbeUserAgents, whose frequent and cheap answers dominate the latencies of low traffic services
+func ExcludeProbes() RequestFilterFn {
+	paths := make(map[string]bool, len(ProbePaths))
+	for _, path := range ProbePaths {
+		paths[path] = true
+	}
+	userAgents := append([]string(nil), ProbeUserAgents...)
+
+	return func(c *gin.Context) bool {
+		if paths[c.Request.URL.Path] {
+			return true
+		}
+		userAgent := c.Request.UserAgent()
+		for _, prefix := range userAgents {
+			if strings.HasPrefix(userAgent, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,285 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPromMiddlewareAuxiliaryMethods(t *testing.T) {
+	tests := []struct {
+		name       string
+		aux        *AuxiliaryMethods
+		method     string
+		wantMethod string
+	}{
+		{"options collapsed", &AuxiliaryMethods{}, http.MethodOptions, AuxiliaryMethodValue},
+		{"head collapsed", &AuxiliaryMethods{}, http.MethodHead, AuxiliaryMethodValue},
+		{"get kept", &AuxiliaryMethods{}, http.MethodGet, http.MethodGet},
+		{"dropped", &AuxiliaryMethods{Drop: true}, http.MethodOptions, ""},
+		{"custom methods", &AuxiliaryMethods{Methods: []string{http.MethodGet}}, http.MethodGet, AuxiliaryMethodValue},
+		{"custom methods replace the defaults", &AuxiliaryMethods{Methods: []string{http.MethodGet}}, http.MethodHead, http.MethodHead},
+		{"disabled", nil, http.MethodOptions, http.MethodOptions},
+	}
+
+	m, err := newMetrics(NewDefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/auxiliary"
+			opts := NewDefaultOpts()
+			opts.AuxiliaryMethods = tt.aux
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.Handle(tt.method, path, func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+
+			before := map[string]float64{}
+			for _, method := range []string{tt.method, AuxiliaryMethodValue} {
+				before[method] = testutil.ToFloat64(m.reqCount.WithLabelValues("204", path, method))
+			}
+			serve(r, tt.method, path)
+
+			for method, count := range before {
+				want := 0.0
+				if method == tt.wantMethod {
+					want = 1
+				}
+				if got := testutil.ToFloat64(m.reqCount.WithLabelValues("204", path, method)) - count; got != want {
+					t.Errorf("got %v requests with method %s, want %v", got, method, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExcludeProbes(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		userAgent string
+		want      bool
+	}{
+		{"healthz", "/healthz", "", true},
+		{"readyz", "/readyz", "curl/8.0", true},
+		{"livez", "/livez", "", true},
+		{"ping", "/ping", "", true},
+		{"kube-probe", "/status", "kube-probe/1.30", true},
+		{"api", "/api/users", "Mozilla/5.0", false},
+		{"probe path prefix", "/healthz/db", "", false},
+		{"kube-probe elsewhere", "/api", "not kube-probe/1.30", false},
+	}
+
+	exclude := ExcludeProbes()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, tt.path, nil)
+			c.Request.Header.Set("User-Agent", tt.userAgent)
+			if got := exclude(c); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromMiddlewareExcludeProbes(t *testing.T) {
+	tests := []struct {
+		name      string
+		aggregate bool
+		userAgent string
+		want      []string
+	}{
+		{"probe", false, "kube-probe/1.30", nil},
+		{"aggregated probe", true, "kube-probe/1.30", []string{"200", FilteredLabelValue, http.MethodGet}},
+		{"client", false, "curl/8.0", []string{"200", "/probed", http.MethodGet}},
+	}
+
+	m, err := newMetrics(NewDefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.ExcludeFn = ExcludeProbes()
+			opts.AggregateFiltered = tt.aggregate
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/probed", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			series := [][]string{{"200", "/probed", http.MethodGet}, {"200", FilteredLabelValue, http.MethodGet}}
+			before := make([]float64, len(series))
+			for i, lvs := range series {
+				before[i] = testutil.ToFloat64(m.reqCount.WithLabelValues(lvs...))
+			}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/probed", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			r.ServeHTTP(w, req)
+
+			for i, lvs := range series {
+				want := 0.0
+				if reflect.DeepEqual(lvs, tt.want) {
+					want = 1
+				}
+				if got := testutil.ToFloat64(m.reqCount.WithLabelValues(lvs...)) - before[i]; got != want {
+					t.Errorf("got %v requests in %v, want %v", got, lvs, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPromMiddlewareFilteredBeforeHandlers(t *testing.T) {
+	tests := []struct {
+		name          string
+		exclude       bool
+		aggregate     bool
+		wantQueued    uint64
+		wantInFlight  []string
+		wantUsersSlot bool
+	}{
+		{"excluded", true, false, 1, []string{"/users"}, true},
+		{"aggregated", true, true, 2, []string{"/users", FilteredLabelValue}, true},
+		{"not excluded", false, false, 2, []string{"/healthz", OtherEndpointValue}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.QueueDuration = true
+			opts.InFlightByRoute = true
+			opts.MaxEndpointCardinality = 1
+			opts.AggregateFiltered = tt.aggregate
+			if tt.exclude {
+				opts.ExcludePaths = []string{"/healthz"}
+			}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
+			r.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			for _, path := range []string{"/healthz", "/users"} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set("X-Request-Start", "t="+strconv.FormatInt(time.Now().UnixMicro(), 10))
+				r.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var queued uint64
+			var inFlight []string
+			for _, mf := range families {
+				switch mf.GetName() {
+				case "service_http_request_queue_duration_seconds":
+					queued = mf.GetMetric()[0].GetHistogram().GetSampleCount()
+				case "service_http_requests_in_flight":
+					for _, metric := range mf.GetMetric() {
+						for _, label := range metric.GetLabel() {
+							if label.GetName() == "endpoint" {
+								inFlight = append(inFlight, label.GetValue())
+							}
+						}
+					}
+				}
+			}
+			if queued != tt.wantQueued {
+				t.Errorf("got %d queue observations, want %d", queued, tt.wantQueued)
+			}
+			if !reflect.DeepEqual(inFlight, tt.wantInFlight) {
+				t.Errorf("got in-flight endpoints %v, want %v", inFlight, tt.wantInFlight)
+			}
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues("200", "/users", http.MethodGet)) == 1; got != tt.wantUsersSlot {
+				t.Errorf("got /users recorded %v, want %v", got, tt.wantUsersSlot)
+			}
+		})
+	}
+}
+
+func TestPathList(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		path  string
+		want  bool
+	}{
+		{"exact", []string{"/healthz"}, "/healthz", true},
+		{"exact only", []string{"/healthz"}, "/healthz/db", false},
+		{"prefix", []string{"/static/*"}, "/static/app.js", true},
+		{"prefix itself", []string{"/static/*"}, "/static/", true},
+		{"outside prefix", []string{"/static/*"}, "/api/static/app.js", false},
+		{"several", []string{"/healthz", "/favicon.ico", "/debug/*"}, "/favicon.ico", true},
+		{"none", []string{"/healthz", "/debug/*"}, "/api", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newPathList(tt.paths).matches(tt.path); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     PromOpts
+		path     string
+		endpoint string
+		want     float64
+	}{
+		{"excluded", PromOpts{ExcludePaths: []string{"/healthz"}}, "/healthz", "/healthz", 0},
+		{"excluded unrouted", PromOpts{ExcludePaths: []string{"/favicon.ico"}}, "/favicon.ico", "/favicon.ico", 0},
+		{"excluded prefix", PromOpts{ExcludePaths: []string{"/static/*"}}, "/static/app.js", "/static/*file", 0},
+		{"not excluded", PromOpts{ExcludePaths: []string{"/healthz"}}, "/api/users", "/api/users", 1},
+		{"included", PromOpts{IncludeOnlyPaths: []string{"/api/*"}}, "/api/users", "/api/users", 1},
+		{"not included", PromOpts{IncludeOnlyPaths: []string{"/api/*"}}, "/healthz", "/healthz", 0},
+		{"excluded from the included", PromOpts{IncludeOnlyPaths: []string{"/api/*"}, ExcludePaths: []string{"/api/internal/*"}},
+			"/api/internal/stats", "/api/internal/stats", 0},
+		{"aggregated", PromOpts{ExcludePaths: []string{"/healthz"}, AggregateFiltered: true}, "/healthz", FilteredLabelValue, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Registerer = prometheus.NewRegistry()
+			r := gin.New()
+			r.Use(PromMiddleware(&opts))
+			for _, path := range []string{"/healthz", "/api/users", "/api/internal/stats", "/static/*file"} {
+				r.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+			}
+			r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+			serve(r, http.MethodGet, tt.path)
+
+			m, err := newMetrics(&opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues("200", tt.endpoint, http.MethodGet)); got != tt.want {
+				t.Errorf("got %v requests of %s, want %v", got, tt.endpoint, tt.want)
+			}
+		})
+	}
+}
@@ -1,70 +1,47 @@
 package ginprom
 
 import (
+	"math/rand/v2"
 	"net/http"
-	"regexp"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const namespace = "service"
 
 var (
 	labels = []string{"status", "endpoint", "method"}
-	uptime = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: namespace,
-			Name:      "uptime",
-			Help:      "HTTP service uptime",
-		}, nil,
-	)
-
-	reqCount = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: namespace,
-			Name:      "http_request_count_total",
-			Help:      "Total number of http requests made.",
-		}, labels,
-	)
-
-	reqDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: namespace,
-		Name:      "http_request_duration_seconds",
-		Help:      "HTTP request latencies in seconds",
-	}, labels)
-
-	reqSizeBytes = prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Namespace: namespace,
-		Name:      "http_request_size_bytes",
-		Help:      "HTTP request size in bytes",
-	}, labels)
-
-	respSizeBytes = prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Namespace: namespace,
-		Name:      "http_response_size_bytes",
-		Help:      "HTTP response size in bytes",
-	}, labels)
+
+	// uptimeCounters holds the uptime counters already increased by a ticker,
+	// a single one per registry is shared by its middlewares
+	uptimeCounters sync.Map
 )
 
-func init() {
-	prometheus.MustRegister(uptime, reqCount, reqDuration, reqSizeBytes, respSizeBytes)
-	go recordUpTime()
-}
+// recordUptime increases service uptime per second until stop is closed
+func recordUpTime(uptime prometheus.Counter, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
-// recordUptime increases service uptime per second
-func recordUpTime() {
-	for range time.Tick(time.Second) {
-		uptime.WithLabelValues().Inc()
+	for {
+		select {
+		case <-ticker.C:
+			uptime.Inc()
+		case <-stop:
+			return
+		}
 	}
 }
 
-// calcRequestSize returns the size of request object
-func calcRequestSize(r *http.Request) float64 {
+// calcRequestSize returns the size of request object, body being the body bytes
+// read by the handlers, or -1 to count the Content-Length instead
+func calcRequestSize(r *http.Request, body int64) float64 {
 	size := 0
-	if r.URL == nil {
+	if r.URL != nil {
 		size = len(r.URL.String())
 	}
 
@@ -81,7 +58,9 @@ func calcRequestSize(r *http.Request) float64 {
 	size += len(r.Host)
 
 	// r.Form and r.MultipartForm are assumed ot be included in r.URL
-	if r.ContentLength != -1 {
+	if body >= 0 {
+		size += int(body)
+	} else if r.ContentLength != -1 {
 		size += int(r.ContentLength)
 	}
 	return float64(size)
@@ -89,6 +68,67 @@ func calcRequestSize(r *http.Request) float64 {
 
 type RequestLabelMappingFn func(c *gin.Context) string
 
+// RoutePath is the default EndpointLabelMappingFn, it returns the route template like
+// /users/:id so IDs don't blow up the cardinality, or the URL path for unmatched routes
+func RoutePath(c *gin.Context) string {
+	if path := c.FullPath(); path != "" {
+		return path
+	}
+	return c.Request.URL.Path
+}
+
+// URLPath is an EndpointLabelMappingFn returning the URL path, the default before RoutePath
+func URLPath(c *gin.Context) string {
+	return c.Request.URL.Path
+}
+
+// HandlerName returns the name of the main handler of the request without its package
+// path, like api.listUsers or api.(*Server).listUsers
+func HandlerName(c *gin.Context) string {
+	return shortFuncName(c.HandlerName())
+}
+
+// shortFuncName returns the name of a Go function without its package path
+func shortFuncName(name string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	// the method values are wrapped in a closure
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// RequestFilterFn reports whether a request is selected
+type RequestFilterFn func(c *gin.Context) bool
+
+// HelpProvider returns the help text of a built-in metric key,
+// an empty string keeps the default help text
+type HelpProvider func(metric string) string
+
+// Observation holds the labels and measurements of a recorded request
+type Observation struct {
+	Status       string
+	Endpoint     string
+	Method       string
+	StatusCode   int
+	Duration     time.Duration
+	RequestSize  float64
+	ResponseSize float64
+	// TimeToFirstByte is how long the handlers took to start the response,
+	// zero if they sent nothing
+	TimeToFirstByte time.Duration
+	// Hijacked reports whether a handler took over the connection, e.g. for a WebSocket
+	Hijacked bool
+	// Warmup reports whether the request started during PromOpts.WarmupPeriod
+	Warmup bool
+	// TraceID is the trace ID of PromOpts.TraceIDFn, empty without one
+	TraceID string
+}
+
+// Observer receives every request recorded by the middleware
+type Observer interface {
+	Observe(o Observation)
+}
+
 // PromOpts represents the Prometheus middleware Options
 // It is used for filtering labels by regex
 type PromOpts struct {
@@ -96,76 +136,564 @@ type PromOpts struct {
 	ExcludeRegexEndpoint   string
 	ExcludeRegexMethod     string
 	EndpointLabelMappingFn RequestLabelMappingFn
+	// StatusLabel selects whether the request metrics are labelled with the status code,
+	// its class like 4xx, or both, the class then being the status_class label
+	StatusLabel StatusLabelMode
+	// HandlerLabel adds the handler label, the name of the Go function handling the
+	// request, to group the routes sharing a handler, see HandlerName
+	HandlerLabel bool
+	// ClientLabelMappingFn adds the client label, the class of the client of a request
+	// like internal or external, to segment the requests by network without labelling
+	// them with the unbounded client IPs, see ClientNetworks
+	ClientLabelMappingFn RequestLabelMappingFn
+	// UserAgentLabelMappingFn adds the user_agent label, the class of the User-Agent of a
+	// request like browser or bot, to separate the bots from the users, see UserAgentClass
+	UserAgentLabelMappingFn RequestLabelMappingFn
+	// HTTPVersionLabel adds the http_version label, 1.0, 1.1, 2 or 3, to compare the
+	// latencies and errors of the protocol versions while rolling out HTTP/2 or h2c
+	HTTPVersionLabel bool
+	// ExtraLabels adds labels to the request metrics, each valued by its function from the
+	// request, like a tenant or an API version. Their values multiply the series, so they
+	// must be few. The labels are read when the middleware is created
+	ExtraLabels map[string]RequestLabelMappingFn
+	// TraceIDFn returns the trace ID of a request, recorded as the exemplar of its duration
+	// so the latency buckets link to the traces, see TraceIDHeader. The exemplars are
+	// exposed in the OpenMetrics format, and not recorded by the summaries
+	TraceIDFn RequestLabelMappingFn
+	// RequestSizeFromContentLength counts the Content-Length in the request sizes instead of
+	// the body bytes read by the handlers, which chunked uploads don't announce
+	RequestSizeFromContentLength bool
+	// ApdexTarget is the target latency T of http_apdex_requests_total, which counts the
+	// requests by endpoint and zone: satisfied up to T, tolerating up to 4T and frustrated
+	// beyond or with a 5xx status. The Apdex score is (satisfied + tolerating/2) / total,
+	// no counter if not positive
+	ApdexTarget time.Duration
+	// WebSocketMetrics tracks the WebSocket connections the handlers hijack by endpoint:
+	// the open connections, their durations and the bytes sent and received through them
+	WebSocketMetrics bool
+	// StreamMetrics tracks the responses the handlers flush, like Server-Sent Events, by
+	// endpoint while they are streamed: their time to first byte, the open streams
+	// and the bytes sent, counted on every flush rather than once the request is done
+	StreamMetrics bool
+	// QueueDuration observes in http_request_queue_duration_seconds how long the requests
+	// waited in front of the service, from the X-Request-Start or X-Queue-Start timestamps
+	// the load balancers like nginx or Heroku set when they received them
+	QueueDuration bool
+	// TLSMetrics counts the requests served over TLS in http_tls_requests_total by version
+	// and cipher suite, to track the clients still negotiating the old versions
+	TLSMetrics bool
+	// SampleRates observes the durations and sizes of 1 in N requests of the endpoints
+	// they map to N, still counting every request, to cut the overhead on the hot routes.
+	// The histograms and summaries of these endpoints then hold 1/N of their requests,
+	// the rates below 2 observe every request
+	SampleRates map[string]int
+	// CountHandlerErrors counts the errors the handlers attach with gin.Context.Error in
+	// http_handler_errors_total by endpoint and type, bind, render, public or private,
+	// including the ones of the requests answered with a success
+	CountHandlerErrors bool
+	// CountPanics counts the panics of the handlers in http_panic_total, the panics
+	// going on to the gin.Recovery before the middleware, see PanicRecovery
+	CountPanics bool
+	// BuildInfo exports the build_info gauge labelled with the version, commit, Go version
+	// and build date of the service, to correlate its behavior with the releases, see
+	// DefaultBuildInfo
+	BuildInfo *BuildInfo
+	// DisableRequestSize, DisableResponseSize and DisableUptime leave out the request size,
+	// the response size, and the uptime counter and start time metrics, to only pay for
+	// the series which are charted
+	DisableRequestSize  bool
+	DisableResponseSize bool
+	DisableUptime       bool
+	// UptimeMode selects whether the uptime is the service_uptime counter, the
+	// service_start_time_seconds gauge, or both
+	UptimeMode UptimeMode
+	// GoCollector and ProcessCollector register the Go runtime collector, with the GC,
+	// goroutine and memory metrics, and the process collector, with the CPU and file
+	// descriptor metrics, next to the HTTP metrics. The default registry already has them
+	GoCollector      CollectorToggle
+	ProcessCollector CollectorToggle
+	// InFlightRequests exports the http_requests_in_flight gauge, which the golden signals
+	// always export, InFlightByRoute labels it by endpoint and method to show the live
+	// concurrency per route
+	InFlightRequests bool
+	InFlightByRoute  bool
+	// SlowRequestThreshold counts the requests lasting longer in http_slow_request_count_total
+	// and passes them to OnSlowRequest, so the application can log or trace them
+	SlowRequestThreshold time.Duration
+	OnSlowRequest        func(c *gin.Context, d time.Duration)
+	// MaxEndpointCardinality caps the distinct endpoint label values recorded by the middleware,
+	// the endpoints seen once it is reached are recorded as OtherEndpointValue. This protects
+	// Prometheus from scanners and URLs with IDs, no limit if not positive
+	MaxEndpointCardinality int
+	// CollapseUnmatchedRoutes records the requests matching no route, answered by the
+	// NoRoute or NoMethod handlers, as NotFoundEndpointValue instead of their endpoint,
+	// so the paths probed by scanners don't add a series each
+	CollapseUnmatchedRoutes bool
+	// PathNormalization normalizes the raw URL paths used as endpoints, like stripping
+	// their query string and trailing slashes, the route templates being kept
+	PathNormalization *PathNormalization
+	// EndpointNormalizers rewrite in order every endpoint label, route templates included,
+	// encoding the URL conventions of an organization without replacing
+	// EndpointLabelMappingFn, see RegexpNormalizer
+	EndpointNormalizers []func(endpoint string) string
+	// SeriesTTL deletes the series of the request metrics without requests for as long,
+	// checked every half of it, and the series of their endpoints in the other counters
+	// once they have none left, so the endpoints removed from the router stop being
+	// exported. The pruned endpoints free their MaxEndpointCardinality slot. The middlewares
+	// sharing the metrics of a registry prune them together, by the longest of their TTLs
+	SeriesTTL time.Duration
+	// CardinalityInterval sets ginprom_series_count by metric and ginprom_label_values by
+	// label to the series and distinct label values of the metrics of the middleware, every
+	// interval, so the labels whose cardinality grows out of control are caught early. The
+	// metrics are gathered from Gatherer, it's disabled if not positive
+	CardinalityInterval time.Duration
+	// ExcludeFn excludes the requests it returns true for, like ExcludeRegexEndpoint,
+	// see ExcludeProbes. It's called before the handlers too, for the metrics observed then
+	ExcludeFn RequestFilterFn
+	// ExcludePaths excludes the requests of these paths, like ExcludeRegexEndpoint, and
+	// IncludeOnlyPaths excludes the others. The paths ending with * match as prefixes,
+	// like /static/*, and are checked before the regexes against the request path
+	ExcludePaths     []string
+	IncludeOnlyPaths []string
+	// Filters replaces the exclude regexes and path lists with its rules, reloadable at runtime
+	Filters *Filters
+	// Settings replaces the filter rules, SampleRates and SlowRequestThreshold with its
+	// own, changeable at runtime, see NewSettings. The slow requests are then counted
+	// even if the threshold starts unset
+	Settings *Settings
+	// AggregateFiltered still records the requests matching an exclude regex, with the
+	// excluded labels set to FilteredLabelValue, so the totals add up to the real traffic
+	AggregateFiltered bool
+	// AuxiliaryMethods collapses or drops the requests of auxiliary methods, see NewDefaultOpts
+	AuxiliaryMethods *AuxiliaryMethods
+	// MethodNormalization bounds the method label to a set of methods, the others being
+	// recorded as OtherMethodValue, see StandardMethods
+	MethodNormalization *MethodNormalization
+	// Observers are notified after the request metrics are recorded
+	Observers []Observer
+	// ObserversOnly registers and records no Prometheus collector, the requests only go to
+	// the Observers, e.g. when they export them to another backend like OpenTelemetry
+	ObserversOnly bool
+	// Help overrides the help text of the built-in metrics, keyed by the Metric* constants
+	Help map[string]string
+	// Names renames the request count, duration and size metrics, keyed by the Metric*
+	// constants, to follow the naming of existing dashboards. The names are prefixed with
+	// the namespace and subsystem, like http_server_requests_total
+	Names map[string]string
+	// HelpProvider supplies the help text of the built-in metrics not overridden by Help
+	HelpProvider HelpProvider
+	// Namespace and Subsystem prefix the names of the middleware and application metrics,
+	// like myapi_http_request_duration_seconds, the namespace defaults to "service"
+	Namespace string
+	Subsystem string
+	// Registerer is where the collectors of the middleware and the application metrics
+	// are registered, the default registerer if nil
+	Registerer prometheus.Registerer
+	// ConstLabels are added to every metric of the middleware, like the service, environment
+	// or region, and to the application metrics, so no relabeling is needed at scrape time.
+	// The Go runtime and process collectors are left as they are
+	ConstLabels prometheus.Labels
+	// InstanceLabels adds the pod, node and namespace of the instance to the request metrics,
+	// see InstanceLabels. Other collectors can get them with
+	// prometheus.WrapRegistererWith(ginprom.InstanceLabels(), reg)
+	InstanceLabels bool
+	// CoarseClock measures durations with a clock updated every millisecond instead
+	// of calling time.Now twice per request, for extreme-throughput services which
+	// don't need sub-millisecond precision
+	CoarseClock bool
+	// BatchInterval buffers the request observations and records them into the metrics
+	// every interval instead of on every request, trading that much staleness for less
+	// contention at very high request rates. Observers are still notified immediately
+	BatchInterval time.Duration
+	// AsyncBuffer records the request metrics on a worker goroutine, through a buffer of
+	// that many requests, so the label building and observations leave the request
+	// goroutines. The requests arriving while the buffer is full are dropped and counted
+	// in http_dropped_observations_total. Observers are still notified immediately
+	AsyncBuffer int
+	// LowOverhead only records the count and duration of the requests, labelled with the
+	// status class unless StatusLabel says otherwise, leaving out the size metrics, the
+	// upgrade metrics and the uptime ticker, for the services where the overhead of the
+	// middleware and the number of series must be minimal
+	LowOverhead bool
+	// ShardedRequestCount splits the request counter in per-CPU shards summed at scrape
+	// time, removing the contention of many cores incrementing the same series
+	ShardedRequestCount bool
+	// DurationType exports the duration as a native histogram or as a summary
+	// instead of a histogram
+	DurationType MetricType
+	// DurationUnit observes the durations in milliseconds rather than seconds, the duration
+	// metric being renamed http_request_duration_milliseconds
+	DurationUnit DurationUnit
+	// DurationBuckets are the buckets of the duration histogram in seconds, like 1ms to 30s,
+	// see ExponentialDurationBuckets, the ones of DurationBucketPreset or prometheus.DefBuckets
+	// if empty. They're converted to DurationUnit, like the buckets of MetricSpecs
+	DurationBuckets []float64
+	// DurationBucketPreset names the BucketPresets of the duration histogram, like BucketsAPIFast
+	DurationBucketPreset string
+	// DurationObjectives are the quantiles of the duration summary, DefDurationObjectives if empty
+	DurationObjectives map[float64]float64
+	// DurationNativeHistogram configures the duration native histogram
+	// of the NativeHistogramMetric type
+	DurationNativeHistogram NativeHistogramOpts
+	// RequestSizeType and ResponseSizeType export the size metrics as histograms
+	// instead of summaries, so they can be aggregated across instances
+	RequestSizeType  MetricType
+	ResponseSizeType MetricType
+	// SizeBuckets are the byte buckets of the size histograms, DefSizeBuckets if empty
+	SizeBuckets []float64
+	// SizeObjectives are the quantiles of the size summaries, which export none if empty
+	SizeObjectives map[float64]float64
+	// SizeMaxAge is how long the observations count in the quantiles of the size summaries,
+	// prometheus.DefMaxAge if zero, over SizeAgeBuckets buckets, prometheus.DefAgeBuckets if zero
+	SizeMaxAge     time.Duration
+	SizeAgeBuckets uint32
+	// WarmupPeriod is how long after the middleware is created the requests are
+	// warming up caches and connection pools, and recorded as WarmupMode says
+	WarmupPeriod time.Duration
+	WarmupMode   WarmupMode
+	// MetricSpecs sets the type, buckets and objectives of the metrics recording
+	// observations, overriding the fields above
+	MetricSpecs MetricSpecs
+
+	goldenSignals bool
 }
 
+// NewDefaultOpts returns the default options, which label the endpoints with their route
+// and collapse the OPTIONS and HEAD requests, set AuxiliaryMethods to nil to record
+// their methods as they are
 func NewDefaultOpts() *PromOpts {
 	return &PromOpts{
-		EndpointLabelMappingFn: func(c *gin.Context) string {
-			return c.Request.URL.Path
-		},
+		EndpointLabelMappingFn: RoutePath,
+		AuxiliaryMethods:       &AuxiliaryMethods{},
 	}
 }
 
-// checkLabel returns match result of labels
-// Return true if regex-pattern compiles failed
-func (po *PromOpts) checkLabel(label, pattern string) bool {
-	if pattern == "" {
-		return true
-	}
-
-	matched, err := regexp.MatchString(pattern, label)
+// PromMiddleware returns a gin.HandlerFunc for exporting some web metrics,
+// it panics when its metrics conflict with registered ones, see NewPromMiddleware
+func PromMiddleware(promOpts *PromOpts) gin.HandlerFunc {
+	mw, err := NewPromMiddleware(promOpts)
 	if err != nil {
-		return true
+		panic(err)
 	}
-
-	return !matched
+	return mw
 }
 
-// PromMiddleware returns a gin.HandlerFunc for exporting some web metrics
-func PromMiddleware(promOpts *PromOpts) gin.HandlerFunc {
+// NewPromMiddleware is like PromMiddleware but returns an error when its metrics conflict
+// with the collectors registered on PromOpts.Registerer. The metrics already
+// registered by another middleware with the same options are reused
+func NewPromMiddleware(promOpts *PromOpts) (gin.HandlerFunc, error) {
 	if promOpts == nil {
 		promOpts = NewDefaultOpts()
 	}
 
 	if promOpts.EndpointLabelMappingFn == nil {
-		promOpts.EndpointLabelMappingFn = func(c *gin.Context) string {
-			return c.Request.URL.Path
+		promOpts.EndpointLabelMappingFn = RoutePath
+	}
+
+	endpointLabel := promOpts.endpointLabelFn()
+	m := &metrics{}
+	settings := promOpts.Settings
+	if settings == nil {
+		settings = promOpts.staticSettings()
+	}
+	var extraLabels []RequestLabelMappingFn
+	if promOpts.ObserversOnly {
+		if promOpts.WarmupPeriod > 0 {
+			m.warmupEnd = time.Now().Add(promOpts.WarmupPeriod)
+		}
+	} else {
+		var err error
+		if m, err = newMetrics(promOpts); err != nil {
+			return nil, err
+		}
+		for _, name := range promOpts.extraLabelNames() {
+			extraLabels = append(extraLabels, promOpts.ExtraLabels[name])
 		}
 	}
+	now := time.Now
+	if promOpts.CoarseClock {
+		now = coarseNow
+	}
+	// the metrics observed before the handlers run are filtered by the path and method
+	// rules, the status being only known once they ran
+	observesEarly := m.queueDuration != nil || m.inFlight != nil || m.inFlightByRoute != nil ||
+		m.websockets != nil || m.streams != nil || m.panics != nil
 
 	return func(c *gin.Context) {
-		start := time.Now()
+		state := getRequestState()
+		defer putRequestState(state)
+
+		state.start = now()
+		rules := settings.filters.compiled.Load()
+		earlyOK := true
+		var earlyEndpoint, earlyMethod string
+		if observesEarly {
+			earlyEndpoint, earlyMethod = endpointLabel(c), promOpts.methodLabel(c.Request.Method)
+			endpointOK := rules.endpointOK(c.Request.URL.Path, earlyEndpoint) &&
+				(promOpts.ExcludeFn == nil || !promOpts.ExcludeFn(c))
+			methodOK := rules.methodOK(earlyMethod)
+			if !endpointOK {
+				earlyEndpoint = FilteredLabelValue
+			}
+			if !methodOK {
+				earlyMethod = FilteredLabelValue
+			}
+			// the excluded requests don't take an endpoint slot either
+			if earlyOK = endpointOK && methodOK || promOpts.AggregateFiltered; earlyOK {
+				earlyEndpoint = m.endpointLabel(earlyEndpoint, promOpts.MaxEndpointCardinality)
+			}
+		}
+		if m.queueDuration != nil && earlyOK {
+			if d, ok := queueDuration(c.Request, time.Now()); ok {
+				m.queueDuration.Observe(d.Seconds())
+			}
+		}
+		if m.inFlight != nil && earlyOK {
+			m.inFlight.Inc()
+			defer m.inFlight.Dec()
+		} else if m.inFlightByRoute != nil && earlyOK {
+			// the route is known before the handlers run, unlike the status
+			inFlight := m.inFlightByRoute.WithLabelValues(earlyEndpoint, earlyMethod)
+			inFlight.Inc()
+			defer inFlight.Dec()
+		}
+
+		// the original writer is restored even if a handler panics,
+		// as the pooled wrapper is reset once the request is done
+		rw := c.Writer
+		defer func() { c.Writer = rw }()
+		w := &state.writer
+		w.reset(rw, now, m.hijacked)
+		c.Writer = w
+		if m.websockets != nil && earlyOK && upgradeProtocol(c.Request) == "websocket" {
+			// the upgrades outlive the requests, their endpoint is known before the handlers
+			w.websocket = m.websockets.conn(earlyEndpoint)
+		}
+		if m.streams != nil && earlyOK {
+			w.stream = responseStream{
+				metrics:  m.streams,
+				endpoint: earlyEndpoint,
+				start:    state.start,
+			}
+			defer w.stream.end(w)
+		}
+		if m.panics != nil && earlyOK {
+			defer func() {
+				if p := recover(); p != nil {
+					countPanic(m.panics, c, earlyEndpoint, earlyMethod, p)
+					panic(p)
+				}
+			}()
+		}
+		countBody := !promOpts.RequestSizeFromContentLength && promOpts.requestSizeEnabled()
+		if body := c.Request.Body; body != nil && countBody {
+			defer func() { c.Request.Body = body }()
+			state.body.reset(body)
+			c.Request.Body = &state.body
+		}
 		c.Next()
+		bodyBytes := int64(-1)
+		if countBody {
+			bodyBytes = state.body.bytes
+		}
+
+		statusCode := c.Writer.Status()
+		status := statusString(statusCode)
+		endpoint := endpointLabel(c)
+		method := promOpts.methodLabel(c.Request.Method)
 
-		status := strconv.Itoa(c.Writer.Status())
-		endpoint := promOpts.EndpointLabelMappingFn(c)
-		method := c.Request.Method
+		seriesStatus := statusCode
+		statusOK := rules.statusOK(status)
+		endpointOK := rules.endpointOK(c.Request.URL.Path, endpoint) &&
+			(promOpts.ExcludeFn == nil || !promOpts.ExcludeFn(c))
+		methodOK := rules.methodOK(method)
 
-		lvs := []string{status, endpoint, method}
+		if !statusOK || !endpointOK || !methodOK {
+			if !promOpts.AggregateFiltered {
+				return
+			}
+			if !statusOK {
+				seriesStatus, status = filteredStatus, FilteredLabelValue
+			}
+			if !endpointOK {
+				endpoint = FilteredLabelValue
+			}
+			if !methodOK {
+				method = FilteredLabelValue
+			}
+		}
+		endpoint = m.endpointLabel(endpoint, promOpts.MaxEndpointCardinality)
+		if aux := promOpts.AuxiliaryMethods; aux != nil && methodOK && aux.matches(method) {
+			if aux.Drop {
+				return
+			}
+			method = AuxiliaryMethodValue
+		}
 
-		ok := promOpts.checkLabel(status, promOpts.ExcludeRegexStatus) &&
-			promOpts.checkLabel(endpoint, promOpts.ExcludeRegexEndpoint) &&
-			promOpts.checkLabel(method, promOpts.ExcludeRegexMethod)
+		if promOpts.statusLabel() == StatusClassLabel && seriesStatus != filteredStatus {
+			status = statusClass(statusCode)
+		}
 
-		if !ok {
-			return
+		if promOpts.HandlerLabel {
+			handler := FilteredLabelValue
+			if endpointOK {
+				handler = HandlerName(c)
+			}
+			state.labels = append(state.labels, handler)
+		}
+		if promOpts.ClientLabelMappingFn != nil {
+			state.labels = append(state.labels, promOpts.ClientLabelMappingFn(c))
+		}
+		if promOpts.UserAgentLabelMappingFn != nil {
+			state.labels = append(state.labels, promOpts.UserAgentLabelMappingFn(c))
+		}
+		if promOpts.HTTPVersionLabel {
+			state.labels = append(state.labels, httpVersionLabel(c.Request))
+		}
+		for _, label := range extraLabels {
+			state.labels = append(state.labels, label(c))
 		}
 
-		respSize := c.Writer.Size()
-		// no response content will return -1
-		if respSize < 0 {
-			respSize = 0
+		elapsed := now().Sub(state.start)
+		// the coarse clock follows the wall clock, which may go backwards
+		if elapsed < 0 {
+			elapsed = 0
 		}
-		reqCount.WithLabelValues(lvs...).Inc()
-		reqDuration.WithLabelValues(lvs...).Observe(time.Since(start).Seconds())
-		reqSizeBytes.WithLabelValues(lvs...).Observe(calcRequestSize(c.Request))
-		respSizeBytes.WithLabelValues(lvs...).Observe(float64(respSize))
-	}
+
+		state.obs = Observation{
+			Status:       status,
+			Endpoint:     endpoint,
+			Method:       method,
+			StatusCode:   statusCode,
+			Duration:     elapsed,
+			RequestSize:  calcRequestSize(c.Request, bodyBytes),
+			ResponseSize: float64(w.size()),
+
+			TimeToFirstByte: w.timeToFirstByte(state.start),
+			Hijacked:        w.hijacked,
+			Warmup:          state.start.Before(m.warmupEnd),
+		}
+		if promOpts.TraceIDFn != nil {
+			state.obs.TraceID = promOpts.TraceIDFn(c)
+		}
+		obs := &state.obs
+
+		slowThreshold := settings.SlowRequestThreshold()
+		// the warm-up requests are recorded into their own metrics, if any
+		rm := m
+		if obs.Warmup {
+			rm = m.warm
+		}
+		if promOpts.ObserversOnly {
+			rm = nil
+		}
+		if rm != nil {
+			if rate := (*settings.sampleRates.Load())[endpoint]; rate > 1 && rand.Uint32()%uint32(rate) != 0 {
+				rm.count(seriesStatus, endpoint, method, state.labels)
+			} else {
+				rm.observe(seriesStatus, endpoint, method, state.labels,
+					promOpts.DurationUnit.value(obs.Duration), obs.RequestSize, obs.ResponseSize, obs.TraceID)
+			}
+			if w.hijacked || statusCode == http.StatusSwitchingProtocols {
+				if protocol := upgradeProtocol(c.Request); protocol != "" && rm.upgrades != nil {
+					rm.upgrades.WithLabelValues(endpoint, protocol).Inc()
+				}
+			}
+			if rm.reqErrors != nil && statusCode >= 500 && statusOK {
+				rm.reqErrors.WithLabelValues(endpoint, method).Inc()
+			}
+			if rm.apdex != nil {
+				zone := apdexZone(elapsed, promOpts.ApdexTarget, statusCode >= 500 && statusOK)
+				rm.apdex.WithLabelValues(endpoint, zone).Inc()
+			}
+			if rm.handlerErrors != nil {
+				for _, err := range c.Errors {
+					rm.handlerErrors.WithLabelValues(endpoint, errorTypeLabel(err.Type)).Inc()
+				}
+			}
+			if rm.tlsRequests != nil && c.Request.TLS != nil {
+				rm.tlsRequests.WithLabelValues(tlsLabels(c.Request.TLS)).Inc()
+			}
+			if rm.slowRequests != nil && slowThreshold > 0 && elapsed > slowThreshold {
+				rm.slowRequests.WithLabelValues(endpoint, method).Inc()
+			}
+		}
+		if promOpts.OnSlowRequest != nil && slowThreshold > 0 && elapsed > slowThreshold {
+			promOpts.OnSlowRequest(c, elapsed)
+		}
+
+		for _, o := range promOpts.Observers {
+			o.Observe(*obs)
+		}
+	}, nil
 }
 
 // PromHandler wrappers the standard http.Handler to gin.HandlerFunc
+// and instruments the scrapes it serves, it panics when its metrics conflict
+// with registered ones, see NewPromHandler
 func PromHandler(handler http.Handler) gin.HandlerFunc {
+	h, err := NewPromHandler(handler)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// NewPromHandler is like PromHandler but returns an error when its metrics conflict
+// with the collectors registered on the default registerer. A nil handler serves the
+// default gatherer like PromHandlerFor
+func NewPromHandler(handler http.Handler) (gin.HandlerFunc, error) {
+	scrapes, err := registerScrapeMetrics()
+	if err != nil {
+		return nil, err
+	}
+	if handler == nil {
+		handler = registryHandler(prometheus.DefaultGatherer)
+	}
+	return scrapeHandler(handler, scrapes), nil
+}
+
+// scrapeHandler returns handler instrumented by scrapes
+func scrapeHandler(handler http.Handler, scrapes *scrapeMetrics) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		start := time.Now()
+		scrapes.inFlight.Inc()
+		defer scrapes.inFlight.Dec()
+
 		handler.ServeHTTP(c.Writer, c.Request)
+		scrapes.observe(start, c.Writer.Size())
+	}
+}
+
+// PromHandlerFor is like PromHandler serving the metrics of the registry of promOpts, in
+// the OpenMetrics format to the scrapers negotiating it so the exemplars are exposed and
+// gzipped to those accepting it, it panics when its metrics conflict with registered
+// ones, see NewPromHandlerFor
+func PromHandlerFor(promOpts *PromOpts) gin.HandlerFunc {
+	h, err := NewPromHandlerFor(promOpts)
+	if err != nil {
+		panic(err)
 	}
+	return h
+}
+
+// NewPromHandlerFor is like PromHandlerFor but returns an error when its metrics conflict
+// with the collectors registered on PromOpts.Registerer. The scrapes are instrumented
+// with the metrics of that registry, so the engines of their own registries don't share
+// or conflict on them
+func NewPromHandlerFor(promOpts *PromOpts) (gin.HandlerFunc, error) {
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	scrapes, err := scrapeMetricsFor(promOpts)
+	if err != nil {
+		return nil, err
+	}
+	return scrapeHandler(registryHandler(promOpts.Gatherer()), scrapes), nil
+}
+
+// registryHandler returns the promhttp handler of gatherer with the unit metadata,
+// negotiating OpenMetrics while the classic scrapers get the text format
+func registryHandler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(unitGatherer{gatherer}, promhttp.HandlerOpts{EnableOpenMetrics: true})
 }
@@ -0,0 +1,1343 @@
+package ginprom
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestEngine returns an engine serving path and the request metrics it records into
+func newTestEngine(t *testing.T, promOpts *PromOpts, path string) (*gin.Engine, *metrics) {
+	t.Helper()
+	r := gin.New()
+	r.Use(PromMiddleware(promOpts))
+	r.GET(path, func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	m, err := newMetrics(promOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, m
+}
+
+func serve(r http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestPromMiddlewareTwice(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  *PromOpts
+		path  string
+		calls int
+	}{
+		{"default options", nil, "/first", 1},
+		{"second middleware", NewDefaultOpts(), "/second", 2},
+		{"golden signals", GoldenSignals(), "/golden", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, m := newTestEngine(t, tt.opts, tt.path)
+			counter := m.reqCount.WithLabelValues("200", tt.path, http.MethodGet)
+			before := testutil.ToFloat64(counter)
+			for i := 0; i < tt.calls; i++ {
+				serve(r, http.MethodGet, tt.path)
+			}
+			if got := testutil.ToFloat64(counter) - before; got != float64(tt.calls) {
+				t.Errorf("got %v requests, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestNewPromMiddlewareConflict(t *testing.T) {
+	// make sure the default metrics are registered before conflicting with them
+	PromMiddleware(nil)
+
+	tests := []struct {
+		name string
+		opts *PromOpts
+	}{
+		{"different help", &PromOpts{Help: map[string]string{MetricRequestDuration: "Conflicting help"}}},
+		{"different const labels", &PromOpts{ConstLabels: prometheus.Labels{"conflict": "a"}}},
+		{"different size type", &PromOpts{ResponseSizeType: HistogramMetric}},
+		{"different duration type", &PromOpts{DurationType: SummaryMetric}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := NewPromMiddleware(tt.opts)
+			if err == nil || mw != nil {
+				t.Fatalf("got %v, want a registration error", err)
+			}
+
+			// the metrics registered before the conflict are rolled back
+			mfs, err := prometheus.DefaultGatherer.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mf := range mfs {
+				for _, m := range mf.GetMetric() {
+					for _, lp := range m.GetLabel() {
+						if lp.GetName() == "conflict" {
+							t.Errorf("%s is still registered with the conflicting labels", mf.GetName())
+						}
+					}
+				}
+			}
+
+			defer func() {
+				if recover() == nil {
+					t.Error("PromMiddleware doesn't panic on conflicts")
+				}
+			}()
+			PromMiddleware(tt.opts)
+		})
+	}
+}
+
+func TestRegistrationRollback(t *testing.T) {
+	added := prometheus.NewCounter(prometheus.CounterOpts{Name: "ginprom_test_rollback_added_total", Help: "Added."})
+	existing := prometheus.NewCounter(prometheus.CounterOpts{Name: "ginprom_test_rollback_existing_total", Help: "Existing."})
+	prometheus.MustRegister(existing)
+	defer prometheus.Unregister(existing)
+
+	r := &registration{}
+	registerOrReuse(r, added)
+	if got := registerOrReuse(r, prometheus.NewCounter(prometheus.CounterOpts{Name: "ginprom_test_rollback_existing_total", Help: "Existing."})); got != existing {
+		t.Error("the registered collector isn't reused")
+	}
+	registerOrReuse(r, prometheus.NewCounter(prometheus.CounterOpts{Name: "ginprom_test_rollback_existing_total", Help: "Conflicting."}))
+
+	if err := r.finish(); err == nil {
+		t.Fatal("got no error, want the conflict")
+	}
+	if !prometheus.Unregister(existing) {
+		t.Error("the existing collector was unregistered")
+	}
+	prometheus.MustRegister(existing)
+	if prometheus.Unregister(added) {
+		t.Error("the collector registered before the conflict is still registered")
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{100, "100"},
+		{200, "200"},
+		{599, "599"},
+		{600, "600"},
+		{99, "99"},
+		{0, "0"},
+		{filteredStatus, FilteredLabelValue},
+	}
+
+	for _, tt := range tests {
+		if got := statusString(tt.code); got != tt.want {
+			t.Errorf("statusString(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{100, "1xx"},
+		{204, "2xx"},
+		{302, "3xx"},
+		{404, "4xx"},
+		{599, "5xx"},
+		{600, "600"},
+		{99, "99"},
+		{filteredStatus, FilteredLabelValue},
+	}
+
+	for _, tt := range tests {
+		if got := statusClass(tt.code); got != tt.want {
+			t.Errorf("statusClass(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestPromOptsStatusLabel(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       StatusLabelMode
+		wantLabels map[string]float64
+		wantStatus []string
+	}{
+		{"code", StatusCodeLabel,
+			map[string]float64{"404": 1, "410": 1, "200": 1},
+			[]string{"404", "410", "200"}},
+		{"class", StatusClassLabel,
+			map[string]float64{"4xx": 2, "2xx": 1},
+			[]string{"4xx", "4xx", "2xx"}},
+		{"code and class", StatusCodeAndClassLabels,
+			map[string]float64{"404/4xx": 1, "410/4xx": 1, "200/2xx": 1},
+			[]string{"404", "410", "200"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			var statuses []string
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.StatusLabel = tt.mode
+			opts.Observers = []Observer{observerFunc(func(o Observation) { statuses = append(statuses, o.Status) })}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/status/:code", func(c *gin.Context) {
+				code, _ := strconv.Atoi(c.Param("code"))
+				c.Status(code)
+			})
+			for _, code := range []string{"404", "410", "200"} {
+				serve(r, http.MethodGet, "/status/"+code)
+			}
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]float64{}
+			for _, mf := range families {
+				if mf.GetName() != "service_http_request_count_total" {
+					continue
+				}
+				for _, metric := range mf.GetMetric() {
+					var status, class string
+					for _, lp := range metric.GetLabel() {
+						switch lp.GetName() {
+						case "status":
+							status = lp.GetValue()
+						case "status_class":
+							class = "/" + lp.GetValue()
+						}
+					}
+					got[status+class] += metric.GetCounter().GetValue()
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantLabels) {
+				t.Errorf("got requests %v, want %v", got, tt.wantLabels)
+			}
+			if !reflect.DeepEqual(statuses, tt.wantStatus) {
+				t.Errorf("got observed statuses %v, want %v", statuses, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func listUsers(c *gin.Context) { c.String(http.StatusOK, HandlerName(c)) }
+
+type usersAPI struct{}
+
+func (usersAPI) list(c *gin.Context) { c.String(http.StatusOK, HandlerName(c)) }
+
+func TestHandlerName(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		want    string
+	}{
+		{"function", listUsers, "ginprom.listUsers"},
+		{"method value", usersAPI{}.list, "ginprom.usersAPI.list"},
+		{"closure", func(c *gin.Context) { c.String(http.StatusOK, HandlerName(c)) }, "ginprom.TestHandlerName.func1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/handler", tt.handler)
+			if got := serve(r, http.MethodGet, "/handler").Body.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsHandlerLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(opts *PromOpts)
+		path string
+		want []string
+	}{
+		{"handler", func(opts *PromOpts) {}, "/users",
+			[]string{"200", "/users", http.MethodGet, "ginprom.listUsers"}},
+		{"routes sharing a handler", func(opts *PromOpts) {}, "/v1/users",
+			[]string{"200", "/v1/users", http.MethodGet, "ginprom.listUsers"}},
+		{"with status class", func(opts *PromOpts) { opts.StatusLabel = StatusCodeAndClassLabels }, "/users",
+			[]string{"200", "/users", http.MethodGet, "2xx", "ginprom.listUsers"}},
+		{"filtered endpoint", func(opts *PromOpts) {
+			opts.ExcludeRegexEndpoint = "^/users$"
+			opts.AggregateFiltered = true
+		}, "/users", []string{"200", FilteredLabelValue, http.MethodGet, FilteredLabelValue}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.HandlerLabel = true
+			tt.opts(opts)
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			r.GET("/v1/users", listUsers)
+			serve(r, http.MethodGet, tt.path)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.want...)); got != 1 {
+				t.Errorf("got %v requests labelled %v, want 1", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsSampleRates(t *testing.T) {
+	const requests = 1000
+	tests := []struct {
+		name     string
+		rates    map[string]int
+		path     string
+		min, max uint64
+	}{
+		{"sampled", map[string]int{"/hot": 10}, "/hot", 50, 200},
+		{"other endpoint", map[string]int{"/hot": 10}, "/cold", requests, requests},
+		{"rate of one", map[string]int{"/hot": 1}, "/hot", requests, requests},
+		{"negative rate", map[string]int{"/hot": -5}, "/hot", requests, requests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.SampleRates = tt.rates
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/hot", listUsers)
+			r.GET("/cold", listUsers)
+			for i := 0; i < requests; i++ {
+				serve(r, http.MethodGet, tt.path)
+			}
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lvs := []string{"200", tt.path, http.MethodGet}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(lvs...)); got != requests {
+				t.Errorf("got %v requests counted, want all %d", got, requests)
+			}
+			var metric dto.Metric
+			if err := m.reqDuration.WithLabelValues(lvs...).(prometheus.Metric).Write(&metric); err != nil {
+				t.Fatal(err)
+			}
+			if got := metric.GetHistogram().GetSampleCount(); got < tt.min || got > tt.max {
+				t.Errorf("got %d durations observed, want between %d and %d", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestPromOptsHTTPVersionLabel(t *testing.T) {
+	tests := []struct {
+		name         string
+		major, minor int
+		want         string
+	}{
+		{"http/1.0", 1, 0, "1.0"},
+		{"http/1.1", 1, 1, "1.1"},
+		{"http/2", 2, 0, "2"},
+		{"http/3", 3, 0, "3"},
+		{"unknown", 0, 9, "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.HTTPVersionLabel = true
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.ProtoMajor, req.ProtoMinor = tt.major, tt.minor
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"200", "/users", http.MethodGet, tt.want}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(want...)); got != 1 {
+				t.Errorf("got %v requests labelled %v, want 1", got, want)
+			}
+		})
+	}
+}
+
+func TestPromOptsExtraLabels(t *testing.T) {
+	tenant := func(c *gin.Context) string { return c.GetHeader("X-Tenant") }
+	version := func(c *gin.Context) string { return c.Param("version") }
+	tests := []struct {
+		name   string
+		labels map[string]RequestLabelMappingFn
+		header string
+		want   []string
+	}{
+		{"none", nil, "acme", []string{"200", "/api/:version/users", http.MethodGet}},
+		{"tenant", map[string]RequestLabelMappingFn{"tenant": tenant}, "acme",
+			[]string{"200", "/api/:version/users", http.MethodGet, "acme"}},
+		{"missing value", map[string]RequestLabelMappingFn{"tenant": tenant}, "",
+			[]string{"200", "/api/:version/users", http.MethodGet, ""}},
+		{"sorted by name", map[string]RequestLabelMappingFn{"tenant": tenant, "api_version": version}, "acme",
+			[]string{"200", "/api/:version/users", http.MethodGet, "v2", "acme"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.ExtraLabels = tt.labels
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/api/:version/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/api/v2/users", nil)
+			req.Header.Set("X-Tenant", tt.header)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.want...)); got != 1 {
+				t.Errorf("got %v requests labelled %v, want 1", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsExtraLabelsInvalid(t *testing.T) {
+	value := func(c *gin.Context) string { return "" }
+	tests := []struct {
+		name   string
+		opts   PromOpts
+		labels map[string]RequestLabelMappingFn
+	}{
+		{"invalid name", PromOpts{}, map[string]RequestLabelMappingFn{"api-version": value}},
+		{"reserved name", PromOpts{}, map[string]RequestLabelMappingFn{"__tenant": value}},
+		{"no function", PromOpts{}, map[string]RequestLabelMappingFn{"tenant": nil}},
+		{"middleware label", PromOpts{}, map[string]RequestLabelMappingFn{"endpoint": value}},
+		{"handler label", PromOpts{}, map[string]RequestLabelMappingFn{"handler": value}},
+		{"client label", PromOpts{}, map[string]RequestLabelMappingFn{"client": value}},
+		{"user agent label", PromOpts{}, map[string]RequestLabelMappingFn{"user_agent": value}},
+		{"http version label", PromOpts{}, map[string]RequestLabelMappingFn{"http_version": value}},
+		{"constant label", PromOpts{ConstLabels: map[string]string{"tenant": "acme"}},
+			map[string]RequestLabelMappingFn{"tenant": value}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Registerer = prometheus.NewRegistry()
+			opts.ExtraLabels = tt.labels
+			if _, err := NewPromMiddleware(&opts); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestPromOptsConstLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(opts *PromOpts)
+	}{
+		{"default options", func(opts *PromOpts) {}},
+		{"start time", func(opts *PromOpts) { opts.UptimeMode = UptimeCounterAndStartTime }},
+		{"optional metrics", func(opts *PromOpts) {
+			opts.InFlightByRoute = true
+			opts.SlowRequestThreshold = time.Nanosecond
+			opts.ApdexTarget = time.Second
+			opts.CountHandlerErrors = true
+			opts.QueueDuration = true
+			opts.BuildInfo = &BuildInfo{Version: "1.0.0"}
+		}},
+		{"golden signals", func(opts *PromOpts) {
+			*opts = *GoldenSignals()
+			opts.GoCollector = CollectorDisabled
+			opts.ProcessCollector = CollectorDisabled
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			tt.opts(opts)
+			opts.Registerer = reg
+			opts.ConstLabels = prometheus.Labels{"service": "api", "region": "eu"}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("X-Request-Start", "t=1")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mf := range families {
+				for _, metric := range mf.GetMetric() {
+					got := map[string]string{}
+					for _, lp := range metric.GetLabel() {
+						got[lp.GetName()] = lp.GetValue()
+					}
+					if got["service"] != "api" || got["region"] != "eu" {
+						t.Errorf("%s has the labels %v, want the constant labels", mf.GetName(), got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPromOptsConstLabelsInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   PromOpts
+		labels prometheus.Labels
+	}{
+		{"invalid name", PromOpts{}, prometheus.Labels{"service-name": "api"}},
+		{"reserved name", PromOpts{}, prometheus.Labels{"__service": "api"}},
+		{"request label", PromOpts{}, prometheus.Labels{"endpoint": "/"}},
+		{"status class label", PromOpts{StatusLabel: StatusCodeAndClassLabels}, prometheus.Labels{"status_class": "2xx"}},
+		{"warmup label", PromOpts{WarmupPeriod: time.Minute}, prometheus.Labels{"warmup": "false"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Registerer = prometheus.NewRegistry()
+			opts.ConstLabels = tt.labels
+			if _, err := NewPromMiddleware(&opts); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestPromOptsDisableMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(opts *PromOpts)
+		want []string
+	}{
+		{"none", func(opts *PromOpts) {}, []string{
+			"service_http_hijacked_connections", "service_http_request_count_total", "service_http_request_duration_seconds",
+			"service_http_request_size_bytes", "service_http_response_size_bytes", "service_uptime",
+		}},
+		{"request size", func(opts *PromOpts) { opts.DisableRequestSize = true }, []string{
+			"service_http_hijacked_connections", "service_http_request_count_total", "service_http_request_duration_seconds",
+			"service_http_response_size_bytes", "service_uptime",
+		}},
+		{"response size", func(opts *PromOpts) { opts.DisableResponseSize = true }, []string{
+			"service_http_hijacked_connections", "service_http_request_count_total", "service_http_request_duration_seconds",
+			"service_http_request_size_bytes", "service_uptime",
+		}},
+		{"uptime and start time", func(opts *PromOpts) {
+			opts.DisableUptime = true
+			opts.UptimeMode = UptimeCounterAndStartTime
+		}, []string{
+			"service_http_hijacked_connections", "service_http_request_count_total", "service_http_request_duration_seconds",
+			"service_http_request_size_bytes", "service_http_response_size_bytes",
+		}},
+		{"all", func(opts *PromOpts) {
+			opts.DisableRequestSize = true
+			opts.DisableResponseSize = true
+			opts.DisableUptime = true
+		}, []string{
+			"service_http_hijacked_connections", "service_http_request_count_total", "service_http_request_duration_seconds",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			tt.opts(opts)
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.POST("/users", listUsers)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("body")))
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, mf := range families {
+				got = append(got, mf.GetName())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got the metrics %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsLowOverhead(t *testing.T) {
+	tests := []struct {
+		name   string
+		status StatusLabelMode
+		path   string
+		want   []string
+	}{
+		{"status class", StatusCodeLabel, "/users", []string{"2xx", "/users", http.MethodGet}},
+		{"status code and class", StatusCodeAndClassLabels, "/users", []string{"200", "/users", http.MethodGet, "2xx"}},
+		{"upgrade", StatusCodeLabel, "/upgrade", []string{"1xx", "/upgrade", http.MethodGet}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.LowOverhead = true
+			opts.StatusLabel = tt.status
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			r.GET("/upgrade", func(c *gin.Context) { c.Status(http.StatusSwitchingProtocols) })
+			req := httptest.NewRequest(http.MethodGet, tt.path, strings.NewReader("body"))
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, mf := range families {
+				got = append(got, mf.GetName())
+			}
+			if want := "service_http_request_count_total,service_http_request_duration_seconds"; strings.Join(got, ",") != want {
+				t.Errorf("got the metrics %v, want %v", got, want)
+			}
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.uptime != nil {
+				t.Error("got the uptime counter")
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.want...)); got != 1 {
+				t.Errorf("got %v requests labelled %v, want 1", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsUptimeMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          UptimeMode
+		wantUptime    bool
+		wantStartTime bool
+	}{
+		{"counter", UptimeCounter, true, false},
+		{"start time", StartTimeGauge, false, true},
+		{"both", UptimeCounterAndStartTime, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.UptimeMode = tt.mode
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]bool{}
+			for _, mf := range families {
+				got[mf.GetName()] = true
+			}
+			if got["service_uptime"] != tt.wantUptime {
+				t.Errorf("got the uptime counter %v, want %v", got["service_uptime"], tt.wantUptime)
+			}
+			if got["service_start_time_seconds"] != tt.wantStartTime {
+				t.Errorf("got the start time gauge %v, want %v", got["service_start_time_seconds"], tt.wantStartTime)
+			}
+			if _, ticking := uptimeCounters.Load(m.uptime); ticking != tt.wantUptime {
+				t.Errorf("got the uptime ticker %v, want %v", ticking, tt.wantUptime)
+			}
+			if tt.wantStartTime {
+				start := testutil.ToFloat64(m.startTime)
+				if since := time.Since(time.Unix(0, int64(start*1e9))); since < 0 || since > time.Hour {
+					t.Errorf("got start time %v, %v ago", start, since)
+				}
+			}
+		})
+	}
+}
+
+func TestApdexZone(t *testing.T) {
+	target := 100 * time.Millisecond
+	tests := []struct {
+		name        string
+		elapsed     time.Duration
+		serverError bool
+		want        string
+	}{
+		{"fast", 10 * time.Millisecond, false, ApdexSatisfied},
+		{"at target", target, false, ApdexSatisfied},
+		{"above target", target + 1, false, ApdexTolerating},
+		{"at four times target", 4 * target, false, ApdexTolerating},
+		{"slow", 4*target + 1, false, ApdexFrustrated},
+		{"fast server error", 10 * time.Millisecond, true, ApdexFrustrated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apdexZone(tt.elapsed, target, tt.serverError); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsApdexTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		sleep  time.Duration
+		status int
+		want   string
+	}{
+		{"satisfied", 0, http.StatusOK, ApdexSatisfied},
+		{"tolerating", 15 * time.Millisecond, http.StatusOK, ApdexTolerating},
+		{"frustrated", 50 * time.Millisecond, http.StatusOK, ApdexFrustrated},
+		{"server error", 0, http.StatusBadGateway, ApdexFrustrated},
+		{"client error", 0, http.StatusNotFound, ApdexSatisfied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.ApdexTarget = 10 * time.Millisecond
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/apdex", func(c *gin.Context) {
+				time.Sleep(tt.sleep)
+				c.Status(tt.status)
+			})
+			serve(r, http.MethodGet, "/apdex")
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, zone := range []string{ApdexSatisfied, ApdexTolerating, ApdexFrustrated} {
+				want := 0.0
+				if zone == tt.want {
+					want = 1
+				}
+				if got := testutil.ToFloat64(m.apdex.WithLabelValues("/apdex", zone)); got != want {
+					t.Errorf("got %v %s requests, want %v", got, zone, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsSeriesCache(t *testing.T) {
+	m, err := newMetrics(NewDefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/series-cache"
+
+	first := m.series(http.StatusOK, path, http.MethodGet)
+	if m.series(http.StatusOK, path, http.MethodGet) != first {
+		t.Error("the series aren't cached")
+	}
+	if m.series(http.StatusNotFound, path, http.MethodGet) == first {
+		t.Error("different labels share the series")
+	}
+
+	before := testutil.ToFloat64(m.reqCount.WithLabelValues("200", path, http.MethodGet))
+	first.count.Inc()
+	if got := testutil.ToFloat64(m.reqCount.WithLabelValues("200", path, http.MethodGet)) - before; got != 1 {
+		t.Errorf("the cached counter isn't the series of the vector, got %v", got)
+	}
+}
+
+func TestPromMiddlewareAggregateFiltered(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      PromOpts
+		method    string
+		path      string
+		status    int
+		wantLabel []string
+	}{
+		{"endpoint", PromOpts{ExcludeRegexEndpoint: "^/filtered-endpoint$"},
+			http.MethodGet, "/filtered-endpoint", http.StatusOK, []string{"200", FilteredLabelValue, http.MethodGet}},
+		{"status", PromOpts{ExcludeRegexStatus: "^418$"},
+			http.MethodGet, "/filtered-status", http.StatusTeapot, []string{FilteredLabelValue, "/filtered-status", http.MethodGet}},
+		{"method", PromOpts{ExcludeRegexMethod: "^PUT$"},
+			http.MethodPut, "/filtered-method", http.StatusOK, []string{"200", "/filtered-method", FilteredLabelValue}},
+		{"all", PromOpts{ExcludeRegexStatus: ".", ExcludeRegexEndpoint: ".", ExcludeRegexMethod: "."},
+			http.MethodGet, "/filtered-all", http.StatusOK, []string{FilteredLabelValue, FilteredLabelValue, FilteredLabelValue}},
+	}
+
+	for _, tt := range tests {
+		for _, aggregate := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s aggregated %v", tt.name, aggregate), func(t *testing.T) {
+				opts := tt.opts
+				opts.AggregateFiltered = aggregate
+				r := gin.New()
+				r.Use(PromMiddleware(&opts))
+				r.Handle(tt.method, tt.path, func(c *gin.Context) {
+					c.Status(tt.status)
+				})
+
+				m, err := newMetrics(NewDefaultOpts())
+				if err != nil {
+					t.Fatal(err)
+				}
+				filtered := m.reqCount.WithLabelValues(tt.wantLabel...)
+				unfiltered := m.reqCount.WithLabelValues(strconv.Itoa(tt.status), tt.path, tt.method)
+				beforeFiltered, beforeUnfiltered := testutil.ToFloat64(filtered), testutil.ToFloat64(unfiltered)
+				serve(r, tt.method, tt.path)
+
+				want := 0.0
+				if aggregate {
+					want = 1
+				}
+				if got := testutil.ToFloat64(filtered) - beforeFiltered; got != want {
+					t.Errorf("got %v filtered requests, want %v", got, want)
+				}
+				if got := testutil.ToFloat64(unfiltered) - beforeUnfiltered; got != 0 {
+					t.Errorf("got %v requests with the excluded labels", got)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkPromMiddleware(b *testing.B) {
+	r := gin.New()
+	r.Use(PromMiddleware(nil))
+	r.GET("/bench", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/bench", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func TestPromOptsRegisterer(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(reg *prometheus.Registry) *PromOpts
+		want []string
+	}{
+		{"default options", func(reg *prometheus.Registry) *PromOpts {
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			return opts
+		}, []string{"service_http_request_count_total", "service_uptime"}},
+		{"labels the default registry refuses", func(reg *prometheus.Registry) *PromOpts {
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.ConstLabels = prometheus.Labels{"conflict": "private"}
+			opts.ResponseSizeType = HistogramMetric
+			return opts
+		}, []string{"service_http_request_count_total", "service_http_response_size_bytes"}},
+		{"golden signals", func(reg *prometheus.Registry) *PromOpts {
+			opts := GoldenSignals()
+			opts.Registerer = reg
+			return opts
+		}, []string{"service_http_requests_in_flight", "go_goroutines"}},
+	}
+
+	path := "/private-registry"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := tt.opts(reg)
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET(path, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			events, err := opts.NewCounter("private_events_total", "Private events.")
+			if err != nil {
+				t.Fatal(err)
+			}
+			events.WithLabelValues().Inc()
+			serve(r, http.MethodGet, path)
+
+			mfs, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := map[string]bool{}
+			for _, mf := range mfs {
+				names[mf.GetName()] = true
+			}
+			for _, name := range append(tt.want, "service_private_events_total") {
+				if !names[name] {
+					t.Errorf("%s isn't in the private registry", name)
+				}
+			}
+
+			mfs, err = prometheus.DefaultGatherer.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mf := range mfs {
+				if mf.GetName() == "service_private_events_total" {
+					t.Error("the application metric is in the default registry")
+				}
+				for _, m := range mf.GetMetric() {
+					for _, lp := range m.GetLabel() {
+						if lp.GetName() == "endpoint" && lp.GetValue() == path {
+							t.Errorf("the request is recorded in the default registry by %s", mf.GetName())
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPromOptsNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		subsystem string
+		prefix    string
+	}{
+		{"default", "", "", "service_"},
+		{"namespace", "myapi", "", "myapi_"},
+		{"subsystem", "myapi", "v2", "myapi_v2_"},
+		{"subsystem only", "", "v2", "service_v2_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.Namespace = tt.namespace
+			opts.Subsystem = tt.subsystem
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/namespaced", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			events, err := opts.NewCounter("events_total", "Events.")
+			if err != nil {
+				t.Fatal(err)
+			}
+			events.WithLabelValues().Inc()
+			serve(r, http.MethodGet, "/namespaced")
+
+			mfs, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := map[string]bool{}
+			for _, mf := range mfs {
+				names[mf.GetName()] = true
+			}
+			for _, name := range []string{"http_request_count_total", "http_request_duration_seconds", "uptime", "events_total"} {
+				if !names[tt.prefix+name] {
+					t.Errorf("%s%s isn't registered, got %v", tt.prefix, name, names)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointLabelMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping RequestLabelMappingFn
+		path    string
+		status  string
+		want    string
+	}{
+		{"route", RoutePath, "/users/42", "200", "/users/:id"},
+		{"static route", RoutePath, "/static", "200", "/static"},
+		{"unmatched route", RoutePath, "/nowhere", "404", "/nowhere"},
+		{"url path", URLPath, "/users/42", "200", "/users/42"},
+		{"default", nil, "/users/42", "200", "/users/:id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := &PromOpts{Registerer: reg, EndpointLabelMappingFn: tt.mapping}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users/:id", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			r.GET("/static", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			serve(r, http.MethodGet, tt.path)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.status, tt.want, http.MethodGet)); got != 1 {
+				t.Errorf("got %v requests labelled %s, want 1", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsCollapseUnmatchedRoutes(t *testing.T) {
+	tests := []struct {
+		name     string
+		collapse bool
+		mapping  RequestLabelMappingFn
+		method   string
+		path     string
+		status   string
+		want     string
+	}{
+		{"matched route", true, nil, http.MethodGet, "/users/42", "200", "/users/:id"},
+		{"unmatched route", true, nil, http.MethodGet, "/wp-admin.php", "404", NotFoundEndpointValue},
+		{"unmatched url path", true, URLPath, http.MethodGet, "/.env", "404", NotFoundEndpointValue},
+		{"matched url path", true, URLPath, http.MethodGet, "/users/42", "200", "/users/42"},
+		{"not allowed method", true, nil, http.MethodPost, "/users/42", "405", NotFoundEndpointValue},
+		{"disabled", false, nil, http.MethodGet, "/wp-admin.php", "404", "/wp-admin.php"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &PromOpts{
+				Registerer:              prometheus.NewRegistry(),
+				EndpointLabelMappingFn:  tt.mapping,
+				CollapseUnmatchedRoutes: tt.collapse,
+			}
+			r := gin.New()
+			r.HandleMethodNotAllowed = true
+			r.Use(PromMiddleware(opts))
+			r.GET("/users/:id", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			r.NoRoute(func(c *gin.Context) {
+				c.String(http.StatusNotFound, "not found")
+			})
+			serve(r, tt.method, tt.path)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.status, tt.want, tt.method)); got != 1 {
+				t.Errorf("got %v requests labelled %s, want 1", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsEndpointLabel(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       int
+		endpoints []string
+		want      []string
+	}{
+		{"no limit", 0, []string{"/a", "/b", "/c"}, []string{"/a", "/b", "/c"}},
+		{"under the limit", 3, []string{"/a", "/b", "/a"}, []string{"/a", "/b", "/a"}},
+		{"over the limit", 2,
+			[]string{"/a", "/b", "/a", "/c", "/b", "/d"},
+			[]string{"/a", "/b", "/a", OtherEndpointValue, "/b", OtherEndpointValue}},
+		{"filtered endpoints aren't counted", 1,
+			[]string{FilteredLabelValue, "/a", FilteredLabelValue, "/b"},
+			[]string{FilteredLabelValue, "/a", FilteredLabelValue, OtherEndpointValue}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &metrics{}
+			var got []string
+			for _, endpoint := range tt.endpoints {
+				got = append(got, m.endpointLabel(endpoint, tt.max))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsEndpointLabelConcurrent(t *testing.T) {
+	m := &metrics{}
+	var wg sync.WaitGroup
+	var kept atomic.Int64
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if m.endpointLabel(fmt.Sprintf("/%d", i%50), 10) != OtherEndpointValue {
+				kept.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got := m.endpointCount.Load(); got != 10 {
+		t.Errorf("got %d endpoints, want 10", got)
+	}
+	if got := kept.Load(); got < 10 || got > 20 {
+		t.Errorf("got %d requests kept, want between 10 and 20", got)
+	}
+}
+
+func TestPromMiddlewareMaxEndpointCardinality(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	opts := NewDefaultOpts()
+	opts.Registerer = reg
+	opts.EndpointLabelMappingFn = URLPath
+	opts.MaxEndpointCardinality = 2
+	r := gin.New()
+	r.Use(PromMiddleware(opts))
+	r.GET("/items/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	for _, path := range []string{"/items/1", "/items/2", "/items/3", "/items/4", "/items/1"} {
+		serve(r, http.MethodGet, path)
+	}
+
+	m, err := newMetrics(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		endpoint string
+		want     float64
+	}{
+		{"/items/1", 2},
+		{"/items/2", 1},
+		{"/items/3", 0},
+		{OtherEndpointValue, 2},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(m.reqCount.WithLabelValues("200", tt.endpoint, http.MethodGet)); got != tt.want {
+			t.Errorf("got %v requests to %s, want %v", got, tt.endpoint, tt.want)
+		}
+	}
+}
+
+func TestPromOptsObserversOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		warmup     time.Duration
+		wantWarmup bool
+	}{
+		{"observers only", 0, false},
+		{"warming up", time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			var observed []Observation
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.ObserversOnly = true
+			opts.WarmupPeriod = tt.warmup
+			opts.Observers = []Observer{observerFunc(func(o Observation) { observed = append(observed, o) })}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/observers-only", func(c *gin.Context) {
+				c.String(http.StatusOK, "ok")
+			})
+			serve(r, http.MethodGet, "/observers-only")
+
+			if len(observed) != 1 {
+				t.Fatalf("got %d observations, want 1", len(observed))
+			}
+			if o := observed[0]; o.Endpoint != "/observers-only" || o.ResponseSize != 2 || o.Warmup != tt.wantWarmup {
+				t.Errorf("got observation %+v", o)
+			}
+			if n, err := testutil.GatherAndCount(reg); err != nil || n != 0 {
+				t.Errorf("got %d metrics registered, %v", n, err)
+			}
+		})
+	}
+}
+
+func TestPromOptsSlowRequestThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		sleep     time.Duration
+		wantSlow  bool
+	}{
+		{"slow", 5 * time.Millisecond, 20 * time.Millisecond, true},
+		{"fast", time.Second, 0, false},
+		{"disabled", 0, 5 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			var slow []time.Duration
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.SlowRequestThreshold = tt.threshold
+			opts.OnSlowRequest = func(c *gin.Context, d time.Duration) {
+				if c.FullPath() != "/slow" {
+					t.Errorf("got the context of %s", c.FullPath())
+				}
+				slow = append(slow, d)
+			}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/slow", func(c *gin.Context) {
+				time.Sleep(tt.sleep)
+				c.Status(http.StatusOK)
+			})
+			serve(r, http.MethodGet, "/slow")
+
+			if got := len(slow) == 1; got != tt.wantSlow {
+				t.Errorf("got slow request callbacks %v", slow)
+			}
+			if tt.wantSlow && slow[0] < tt.sleep {
+				t.Errorf("got duration %v, want at least %v", slow[0], tt.sleep)
+			}
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.threshold <= 0 {
+				if m.slowRequests != nil {
+					t.Error("the slow request counter is registered without threshold")
+				}
+				return
+			}
+			want := 0.0
+			if tt.wantSlow {
+				want = 1
+			}
+			if got := testutil.ToFloat64(m.slowRequests.WithLabelValues("/slow", http.MethodGet)); got != want {
+				t.Errorf("got %v slow requests, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPromOptsInFlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    func(opts *PromOpts)
+		byRoute bool
+		none    bool
+	}{
+		{"disabled", func(opts *PromOpts) {}, false, true},
+		{"in-flight", func(opts *PromOpts) { opts.InFlightRequests = true }, false, false},
+		{"golden signals", func(opts *PromOpts) { opts.goldenSignals = true }, false, false},
+		{"by route", func(opts *PromOpts) { opts.InFlightByRoute = true }, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			tt.opts(opts)
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.none {
+				if m.inFlight != nil || m.inFlightByRoute != nil {
+					t.Error("the in-flight gauge is registered")
+				}
+				return
+			}
+			gauge := m.inFlight
+			if tt.byRoute {
+				gauge = m.inFlightByRoute.WithLabelValues("/in-flight/:id", http.MethodGet)
+			}
+
+			entered, release := make(chan struct{}), make(chan struct{})
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/in-flight/:id", func(c *gin.Context) {
+				close(entered)
+				<-release
+				c.Status(http.StatusOK)
+			})
+			done := make(chan struct{})
+			go func() {
+				serve(r, http.MethodGet, "/in-flight/1")
+				close(done)
+			}()
+
+			<-entered
+			if got := testutil.ToFloat64(gauge); got != 1 {
+				t.Errorf("got %v requests in flight while served, want 1", got)
+			}
+			close(release)
+			<-done
+			if got := testutil.ToFloat64(gauge); got != 0 {
+				t.Errorf("got %v requests in flight once served, want 0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package ginprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// goldenDurationBuckets covers 1ms to 30s, which suits most HTTP APIs better than prometheus.DefBuckets
+var goldenDurationBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// GoldenSignals returns the options of a middleware exporting the four golden signals:
+// latency (duration histogram with 1ms-30s buckets), traffic (request count),
+// errors (5xx counter) and saturation (in-flight gauge plus Go runtime and process collectors)
+func GoldenSignals() *PromOpts {
+	opts := NewDefaultOpts()
+	opts.goldenSignals = true
+	return opts
+}
+
+// CollectorToggle selects whether a middleware registers a collector
+type CollectorToggle int
+
+const (
+	// CollectorDefault registers the collector with the GoldenSignals options only
+	CollectorDefault CollectorToggle = iota
+	// CollectorEnabled registers the collector
+	CollectorEnabled
+	// CollectorDisabled doesn't register the collector, even with the GoldenSignals options
+	CollectorDisabled
+)
+
+// enabled reports whether the collector is registered, by default when golden is
+func (t CollectorToggle) enabled(golden bool) bool {
+	return t == CollectorEnabled || t == CollectorDefault && golden
+}
+
+// registerRuntimeCollectors registers the Go runtime and process collectors promOpts
+// enables, which the default registry may already contain
+func registerRuntimeCollectors(r *registration, promOpts *PromOpts) {
+	if promOpts.GoCollector.enabled(promOpts.goldenSignals) {
+		registerOrReuse(r, prometheus.NewGoCollector())
+	}
+	if promOpts.ProcessCollector.enabled(promOpts.goldenSignals) {
+		registerOrReuse(r, prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	}
+}
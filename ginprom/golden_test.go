@@ -0,0 +1,67 @@
+package ginprom
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPromOptsRuntimeCollectors(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        func() *PromOpts
+		wantGo      bool
+		wantProcess bool
+	}{
+		{"default", NewDefaultOpts, false, false},
+		{"golden signals", GoldenSignals, true, true},
+		{"go collector", func() *PromOpts {
+			opts := NewDefaultOpts()
+			opts.GoCollector = CollectorEnabled
+			return opts
+		}, true, false},
+		{"process collector", func() *PromOpts {
+			opts := NewDefaultOpts()
+			opts.ProcessCollector = CollectorEnabled
+			return opts
+		}, false, true},
+		{"golden signals without go collector", func() *PromOpts {
+			opts := GoldenSignals()
+			opts.GoCollector = CollectorDisabled
+			return opts
+		}, false, true},
+		{"golden signals without both", func() *PromOpts {
+			opts := GoldenSignals()
+			opts.GoCollector = CollectorDisabled
+			opts.ProcessCollector = CollectorDisabled
+			return opts
+		}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := tt.opts()
+			opts.Registerer = reg
+			if _, err := NewPromMiddleware(opts); err != nil {
+				t.Fatal(err)
+			}
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]bool{}
+			for _, mf := range families {
+				got[mf.GetName()] = true
+			}
+			if got["go_goroutines"] != tt.wantGo {
+				t.Errorf("got the Go collector %v, want %v", got["go_goroutines"], tt.wantGo)
+			}
+			// the process metrics are only collected where /proc exists
+			if tt.wantProcess != reg.Unregister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{})) {
+				t.Errorf("got the process collector %v, want %v", !tt.wantProcess, tt.wantProcess)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package ginprom
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GroupLabel is the label of the router group prefix added by UseGroup
+const GroupLabel = "group"
+
+// UseGroup attaches the middleware to group, labelling the requests of its routes with the
+// group label, its prefix like /api/v1, so the versioned APIs compare without regexes. The
+// groups attached with the same options share the metrics, while the requests outside of
+// them aren't recorded, and the ones of nested groups both attached are recorded twice.
+// The group label is added to a copy of PromOpts.ExtraLabels
+func UseGroup(group *gin.RouterGroup, promOpts *PromOpts) error {
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	if _, ok := promOpts.ExtraLabels[GroupLabel]; ok {
+		return fmt.Errorf("ginprom: extra label %q is the label of the router groups", GroupLabel)
+	}
+
+	opts := *promOpts
+	opts.ExtraLabels = make(map[string]RequestLabelMappingFn, len(promOpts.ExtraLabels)+1)
+	for name, fn := range promOpts.ExtraLabels {
+		opts.ExtraLabels[name] = fn
+	}
+	prefix := group.BasePath()
+	opts.ExtraLabels[GroupLabel] = func(*gin.Context) string { return prefix }
+
+	mw, err := NewPromMiddleware(&opts)
+	if err != nil {
+		return err
+	}
+	group.Use(mw)
+	return nil
+}
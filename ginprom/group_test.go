@@ -0,0 +1,72 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUseGroup(t *testing.T) {
+	tenant := func(c *gin.Context) string { return "acme" }
+	tests := []struct {
+		name   string
+		labels map[string]RequestLabelMappingFn
+		path   string
+		want   []string
+	}{
+		{"v1", nil, "/api/v1/users", []string{"200", "/api/v1/users", http.MethodGet, "/api/v1"}},
+		{"v2", nil, "/api/v2/users", []string{"200", "/api/v2/users", http.MethodGet, "/api/v2"}},
+		{"with extra labels", map[string]RequestLabelMappingFn{"tenant": tenant}, "/api/v2/users",
+			[]string{"200", "/api/v2/users", http.MethodGet, "/api/v2", "acme"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.ExtraLabels = tt.labels
+			r := gin.New()
+			for _, prefix := range []string{"/api/v1", "/api/v2"} {
+				group := r.Group(prefix)
+				if err := UseGroup(group, opts); err != nil {
+					t.Fatal(err)
+				}
+				group.GET("/users", listUsers)
+			}
+			r.GET("/health", listUsers)
+			serve(r, http.MethodGet, tt.path)
+			serve(r, http.MethodGet, "/health")
+
+			if _, ok := opts.ExtraLabels[GroupLabel]; ok {
+				t.Error("the group label was added to the options")
+			}
+			grouped := *opts
+			grouped.ExtraLabels = map[string]RequestLabelMappingFn{GroupLabel: URLPath}
+			for name, fn := range tt.labels {
+				grouped.ExtraLabels[name] = fn
+			}
+			m, err := newMetrics(&grouped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.want...)); got != 1 {
+				t.Errorf("got %v requests labelled %v, want 1", got, tt.want)
+			}
+			if got := testutil.CollectAndCount(m.reqCount); got != 1 {
+				t.Errorf("got %d series, want the one of the group route", got)
+			}
+		})
+	}
+}
+
+func TestUseGroupConflict(t *testing.T) {
+	opts := NewDefaultOpts()
+	opts.Registerer = prometheus.NewRegistry()
+	opts.ExtraLabels = map[string]RequestLabelMappingFn{GroupLabel: func(c *gin.Context) string { return "" }}
+	if err := UseGroup(gin.New().Group("/api"), opts); err == nil {
+		t.Error("got no error")
+	}
+}
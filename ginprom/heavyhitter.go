@@ -0,0 +1,145 @@
+package ginprom
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultHeavyHitterTopN = 5
+
+// HeavyHitters is an Observer and Collector which exports the endpoints
+// contributing most to the total latency and error count of the last interval
+type HeavyHitters struct {
+	topN     int
+	interval time.Duration
+
+	mu      sync.Mutex
+	latency map[string]float64
+	errors  map[string]float64
+
+	latencyGauge *prometheus.GaugeVec
+	errorsGauge  *prometheus.GaugeVec
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewHeavyHitters returns a started HeavyHitters which keeps the topN endpoints
+// and refreshes its gauges every minute, it still needs to be registered
+func NewHeavyHitters(topN int) *HeavyHitters {
+	if topN <= 0 {
+		topN = defaultHeavyHitterTopN
+	}
+
+	h := &HeavyHitters{
+		topN:     topN,
+		interval: time.Minute,
+		latency:  make(map[string]float64),
+		errors:   make(map[string]float64),
+		latencyGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "heavy_hitter_latency_seconds",
+			Help:      "Sum of request duration of the endpoints contributing most to latency in the last minute",
+		}, []string{"endpoint", "rank"}),
+		errorsGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "heavy_hitter_errors",
+			Help:      "Error count of the endpoints contributing most to errors in the last minute",
+		}, []string{"endpoint", "rank"}),
+		stop: make(chan struct{}),
+	}
+
+	go h.run()
+	return h
+}
+
+// Describe implements prometheus.Collector
+func (h *HeavyHitters) Describe(ch chan<- *prometheus.Desc) {
+	h.latencyGauge.Describe(ch)
+	h.errorsGauge.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (h *HeavyHitters) Collect(ch chan<- prometheus.Metric) {
+	h.latencyGauge.Collect(ch)
+	h.errorsGauge.Collect(ch)
+}
+
+// Observe implements Observer
+func (h *HeavyHitters) Observe(o Observation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latency[o.Endpoint] += o.Duration.Seconds()
+	if o.StatusCode >= 500 {
+		h.errors[o.Endpoint]++
+	}
+}
+
+// Stop stops refreshing the gauges
+func (h *HeavyHitters) Stop() {
+	h.once.Do(func() { close(h.stop) })
+}
+
+func (h *HeavyHitters) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.flush()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// flush publishes the top endpoints of the finished interval and starts a new one
+func (h *HeavyHitters) flush() {
+	h.mu.Lock()
+	latency, errors := h.latency, h.errors
+	h.latency = make(map[string]float64, len(latency))
+	h.errors = make(map[string]float64, len(errors))
+	h.mu.Unlock()
+
+	setTopN(h.latencyGauge, latency, h.topN)
+	setTopN(h.errorsGauge, errors, h.topN)
+}
+
+type endpointValue struct {
+	endpoint string
+	value    float64
+}
+
+// topN returns the n endpoints with the highest values, highest first
+func topN(values map[string]float64, n int) []endpointValue {
+	sorted := make([]endpointValue, 0, len(values))
+	for endpoint, value := range values {
+		if value > 0 {
+			sorted = append(sorted, endpointValue{endpoint, value})
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].value == sorted[j].value {
+			return sorted[i].endpoint < sorted[j].endpoint
+		}
+		return sorted[i].value > sorted[j].value
+	})
+
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func setTopN(gauge *prometheus.GaugeVec, values map[string]float64, n int) {
+	gauge.Reset()
+	for i, ev := range topN(values, n) {
+		gauge.WithLabelValues(ev.endpoint, strconv.Itoa(i+1)).Set(ev.value)
+	}
+}
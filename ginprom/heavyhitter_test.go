@@ -0,0 +1,83 @@
+package ginprom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTopN(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]float64
+		n      int
+		want   []endpointValue
+	}{
+		{
+			name:   "empty",
+			values: map[string]float64{},
+			n:      3,
+			want:   []endpointValue{},
+		},
+		{
+			name:   "highest first and truncated",
+			values: map[string]float64{"/a": 1, "/b": 3, "/c": 2},
+			n:      2,
+			want:   []endpointValue{{"/b", 3}, {"/c", 2}},
+		},
+		{
+			name:   "ties ordered by endpoint",
+			values: map[string]float64{"/b": 1, "/a": 1},
+			n:      5,
+			want:   []endpointValue{{"/a", 1}, {"/b", 1}},
+		},
+		{
+			name:   "zero values skipped",
+			values: map[string]float64{"/a": 0, "/b": 1},
+			n:      5,
+			want:   []endpointValue{{"/b", 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := topN(tt.values, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("topN() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeavyHittersFlush(t *testing.T) {
+	h := NewHeavyHitters(1)
+	defer h.Stop()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(h)
+
+	h.Observe(Observation{Endpoint: "/slow", StatusCode: 200, Duration: 2 * time.Second})
+	h.Observe(Observation{Endpoint: "/fast", StatusCode: 500, Duration: time.Second})
+	h.flush()
+
+	expected := `
+# HELP service_heavy_hitter_errors Error count of the endpoints contributing most to errors in the last minute
+# TYPE service_heavy_hitter_errors gauge
+service_heavy_hitter_errors{endpoint="/fast",rank="1"} 1
+# HELP service_heavy_hitter_latency_seconds Sum of request duration of the endpoints contributing most to latency in the last minute
+# TYPE service_heavy_hitter_latency_seconds gauge
+service_heavy_hitter_latency_seconds{endpoint="/slow",rank="1"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// a quiet interval clears the gauges
+	h.flush()
+	if n := testutil.CollectAndCount(h); n != 0 {
+		t.Errorf("got %d series after an empty interval, want 0", n)
+	}
+}
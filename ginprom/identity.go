@@ -0,0 +1,68 @@
+package ginprom
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DownwardAPIDir is where the Kubernetes Downward API volume is expected to be mounted
+var DownwardAPIDir = "/etc/podinfo"
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// identitySources lists, per label, the env vars and files tried in order, then the
+// env vars only meaningful inside Kubernetes
+var identitySources = []struct {
+	label       string
+	envs        []string
+	files       []string
+	clusterEnvs []string
+}{
+	{"pod", []string{"POD_NAME"}, []string{"name"}, []string{"HOSTNAME"}},
+	{"node", []string{"NODE_NAME"}, []string{"nodename"}, nil},
+	{"namespace", []string{"POD_NAMESPACE"}, []string{"namespace", serviceAccountNamespaceFile}, nil},
+}
+
+// InstanceLabels returns the pod, node and namespace of the running instance, read from
+// the POD_NAME, NODE_NAME and POD_NAMESPACE env vars or from the Downward API files
+// in DownwardAPIDir, labels which can't be found are left out. Inside Kubernetes the pod
+// falls back to HOSTNAME, which is the pod name there
+func InstanceLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	inCluster := os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+
+	for _, source := range identitySources {
+		value := lookupIdentity(source.envs, source.files)
+		if value == "" && inCluster {
+			value = lookupIdentity(source.clusterEnvs, nil)
+		}
+		if value != "" {
+			labels[source.label] = value
+		}
+	}
+	return labels
+}
+
+func lookupIdentity(envs, files []string) string {
+	for _, env := range envs {
+		if value := os.Getenv(env); value != "" {
+			return value
+		}
+	}
+	for _, file := range files {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(DownwardAPIDir, file)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if value := strings.TrimSpace(string(content)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
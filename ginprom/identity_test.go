@@ -0,0 +1,74 @@
+package ginprom
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstanceLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		envs  map[string]string
+		files map[string]string
+		want  map[string]string
+	}{
+		{
+			name: "env vars",
+			envs: map[string]string{"POD_NAME": "web-1", "NODE_NAME": "node-a", "POD_NAMESPACE": "prod"},
+			want: map[string]string{"pod": "web-1", "node": "node-a", "namespace": "prod"},
+		},
+		{
+			name:  "downward API files",
+			files: map[string]string{"name": "web-2\n", "nodename": "node-b", "namespace": "staging"},
+			want:  map[string]string{"pod": "web-2", "node": "node-b", "namespace": "staging"},
+		},
+		{
+			name:  "env vars win over files",
+			envs:  map[string]string{"POD_NAME": "web-1"},
+			files: map[string]string{"name": "web-2"},
+			want:  map[string]string{"pod": "web-1"},
+		},
+		{
+			name: "hostname outside Kubernetes",
+			envs: map[string]string{"HOSTNAME": "laptop"},
+			want: map[string]string{},
+		},
+		{
+			name: "hostname inside Kubernetes",
+			envs: map[string]string{"HOSTNAME": "web-3", "KUBERNETES_SERVICE_HOST": "10.0.0.1"},
+			want: map[string]string{"pod": "web-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"POD_NAME", "NODE_NAME", "POD_NAMESPACE", "HOSTNAME", "KUBERNETES_SERVICE_HOST"} {
+				t.Setenv(env, tt.envs[env])
+			}
+
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer func(old string) { DownwardAPIDir = old }(DownwardAPIDir)
+			DownwardAPIDir = dir
+
+			got := InstanceLabels()
+			if _, ok := tt.want["namespace"]; !ok {
+				// the service account namespace file exists when the tests run in a pod
+				delete(got, "namespace")
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for label, want := range tt.want {
+				if got[label] != want {
+					t.Errorf("label %s = %q, want %q", label, got[label], want)
+				}
+			}
+		})
+	}
+}
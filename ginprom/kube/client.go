@@ -0,0 +1,179 @@
+// Package kube enriches the metrics with the Kubernetes metadata of the running pod,
+// talking to the API server with the in-cluster service account.
+//
+// The service account needs get on pods, and on replicasets in the apps group to
+// resolve Deployments, e.g. with this Role bound to it:
+//
+//	rules:
+//	- apiGroups: [""]
+//	  resources: ["pods"]
+//	  verbs: ["get"]
+//	- apiGroups: ["apps"]
+//	  resources: ["replicasets"]
+//	  verbs: ["get"]
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	defaultTimeout    = 5 * time.Second
+)
+
+// ErrNotInCluster is returned when the process doesn't run inside a Kubernetes pod
+var ErrNotInCluster = errors.New("kube: not running in a Kubernetes cluster")
+
+// Client is a minimal read-only Kubernetes API client
+type Client struct {
+	host  string
+	token string
+	http  *http.Client
+}
+
+// InClusterClient returns a Client configured from the pod service account
+func InClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, ErrNotInCluster
+	}
+
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("kube: invalid service account CA")
+	}
+
+	return &Client{
+		host:  "https://" + net.JoinHostPort(host, port),
+		token: strings.TrimSpace(string(token)),
+		http: &http.Client{
+			Timeout: defaultTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.host+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kube: GET %s: unexpected status %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// OwnerReference is the owner of an object
+type OwnerReference struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Controller bool   `json:"controller"`
+}
+
+// ObjectMeta holds the metadata fields used by this package
+type ObjectMeta struct {
+	Name            string           `json:"name"`
+	Namespace       string           `json:"namespace"`
+	OwnerReferences []OwnerReference `json:"ownerReferences"`
+}
+
+// controller returns the controlling owner, or nil
+func (m ObjectMeta) controller() *OwnerReference {
+	for i, owner := range m.OwnerReferences {
+		if owner.Controller {
+			return &m.OwnerReferences[i]
+		}
+	}
+	return nil
+}
+
+// ResourceRequirements holds the requests and limits of a container
+type ResourceRequirements struct {
+	Requests map[string]string `json:"requests"`
+	Limits   map[string]string `json:"limits"`
+}
+
+// Container is a container of the pod spec
+type Container struct {
+	Name      string               `json:"name"`
+	Resources ResourceRequirements `json:"resources"`
+}
+
+// ContainerStatus is the status of a container
+type ContainerStatus struct {
+	Name         string `json:"name"`
+	RestartCount int    `json:"restartCount"`
+}
+
+// Pod holds the pod fields used by this package
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Containers []Container `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		ContainerStatuses []ContainerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// Pod fetches a pod
+func (c *Client) Pod(ctx context.Context, namespace, name string) (*Pod, error) {
+	pod := &Pod{}
+	err := c.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", namespace, name), pod)
+	return pod, err
+}
+
+// Workload returns the kind and name of the workload controlling the pod,
+// following ReplicaSets up to their Deployment
+func (c *Client) Workload(ctx context.Context, pod *Pod) (kind, name string, err error) {
+	owner := pod.Metadata.controller()
+	if owner == nil {
+		return "Pod", pod.Metadata.Name, nil
+	}
+	if owner.Kind != "ReplicaSet" {
+		return owner.Kind, owner.Name, nil
+	}
+
+	rs := &struct {
+		Metadata ObjectMeta `json:"metadata"`
+	}{}
+	path := fmt.Sprintf("/apis/apps/v1/namespaces/%s/replicasets/%s", pod.Metadata.Namespace, owner.Name)
+	if err := c.get(ctx, path, rs); err != nil {
+		return "", "", err
+	}
+	if deployment := rs.Metadata.controller(); deployment != nil {
+		return deployment.Kind, deployment.Name, nil
+	}
+	return owner.Kind, owner.Name, nil
+}
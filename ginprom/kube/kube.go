@@ -0,0 +1,189 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ginmetric/ginprom"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// namespace avoids clashing with the kube_* series of kube-state-metrics
+	namespace              = "ginprom"
+	defaultRefreshInterval = 30 * time.Second
+)
+
+// resourceUnits are the units of the resource quantities, once parsed
+var resourceUnits = map[string]string{
+	"cpu":               "core",
+	"memory":            "byte",
+	"ephemeral-storage": "byte",
+}
+
+// Self fetches the pod the process is running in, identified by ginprom.InstanceLabels
+func (c *Client) Self(ctx context.Context) (*Pod, error) {
+	labels := ginprom.InstanceLabels()
+	if labels["pod"] == "" || labels["namespace"] == "" {
+		return nil, errors.New("kube: unable to identify the pod, set POD_NAME and POD_NAMESPACE")
+	}
+	return c.Pod(ctx, labels["namespace"], labels["pod"])
+}
+
+// WorkloadLabels returns the workload and workload_kind labels of the running pod,
+// meant to be merged into ginprom.PromOpts.ConstLabels
+func WorkloadLabels(ctx context.Context, c *Client) (prometheus.Labels, error) {
+	pod, err := c.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kind, name, err := c.Workload(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+	return prometheus.Labels{"workload": name, "workload_kind": strings.ToLower(kind)}, nil
+}
+
+// PodCollector exports the restart count and resource requests/limits of the
+// containers of the running pod, refreshing them at most every RefreshInterval.
+// When the pod can't be fetched, like outside Kubernetes, only ginprom_pod_info_up
+// is exported, at 0, so the scrape of the other metrics still succeeds
+type PodCollector struct {
+	client *Client
+
+	// RefreshInterval is how long a fetched pod is reused across scrapes
+	RefreshInterval time.Duration
+	// OnError is called with the error of the first failed fetch after a successful
+	// one or the start, the error being logged if nil
+	OnError func(err error)
+
+	mu      sync.Mutex
+	pod     *Pod
+	fetched time.Time
+	failing bool
+
+	up       *prometheus.Desc
+	restarts *prometheus.Desc
+	requests *prometheus.Desc
+	limits   *prometheus.Desc
+}
+
+// NewPodCollector returns a PodCollector, it still needs to be registered
+func NewPodCollector(c *Client) *PodCollector {
+	return &PodCollector{
+		client:          c,
+		RefreshInterval: defaultRefreshInterval,
+		up: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pod", "info_up"),
+			"1 if the running pod was fetched from the API server, 0 if it couldn't be",
+			nil, nil),
+		restarts: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pod", "container_restarts_total"),
+			"Number of restarts of the container of the running pod",
+			[]string{"container"}, nil),
+		requests: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pod", "container_resource_requests"),
+			"Resource requests of the container of the running pod",
+			[]string{"container", "resource", "unit"}, nil),
+		limits: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pod", "container_resource_limits"),
+			"Resource limits of the container of the running pod",
+			[]string{"container", "resource", "unit"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (pc *PodCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pc.up
+	ch <- pc.restarts
+	ch <- pc.requests
+	ch <- pc.limits
+}
+
+// Collect implements prometheus.Collector
+func (pc *PodCollector) Collect(ch chan<- prometheus.Metric) {
+	pod, err := pc.fetch()
+	if err != nil {
+		// an invalid metric would fail the whole scrape
+		ch <- prometheus.MustNewConstMetric(pc.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(pc.up, prometheus.GaugeValue, 1)
+
+	for _, status := range pod.Status.ContainerStatuses {
+		ch <- prometheus.MustNewConstMetric(pc.restarts, prometheus.CounterValue, float64(status.RestartCount), status.Name)
+	}
+	for _, container := range pod.Spec.Containers {
+		collectResources(ch, pc.requests, container.Name, container.Resources.Requests)
+		collectResources(ch, pc.limits, container.Name, container.Resources.Limits)
+	}
+}
+
+func (pc *PodCollector) fetch() (*Pod, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.pod != nil && time.Since(pc.fetched) < pc.RefreshInterval {
+		return pc.pod, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	pod, err := pc.client.Self(ctx)
+	if err != nil {
+		// serve the stale pod rather than nothing
+		if pc.pod != nil {
+			return pc.pod, nil
+		}
+		if !pc.failing {
+			pc.failing = true
+			pc.report(err)
+		}
+		return nil, err
+	}
+	pc.pod, pc.fetched, pc.failing = pod, time.Now(), false
+	return pod, nil
+}
+
+// report passes err to OnError, or logs it
+func (pc *PodCollector) report(err error) {
+	if pc.OnError != nil {
+		pc.OnError(err)
+		return
+	}
+	log.Printf("kube: the pod metrics are unavailable: %v", err)
+}
+
+func collectResources(ch chan<- prometheus.Metric, desc *prometheus.Desc, container string, resources map[string]string) {
+	for resource, quantity := range resources {
+		value, err := ParseQuantity(quantity)
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, container, resource, resourceUnits[resource])
+	}
+}
+
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50}, {"Ei", 1 << 60},
+	{"n", 1e-9}, {"u", 1e-6}, {"m", 1e-3},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15}, {"E", 1e18},
+}
+
+// ParseQuantity converts a Kubernetes resource quantity such as "500m" or "1Gi" to a float
+func ParseQuantity(quantity string) (float64, error) {
+	quantity = strings.TrimSpace(quantity)
+	for _, s := range quantitySuffixes {
+		if strings.HasSuffix(quantity, s.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(quantity, s.suffix), 64)
+			return value * s.multiplier, err
+		}
+	}
+	return strconv.ParseFloat(quantity, 64)
+}
@@ -0,0 +1,156 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		quantity string
+		want     float64
+		wantErr  bool
+	}{
+		{quantity: "2", want: 2},
+		{quantity: "500m", want: 0.5},
+		{quantity: "1.5", want: 1.5},
+		{quantity: "128Mi", want: 128 << 20},
+		{quantity: "1Gi", want: 1 << 30},
+		{quantity: "2k", want: 2000},
+		{quantity: "1G", want: 1e9},
+		{quantity: " 5n ", want: 5e-9},
+		{quantity: "abc", wantErr: true},
+		{quantity: "Mi", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.quantity, func(t *testing.T) {
+			got, err := ParseQuantity(tt.quantity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const testPod = `{
+	"metadata": {
+		"name": "web-1",
+		"namespace": "prod",
+		"ownerReferences": [{"kind": "ReplicaSet", "name": "web-5d8f", "controller": true}]
+	},
+	"spec": {"containers": [{"name": "app", "resources": {"requests": {"cpu": "250m", "memory": "64Mi"}, "limits": {"cpu": "1"}}}]},
+	"status": {"containerStatuses": [{"name": "app", "restartCount": 3}]}
+}`
+
+const testReplicaSet = `{"metadata": {"name": "web-5d8f", "ownerReferences": [{"kind": "Deployment", "name": "web", "controller": true}]}}`
+
+func testClient(t *testing.T) *Client {
+	t.Setenv("POD_NAME", "web-1")
+	t.Setenv("POD_NAMESPACE", "prod")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/prod/pods/web-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testPod))
+	})
+	mux.HandleFunc("/apis/apps/v1/namespaces/prod/replicasets/web-5d8f", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testReplicaSet))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return &Client{host: srv.URL, http: srv.Client()}
+}
+
+func TestWorkloadLabels(t *testing.T) {
+	labels, err := WorkloadLabels(context.Background(), testClient(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["workload"] != "web" || labels["workload_kind"] != "deployment" {
+		t.Errorf("got %v, want the web deployment", labels)
+	}
+}
+
+func TestPodCollector(t *testing.T) {
+	pc := NewPodCollector(testClient(t))
+
+	expected := `
+# HELP ginprom_pod_container_resource_limits Resource limits of the container of the running pod
+# TYPE ginprom_pod_container_resource_limits gauge
+ginprom_pod_container_resource_limits{container="app",resource="cpu",unit="core"} 1
+# HELP ginprom_pod_container_resource_requests Resource requests of the container of the running pod
+# TYPE ginprom_pod_container_resource_requests gauge
+ginprom_pod_container_resource_requests{container="app",resource="cpu",unit="core"} 0.25
+ginprom_pod_container_resource_requests{container="app",resource="memory",unit="byte"} 6.7108864e+07
+# HELP ginprom_pod_container_restarts_total Number of restarts of the container of the running pod
+# TYPE ginprom_pod_container_restarts_total counter
+ginprom_pod_container_restarts_total{container="app"} 3
+# HELP ginprom_pod_info_up 1 if the running pod was fetched from the API server, 0 if it couldn't be
+# TYPE ginprom_pod_info_up gauge
+ginprom_pod_info_up 1
+`
+	if err := testutil.CollectAndCompare(pc, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPodCollectorUnavailable(t *testing.T) {
+	tests := []struct {
+		name   string
+		client func(t *testing.T) *Client
+	}{
+		{"outside kubernetes", func(t *testing.T) *Client {
+			t.Setenv("POD_NAME", "")
+			t.Setenv("POD_NAMESPACE", "")
+			return &Client{host: "http://127.0.0.1:0", http: http.DefaultClient}
+		}},
+		{"api server error", func(t *testing.T) *Client {
+			t.Setenv("POD_NAME", "web-1")
+			t.Setenv("POD_NAMESPACE", "prod")
+			srv := httptest.NewServer(http.NotFoundHandler())
+			t.Cleanup(srv.Close)
+			return &Client{host: srv.URL, http: srv.Client()}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := NewPodCollector(tt.client(t))
+			var errs []error
+			pc.OnError = func(err error) { errs = append(errs, err) }
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(pc, prometheus.NewCounter(prometheus.CounterOpts{Name: "app_orders_total", Help: "help"}))
+			h := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("got status %d, want 200: %s", w.Code, w.Body)
+				}
+				for _, want := range []string{"app_orders_total 0", "ginprom_pod_info_up 0"} {
+					if !strings.Contains(w.Body.String(), want) {
+						t.Errorf("got no %s in:\n%s", want, w.Body)
+					}
+				}
+				if strings.Contains(w.Body.String(), "ginprom_pod_container") {
+					t.Errorf("got pod series without a pod:\n%s", w.Body)
+				}
+			}
+			if len(errs) != 1 {
+				t.Errorf("got %d errors reported, want 1: %v", len(errs), errs)
+			}
+		})
+	}
+}
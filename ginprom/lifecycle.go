@@ -0,0 +1,41 @@
+package ginprom
+
+import "sync"
+
+// background holds the stop functions of the goroutines started by the middlewares
+var background struct {
+	mu    sync.Mutex
+	stops []func()
+}
+
+// goBackground runs run in a goroutine until Close closes its stop channel
+func goBackground(run func(stop <-chan struct{})) {
+	stop, done := make(chan struct{}), make(chan struct{})
+
+	background.mu.Lock()
+	background.stops = append(background.stops, func() {
+		close(stop)
+		<-done
+	})
+	background.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		run(stop)
+	}()
+}
+
+// Close stops the goroutines started by the middlewares: the uptime tickers, the coarse
+// clock and the batchers, once their buffered observations are recorded. The middlewares
+// keep recording without them, the coarse clock restarting when it's used again. The
+// collectors created by the caller, like a ScrapeWatcher, have their own Stop
+func Close() {
+	background.mu.Lock()
+	stops := background.stops
+	background.stops = nil
+	background.mu.Unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+}
@@ -0,0 +1,93 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClose(t *testing.T) {
+	tests := []struct {
+		name string
+		// start starts the background work and returns the check run once closed
+		start func(t *testing.T) func(t *testing.T)
+	}{
+		{"uptime", func(t *testing.T) func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := uptimeCounters.Load(m.uptime); !ok {
+				t.Fatal("the uptime ticker isn't started")
+			}
+			return func(t *testing.T) {
+				if _, ok := uptimeCounters.Load(m.uptime); ok {
+					t.Error("the uptime ticker is still running")
+				}
+				if _, err := newMetrics(opts); err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := uptimeCounters.Load(m.uptime); !ok {
+					t.Error("a later middleware doesn't restart the uptime ticker")
+				}
+			}
+		}},
+		{"coarse clock", func(t *testing.T) func(t *testing.T) {
+			coarseNow()
+			return func(t *testing.T) {
+				if coarseRunning.Load() {
+					t.Error("the coarse clock is still running")
+				}
+				if now := coarseNow(); time.Since(now) > time.Second || !coarseRunning.Load() {
+					t.Errorf("the coarse clock doesn't restart, got %v", now)
+				}
+			}
+		}},
+		{"batcher", func(t *testing.T) func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.BatchInterval = time.Hour
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.observe(http.StatusOK, "/closed", http.MethodGet, nil, 0.1, 10, 20, "")
+			count := m.reqCount.WithLabelValues("200", "/closed", http.MethodGet)
+			if got := testutil.ToFloat64(count); got != 0 {
+				t.Fatalf("got %v requests before the flush", got)
+			}
+			return func(t *testing.T) {
+				if got := testutil.ToFloat64(count); got != 1 {
+					t.Errorf("got %v requests once closed, want the buffered one", got)
+				}
+				m.observe(http.StatusOK, "/closed", http.MethodGet, nil, 0.1, 10, 20, "")
+				if got := testutil.ToFloat64(count); got != 2 {
+					t.Errorf("got %v requests, want the later one recorded directly", got)
+				}
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := tt.start(t)
+			Close()
+			check(t)
+		})
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	b := newBatcher(time.Hour)
+	Close()
+	Close()
+	b.Stop()
+	if !b.stopped.Load() {
+		t.Error("the batcher isn't stopped")
+	}
+}
@@ -0,0 +1,90 @@
+package ginprom
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Maintenance is a Collector switching the service in and out of maintenance,
+// during which the MaintenanceMode middleware rejects the requests
+type Maintenance struct {
+	// Exempt selects the requests served during maintenance, like probes or scrapes
+	Exempt RequestFilterFn
+
+	enabled    atomic.Bool
+	retryAfter atomic.Int64
+
+	active   prometheus.Gauge
+	rejected prometheus.Counter
+}
+
+// NewMaintenance returns a disabled Maintenance, it still needs to be registered
+func NewMaintenance() *Maintenance {
+	return &Maintenance{
+		active: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "maintenance_mode",
+			Help:      "1 while the service is in maintenance and rejects requests",
+		}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "maintenance_rejected_requests_total",
+			Help:      "Total number of requests rejected because of maintenance.",
+		}),
+	}
+}
+
+// Enable starts the maintenance, the rejected requests are told to retry after retryAfter
+// if positive
+func (m *Maintenance) Enable(retryAfter time.Duration) {
+	m.retryAfter.Store(int64(retryAfter))
+	m.enabled.Store(true)
+	m.active.Set(1)
+}
+
+// Disable ends the maintenance
+func (m *Maintenance) Disable() {
+	m.enabled.Store(false)
+	m.active.Set(0)
+}
+
+// Enabled reports whether the service is in maintenance
+func (m *Maintenance) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// Describe implements prometheus.Collector
+func (m *Maintenance) Describe(ch chan<- *prometheus.Desc) {
+	m.active.Describe(ch)
+	m.rejected.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *Maintenance) Collect(ch chan<- prometheus.Metric) {
+	m.active.Collect(ch)
+	m.rejected.Collect(ch)
+}
+
+// MaintenanceMode returns a gin.HandlerFunc answering 503 with Retry-After to the requests
+// not exempted while m is enabled. Used after PromMiddleware the rejected requests are also
+// recorded as 5xx
+func MaintenanceMode(m *Maintenance) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.Enabled() || m.Exempt != nil && m.Exempt(c) {
+			c.Next()
+			return
+		}
+
+		if retryAfter := time.Duration(m.retryAfter.Load()); retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		m.rejected.Inc()
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+	}
+}
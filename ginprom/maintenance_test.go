@@ -0,0 +1,85 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	tests := []struct {
+		name           string
+		enable         bool
+		retryAfter     time.Duration
+		path           string
+		wantStatus     int
+		wantRetryAfter string
+		wantRejected   float64
+	}{
+		{"disabled", false, time.Minute, "/api", http.StatusOK, "", 0},
+		{"enabled", true, time.Minute, "/api", http.StatusServiceUnavailable, "60", 1},
+		{"rounded up", true, 1500 * time.Millisecond, "/api", http.StatusServiceUnavailable, "2", 1},
+		{"no retry after", true, 0, "/api", http.StatusServiceUnavailable, "", 1},
+		{"exempt", true, time.Minute, "/healthz", http.StatusOK, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMaintenance()
+			m.Exempt = ExcludeProbes()
+			if tt.enable {
+				m.Enable(tt.retryAfter)
+			}
+			r := gin.New()
+			r.Use(MaintenanceMode(m))
+			r.GET(tt.path, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := serve(r, http.MethodGet, tt.path)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("got Retry-After %q, want %q", got, tt.wantRetryAfter)
+			}
+			if got := testutil.ToFloat64(m.rejected); got != tt.wantRejected {
+				t.Errorf("got %v rejected requests, want %v", got, tt.wantRejected)
+			}
+			wantActive := 0.0
+			if tt.enable {
+				wantActive = 1
+			}
+			if got := testutil.ToFloat64(m.active); got != wantActive {
+				t.Errorf("got maintenance gauge %v, want %v", got, wantActive)
+			}
+		})
+	}
+}
+
+func TestMaintenanceDisable(t *testing.T) {
+	m := NewMaintenance()
+	r := gin.New()
+	r.Use(MaintenanceMode(m))
+	r.GET("/api", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	m.Enable(time.Minute)
+	if w := serve(r, http.MethodGet, "/api"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d during maintenance", w.Code)
+	}
+	m.Disable()
+	if w := serve(r, http.MethodGet, "/api"); w.Code != http.StatusOK || m.Enabled() {
+		t.Errorf("got status %d after maintenance", w.Code)
+	}
+	if got := testutil.ToFloat64(m.active); got != 0 {
+		t.Errorf("got maintenance gauge %v after maintenance", got)
+	}
+	if got := testutil.CollectAndCount(m); got != 2 {
+		t.Errorf("got %d metrics, want 2", got)
+	}
+}
@@ -0,0 +1,160 @@
+package ginprom
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// Keys of the built-in metrics, used to override their metadata in PromOpts
+const (
+	MetricUptime           = "uptime"
+	MetricRequestCount     = "request_count"
+	MetricRequestDuration  = "request_duration"
+	MetricRequestSize      = "request_size"
+	MetricResponseSize     = "response_size"
+	MetricRequestErrors    = "request_errors"
+	MetricRequestsInFlight = "requests_in_flight"
+	MetricUpgrades         = "upgrades"
+	MetricHijackedConns    = "hijacked_connections"
+	MetricSlowRequests     = "slow_requests"
+	MetricStartTime        = "start_time"
+	MetricPanics           = "panics"
+	MetricHandlerErrors    = "handler_errors"
+	MetricApdex            = "apdex"
+
+	MetricWebSocketConns    = "websocket_connections"
+	MetricWebSocketDuration = "websocket_duration"
+	MetricWebSocketSent     = "websocket_sent"
+	MetricWebSocketReceived = "websocket_received"
+
+	MetricStreamFirstByte = "stream_first_byte"
+	MetricStreams         = "streams"
+	MetricStreamSent      = "stream_sent"
+
+	MetricQueueDuration = "queue_duration"
+	MetricTLSRequests   = "tls_requests"
+	MetricBuildInfo     = "build_info"
+
+	MetricMiddlewareDuration  = "middleware_duration"
+	MetricDroppedObservations = "dropped_observations"
+
+	MetricSeriesCount = "series_count"
+	MetricLabelValues = "label_values"
+)
+
+// defaultUnits are the OpenMetrics units of the built-in metrics, they match
+// the suffix of the metric names since the OpenMetrics encoder appends missing ones
+var defaultUnits = map[string]string{
+	MetricRequestDuration: "seconds",
+	MetricRequestSize:     "bytes",
+	MetricResponseSize:    "bytes",
+}
+
+// units maps fully-qualified metric names to their OpenMetrics unit
+var units sync.Map
+
+// help returns the help text of the built-in metric key
+func (po *PromOpts) help(key, defaultHelp string) string {
+	if help, ok := po.Help[key]; ok && help != "" {
+		return help
+	}
+	if po.HelpProvider != nil {
+		if help := po.HelpProvider(key); help != "" {
+			return help
+		}
+	}
+	return defaultHelp
+}
+
+// name returns the name of the built-in metric key, before the namespace and subsystem
+func (po *PromOpts) name(key, defaultName string) string {
+	if name, ok := po.Names[key]; ok && name != "" {
+		return name
+	}
+	return defaultName
+}
+
+// nameOverridable are the keys of the built-in metrics PromOpts.Names can rename
+var nameOverridable = map[string]bool{
+	MetricRequestCount:    true,
+	MetricRequestDuration: true,
+	MetricRequestSize:     true,
+	MetricResponseSize:    true,
+}
+
+// validateNames returns an error when a name of PromOpts.Names is invalid or of no metric
+func (po *PromOpts) validateNames() error {
+	for key, name := range po.Names {
+		switch {
+		case !nameOverridable[key]:
+			return fmt.Errorf("ginprom: metric %q can't be renamed", key)
+		case name != "" && !model.IsValidLegacyMetricName(name):
+			return fmt.Errorf("ginprom: invalid name %q of metric %q", name, key)
+		}
+	}
+	return nil
+}
+
+// setUnit remembers the unit of the built-in metric published as fqName, the
+// renamed metrics without the unit suffix have none
+func setUnit(unit, fqName string) {
+	if unit != "" && strings.HasSuffix(fqName, "_"+unit) {
+		units.Store(fqName, unit)
+	}
+}
+
+type unitGatherer struct {
+	prometheus.Gatherer
+}
+
+// Gather implements prometheus.Gatherer
+func (g unitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	for _, mf := range mfs {
+		if mf.Unit != nil {
+			continue
+		}
+		if unit, ok := units.Load(mf.GetName()); ok {
+			mf.Unit = stringPtr(unit.(string))
+		}
+	}
+	return mfs, err
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// OpenMetricsHandler returns a http.Handler serving the metrics of gatherer,
+// including the unit metadata when the scraper negotiates OpenMetrics
+func OpenMetricsHandler(gatherer prometheus.Gatherer) http.Handler {
+	gatherer = unitGatherer{gatherer}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := gatherer.Gather()
+		if err != nil && len(mfs) == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+		w.Header().Set("Content-Type", string(format))
+
+		enc := expfmt.NewEncoder(w, format, expfmt.WithUnit())
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				return
+			}
+		}
+		if closer, ok := enc.(expfmt.Closer); ok {
+			closer.Close()
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHelp(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *PromOpts
+		key  string
+		want string
+	}{
+		{"default", &PromOpts{}, MetricRequestCount, "default help"},
+		{"override", &PromOpts{Help: map[string]string{MetricUptime: "owned by team-a"}}, MetricUptime, "owned by team-a"},
+		{"empty override keeps default", &PromOpts{Help: map[string]string{MetricUptime: ""}}, MetricUptime, "default help"},
+		{"other key", &PromOpts{Help: map[string]string{MetricUptime: "owned by team-a"}}, MetricRequestSize, "default help"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.help(tt.key, "default help"); got != tt.want {
+				t.Errorf("help() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHelpProvider(t *testing.T) {
+	provider := func(metric string) string {
+		if metric == MetricRequestSize {
+			return ""
+		}
+		return metric + " see https://runbooks/" + metric
+	}
+
+	tests := []struct {
+		name string
+		help map[string]string
+		key  string
+		want string
+	}{
+		{"provider", nil, MetricRequestCount, "request_count see https://runbooks/request_count"},
+		{"help map wins", map[string]string{MetricRequestCount: "explicit"}, MetricRequestCount, "explicit"},
+		{"empty answer keeps default", nil, MetricRequestSize, "default help"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &PromOpts{Help: tt.help, HelpProvider: provider}
+			if got := opts.help(tt.key, "default help"); got != tt.want {
+				t.Errorf("help() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenMetricsHandlerUnits(t *testing.T) {
+	name := prometheus.BuildFQName(namespace, "", "http_request_duration_seconds")
+	setUnit(defaultUnits[MetricRequestDuration], name)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewHistogram(prometheus.HistogramOpts{Name: name, Help: "help"}))
+
+	tests := []struct {
+		name     string
+		accept   string
+		wantUnit bool
+	}{
+		{"openmetrics", "application/openmetrics-text; version=1.0.0", true},
+		{"text format", "text/plain", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			OpenMetricsHandler(reg).ServeHTTP(w, req)
+
+			body := w.Body.String()
+			if got := strings.Contains(body, "# UNIT "+name+" seconds"); got != tt.wantUnit {
+				t.Errorf("unit written = %v, want %v:\n%s", got, tt.wantUnit, body)
+			}
+			if !strings.Contains(body, name+"_count") {
+				t.Errorf("metric name changed:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestPromOptsNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    map[string]string
+		want     []string
+		wantUnit map[string]bool
+	}{
+		{"defaults", nil, []string{
+			"service_http_request_count_total", "service_http_request_duration_seconds",
+			"service_http_request_size_bytes", "service_http_response_size_bytes",
+		}, map[string]bool{"service_http_request_duration_seconds": true}},
+		{"renamed", map[string]string{
+			MetricRequestCount:    "http_server_requests_total",
+			MetricRequestDuration: "http_server_duration_seconds",
+			MetricRequestSize:     "http_server_request_body_bytes",
+			MetricResponseSize:    "http_server_response_length",
+		}, []string{
+			"service_http_server_duration_seconds", "service_http_server_request_body_bytes",
+			"service_http_server_requests_total", "service_http_server_response_length",
+		}, map[string]bool{
+			"service_http_server_duration_seconds":   true,
+			"service_http_server_request_body_bytes": true,
+			"service_http_server_response_length":    false,
+		}},
+		{"empty name keeps default", map[string]string{MetricRequestCount: ""}, []string{
+			"service_http_request_count_total", "service_http_request_duration_seconds",
+			"service_http_request_size_bytes", "service_http_response_size_bytes",
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.Names = tt.names
+			opts.DisableUptime = true
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.observe(http.StatusOK, "/", http.MethodGet, nil, 0.1, 10, 20, "")
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, mf := range families {
+				if mf.GetName() != "service_http_hijacked_connections" {
+					got = append(got, mf.GetName())
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got the metrics %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.wantUnit {
+				if _, got := units.Load(name); got != want {
+					t.Errorf("got a unit for %s %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPromOptsNamesInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		names map[string]string
+	}{
+		{"invalid name", map[string]string{MetricRequestCount: "http-requests"}},
+		{"unknown metric", map[string]string{"requests": "http_requests_total"}},
+		{"not renamable", map[string]string{MetricUptime: "service_uptime_seconds"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.Names = tt.names
+			if _, err := NewPromMiddleware(opts); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package ginprom
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OtherMethodValue is the method label of the requests whose method isn't allowed
+// by MethodNormalization
+const OtherMethodValue = "OTHER"
+
+// StandardMethods are the methods of RFC 9110 and RFC 5789, allowed by
+// MethodNormalization when none are set
+var StandardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// MethodNormalization records the methods case insensitively, as spelled in Methods, and
+// the requests of any other method under OtherMethodValue, so the garbage methods sent by
+// scanners don't add a series each
+type MethodNormalization struct {
+	// Methods are the allowed methods, StandardMethods if empty
+	Methods []string
+}
+
+// normalize returns the allowed method matching method, OtherMethodValue if none does
+func (n *MethodNormalization) normalize(method string) string {
+	methods := n.Methods
+	if len(methods) == 0 {
+		methods = StandardMethods
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return m
+		}
+	}
+	return OtherMethodValue
+}
+
+// methodLabel returns the method label of the requests of method
+func (po *PromOpts) methodLabel(method string) string {
+	if po.MethodNormalization == nil {
+		return method
+	}
+	return po.MethodNormalization.normalize(method)
+}
@@ -0,0 +1,70 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMethodNormalization(t *testing.T) {
+	tests := []struct {
+		name    string
+		methods []string
+		method  string
+		want    string
+	}{
+		{"standard", nil, http.MethodGet, http.MethodGet},
+		{"lower case", nil, "patch", http.MethodPatch},
+		{"garbage", nil, "XYZZY", OtherMethodValue},
+		{"empty", nil, "", OtherMethodValue},
+		{"allowed", []string{http.MethodGet, "PROPFIND"}, "propfind", "PROPFIND"},
+		{"not allowed", []string{http.MethodGet, "PROPFIND"}, http.MethodPost, OtherMethodValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &MethodNormalization{Methods: tt.methods}
+			if got := n.normalize(tt.method); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsMethodNormalization(t *testing.T) {
+	tests := []struct {
+		name          string
+		normalization *MethodNormalization
+		method        string
+		status        string
+		endpoint      string
+		want          string
+	}{
+		{"standard", &MethodNormalization{}, http.MethodGet, "200", "/users", http.MethodGet},
+		{"garbage", &MethodNormalization{}, "XYZZY", "404", "/users", OtherMethodValue},
+		{"allowlist", &MethodNormalization{Methods: []string{http.MethodGet}}, http.MethodDelete,
+			"404", "/users", OtherMethodValue},
+		{"disabled", nil, "XYZZY", "404", "/users", "XYZZY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &PromOpts{Registerer: prometheus.NewRegistry(), MethodNormalization: tt.normalization}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			serve(r, tt.method, "/users")
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.status, tt.endpoint, tt.want)); got != 1 {
+				t.Errorf("got %v requests labelled %s, want 1", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,805 @@
+package ginprom
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// metrics holds the collectors recorded by a middleware
+type metrics struct {
+	uptime        *prometheus.CounterVec
+	reqCount      *prometheus.CounterVec
+	reqDuration   prometheus.ObserverVec
+	reqSizeBytes  prometheus.ObserverVec
+	respSizeBytes prometheus.ObserverVec
+
+	// upgrades counts the protocol upgrades, hijacked tracks the connections
+	// taken over by handlers until they are closed
+	upgrades *prometheus.CounterVec
+	hijacked prometheus.Gauge
+
+	// slowRequests counts the requests over PromOpts.SlowRequestThreshold, if set
+	slowRequests *prometheus.CounterVec
+
+	// reqCountSharded replaces reqCount when PromOpts.ShardedRequestCount is set
+	reqCountSharded *shardedCounterVec
+
+	// golden signals only
+	reqErrors *prometheus.CounterVec
+
+	// inFlight counts the requests being served, by endpoint and method in inFlightByRoute
+	inFlight        prometheus.Gauge
+	inFlightByRoute *prometheus.GaugeVec
+	// apdex counts the requests by Apdex zone, nil unless PromOpts.ApdexTarget is set
+	apdex *prometheus.CounterVec
+	// handlerErrors counts the errors of gin.Context.Errors, nil unless PromOpts.CountHandlerErrors is set
+	handlerErrors *prometheus.CounterVec
+	// tlsRequests counts the TLS requests by version and cipher suite, nil unless PromOpts.TLSMetrics is set
+	tlsRequests *prometheus.CounterVec
+	// websockets tracks the WebSocket connections, nil unless PromOpts.WebSocketMetrics is set
+	websockets *websocketMetrics
+	// streams tracks the streamed responses, nil unless PromOpts.StreamMetrics is set
+	streams *streamMetrics
+	// queueDuration observes the wait in front of the service, nil unless PromOpts.QueueDuration is set
+	queueDuration prometheus.Histogram
+	// panics counts the panics of the handlers, nil unless PromOpts.CountPanics is set
+	panics *prometheus.CounterVec
+	// startTime is set once to the start of the service, nil in the UptimeCounter mode
+	startTime prometheus.Gauge
+
+	// statusLabel is how the status of the request metrics is labelled
+	statusLabel StatusLabelMode
+
+	// children caches the series of the request metrics by seriesKey,
+	// saving the label hashing of WithLabelValues on every request
+	children sync.Map
+	// sharing holds the middlewares recording into the same request metrics, which prune
+	// their series together
+	sharing *seriesSharing
+	// batch buffers the observations when PromOpts.BatchInterval is set
+	batch *batcher
+	// async records the observations on a worker when PromOpts.AsyncBuffer is set
+	async *asyncRecorder
+
+	// endpoints holds the endpoint label values seen when PromOpts.MaxEndpointCardinality
+	// is set, endpointCount their number
+	endpoints     sync.Map
+	endpointCount atomic.Int64
+
+	// warm holds the request metrics of the requests started before warmupEnd,
+	// nil when they aren't recorded
+	warm      *metrics
+	warmupEnd time.Time
+}
+
+// seriesKey identifies the series of a request
+type seriesKey struct {
+	status   int
+	endpoint string
+	method   string
+	// extra joins the values of the extra labels
+	extra string
+}
+
+// requestSeries holds the series of the request metrics sharing the same labels
+type requestSeries struct {
+	count    interface{ Inc() }
+	duration prometheus.Observer
+	// reqSize and respSize are nil when their metric is disabled
+	reqSize  prometheus.Observer
+	respSize prometheus.Observer
+	// exemplars is the duration if it records exemplars, summaries don't
+	exemplars prometheus.ExemplarObserver
+
+	// lvs are the label values of the series, lastSeen the unix nano time of its last
+	// request when PromOpts.SeriesTTL is set
+	lvs      []string
+	endpoint string
+	lastSeen atomic.Int64
+}
+
+// series returns the request series of the labels, extra being the values of the
+// labels following the status, endpoint and method ones
+func (m *metrics) series(status int, endpoint, method string, extra ...string) *requestSeries {
+	if m.statusLabel == StatusClassLabel && status >= 100 && status < len(statusStrings) {
+		// the codes of a class share their series
+		status = status / 100 * 100
+	}
+	key := seriesKey{status, endpoint, method, strings.Join(extra, "\xff")}
+	if s, ok := m.children.Load(key); ok {
+		return m.seen(s.(*requestSeries))
+	}
+
+	lvs := make([]string, 0, len(labels)+1+len(extra))
+	switch m.statusLabel {
+	case StatusClassLabel:
+		lvs = append(lvs, statusClass(status), endpoint, method)
+	case StatusCodeAndClassLabels:
+		lvs = append(lvs, statusString(status), endpoint, method, statusClass(status))
+	default:
+		lvs = append(lvs, statusString(status), endpoint, method)
+	}
+	lvs = append(lvs, extra...)
+	series := &requestSeries{
+		duration: m.reqDuration.WithLabelValues(lvs...),
+		lvs:      lvs,
+		endpoint: endpoint,
+	}
+	if m.reqSizeBytes != nil {
+		series.reqSize = m.reqSizeBytes.WithLabelValues(lvs...)
+	}
+	if m.respSizeBytes != nil {
+		series.respSize = m.respSizeBytes.WithLabelValues(lvs...)
+	}
+	series.exemplars, _ = series.duration.(prometheus.ExemplarObserver)
+	if m.reqCountSharded != nil {
+		series.count = m.reqCountSharded.WithLabelValues(lvs...)
+	} else {
+		series.count = m.reqCount.WithLabelValues(lvs...)
+	}
+	s, _ := m.children.LoadOrStore(key, series)
+	return m.seen(s.(*requestSeries))
+}
+
+// observe records a request into the series, its duration with the exemplar
+// of traceID if any
+func (s *requestSeries) observe(duration, reqSize, respSize float64, traceID string) {
+	s.count.Inc()
+	if exemplar := exemplarLabels(traceID); exemplar != nil && s.exemplars != nil {
+		s.exemplars.ObserveWithExemplar(duration, exemplar)
+	} else {
+		s.duration.Observe(duration)
+	}
+	if s.reqSize != nil {
+		s.reqSize.Observe(reqSize)
+	}
+	if s.respSize != nil {
+		s.respSize.Observe(respSize)
+	}
+}
+
+// observe records a request into the series of the labels, on the recording worker
+// or batched if enabled
+func (m *metrics) observe(status int, endpoint, method string, extra []string, duration, reqSize, respSize float64, traceID string) {
+	if m.async != nil && m.async.enqueue(asyncObservation{
+		m: m, status: status, endpoint: endpoint, method: method, extra: copyLabels(extra),
+		duration: duration, reqSize: reqSize, respSize: respSize, traceID: traceID,
+	}) {
+		return
+	}
+	m.observeNow(status, endpoint, method, extra, duration, reqSize, respSize, traceID)
+}
+
+// observeNow records a request into the series of the labels, batched if enabled
+func (m *metrics) observeNow(status int, endpoint, method string, extra []string, duration, reqSize, respSize float64, traceID string) {
+	series := m.series(status, endpoint, method, extra...)
+	if m.batch != nil {
+		m.batch.record(series, duration, reqSize, respSize, traceID)
+		return
+	}
+	series.observe(duration, reqSize, respSize, traceID)
+}
+
+// count counts a request into the series of the labels without observing it,
+// on the recording worker if enabled
+func (m *metrics) count(status int, endpoint, method string, extra []string) {
+	if m.async != nil && m.async.enqueue(asyncObservation{
+		m: m, status: status, endpoint: endpoint, method: method, extra: copyLabels(extra), countOnly: true,
+	}) {
+		return
+	}
+	m.countNow(status, endpoint, method, extra)
+}
+
+func (m *metrics) countNow(status int, endpoint, method string, extra []string) {
+	m.series(status, endpoint, method, extra...).count.Inc()
+}
+
+// copyLabels copies the label values of a pooled request state
+func copyLabels(lvs []string) []string {
+	if len(lvs) == 0 {
+		return nil
+	}
+	return append([]string(nil), lvs...)
+}
+
+// statusStrings holds the status label of the valid status codes
+var statusStrings = func() (codes [600]string) {
+	for code := 100; code < len(codes); code++ {
+		codes[code] = strconv.Itoa(code)
+	}
+	return codes
+}()
+
+// OtherEndpointValue replaces the endpoints seen once PromOpts.MaxEndpointCardinality is reached
+const OtherEndpointValue = "other"
+
+// NotFoundEndpointValue replaces the endpoints of the unmatched routes with
+// PromOpts.CollapseUnmatchedRoutes
+const NotFoundEndpointValue = "not_found"
+
+// endpointLabelFn returns the EndpointLabelMappingFn of po, RoutePath if nil, normalized
+// by PathNormalization then EndpointNormalizers and returning NotFoundEndpointValue for the
+// unmatched routes with CollapseUnmatchedRoutes
+func (po *PromOpts) endpointLabelFn() RequestLabelMappingFn {
+	endpointLabel := po.EndpointLabelMappingFn
+	if endpointLabel == nil {
+		endpointLabel = RoutePath
+	}
+	if po.PathNormalization != nil {
+		endpointLabel = po.PathNormalization.normalizedEndpoint(endpointLabel)
+	}
+	if len(po.EndpointNormalizers) > 0 {
+		endpointLabel = normalizedEndpoints(endpointLabel, po.EndpointNormalizers)
+	}
+	if !po.CollapseUnmatchedRoutes {
+		return endpointLabel
+	}
+	return func(c *gin.Context) string {
+		if c.FullPath() == "" {
+			return NotFoundEndpointValue
+		}
+		return endpointLabel(c)
+	}
+}
+
+// endpointLabel returns endpoint, or OtherEndpointValue when it would exceed max distinct
+// endpoints, max not being positive disabling the limit
+func (m *metrics) endpointLabel(endpoint string, max int) string {
+	if max <= 0 || endpoint == FilteredLabelValue {
+		return endpoint
+	}
+	if _, ok := m.endpoints.Load(endpoint); ok {
+		return endpoint
+	}
+	if m.endpointCount.Add(1) > int64(max) {
+		m.endpointCount.Add(-1)
+		return OtherEndpointValue
+	}
+	if _, loaded := m.endpoints.LoadOrStore(endpoint, struct{}{}); loaded {
+		m.endpointCount.Add(-1)
+	}
+	return endpoint
+}
+
+// FilteredLabelValue replaces the excluded label values of the requests recorded
+// with PromOpts.AggregateFiltered
+const FilteredLabelValue = "__filtered__"
+
+// filteredStatus is the status code of the series of the requests with a filtered status
+const filteredStatus = -1
+
+// Apdex zones of the requests, see PromOpts.ApdexTarget
+const (
+	ApdexSatisfied  = "satisfied"
+	ApdexTolerating = "tolerating"
+	ApdexFrustrated = "frustrated"
+)
+
+// apdexZone returns the Apdex zone of a request served in elapsed for the target latency,
+// the server errors being frustrated
+func apdexZone(elapsed, target time.Duration, serverError bool) string {
+	switch {
+	case serverError || elapsed > 4*target:
+		return ApdexFrustrated
+	case elapsed > target:
+		return ApdexTolerating
+	}
+	return ApdexSatisfied
+}
+
+// UptimeMode selects how the uptime of the service is exported
+type UptimeMode int
+
+const (
+	// UptimeCounter increases the service_uptime counter every second, which is kept
+	// for the existing dashboards
+	UptimeCounter UptimeMode = iota
+	// StartTimeGauge sets the service_start_time_seconds gauge once, the uptime
+	// being time() - service_start_time_seconds
+	StartTimeGauge
+	// UptimeCounterAndStartTime exports both, to migrate the dashboards
+	UptimeCounterAndStartTime
+)
+
+// startTime is when the package was initialized, about the start of the process
+var startTime = time.Now()
+
+// StatusLabelMode selects how the status of the requests is labelled
+type StatusLabelMode int
+
+const (
+	// StatusCodeLabel labels the requests with their status code, like status="404"
+	StatusCodeLabel StatusLabelMode = iota
+	// StatusClassLabel labels the requests with their status class, like status="4xx",
+	// for fewer series when a service answers many distinct codes
+	StatusClassLabel
+	// StatusCodeAndClassLabels adds the status_class label to the status code
+	StatusCodeAndClassLabels
+)
+
+// statusClasses holds the status class labels by hundreds
+var statusClasses = [...]string{"", "1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// statusClass returns the status class label of code, the code itself when it's invalid
+func statusClass(code int) string {
+	if code >= 100 && code < len(statusStrings) {
+		return statusClasses[code/100]
+	}
+	return statusString(code)
+}
+
+// statusLabel returns how the status of the request metrics is labelled, by class
+// by default with PromOpts.LowOverhead
+func (po *PromOpts) statusLabel() StatusLabelMode {
+	if po.LowOverhead && po.StatusLabel == StatusCodeLabel {
+		return StatusClassLabel
+	}
+	return po.StatusLabel
+}
+
+// requestSizeEnabled reports whether the request size metric is recorded
+func (po *PromOpts) requestSizeEnabled() bool {
+	return !po.LowOverhead && !po.DisableRequestSize
+}
+
+// requestLabels returns the label names of the request metrics
+func (po *PromOpts) requestLabels() []string {
+	names := append([]string(nil), labels...)
+	if po.statusLabel() == StatusCodeAndClassLabels {
+		names = append(names, "status_class")
+	}
+	if po.HandlerLabel {
+		names = append(names, "handler")
+	}
+	if po.ClientLabelMappingFn != nil {
+		names = append(names, "client")
+	}
+	if po.UserAgentLabelMappingFn != nil {
+		names = append(names, "user_agent")
+	}
+	if po.HTTPVersionLabel {
+		names = append(names, "http_version")
+	}
+	return append(names, po.extraLabelNames()...)
+}
+
+// extraLabelNames returns the names of PromOpts.ExtraLabels in order
+func (po *PromOpts) extraLabelNames() []string {
+	names := make([]string, 0, len(po.ExtraLabels))
+	for name := range po.ExtraLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateExtraLabels returns an error when an extra label is invalid or conflicts
+// with the labels of the middleware
+func (po *PromOpts) validateExtraLabels() error {
+	constLabels := po.constLabels()
+	for _, name := range po.extraLabelNames() {
+		switch {
+		case !model.LabelName(name).IsValidLegacy() || strings.HasPrefix(name, "__"):
+			return fmt.Errorf("ginprom: invalid extra label %q", name)
+		case po.ExtraLabels[name] == nil:
+			return fmt.Errorf("ginprom: extra label %q has no function", name)
+		case name == "status" || name == "endpoint" || name == "method" ||
+			name == "status_class" || name == "handler" || name == "client" || name == "user_agent" ||
+			name == "http_version":
+			return fmt.Errorf("ginprom: extra label %q is a label of the middleware", name)
+		case constLabels[name] != "":
+			return fmt.Errorf("ginprom: extra label %q is already a constant label", name)
+		}
+	}
+	return nil
+}
+
+// httpVersionLabel returns the http_version label of r: 1.0, 1.1, 2, 3, or other
+func httpVersionLabel(r *http.Request) string {
+	switch {
+	case r.ProtoMajor == 1 && r.ProtoMinor == 1:
+		return "1.1"
+	case r.ProtoMajor == 1 && r.ProtoMinor == 0:
+		return "1.0"
+	case r.ProtoMajor == 2:
+		return "2"
+	case r.ProtoMajor == 3:
+		return "3"
+	default:
+		return "other"
+	}
+}
+
+// validateConstLabels returns an error when a constant label is invalid or is a label
+// of the request metrics
+func (po *PromOpts) validateConstLabels() error {
+	requestLabels := map[string]bool{"warmup": po.WarmupPeriod > 0}
+	for _, name := range po.requestLabels() {
+		requestLabels[name] = true
+	}
+	for name := range po.ConstLabels {
+		switch {
+		case !model.LabelName(name).IsValidLegacy() || strings.HasPrefix(name, "__"):
+			return fmt.Errorf("ginprom: invalid constant label %q", name)
+		case requestLabels[name]:
+			return fmt.Errorf("ginprom: constant label %q is a label of the middleware", name)
+		}
+	}
+	return nil
+}
+
+// statusString returns the status label of code without allocating for valid codes
+func statusString(code int) string {
+	if code >= 100 && code < len(statusStrings) {
+		return statusStrings[code]
+	}
+	if code == filteredStatus {
+		return FilteredLabelValue
+	}
+	return strconv.Itoa(code)
+}
+
+// newMetrics creates and registers the collectors described by promOpts,
+// reusing the ones already registered by another middleware. Nothing stays
+// registered when one of them conflicts
+func newMetrics(promOpts *PromOpts) (*metrics, error) {
+	if err := promOpts.MetricSpecs.Validate(); err != nil {
+		return nil, err
+	}
+	if err := promOpts.validateBucketPreset(); err != nil {
+		return nil, err
+	}
+	if err := promOpts.validateDurationUnit(); err != nil {
+		return nil, err
+	}
+	if err := promOpts.validateNames(); err != nil {
+		return nil, err
+	}
+	if err := promOpts.validateConstLabels(); err != nil {
+		return nil, err
+	}
+	if err := promOpts.validateExtraLabels(); err != nil {
+		return nil, err
+	}
+	specs := map[string]MetricSpec{}
+	for key := range observedMetricTypes {
+		specs[key] = promOpts.metricSpec(key)
+		if err := specs[key].validate(key); err != nil {
+			return nil, err
+		}
+	}
+
+	r := promOpts.registration()
+	warmupLabel := ""
+	if promOpts.WarmupPeriod > 0 && promOpts.WarmupMode == WarmupLabel {
+		warmupLabel = "false"
+	}
+	m := registerMetrics(r, promOpts, specs, warmupLabel)
+	if warmupLabel != "" {
+		m.warm = registerMetrics(r, promOpts, specs, "true")
+	}
+	var dropped prometheus.Counter
+	if promOpts.AsyncBuffer > 0 {
+		dropped = registerDroppedObservations(r, promOpts)
+	}
+	var cardinality *cardinalityMetrics
+	if promOpts.CardinalityInterval > 0 {
+		cardinality = registerCardinality(r, promOpts)
+	}
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	if cardinality != nil {
+		if _, started := cardinalityWatchers.LoadOrStore(cardinality.series, true); !started {
+			interval, vec := promOpts.CardinalityInterval, cardinality.series
+			goBackground(func(stop <-chan struct{}) {
+				cardinality.watch(interval, stop)
+				// a later middleware restarts the ticker
+				cardinalityWatchers.Delete(vec)
+			})
+		}
+	}
+	if dropped != nil {
+		m.async = newAsyncRecorder(promOpts.AsyncBuffer, dropped)
+		if m.warm != nil {
+			m.warm.async = m.async
+		}
+	}
+	if m.uptime != nil {
+		if _, started := uptimeCounters.LoadOrStore(m.uptime, true); !started {
+			// created before the first tick so the uptime is exported right away
+			uptime, vec := m.uptime.WithLabelValues(), m.uptime
+			goBackground(func(stop <-chan struct{}) {
+				recordUpTime(uptime, stop)
+				// a later middleware restarts the ticker
+				uptimeCounters.Delete(vec)
+			})
+		}
+	}
+	shareSeries(m, promOpts.SeriesTTL)
+	if m.warm != nil {
+		shareSeries(m.warm, promOpts.SeriesTTL)
+	}
+	if promOpts.BatchInterval > 0 {
+		m.batch = newBatcher(promOpts.BatchInterval)
+		if m.warm != nil {
+			m.warm.batch = m.batch
+		}
+	}
+	if promOpts.WarmupPeriod > 0 {
+		m.warmupEnd = time.Now().Add(promOpts.WarmupPeriod)
+	}
+
+	ns := promOpts.namespace()
+	setUnit(promOpts.unit(MetricRequestDuration), prometheus.BuildFQName(ns, promOpts.Subsystem,
+		promOpts.name(MetricRequestDuration, "http_request_duration_"+promOpts.DurationUnit.String())))
+	setUnit(promOpts.unit(MetricRequestSize), prometheus.BuildFQName(ns, promOpts.Subsystem,
+		promOpts.name(MetricRequestSize, "http_request_size_bytes")))
+	setUnit(promOpts.unit(MetricResponseSize), prometheus.BuildFQName(ns, promOpts.Subsystem,
+		promOpts.name(MetricResponseSize, "http_response_size_bytes")))
+	track(m)
+	return m, nil
+}
+
+// registerMetrics registers the collectors described by promOpts with r. A non-empty
+// warmup is the value of the warmup label of the request metrics, the metrics of warm-up
+// requests, with warmup "true", don't include the ones of the whole process
+func registerMetrics(r *registration, promOpts *PromOpts, specs map[string]MetricSpec, warmup string) *metrics {
+	baseLabels := promOpts.constLabels()
+	constLabels := promOpts.constLabels()
+	if warmup != "" {
+		constLabels["warmup"] = warmup
+	}
+	warmingUp := warmup == "true"
+	reqCountOpts := prometheus.CounterOpts{
+		Namespace:   promOpts.namespace(),
+		Subsystem:   promOpts.Subsystem,
+		ConstLabels: constLabels,
+		Name:        promOpts.name(MetricRequestCount, "http_request_count_total"),
+		Help:        promOpts.help(MetricRequestCount, "Total number of http requests made."),
+	}
+
+	labelNames := promOpts.requestLabels()
+	m := &metrics{statusLabel: promOpts.statusLabel()}
+	uptime := !warmingUp && !promOpts.LowOverhead && !promOpts.DisableUptime
+	if uptime && promOpts.UptimeMode != StartTimeGauge {
+		m.uptime = registerOrReuse(r, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   promOpts.namespace(),
+				Subsystem:   promOpts.Subsystem,
+				ConstLabels: baseLabels,
+				Name:        "uptime",
+				Help:        promOpts.help(MetricUptime, "HTTP service uptime"),
+			}, nil,
+		))
+	}
+	if uptime && promOpts.UptimeMode != UptimeCounter {
+		m.startTime = registerOrReuse(r, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: baseLabels,
+			Name:        "start_time_seconds",
+			Help:        promOpts.help(MetricStartTime, "Start time of the HTTP service since unix epoch in seconds"),
+		}))
+		m.startTime.Set(float64(startTime.UnixNano()) / 1e9)
+	}
+	if promOpts.ShardedRequestCount {
+		m.reqCountSharded = registerOrReuse(r, newShardedCounterVec(reqCountOpts, labelNames))
+	} else {
+		m.reqCount = registerOrReuse(r, prometheus.NewCounterVec(reqCountOpts, labelNames))
+	}
+	m.reqDuration = registerObserverVec(r, specs[MetricRequestDuration], prometheus.HistogramOpts{
+		Namespace:   promOpts.namespace(),
+		Subsystem:   promOpts.Subsystem,
+		ConstLabels: constLabels,
+		Name:        promOpts.name(MetricRequestDuration, "http_request_duration_"+promOpts.DurationUnit.String()),
+		Help:        promOpts.help(MetricRequestDuration, "HTTP request latencies in "+promOpts.DurationUnit.String()),
+	}, labelNames)
+	if promOpts.requestSizeEnabled() {
+		m.reqSizeBytes = registerObserverVec(r, specs[MetricRequestSize], prometheus.HistogramOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        promOpts.name(MetricRequestSize, "http_request_size_bytes"),
+			Help:        promOpts.help(MetricRequestSize, "HTTP request size in bytes"),
+		}, labelNames)
+	}
+	if !promOpts.LowOverhead && !promOpts.DisableResponseSize {
+		m.respSizeBytes = registerObserverVec(r, specs[MetricResponseSize], prometheus.HistogramOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        promOpts.name(MetricResponseSize, "http_response_size_bytes"),
+			Help:        promOpts.help(MetricResponseSize, "HTTP response size in bytes"),
+		}, labelNames)
+	}
+	// the low overhead middlewares only record the count and duration of the requests
+	if !promOpts.LowOverhead {
+		m.upgrades = registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_upgrades_total",
+			Help:        promOpts.help(MetricUpgrades, "Total number of http connections upgraded to another protocol."),
+		}, []string{"endpoint", "protocol"}))
+		if !warmingUp {
+			m.hijacked = registerOrReuse(r, prometheus.NewGauge(prometheus.GaugeOpts{
+				Namespace:   promOpts.namespace(),
+				Subsystem:   promOpts.Subsystem,
+				ConstLabels: baseLabels,
+				Name:        "http_hijacked_connections",
+				Help:        promOpts.help(MetricHijackedConns, "Number of open http connections taken over by a handler, e.g. WebSockets"),
+			}))
+		}
+	}
+
+	if promOpts.SlowRequestThreshold > 0 || promOpts.Settings != nil {
+		m.slowRequests = registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_slow_request_count_total",
+			Help:        promOpts.help(MetricSlowRequests, "Total number of http requests slower than the slow request threshold."),
+		}, []string{"endpoint", "method"}))
+	}
+	if promOpts.goldenSignals {
+		m.reqErrors = registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_request_errors_total",
+			Help:        promOpts.help(MetricRequestErrors, "Total number of http requests answered with a 5xx status."),
+		}, []string{"endpoint", "method"}))
+	}
+	if promOpts.ApdexTarget > 0 {
+		m.apdex = registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_apdex_requests_total",
+			Help: promOpts.help(MetricApdex, fmt.Sprintf(
+				"Total number of http requests by Apdex zone for a target latency of %v.", promOpts.ApdexTarget)),
+		}, []string{"endpoint", "zone"}))
+	}
+	if promOpts.CountHandlerErrors {
+		m.handlerErrors = registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_handler_errors_total",
+			Help:        promOpts.help(MetricHandlerErrors, "Total number of errors the http handlers attached to their context."),
+		}, []string{"endpoint", "type"}))
+	}
+	if promOpts.TLSMetrics {
+		m.tlsRequests = registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_tls_requests_total",
+			Help:        promOpts.help(MetricTLSRequests, "Total number of http requests served over TLS."),
+		}, []string{"version", "cipher_suite"}))
+	}
+	if !warmingUp {
+		registerRuntimeCollectors(r, promOpts)
+		if promOpts.CountPanics {
+			m.panics = registerPanicCounter(r, promOpts)
+		}
+		if promOpts.WebSocketMetrics {
+			m.websockets = registerWebSocketMetrics(r, promOpts)
+		}
+		if promOpts.StreamMetrics {
+			m.streams = registerStreamMetrics(r, promOpts)
+		}
+		if promOpts.QueueDuration {
+			m.queueDuration = registerQueueDuration(r, promOpts)
+		}
+		if promOpts.BuildInfo != nil {
+			registerBuildInfo(r, promOpts)
+		}
+	}
+	if (promOpts.goldenSignals || promOpts.InFlightRequests || promOpts.InFlightByRoute) && !warmingUp {
+		inFlightOpts := prometheus.GaugeOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: baseLabels,
+			Name:        "http_requests_in_flight",
+			Help:        promOpts.help(MetricRequestsInFlight, "Number of http requests currently being served"),
+		}
+		if promOpts.InFlightByRoute {
+			m.inFlightByRoute = registerOrReuse(r, prometheus.NewGaugeVec(inFlightOpts, []string{"endpoint", "method"}))
+		} else {
+			m.inFlight = registerOrReuse(r, prometheus.NewGauge(inFlightOpts))
+		}
+	}
+	return m
+}
+
+// namespace returns the namespace of the metrics of the middleware
+func (po *PromOpts) namespace() string {
+	if po.Namespace != "" {
+		return po.Namespace
+	}
+	return namespace
+}
+
+// constLabels returns the labels added to every metric of the middleware
+func (po *PromOpts) constLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	if po.InstanceLabels {
+		for name, value := range InstanceLabels() {
+			labels[name] = value
+		}
+	}
+	for name, value := range po.ConstLabels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// registration tracks the collectors registered by a
+// constructor, so they can be unregistered when a later one fails
+type registration struct {
+	// reg is where the collectors are registered, the default registerer if nil
+	reg   prometheus.Registerer
+	added []prometheus.Collector
+	err   error
+}
+
+// registration returns the registration of the collectors of the middleware
+func (po *PromOpts) registration() *registration {
+	return &registration{reg: po.Registerer}
+}
+
+// registerer returns where the collectors are registered
+func (r *registration) registerer() prometheus.Registerer {
+	if r.reg != nil {
+		return r.reg
+	}
+	return prometheus.DefaultRegisterer
+}
+
+// registerOrReuse registers c, or returns the collector already registered with the
+// same descriptors, so building several middlewares in one process shares their
+// metrics. After an error it does nothing and the error is reported by finish
+func registerOrReuse[T prometheus.Collector](r *registration, c T) T {
+	if r.err != nil {
+		return c
+	}
+	if err := r.registerer().Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		r.err = fmt.Errorf("ginprom: %w", err)
+		return c
+	}
+	r.added = append(r.added, c)
+	return c
+}
+
+// finish returns the registration error, unregistering what was registered before it
+func (r *registration) finish() error {
+	if r.err == nil {
+		return nil
+	}
+	reg := r.registerer()
+	for _, c := range r.added {
+		reg.Unregister(c)
+	}
+	r.added = nil
+	return r.err
+}
@@ -0,0 +1,276 @@
+package ginprom
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricType selects how a built-in metric recording observations is exported
+type MetricType int
+
+const (
+	// DefaultMetricType keeps the type the metric has by default
+	DefaultMetricType MetricType = iota
+	// SummaryMetric exports quantiles computed by the instance, cheap to store
+	// but impossible to aggregate across instances
+	SummaryMetric
+	// HistogramMetric exports bucket counters, which can be aggregated
+	HistogramMetric
+	// NativeHistogramMetric exports a native histogram with exponential buckets,
+	// precise at a low storage cost when the scraper negotiates them. The classic
+	// buckets are still exported for the scrapers which don't
+	NativeHistogramMetric
+)
+
+// String returns the name of the type
+func (t MetricType) String() string {
+	switch t {
+	case DefaultMetricType:
+		return "default"
+	case SummaryMetric:
+		return "summary"
+	case HistogramMetric:
+		return "histogram"
+	case NativeHistogramMetric:
+		return "native_histogram"
+	}
+	return fmt.Sprintf("MetricType(%d)", int(t))
+}
+
+// DefSizeBuckets are the buckets of the size histograms when none are set, from 64B to 16MB
+var DefSizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+// DefDurationObjectives are the quantiles of the duration summary when none are set
+var DefDurationObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// NativeHistogramOpts configures a native histogram, the zero fields keeping their default
+type NativeHistogramOpts struct {
+	// BucketFactor is the maximal growth factor between two buckets, above 1, 1.1 by default.
+	// Lower factors are more precise but need more buckets
+	BucketFactor float64
+	// ZeroThreshold is the width of the bucket of the observations close to zero,
+	// prometheus.DefNativeHistogramZeroThreshold by default
+	ZeroThreshold float64
+	// MaxBucketNumber bounds the buckets, 160 by default
+	MaxBucketNumber uint32
+	// MinResetDuration is the minimal time between two resets of the histogram to stay
+	// under MaxBucketNumber, an hour by default
+	MinResetDuration time.Duration
+	// MaxZeroThreshold is how wide the zero bucket can grow to stay under MaxBucketNumber
+	// before the histogram is reset
+	MaxZeroThreshold float64
+}
+
+// defaultNativeHistogram is the configuration of the native histograms by default
+var defaultNativeHistogram = NativeHistogramOpts{
+	BucketFactor:     1.1,
+	MaxBucketNumber:  160,
+	MinResetDuration: time.Hour,
+}
+
+// merge returns o with the non-zero fields of override
+func (o NativeHistogramOpts) merge(override NativeHistogramOpts) NativeHistogramOpts {
+	if override.BucketFactor != 0 {
+		o.BucketFactor = override.BucketFactor
+	}
+	if override.ZeroThreshold != 0 {
+		o.ZeroThreshold = override.ZeroThreshold
+	}
+	if override.MaxBucketNumber != 0 {
+		o.MaxBucketNumber = override.MaxBucketNumber
+	}
+	if override.MinResetDuration != 0 {
+		o.MinResetDuration = override.MinResetDuration
+	}
+	if override.MaxZeroThreshold != 0 {
+		o.MaxZeroThreshold = override.MaxZeroThreshold
+	}
+	return o
+}
+
+// validate checks the values of o of key
+func (o NativeHistogramOpts) validate(key string) error {
+	switch {
+	case o.BucketFactor != 0 && !(o.BucketFactor > 1) || math.IsInf(o.BucketFactor, 1):
+		return fmt.Errorf("ginprom: native histogram bucket factor %v of %s isn't above 1", o.BucketFactor, key)
+	case !(o.ZeroThreshold >= 0) || !(o.MaxZeroThreshold >= 0):
+		return fmt.Errorf("ginprom: native histogram zero thresholds of %s are invalid", key)
+	case o.MinResetDuration < 0:
+		return fmt.Errorf("ginprom: native histogram reset duration of %s is negative", key)
+	}
+	return nil
+}
+
+// MetricSpec describes how a built-in metric recording observations is exported
+type MetricSpec struct {
+	Type MetricType
+	// Buckets are the upper bounds of the histogram buckets, in increasing order
+	Buckets []float64
+	// Objectives maps the quantiles of the summary to their absolute error
+	Objectives map[float64]float64
+	// MaxAge is how long the observations count in the quantiles of the summary,
+	// prometheus.DefMaxAge if zero, over AgeBuckets buckets, prometheus.DefAgeBuckets if zero
+	MaxAge     time.Duration
+	AgeBuckets uint32
+	// NativeHistogram configures the native histogram
+	NativeHistogram NativeHistogramOpts
+}
+
+// MetricSpecs maps the keys of the built-in metrics recording observations, MetricRequestDuration,
+// MetricRequestSize and MetricResponseSize, to how they are exported. It takes precedence over
+// the type, bucket and objective fields of PromOpts, and can be shared by the services
+// following the same metrics standard
+type MetricSpecs map[string]MetricSpec
+
+// observedMetricTypes are the default types of the metrics which can be given a MetricSpec
+var observedMetricTypes = map[string]MetricType{
+	MetricRequestDuration: HistogramMetric,
+	MetricRequestSize:     SummaryMetric,
+	MetricResponseSize:    SummaryMetric,
+}
+
+// Validate returns an error when a key isn't a metric recording observations,
+// or a spec is invalid or sets what its type ignores
+func (specs MetricSpecs) Validate() error {
+	for key, spec := range specs {
+		defaultType, ok := observedMetricTypes[key]
+		if !ok {
+			return fmt.Errorf("ginprom: %q isn't a metric recording observations", key)
+		}
+		if err := spec.validate(key); err != nil {
+			return err
+		}
+
+		t := spec.Type
+		if t == DefaultMetricType {
+			t = defaultType
+		}
+		if t == SummaryMetric && len(spec.Buckets) > 0 {
+			return fmt.Errorf("ginprom: %s is a summary but has buckets", key)
+		}
+		if t != SummaryMetric && (len(spec.Objectives) > 0 || spec.MaxAge != 0 || spec.AgeBuckets != 0) {
+			return fmt.Errorf("ginprom: %s is a %v but has objectives", key, t)
+		}
+		if t != NativeHistogramMetric && spec.NativeHistogram != (NativeHistogramOpts{}) {
+			return fmt.Errorf("ginprom: %s is a %v but has native histogram options", key, t)
+		}
+	}
+	return nil
+}
+
+// validate checks the values of the spec of key
+func (s MetricSpec) validate(key string) error {
+	if s.Type < DefaultMetricType || s.Type > NativeHistogramMetric {
+		return fmt.Errorf("ginprom: unknown type %v of %s", s.Type, key)
+	}
+	for i, bound := range s.Buckets {
+		if math.IsNaN(bound) || i > 0 && bound <= s.Buckets[i-1] {
+			return fmt.Errorf("ginprom: buckets of %s aren't in increasing order: %v", key, s.Buckets)
+		}
+	}
+	for q, e := range s.Objectives {
+		if !(q >= 0 && q <= 1) || !(e > 0 && e < 1) {
+			return fmt.Errorf("ginprom: invalid objective %v with error %v of %s", q, e, key)
+		}
+	}
+	if s.MaxAge < 0 {
+		return fmt.Errorf("ginprom: max age %v of %s is negative", s.MaxAge, key)
+	}
+	return s.NativeHistogram.validate(key)
+}
+
+// metricSpec returns how the metric key is exported, the entry of MetricSpecs
+// taking precedence over the fields of PromOpts and the defaults
+func (po *PromOpts) metricSpec(key string) MetricSpec {
+	var spec MetricSpec
+	switch key {
+	case MetricRequestDuration:
+		spec = MetricSpec{Type: po.DurationType, Buckets: po.DurationBuckets, Objectives: po.DurationObjectives,
+			NativeHistogram: po.DurationNativeHistogram}
+	case MetricRequestSize:
+		spec = MetricSpec{Type: po.RequestSizeType, Buckets: po.SizeBuckets, Objectives: po.SizeObjectives,
+			MaxAge: po.SizeMaxAge, AgeBuckets: po.SizeAgeBuckets}
+	case MetricResponseSize:
+		spec = MetricSpec{Type: po.ResponseSizeType, Buckets: po.SizeBuckets, Objectives: po.SizeObjectives,
+			MaxAge: po.SizeMaxAge, AgeBuckets: po.SizeAgeBuckets}
+	}
+	if override, ok := po.MetricSpecs[key]; ok {
+		if override.Type != DefaultMetricType {
+			spec.Type = override.Type
+		}
+		if len(override.Buckets) > 0 {
+			spec.Buckets = override.Buckets
+		}
+		if len(override.Objectives) > 0 {
+			spec.Objectives = override.Objectives
+		}
+		if override.MaxAge != 0 {
+			spec.MaxAge = override.MaxAge
+		}
+		if override.AgeBuckets != 0 {
+			spec.AgeBuckets = override.AgeBuckets
+		}
+		spec.NativeHistogram = spec.NativeHistogram.merge(override.NativeHistogram)
+	}
+
+	if spec.Type == DefaultMetricType {
+		spec.Type = observedMetricTypes[key]
+	}
+	if len(spec.Buckets) == 0 {
+		switch {
+		case key != MetricRequestDuration:
+			spec.Buckets = DefSizeBuckets
+		case po.DurationBucketPreset != "":
+			spec.Buckets = BucketPresets[po.DurationBucketPreset]
+		case po.goldenSignals:
+			spec.Buckets = goldenDurationBuckets
+		default:
+			spec.Buckets = prometheus.DefBuckets
+		}
+	}
+	if key == MetricRequestDuration {
+		// the duration buckets are set in seconds whatever the unit
+		spec.Buckets = po.DurationUnit.scale(spec.Buckets)
+	}
+	if len(spec.Objectives) == 0 && key == MetricRequestDuration {
+		spec.Objectives = DefDurationObjectives
+	}
+	spec.NativeHistogram = defaultNativeHistogram.merge(spec.NativeHistogram)
+	return spec
+}
+
+// registerObserverVec registers the metric described by opts as spec describes it,
+// the buckets of opts are replaced by the ones of spec
+func registerObserverVec(r *registration, spec MetricSpec, opts prometheus.HistogramOpts, labelNames []string) prometheus.ObserverVec {
+	opts.Buckets = spec.Buckets
+	switch spec.Type {
+	case SummaryMetric:
+		return registerOrReuse(r, prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        opts.Name,
+			Help:        opts.Help,
+			ConstLabels: opts.ConstLabels,
+			Objectives:  spec.Objectives,
+			MaxAge:      spec.MaxAge,
+			AgeBuckets:  spec.AgeBuckets,
+		}, labelNames))
+	case HistogramMetric:
+		return registerOrReuse(r, prometheus.NewHistogramVec(opts, labelNames))
+	case NativeHistogramMetric:
+		native := defaultNativeHistogram.merge(spec.NativeHistogram)
+		opts.NativeHistogramBucketFactor = native.BucketFactor
+		opts.NativeHistogramZeroThreshold = native.ZeroThreshold
+		opts.NativeHistogramMaxBucketNumber = native.MaxBucketNumber
+		opts.NativeHistogramMinResetDuration = native.MinResetDuration
+		opts.NativeHistogramMaxZeroThreshold = native.MaxZeroThreshold
+		return registerOrReuse(r, prometheus.NewHistogramVec(opts, labelNames))
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("ginprom: unknown type %v of %s", spec.Type, opts.Name)
+	}
+	return nil
+}
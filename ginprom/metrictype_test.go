@@ -0,0 +1,348 @@
+package ginprom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRegisterObserverVec(t *testing.T) {
+	tests := []struct {
+		name       string
+		typ        MetricType
+		want       dto.MetricType
+		wantNative bool
+		wantErr    bool
+	}{
+		{"summary", SummaryMetric, dto.MetricType_SUMMARY, false, false},
+		{"histogram", HistogramMetric, dto.MetricType_HISTOGRAM, false, false},
+		{"native histogram", NativeHistogramMetric, dto.MetricType_HISTOGRAM, true, false},
+		{"unresolved", DefaultMetricType, 0, false, true},
+		{"unknown", MetricType(42), 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &registration{}
+			spec := MetricSpec{Type: tt.typ, Buckets: DefSizeBuckets, Objectives: DefDurationObjectives}
+			vec := registerObserverVec(r, spec, prometheus.HistogramOpts{
+				Name: "ginprom_test_observer_vec",
+				Help: "Observations.",
+			}, []string{"label"})
+			if err := r.finish(); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer prometheus.Unregister(vec)
+
+			vec.WithLabelValues("value").Observe(100)
+			mfs, err := prometheus.DefaultGatherer.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mf := range mfs {
+				if mf.GetName() == "ginprom_test_observer_vec" {
+					if mf.GetType() != tt.want {
+						t.Errorf("got type %v, want %v", mf.GetType(), tt.want)
+					}
+					m := mf.GetMetric()[0]
+					if got := m.GetHistogram() != nil && m.GetHistogram().Schema != nil; got != tt.wantNative {
+						t.Errorf("got native histogram %v, want %v", got, tt.wantNative)
+					}
+					if len(m.GetHistogram().GetBucket()) == 0 && tt.want == dto.MetricType_HISTOGRAM {
+						t.Error("the histogram has no classic buckets")
+					}
+					if got := len(m.GetSummary().GetQuantile()); tt.want == dto.MetricType_SUMMARY && got != len(DefDurationObjectives) {
+						t.Errorf("got %d quantiles, want %d", got, len(DefDurationObjectives))
+					}
+					return
+				}
+			}
+			t.Error("the metric isn't registered")
+		})
+	}
+}
+
+func TestMetricTypeString(t *testing.T) {
+	tests := []struct {
+		typ  MetricType
+		want string
+	}{
+		{DefaultMetricType, "default"},
+		{SummaryMetric, "summary"},
+		{HistogramMetric, "histogram"},
+		{NativeHistogramMetric, "native_histogram"},
+		{MetricType(42), "MetricType(42)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.typ.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestMetricSpecsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   MetricSpecs
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"standard", MetricSpecs{
+			MetricRequestDuration: {Type: NativeHistogramMetric, Buckets: []float64{.01, .1, 1}},
+			MetricRequestSize:     {Type: HistogramMetric},
+			MetricResponseSize:    {Objectives: map[float64]float64{0.5: 0.05, 0.99: 0.001}},
+		}, false},
+		{"unknown key", MetricSpecs{MetricRequestCount: {Type: HistogramMetric}}, true},
+		{"unknown type", MetricSpecs{MetricRequestSize: {Type: MetricType(42)}}, true},
+		{"unordered buckets", MetricSpecs{MetricRequestDuration: {Buckets: []float64{1, .1}}}, true},
+		{"duplicated buckets", MetricSpecs{MetricRequestDuration: {Buckets: []float64{1, 1}}}, true},
+		{"summary buckets", MetricSpecs{MetricRequestSize: {Buckets: []float64{1, 2}}}, true},
+		{"histogram objectives", MetricSpecs{MetricRequestDuration: {Objectives: map[float64]float64{0.5: 0.05}}}, true},
+		{"quantile out of range", MetricSpecs{MetricRequestDuration: {Type: SummaryMetric, Objectives: map[float64]float64{1.5: 0.05}}}, true},
+		{"error out of range", MetricSpecs{MetricRequestDuration: {Type: SummaryMetric, Objectives: map[float64]float64{0.5: 0}}}, true},
+		{"summary max age", MetricSpecs{MetricRequestSize: {MaxAge: time.Minute, AgeBuckets: 3}}, false},
+		{"histogram max age", MetricSpecs{MetricRequestDuration: {MaxAge: time.Minute}}, true},
+		{"histogram age buckets", MetricSpecs{MetricRequestSize: {Type: HistogramMetric, AgeBuckets: 3}}, true},
+		{"negative max age", MetricSpecs{MetricRequestSize: {MaxAge: -time.Minute}}, true},
+		{"native histogram", MetricSpecs{MetricRequestDuration: {Type: NativeHistogramMetric,
+			NativeHistogram: NativeHistogramOpts{BucketFactor: 1.05, ZeroThreshold: 1e-6, MaxZeroThreshold: 1e-3}}}, false},
+		{"histogram native options", MetricSpecs{MetricRequestDuration: {NativeHistogram: NativeHistogramOpts{BucketFactor: 1.05}}}, true},
+		{"bucket factor of 1", MetricSpecs{MetricRequestDuration: {Type: NativeHistogramMetric,
+			NativeHistogram: NativeHistogramOpts{BucketFactor: 1}}}, true},
+		{"negative zero threshold", MetricSpecs{MetricRequestDuration: {Type: NativeHistogramMetric,
+			NativeHistogram: NativeHistogramOpts{ZeroThreshold: -1}}}, true},
+		{"negative reset duration", MetricSpecs{MetricRequestDuration: {Type: NativeHistogramMetric,
+			NativeHistogram: NativeHistogramOpts{MinResetDuration: -time.Second}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.specs.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPromOptsMetricSpec(t *testing.T) {
+	objectives := map[float64]float64{0.9: 0.01}
+	tests := []struct {
+		name string
+		opts *PromOpts
+		key  string
+		want MetricSpec
+	}{
+		{"default duration", &PromOpts{}, MetricRequestDuration,
+			MetricSpec{Type: HistogramMetric, Buckets: prometheus.DefBuckets, Objectives: DefDurationObjectives, NativeHistogram: defaultNativeHistogram}},
+		{"golden duration", GoldenSignals(), MetricRequestDuration,
+			MetricSpec{Type: HistogramMetric, Buckets: goldenDurationBuckets, Objectives: DefDurationObjectives, NativeHistogram: defaultNativeHistogram}},
+		{"default size", &PromOpts{}, MetricResponseSize,
+			MetricSpec{Type: SummaryMetric, Buckets: DefSizeBuckets, NativeHistogram: defaultNativeHistogram}},
+		{"fields", &PromOpts{DurationType: SummaryMetric, DurationObjectives: objectives}, MetricRequestDuration,
+			MetricSpec{Type: SummaryMetric, Buckets: prometheus.DefBuckets, Objectives: objectives, NativeHistogram: defaultNativeHistogram}},
+		{"duration buckets", &PromOpts{DurationBuckets: []float64{.001, 30}}, MetricRequestDuration,
+			MetricSpec{Type: HistogramMetric, Buckets: []float64{.001, 30}, Objectives: DefDurationObjectives, NativeHistogram: defaultNativeHistogram}},
+		{"duration buckets over golden signals", &PromOpts{DurationBuckets: []float64{1, 2}, goldenSignals: true}, MetricRequestDuration,
+			MetricSpec{Type: HistogramMetric, Buckets: []float64{1, 2}, Objectives: DefDurationObjectives, NativeHistogram: defaultNativeHistogram}},
+		{"size fields", &PromOpts{RequestSizeType: HistogramMetric, SizeBuckets: []float64{1, 2}}, MetricRequestSize,
+			MetricSpec{Type: HistogramMetric, Buckets: []float64{1, 2}, NativeHistogram: defaultNativeHistogram}},
+		{"specs override the fields", &PromOpts{
+			RequestSizeType: HistogramMetric,
+			SizeBuckets:     []float64{1, 2},
+			MetricSpecs:     MetricSpecs{MetricRequestSize: {Buckets: []float64{3, 4}}},
+		}, MetricRequestSize, MetricSpec{Type: HistogramMetric, Buckets: []float64{3, 4}, NativeHistogram: defaultNativeHistogram}},
+		{"specs only set what they set", &PromOpts{
+			DurationObjectives: objectives,
+			MetricSpecs:        MetricSpecs{MetricRequestDuration: {Type: SummaryMetric}},
+		}, MetricRequestDuration, MetricSpec{Type: SummaryMetric, Buckets: prometheus.DefBuckets, Objectives: objectives, NativeHistogram: defaultNativeHistogram}},
+		{"size summary fields", &PromOpts{SizeObjectives: objectives, SizeMaxAge: time.Minute, SizeAgeBuckets: 3}, MetricResponseSize,
+			MetricSpec{Type: SummaryMetric, Buckets: DefSizeBuckets, Objectives: objectives, MaxAge: time.Minute, AgeBuckets: 3,
+				NativeHistogram: defaultNativeHistogram}},
+		{"specs override the max age", &PromOpts{
+			SizeMaxAge:     time.Minute,
+			SizeAgeBuckets: 3,
+			MetricSpecs:    MetricSpecs{MetricRequestSize: {MaxAge: time.Hour}},
+		}, MetricRequestSize, MetricSpec{Type: SummaryMetric, Buckets: DefSizeBuckets, MaxAge: time.Hour, AgeBuckets: 3,
+			NativeHistogram: defaultNativeHistogram}},
+		{"duration native histogram", &PromOpts{
+			DurationType:            NativeHistogramMetric,
+			DurationNativeHistogram: NativeHistogramOpts{BucketFactor: 1.01},
+		}, MetricRequestDuration, MetricSpec{Type: NativeHistogramMetric, Buckets: prometheus.DefBuckets, Objectives: DefDurationObjectives,
+			NativeHistogram: NativeHistogramOpts{BucketFactor: 1.01, MaxBucketNumber: 160, MinResetDuration: time.Hour}}},
+		{"specs merge the native histogram", &PromOpts{
+			DurationNativeHistogram: NativeHistogramOpts{BucketFactor: 1.01},
+			MetricSpecs: MetricSpecs{MetricRequestDuration: {
+				Type:            NativeHistogramMetric,
+				NativeHistogram: NativeHistogramOpts{MaxBucketNumber: 40},
+			}},
+		}, MetricRequestDuration, MetricSpec{Type: NativeHistogramMetric, Buckets: prometheus.DefBuckets, Objectives: DefDurationObjectives,
+			NativeHistogram: NativeHistogramOpts{BucketFactor: 1.01, MaxBucketNumber: 40, MinResetDuration: time.Hour}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.opts.metricSpec(tt.key)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPromMiddlewareInvalidSpecs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *PromOpts
+	}{
+		{"invalid specs", &PromOpts{MetricSpecs: MetricSpecs{MetricRequestCount: {}}}},
+		{"invalid size buckets", &PromOpts{RequestSizeType: HistogramMetric, SizeBuckets: []float64{2, 1}}},
+		{"invalid duration buckets", &PromOpts{DurationBuckets: []float64{1, 1}}},
+		{"invalid duration objectives", &PromOpts{DurationType: SummaryMetric, DurationObjectives: map[float64]float64{2: 0.1}}},
+		{"negative size max age", &PromOpts{SizeMaxAge: -time.Minute}},
+		{"invalid duration native histogram", &PromOpts{DurationType: NativeHistogramMetric,
+			DurationNativeHistogram: NativeHistogramOpts{BucketFactor: 0.5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mw, err := NewPromMiddleware(tt.opts); err == nil || mw != nil {
+				t.Errorf("got %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+func TestPromOptsDurationBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []float64
+		want    []float64
+	}{
+		{"default", nil, prometheus.DefBuckets},
+		{"custom", []float64{.001, .01, .1, 1, 10, 30}, []float64{.001, .01, .1, 1, 10, 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.DurationBuckets = tt.buckets
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.reqDuration.WithLabelValues("200", "/", "GET").Observe(0.5)
+
+			mfs, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mf := range mfs {
+				if mf.GetName() != "service_http_request_duration_seconds" {
+					continue
+				}
+				var got []float64
+				for _, b := range mf.GetMetric()[0].GetHistogram().GetBucket() {
+					got = append(got, b.GetUpperBound())
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got buckets %v, want %v", got, tt.want)
+				}
+				return
+			}
+			t.Error("the duration isn't registered")
+		})
+	}
+}
+
+func TestPromOptsDurationNativeHistogram(t *testing.T) {
+	tests := []struct {
+		name          string
+		native        NativeHistogramOpts
+		wantSchema    int32
+		wantThreshold float64
+	}{
+		{"default", NativeHistogramOpts{}, 3, prometheus.DefNativeHistogramZeroThreshold},
+		{"coarse", NativeHistogramOpts{BucketFactor: 2}, 0, prometheus.DefNativeHistogramZeroThreshold},
+		{"fine", NativeHistogramOpts{BucketFactor: 1.01, ZeroThreshold: 1e-6}, 7, 1e-6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.DurationType = NativeHistogramMetric
+			opts.DurationNativeHistogram = tt.native
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			observer := m.reqDuration.WithLabelValues("200", "/native", "GET")
+			observer.Observe(0.1)
+
+			var metric dto.Metric
+			if err := observer.(prometheus.Metric).Write(&metric); err != nil {
+				t.Fatal(err)
+			}
+			h := metric.GetHistogram()
+			if h.GetSchema() != tt.wantSchema {
+				t.Errorf("got schema %d, want %d", h.GetSchema(), tt.wantSchema)
+			}
+			if h.GetZeroThreshold() != tt.wantThreshold {
+				t.Errorf("got zero threshold %v, want %v", h.GetZeroThreshold(), tt.wantThreshold)
+			}
+		})
+	}
+}
+
+func TestPromOptsSizeObjectives(t *testing.T) {
+	tests := []struct {
+		name          string
+		objectives    map[float64]float64
+		wantQuantiles []float64
+	}{
+		{"default", nil, nil},
+		{"objectives", map[float64]float64{0.5: 0.05, 0.99: 0.001}, []float64{0.5, 0.99}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.SizeObjectives = tt.objectives
+			opts.SizeMaxAge = time.Minute
+			opts.SizeAgeBuckets = 2
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, vec := range []prometheus.ObserverVec{m.reqSizeBytes, m.respSizeBytes} {
+				observer := vec.WithLabelValues("200", "/size", "GET")
+				observer.Observe(100)
+				var metric dto.Metric
+				if err := observer.(prometheus.Metric).Write(&metric); err != nil {
+					t.Fatal(err)
+				}
+				var got []float64
+				for _, q := range metric.GetSummary().GetQuantile() {
+					got = append(got, q.GetQuantile())
+					if q.GetValue() != 100 {
+						t.Errorf("got quantile %v = %v, want 100", q.GetQuantile(), q.GetValue())
+					}
+				}
+				if !reflect.DeepEqual(got, tt.wantQuantiles) {
+					t.Errorf("got quantiles %v, want %v", got, tt.wantQuantiles)
+				}
+			}
+		})
+	}
+}
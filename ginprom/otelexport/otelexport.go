@@ -0,0 +1,72 @@
+// Package otelexport records the requests of the ginprom middleware through the
+// OpenTelemetry metrics API, for the services exporting to an OTLP collector rather
+// than being scraped. Used with ginprom.PromOpts.ObserversOnly no Prometheus collector
+// is registered:
+//
+//	observer, err := otelexport.New(meterProvider)
+//	opts := ginprom.NewDefaultOpts()
+//	opts.ObserversOnly = true
+//	opts.Observers = []ginprom.Observer{observer}
+//	r.Use(ginprom.PromMiddleware(opts))
+package otelexport
+
+import (
+	"context"
+	"fmt"
+
+	"ginmetric/ginprom"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ScopeName is the instrumentation scope of the instruments
+const ScopeName = "ginmetric/ginprom/otelexport"
+
+// Observer is a ginprom.Observer recording the request metrics of the middleware
+// into OpenTelemetry instruments with the status, endpoint and method attributes
+type Observer struct {
+	requests metric.Int64Counter
+	duration metric.Float64Histogram
+	reqSize  metric.Float64Histogram
+	respSize metric.Float64Histogram
+}
+
+// New returns an Observer whose instruments are created by a meter of provider
+func New(provider metric.MeterProvider) (*Observer, error) {
+	meter := provider.Meter(ScopeName)
+	o := &Observer{}
+	var err error
+	if o.requests, err = meter.Int64Counter("http_request_count",
+		metric.WithDescription("Total number of http requests made.")); err != nil {
+		return nil, fmt.Errorf("otelexport: %w", err)
+	}
+	if o.duration, err = meter.Float64Histogram("http_request_duration",
+		metric.WithDescription("HTTP request latencies in seconds"), metric.WithUnit("s")); err != nil {
+		return nil, fmt.Errorf("otelexport: %w", err)
+	}
+	if o.reqSize, err = meter.Float64Histogram("http_request_size",
+		metric.WithDescription("HTTP request size in bytes"), metric.WithUnit("By")); err != nil {
+		return nil, fmt.Errorf("otelexport: %w", err)
+	}
+	if o.respSize, err = meter.Float64Histogram("http_response_size",
+		metric.WithDescription("HTTP response size in bytes"), metric.WithUnit("By")); err != nil {
+		return nil, fmt.Errorf("otelexport: %w", err)
+	}
+	return o, nil
+}
+
+// Observe implements ginprom.Observer
+func (o *Observer) Observe(obs ginprom.Observation) {
+	ctx := context.Background()
+	attrs := metric.WithAttributeSet(attribute.NewSet(
+		attribute.String("status", obs.Status),
+		attribute.String("endpoint", obs.Endpoint),
+		attribute.String("method", obs.Method),
+	))
+
+	o.requests.Add(ctx, 1, attrs)
+	o.duration.Record(ctx, obs.Duration.Seconds(), attrs)
+	o.reqSize.Record(ctx, obs.RequestSize, attrs)
+	o.respSize.Record(ctx, obs.ResponseSize, attrs)
+}
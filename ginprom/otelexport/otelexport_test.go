@@ -0,0 +1,85 @@
+package otelexport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ginmetric/ginprom"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestObserver(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		path     string
+		requests int
+		status   string
+		endpoint string
+	}{
+		{"route", "/users/42", 2, "200", "/users/:id"},
+		{"unmatched route", "/nowhere", 1, "404", "/nowhere"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			observer, err := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := ginprom.NewDefaultOpts()
+			opts.ObserversOnly = true
+			opts.Observers = []ginprom.Observer{observer}
+			r := gin.New()
+			r.Use(ginprom.PromMiddleware(opts))
+			r.GET("/users/:id", func(c *gin.Context) {
+				c.String(http.StatusOK, "user")
+			})
+			for i := 0; i < tt.requests; i++ {
+				r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+			if len(rm.ScopeMetrics) != 1 || rm.ScopeMetrics[0].Scope.Name != ScopeName {
+				t.Fatalf("got scopes %+v", rm.ScopeMetrics)
+			}
+			want := attribute.NewSet(
+				attribute.String("status", tt.status),
+				attribute.String("endpoint", tt.endpoint),
+				attribute.String("method", http.MethodGet),
+			)
+
+			got := map[string]bool{}
+			for _, m := range rm.ScopeMetrics[0].Metrics {
+				got[m.Name] = true
+				switch data := m.Data.(type) {
+				case metricdata.Sum[int64]:
+					if len(data.DataPoints) != 1 || !data.DataPoints[0].Attributes.Equals(&want) || data.DataPoints[0].Value != int64(tt.requests) {
+						t.Errorf("got %s points %+v", m.Name, data.DataPoints)
+					}
+				case metricdata.Histogram[float64]:
+					if len(data.DataPoints) != 1 || !data.DataPoints[0].Attributes.Equals(&want) || data.DataPoints[0].Count != uint64(tt.requests) {
+						t.Errorf("got %s points %+v", m.Name, data.DataPoints)
+					}
+				default:
+					t.Errorf("unexpected %s data %T", m.Name, m.Data)
+				}
+			}
+			for _, name := range []string{"http_request_count", "http_request_duration", "http_request_size", "http_response_size"} {
+				if !got[name] {
+					t.Errorf("%s isn't recorded", name)
+				}
+			}
+		})
+	}
+}
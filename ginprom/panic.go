@@ -0,0 +1,69 @@
+package ginprom
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// panicCountedKey marks in the context the requests whose panic was counted,
+// so the middleware and PanicRecovery don't both count it
+const panicCountedKey = "ginprom.panicCounted"
+
+// registerPanicCounter registers the http_panic_total counter of promOpts with r
+func registerPanicCounter(r *registration, promOpts *PromOpts) *prometheus.CounterVec {
+	return registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   promOpts.namespace(),
+		Subsystem:   promOpts.Subsystem,
+		ConstLabels: promOpts.constLabels(),
+		Name:        "http_panic_total",
+		Help:        promOpts.help(MetricPanics, "Total number of http requests whose handler panicked."),
+	}, []string{"endpoint", "method"}))
+}
+
+// countPanic counts the panic p of the request of c into panics once,
+// http.ErrAbortHandler aborting on purpose
+func countPanic(panics *prometheus.CounterVec, c *gin.Context, endpoint, method string, p interface{}) {
+	if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+		return
+	}
+	if c.GetBool(panicCountedKey) {
+		return
+	}
+	c.Set(panicCountedKey, true)
+	panics.WithLabelValues(endpoint, method).Inc()
+}
+
+// PanicRecovery returns a gin.Recovery counting the recovered panics, it panics when
+// its counter conflicts with a registered one, see NewPanicRecovery
+func PanicRecovery(promOpts *PromOpts) gin.HandlerFunc {
+	h, err := NewPanicRecovery(promOpts)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// NewPanicRecovery is like PanicRecovery but returns an error when its counter conflicts
+// with the collectors registered on PromOpts.Registerer. Used instead of gin.Recovery after
+// the middleware, the requests which panicked are also recorded with their 500 status; the
+// middleware counts the panics itself with PromOpts.CountPanics otherwise
+func NewPanicRecovery(promOpts *PromOpts) (gin.HandlerFunc, error) {
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	endpointLabel := promOpts.endpointLabelFn()
+
+	r := promOpts.registration()
+	panics := registerPanicCounter(r, promOpts)
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+
+	return gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+		countPanic(panics, c, endpointLabel(c), promOpts.methodLabel(c.Request.Method), err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}), nil
+}
@@ -0,0 +1,83 @@
+package ginprom
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPanicCounter(t *testing.T) {
+	errorWriter := gin.DefaultErrorWriter
+	gin.DefaultErrorWriter = io.Discard
+	defer func() { gin.DefaultErrorWriter = errorWriter }()
+
+	tests := []struct {
+		name        string
+		countPanics bool
+		// recovery is where the panics are recovered: "gin" before the middleware,
+		// "ginprom" after it
+		recovery    string
+		panicValue  interface{}
+		wantPanics  float64
+		wantRecords float64
+	}{
+		{"middleware", true, "gin", "boom", 1, 0},
+		{"panic recovery", false, "ginprom", "boom", 1, 1},
+		{"both", true, "ginprom", "boom", 1, 1},
+		{"abort handler", true, "gin", http.ErrAbortHandler, 0, 0},
+		{"no panic", true, "ginprom", nil, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.CountPanics = tt.countPanics
+			r := gin.New()
+			if tt.recovery == "gin" {
+				r.Use(gin.Recovery())
+			}
+			r.Use(PromMiddleware(opts))
+			if tt.recovery == "ginprom" {
+				r.Use(PanicRecovery(opts))
+			}
+			r.GET("/panic", func(c *gin.Context) {
+				if tt.panicValue != nil {
+					panic(tt.panicValue)
+				}
+				c.Status(http.StatusInternalServerError)
+			})
+
+			if w := serve(r, http.MethodGet, "/panic"); w.Code != http.StatusInternalServerError {
+				t.Errorf("got status %d, want 500", w.Code)
+			}
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counter := registerPanicCounter(opts.registration(), opts)
+			if got := testutil.ToFloat64(counter.WithLabelValues("/panic", http.MethodGet)); got != tt.wantPanics {
+				t.Errorf("got %v panics, want %v", got, tt.wantPanics)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues("500", "/panic", http.MethodGet)); got != tt.wantRecords {
+				t.Errorf("got %v requests recorded, want %v", got, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestNewPanicRecoveryConflict(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_http_panic_total",
+		Help: "conflicting",
+	}, []string{"route"}))
+
+	if h, err := NewPanicRecovery(&PromOpts{Registerer: reg}); err == nil || h != nil {
+		t.Errorf("got %v, want a conflict error", err)
+	}
+}
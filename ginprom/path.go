@@ -0,0 +1,171 @@
+package ginprom
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PathNormalization rewrites the raw URL paths used as endpoint labels, by URLPath or by
+// RoutePath for the unmatched routes, so the spellings of a path share their series. The
+// route templates of the matched routes are kept as is
+type PathNormalization struct {
+	// StripQuery removes the query string, for the mappings labelling with the request URI
+	StripQuery bool
+	// StripTrailingSlash removes the trailing slashes, / staying the root path
+	StripTrailingSlash bool
+	// Lowercase lowercases the path
+	Lowercase bool
+	// Normalizers rewrite the path in order, after the normalizations above, see IDNormalizers
+	Normalizers []func(path string) string
+}
+
+// normalize returns path normalized
+func (n *PathNormalization) normalize(path string) string {
+	if n.StripQuery {
+		path, _, _ = strings.Cut(path, "?")
+	}
+	if n.StripTrailingSlash && len(path) > 1 {
+		if path = strings.TrimRight(path, "/"); path == "" {
+			path = "/"
+		}
+	}
+	if n.Lowercase {
+		path = strings.ToLower(path)
+	}
+	for _, normalize := range n.Normalizers {
+		path = normalize(path)
+	}
+	return path
+}
+
+// normalizedEndpoint returns endpointLabel normalizing by n the endpoints which aren't
+// the route template of the request
+func (n *PathNormalization) normalizedEndpoint(endpointLabel RequestLabelMappingFn) RequestLabelMappingFn {
+	return func(c *gin.Context) string {
+		endpoint := endpointLabel(c)
+		if route := c.FullPath(); route != "" && endpoint == route {
+			return endpoint
+		}
+		return n.normalize(endpoint)
+	}
+}
+
+// IDNormalizers replace the numeric IDs, UUIDs and hex hashes of the path segments with
+// :id, :uuid and :hash, for the Normalizers of the apps labelling with the URL paths, like
+// the reverse proxies of a wildcard route
+var IDNormalizers = []func(path string) string{NumericIDs, UUIDs, HexHashes}
+
+// NumericIDs replaces the numeric path segments with :id
+func NumericIDs(path string) string {
+	return replaceSegments(path, ":id", isNumeric)
+}
+
+// UUIDs replaces the UUID path segments, of any case, with :uuid
+func UUIDs(path string) string {
+	return replaceSegments(path, ":uuid", isUUID)
+}
+
+// HexHashes replaces the path segments of at least 16 hex digits, like MD5 and SHA
+// digests, with :hash
+func HexHashes(path string) string {
+	return replaceSegments(path, ":hash", func(segment string) bool {
+		return len(segment) >= 16 && isHex(segment)
+	})
+}
+
+// replaceSegments returns path with its segments matching match replaced with placeholder
+func replaceSegments(path, placeholder string, match func(segment string) bool) string {
+	segments := strings.Split(path, "/")
+	replaced := false
+	for i, segment := range segments {
+		if segment != "" && match(segment) {
+			segments[i] = placeholder
+			replaced = true
+		}
+	}
+	if !replaced {
+		return path
+	}
+	return strings.Join(segments, "/")
+}
+
+// isNumeric reports whether s only has decimal digits
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHex reports whether s only has hex digits
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isHexDigit reports whether b is a hex digit
+func isHexDigit(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+// isUUID reports whether s is a UUID like 123e4567-e89b-12d3-a456-426614174000
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RegexpNormalizer returns an endpoint normalizer replacing the matches of pattern with
+// replacement, expanding its $1 like regexp.ReplaceAllString, it panics when pattern is
+// invalid, see NewRegexpNormalizer
+func RegexpNormalizer(pattern, replacement string) func(endpoint string) string {
+	normalize, err := NewRegexpNormalizer(pattern, replacement)
+	if err != nil {
+		panic(err)
+	}
+	return normalize
+}
+
+// NewRegexpNormalizer is like RegexpNormalizer but returns an error when pattern is invalid
+func NewRegexpNormalizer(pattern, replacement string) (func(endpoint string) string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("ginprom: invalid endpoint normalizer: %w", err)
+	}
+	return func(endpoint string) string {
+		return re.ReplaceAllString(endpoint, replacement)
+	}, nil
+}
+
+// normalizedEndpoints returns endpointLabel rewriting the endpoints by normalizers in order
+func normalizedEndpoints(endpointLabel RequestLabelMappingFn, normalizers []func(endpoint string) string) RequestLabelMappingFn {
+	return func(c *gin.Context) string {
+		endpoint := endpointLabel(c)
+		for _, normalize := range normalizers {
+			endpoint = normalize(endpoint)
+		}
+		return endpoint
+	}
+}
@@ -0,0 +1,188 @@
+package ginprom
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPathNormalization(t *testing.T) {
+	ids := regexp.MustCompile(`/[0-9]+`)
+	tests := []struct {
+		name string
+		n    PathNormalization
+		path string
+		want string
+	}{
+		{"none", PathNormalization{}, "/Users/?page=2", "/Users/?page=2"},
+		{"query", PathNormalization{StripQuery: true}, "/users?page=2", "/users"},
+		{"trailing slash", PathNormalization{StripTrailingSlash: true}, "/users//", "/users"},
+		{"root", PathNormalization{StripTrailingSlash: true}, "//", "/"},
+		{"lowercase", PathNormalization{Lowercase: true}, "/Users/Alice", "/users/alice"},
+		{"all", PathNormalization{StripQuery: true, StripTrailingSlash: true, Lowercase: true},
+			"/Users/?Page=2", "/users"},
+		{"normalizers in order", PathNormalization{StripQuery: true, Normalizers: []func(string) string{
+			func(path string) string { return ids.ReplaceAllString(path, "/:id") },
+			func(path string) string { return "/api" + path },
+		}}, "/users/42?full=1", "/api/users/:id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.n.normalize(tt.path); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsPathNormalization(t *testing.T) {
+	n := &PathNormalization{StripQuery: true, StripTrailingSlash: true, Lowercase: true}
+	requestURI := func(c *gin.Context) string { return c.Request.RequestURI }
+	tests := []struct {
+		name     string
+		mapping  RequestLabelMappingFn
+		collapse bool
+		path     string
+		status   string
+		want     string
+	}{
+		{"route template kept", nil, false, "/Users/42", "200", "/Users/:id"},
+		{"unmatched route", nil, false, "/Nowhere/", "404", "/nowhere"},
+		{"url path", URLPath, false, "/Users/42", "200", "/users/42"},
+		{"request uri", requestURI, false, "/Users/42?page=2", "200", "/users/42"},
+		{"collapsed", nil, true, "/Nowhere/", "404", NotFoundEndpointValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &PromOpts{
+				Registerer:              prometheus.NewRegistry(),
+				EndpointLabelMappingFn:  tt.mapping,
+				PathNormalization:       n,
+				CollapseUnmatchedRoutes: tt.collapse,
+			}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/Users/:id", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			serve(r, http.MethodGet, tt.path)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.status, tt.want, http.MethodGet)); got != 1 {
+				t.Errorf("got %v requests labelled %s, want 1", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIDNormalizers(t *testing.T) {
+	n := &PathNormalization{Normalizers: IDNormalizers}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"numeric", "/users/42/orders/7", "/users/:id/orders/:id"},
+		{"uuid", "/jobs/123e4567-E89B-12d3-a456-426614174000", "/jobs/:uuid"},
+		{"sha1", "/blobs/da39a3ee5e6b4b0d3255bfef95601890afd80709", "/blobs/:hash"},
+		{"long number", "/orders/12345678901234567890", "/orders/:id"},
+		{"short hex", "/colors/beef", "/colors/beef"},
+		{"mixed", "/users/42/avatar/d41d8cd98f00b204e9800998ecf8427e.png", "/users/:id/avatar/d41d8cd98f00b204e9800998ecf8427e.png"},
+		{"not a uuid", "/jobs/123e4567-e89b-12d3-a456_426614174000", "/jobs/123e4567-e89b-12d3-a456_426614174000"},
+		{"trailing slash", "/users/42/", "/users/:id/"},
+		{"none", "/users/me", "/users/me"},
+		{"root", "/", "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.normalize(tt.path); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRegexpNormalizer(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		replacement string
+		endpoint    string
+		want        string
+		wantErr     bool
+	}{
+		{"replace", `^/api/v[0-9]+`, "/api", "/api/v3/users", "/api/users", false},
+		{"expand", `^/(\w+)/legacy/`, "/$1/", "/shop/legacy/cart", "/shop/cart", false},
+		{"no match", `^/internal`, "", "/users", "/users", false},
+		{"invalid", `(`, "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalize, err := NewRegexpNormalizer(tt.pattern, tt.replacement)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want an error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := normalize(tt.endpoint); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsEndpointNormalizers(t *testing.T) {
+	tests := []struct {
+		name        string
+		normalizers []func(string) string
+		path        string
+		status      string
+		want        string
+	}{
+		{"none", nil, "/v1/users/42", "200", "/v1/users/:id"},
+		{"route template", []func(string) string{RegexpNormalizer(`^/v[0-9]+`, "")},
+			"/v1/users/42", "200", "/users/:id"},
+		{"in order", []func(string) string{
+			RegexpNormalizer(`^/v[0-9]+`, ""),
+			func(endpoint string) string { return "/public" + endpoint },
+		}, "/v1/users/42", "200", "/public/users/:id"},
+		{"after the path normalization", []func(string) string{RegexpNormalizer(`:id`, "{id}")},
+			"/v2/orders/7", "404", "/v2/orders/{id}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &PromOpts{
+				Registerer:          prometheus.NewRegistry(),
+				PathNormalization:   &PathNormalization{Normalizers: IDNormalizers},
+				EndpointNormalizers: tt.normalizers,
+			}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/v1/users/:id", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			serve(r, http.MethodGet, tt.path)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.status, tt.want, http.MethodGet)); got != 1 {
+				t.Errorf("got %v requests labelled %s, want 1", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package ginprom
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const defaultPushInterval = 15 * time.Second
+
+// PushgatewayOpts configures a Pushgateway
+type PushgatewayOpts struct {
+	// URL is the address of the Pushgateway, like http://pushgateway:9091
+	URL string
+	// Job is the job label of the pushed metrics
+	Job string
+	// Interval is how often the metrics are pushed, 15s if not positive
+	Interval time.Duration
+	// Grouping are the labels of the pushed group next to the job
+	Grouping map[string]string
+	// Gatherer supplies the pushed metrics, prometheus.DefaultGatherer if nil
+	Gatherer prometheus.Gatherer
+	// Client sends the pushes, http.DefaultClient if nil
+	Client push.HTTPDoer
+	// OnError is called with the errors of the pushes, if set
+	OnError func(err error)
+}
+
+// Pushgateway is a Collector periodically pushing the metrics to a Prometheus Pushgateway,
+// for short-lived services and the ones Prometheus can't reach
+type Pushgateway struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	onError  func(err error)
+
+	pushes *prometheus.CounterVec
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPushgateway returns a Pushgateway pushing every interval until stopped,
+// it still needs to be registered for its own metrics to be pushed
+func NewPushgateway(opts PushgatewayOpts) (*Pushgateway, error) {
+	if opts.URL == "" {
+		return nil, errors.New("ginprom: the Pushgateway URL is required")
+	}
+	if opts.Job == "" {
+		return nil, errors.New("ginprom: the Pushgateway job is required")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultPushInterval
+	}
+	if opts.Gatherer == nil {
+		opts.Gatherer = prometheus.DefaultGatherer
+	}
+
+	pusher := push.New(opts.URL, opts.Job).Gatherer(opts.Gatherer)
+	for name, value := range opts.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if opts.Client != nil {
+		pusher = pusher.Client(opts.Client)
+	}
+	if err := pusher.Error(); err != nil {
+		return nil, fmt.Errorf("ginprom: %w", err)
+	}
+
+	p := &Pushgateway{
+		pusher:   pusher,
+		interval: opts.Interval,
+		onError:  opts.OnError,
+		pushes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: selfNamespace,
+			Name:      "pushgateway_pushes_total",
+			Help:      "Total number of pushes made to the Pushgateway.",
+		}, []string{"result"}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Describe implements prometheus.Collector
+func (p *Pushgateway) Describe(ch chan<- *prometheus.Desc) {
+	p.pushes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (p *Pushgateway) Collect(ch chan<- prometheus.Metric) {
+	p.pushes.Collect(ch)
+}
+
+// Stop pushes the metrics a last time, so the final values of a job are kept, and stops pushing
+func (p *Pushgateway) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.stopped
+}
+
+func (p *Pushgateway) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.push()
+		case <-p.stop:
+			p.push()
+			return
+		}
+	}
+}
+
+func (p *Pushgateway) push() {
+	if err := p.pusher.Push(); err != nil {
+		p.pushes.WithLabelValues("error").Inc()
+		if p.onError != nil {
+			p.onError(err)
+		}
+		return
+	}
+	p.pushes.WithLabelValues("success").Inc()
+}
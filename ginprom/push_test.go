@@ -0,0 +1,133 @@
+package ginprom
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakePushgateway records the pushes it receives
+type fakePushgateway struct {
+	status int
+
+	mu     sync.Mutex
+	pushes []string
+	bodies []string
+}
+
+func (g *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	g.mu.Lock()
+	g.pushes = append(g.pushes, r.Method+" "+r.URL.Path)
+	g.bodies = append(g.bodies, string(body))
+	g.mu.Unlock()
+	w.WriteHeader(g.status)
+}
+
+func (g *fakePushgateway) received() ([]string, []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.pushes...), append([]string(nil), g.bodies...)
+}
+
+func TestPushgateway(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		grouping   map[string]string
+		wantPath   string
+		wantResult string
+	}{
+		{"push", http.StatusOK, nil, "PUT /metrics/job/batch", "success"},
+		{"grouping", http.StatusOK, map[string]string{"instance": "worker-1"}, "PUT /metrics/job/batch/instance/worker-1", "success"},
+		{"failing", http.StatusInternalServerError, nil, "PUT /metrics/job/batch", "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := &fakePushgateway{status: tt.status}
+			srv := httptest.NewServer(gateway)
+			defer srv.Close()
+
+			reg := prometheus.NewRegistry()
+			processed := prometheus.NewCounter(prometheus.CounterOpts{Name: "batch_processed_total", Help: "Processed items."})
+			reg.MustRegister(processed)
+			processed.Add(3)
+
+			var errs int
+			var mu sync.Mutex
+			p, err := NewPushgateway(PushgatewayOpts{
+				URL:      srv.URL,
+				Job:      "batch",
+				Interval: 10 * time.Millisecond,
+				Grouping: tt.grouping,
+				Gatherer: reg,
+				OnError: func(error) {
+					mu.Lock()
+					errs++
+					mu.Unlock()
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(30 * time.Millisecond)
+			p.Stop()
+			p.Stop()
+
+			pushes, bodies := gateway.received()
+			if len(pushes) < 2 {
+				t.Fatalf("got %d pushes, want the periodic ones and the final one", len(pushes))
+			}
+			for i, push := range pushes {
+				if push != tt.wantPath {
+					t.Errorf("got push %q, want %q", push, tt.wantPath)
+				}
+				if !strings.Contains(bodies[i], "batch_processed_total") {
+					t.Errorf("the push doesn't contain the gathered metrics")
+				}
+			}
+			if got := testutil.ToFloat64(p.pushes.WithLabelValues(tt.wantResult)); got != float64(len(pushes)) {
+				t.Errorf("got %v %s pushes, want %d", got, tt.wantResult, len(pushes))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if wantErrs := tt.wantResult == "error"; (errs > 0) != wantErrs {
+				t.Errorf("got %d errors", errs)
+			}
+
+			// no push happens once stopped
+			time.Sleep(20 * time.Millisecond)
+			if after, _ := gateway.received(); len(after) != len(pushes) {
+				t.Errorf("got %d pushes after Stop", len(after)-len(pushes))
+			}
+		})
+	}
+}
+
+func TestNewPushgatewayInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts PushgatewayOpts
+	}{
+		{"no URL", PushgatewayOpts{Job: "batch"}},
+		{"no job", PushgatewayOpts{URL: "http://localhost:9091"}},
+		{"invalid grouping", PushgatewayOpts{URL: "http://localhost:9091", Job: "batch", Grouping: map[string]string{"": "x"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p, err := NewPushgateway(tt.opts); err == nil {
+				p.Stop()
+				t.Error("got no error")
+			}
+		})
+	}
+}
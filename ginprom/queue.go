@@ -0,0 +1,69 @@
+package ginprom
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queueStartHeaders are the headers the load balancers set to when they received the
+// requests, in order of precedence
+var queueStartHeaders = []string{"X-Request-Start", "X-Queue-Start"}
+
+// registerQueueDuration registers the http_request_queue_duration_seconds histogram of promOpts with r
+func registerQueueDuration(r *registration, promOpts *PromOpts) prometheus.Histogram {
+	buckets := promOpts.durationBuckets()
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	return registerOrReuse(r, prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace:   promOpts.namespace(),
+		Subsystem:   promOpts.Subsystem,
+		ConstLabels: promOpts.constLabels(),
+		Name:        "http_request_queue_duration_seconds",
+		Help:        promOpts.help(MetricQueueDuration, "How long the http requests waited in front of the service in seconds"),
+		Buckets:     buckets,
+	}))
+}
+
+// queueDuration returns how long before now the request was received by the load balancer,
+// false if it has no timestamp header. The durations skewed below zero are zero
+func queueDuration(r *http.Request, now time.Time) (time.Duration, bool) {
+	for _, header := range queueStartHeaders {
+		value := r.Header.Get(header)
+		if value == "" {
+			continue
+		}
+		start, ok := parseRequestStart(value)
+		if !ok {
+			continue
+		}
+		if d := now.Sub(start); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// parseRequestStart parses the epoch timestamp of a X-Request-Start header, "t=" prefixed
+// by nginx, in seconds, milliseconds like Heroku or microseconds, told by their magnitude
+func parseRequestStart(value string) (time.Time, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "t=")
+	ts, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(ts > 0) || math.IsInf(ts, 0) {
+		return time.Time{}, false
+	}
+	switch {
+	case ts > 1e15:
+		ts /= 1e6
+	case ts > 1e12:
+		ts /= 1e3
+	}
+	// rounded to the microsecond, the float seconds being noisy below
+	return time.UnixMicro(int64(math.Round(ts * 1e6))), true
+}
@@ -0,0 +1,144 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseRequestStart(t *testing.T) {
+	want := time.Unix(1700000000, 250000000)
+	tests := []struct {
+		name   string
+		value  string
+		wantOK bool
+	}{
+		{"nginx seconds", "t=1700000000.250", true},
+		{"seconds", "1700000000.25", true},
+		{"heroku milliseconds", "1700000000250", true},
+		{"nginx milliseconds", "t=1700000000250", true},
+		{"microseconds", "1700000000250000", true},
+		{"spaces", " t=1700000000.25 ", true},
+		{"empty", "", false},
+		{"garbage", "t=soon", false},
+		{"zero", "0", false},
+		{"negative", "-1700000000", false},
+		{"not a number", "NaN", false},
+		{"infinite", "+Inf", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRequestStart(tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got.Sub(want).Abs() > time.Millisecond {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueueDuration(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ms := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(-d).UnixMilli(), 10)
+	}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+		wantOK  bool
+	}{
+		{"request start", map[string]string{"X-Request-Start": ms(150 * time.Millisecond)}, 150 * time.Millisecond, true},
+		{"queue start", map[string]string{"X-Queue-Start": ms(time.Second)}, time.Second, true},
+		{"request start first", map[string]string{
+			"X-Request-Start": ms(time.Second),
+			"X-Queue-Start":   ms(2 * time.Second),
+		}, time.Second, true},
+		{"invalid request start", map[string]string{
+			"X-Request-Start": "yesterday",
+			"X-Queue-Start":   ms(2 * time.Second),
+		}, 2 * time.Second, true},
+		{"clock skew", map[string]string{"X-Request-Start": ms(-time.Second)}, 0, true},
+		{"no header", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			got, ok := queueDuration(r, now)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("got %v %v, want %v %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPromMiddlewareQueueDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		header    string
+		wantCount uint64
+	}{
+		{"queued", true, "t=" + strconv.FormatInt(time.Now().Add(-time.Second).UnixMicro(), 10), 1},
+		{"no header", true, "", 0},
+		{"disabled", false, "t=1700000000", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.QueueDuration = tt.enabled
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/queued", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/queued", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-Start", tt.header)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			count, err := testutil.GatherAndCount(reg, "service_http_request_queue_duration_seconds")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{true: 1}[tt.enabled]; count != want {
+				t.Fatalf("got %d queue duration series, want %d", count, want)
+			}
+			if !tt.enabled {
+				return
+			}
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mf := range families {
+				if mf.GetName() != "service_http_request_queue_duration_seconds" {
+					continue
+				}
+				h := mf.GetMetric()[0].GetHistogram()
+				if h.GetSampleCount() != tt.wantCount {
+					t.Errorf("got %d observations, want %d", h.GetSampleCount(), tt.wantCount)
+				}
+				if tt.wantCount > 0 && (h.GetSampleSum() < 1 || h.GetSampleSum() > 2) {
+					t.Errorf("got %vs queued, want about 1s", h.GetSampleSum())
+				}
+			}
+		})
+	}
+}
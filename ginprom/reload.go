@@ -0,0 +1,129 @@
+package ginprom
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// FilterRules are the exclude regexes and path lists of the middleware, see PromOpts
+type FilterRules struct {
+	ExcludeRegexStatus   string   `json:"exclude_status"`
+	ExcludeRegexEndpoint string   `json:"exclude_endpoint"`
+	ExcludeRegexMethod   string   `json:"exclude_method"`
+	ExcludePaths         []string `json:"exclude_paths"`
+	IncludeOnlyPaths     []string `json:"include_only_paths"`
+}
+
+// Filters holds the FilterRules of the middlewares using it, reloadable at runtime
+// so the noisy endpoints are filtered out without redeploying
+type Filters struct {
+	compiled atomic.Pointer[compiledFilters]
+}
+
+// NewFilters returns the Filters of rules, an error when one of their regexes is invalid
+func NewFilters(rules FilterRules) (*Filters, error) {
+	f := &Filters{}
+	if err := f.Reload(rules); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload swaps the rules of f for rules, used by the requests completed next. The rules are
+// kept when one of the regexes of rules is invalid
+func (f *Filters) Reload(rules FilterRules) error {
+	compiled, err := compileFilters(rules)
+	if err != nil {
+		return err
+	}
+	f.compiled.Store(compiled)
+	return nil
+}
+
+// Rules returns the current rules of f
+func (f *Filters) Rules() FilterRules {
+	rules := f.compiled.Load().rules
+	rules.ExcludePaths = append([]string(nil), rules.ExcludePaths...)
+	rules.IncludeOnlyPaths = append([]string(nil), rules.IncludeOnlyPaths...)
+	return rules
+}
+
+// filterRules returns the FilterRules of po
+func (po *PromOpts) filterRules() FilterRules {
+	return FilterRules{
+		ExcludeRegexStatus:   po.ExcludeRegexStatus,
+		ExcludeRegexEndpoint: po.ExcludeRegexEndpoint,
+		ExcludeRegexMethod:   po.ExcludeRegexMethod,
+		ExcludePaths:         po.ExcludePaths,
+		IncludeOnlyPaths:     po.IncludeOnlyPaths,
+	}
+}
+
+// compiledFilters are FilterRules ready to match the requests
+type compiledFilters struct {
+	rules                    FilterRules
+	status, endpoint, method *regexp.Regexp
+	excludedPaths            *pathList
+	includedPaths            *pathList
+}
+
+// compileFilters compiles rules. The invalid regexes are left nil, matching nothing,
+// along with the error of the first one
+func compileFilters(rules FilterRules) (*compiledFilters, error) {
+	c := &compiledFilters{
+		rules: FilterRules{
+			ExcludeRegexStatus:   rules.ExcludeRegexStatus,
+			ExcludeRegexEndpoint: rules.ExcludeRegexEndpoint,
+			ExcludeRegexMethod:   rules.ExcludeRegexMethod,
+			ExcludePaths:         append([]string(nil), rules.ExcludePaths...),
+			IncludeOnlyPaths:     append([]string(nil), rules.IncludeOnlyPaths...),
+		},
+		excludedPaths: newPathList(rules.ExcludePaths),
+		includedPaths: newPathList(rules.IncludeOnlyPaths),
+	}
+	var firstErr error
+	for _, regex := range []struct {
+		setting, pattern string
+		compiled         **regexp.Regexp
+	}{
+		{"ExcludeRegexStatus", rules.ExcludeRegexStatus, &c.status},
+		{"ExcludeRegexEndpoint", rules.ExcludeRegexEndpoint, &c.endpoint},
+		{"ExcludeRegexMethod", rules.ExcludeRegexMethod, &c.method},
+	} {
+		if regex.pattern == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(regex.pattern)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("ginprom: %s: %w", regex.setting, err)
+			}
+			continue
+		}
+		*regex.compiled = compiled
+	}
+	return c, firstErr
+}
+
+// allows reports whether label isn't excluded by regex
+func allows(regex *regexp.Regexp, label string) bool {
+	return regex == nil || !regex.MatchString(label)
+}
+
+// statusOK reports whether the status isn't excluded
+func (c *compiledFilters) statusOK(status string) bool {
+	return allows(c.status, status)
+}
+
+// endpointOK reports whether the request path and endpoint aren't excluded
+func (c *compiledFilters) endpointOK(path, endpoint string) bool {
+	return (c.excludedPaths == nil || !c.excludedPaths.matches(path)) &&
+		(c.includedPaths == nil || c.includedPaths.matches(path)) &&
+		allows(c.endpoint, endpoint)
+}
+
+// methodOK reports whether the method isn't excluded
+func (c *compiledFilters) methodOK(method string) bool {
+	return allows(c.method, method)
+}
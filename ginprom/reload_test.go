@@ -0,0 +1,106 @@
+package ginprom
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFiltersReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   FilterRules
+		wantErr string
+	}{
+		{"valid", FilterRules{ExcludeRegexEndpoint: "^/noisy", ExcludePaths: []string{"/healthz"}}, ""},
+		{"empty", FilterRules{}, ""},
+		{"invalid status", FilterRules{ExcludeRegexStatus: "(4"}, "ExcludeRegexStatus"},
+		{"invalid method", FilterRules{ExcludeRegexMethod: "*"}, "ExcludeRegexMethod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initial := FilterRules{ExcludeRegexMethod: "OPTIONS"}
+			f, err := NewFilters(initial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = f.Reload(tt.rules)
+			want := tt.rules
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error about %s", err, tt.wantErr)
+				}
+				want = initial
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got := f.Rules()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got rules %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewFiltersInvalid(t *testing.T) {
+	if f, err := NewFilters(FilterRules{ExcludeRegexEndpoint: "[a-"}); err == nil || f != nil {
+		t.Errorf("got %v, want an error", err)
+	}
+}
+
+func TestPromOptsFilters(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules FilterRules
+		path  string
+		want  float64
+	}{
+		{"not excluded", FilterRules{}, "/noisy/1", 1},
+		{"endpoint", FilterRules{ExcludeRegexEndpoint: "^/noisy"}, "/noisy/1", 0},
+		{"path", FilterRules{ExcludePaths: []string{"/noisy/*"}}, "/noisy/1", 0},
+		{"include only", FilterRules{IncludeOnlyPaths: []string{"/api/*"}}, "/noisy/1", 0},
+		{"status", FilterRules{ExcludeRegexStatus: "^200$"}, "/noisy/1", 0},
+		{"method", FilterRules{ExcludeRegexMethod: "GET"}, "/noisy/1", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := NewFilters(FilterRules{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.EndpointLabelMappingFn = URLPath
+			// the filters replace the rules of the options
+			opts.ExcludeRegexEndpoint = ".*"
+			opts.Filters = filters
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/noisy/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counter := m.reqCount.WithLabelValues("200", tt.path, http.MethodGet)
+
+			serve(r, http.MethodGet, tt.path)
+			if got := testutil.ToFloat64(counter); got != 1 {
+				t.Fatalf("got %v requests before the reload, want 1", got)
+			}
+			if err := filters.Reload(tt.rules); err != nil {
+				t.Fatal(err)
+			}
+			serve(r, http.MethodGet, tt.path)
+			if got := testutil.ToFloat64(counter); got != 1+tt.want {
+				t.Errorf("got %v requests after the reload, want %v", got, 1+tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package ginprom
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// created holds the metrics of the middlewares, so Reset deletes their series
+var created struct {
+	mu      sync.Mutex
+	metrics []*metrics
+}
+
+// track adds m to the metrics deleted by Reset
+func track(m *metrics) {
+	created.mu.Lock()
+	created.metrics = append(created.metrics, m)
+	created.mu.Unlock()
+}
+
+// resetter is a metric vector whose series can all be deleted
+type resetter interface {
+	Reset()
+}
+
+// Reset deletes the series of the request metrics and of the other metric vectors of the
+// middlewares, so the integration tests assert on the requests of each case without the
+// earlier ones. The uptime and the in-flight gauges of the process are kept, and the
+// observations still queued by PromOpts.AsyncBuffer may be recorded after the reset
+func Reset() {
+	created.mu.Lock()
+	all := append([]*metrics(nil), created.metrics...)
+	created.mu.Unlock()
+
+	for _, m := range all {
+		m.reset()
+		if m.warm != nil {
+			m.warm.reset()
+		}
+	}
+}
+
+// reset deletes the series of the vectors of m
+func (m *metrics) reset() {
+	// the cached series would keep recording into the deleted ones
+	m.children.Clear()
+	m.endpoints.Clear()
+	m.endpointCount.Store(0)
+
+	resetVecs(m.reqCount, m.upgrades, m.slowRequests, m.reqErrors, m.apdex, m.handlerErrors, m.tlsRequests, m.panics)
+	resetVecs(m.inFlightByRoute)
+	resetVecs(m.reqCountSharded)
+	for _, vec := range []prometheus.ObserverVec{m.reqDuration, m.reqSizeBytes, m.respSizeBytes} {
+		// the histograms and summaries, nil when disabled
+		if vec, ok := vec.(resetter); ok {
+			vec.Reset()
+		}
+	}
+	if m.websockets != nil {
+		resetVecs(m.websockets.active)
+		resetVecs(m.websockets.duration)
+		resetVecs(m.websockets.sent, m.websockets.received)
+	}
+	if m.streams != nil {
+		resetVecs(m.streams.firstByte)
+		resetVecs(m.streams.active)
+		resetVecs(m.streams.sent)
+	}
+}
+
+// resetVecs resets the vectors which aren't nil
+func resetVecs[V interface {
+	comparable
+	resetter
+}](vecs ...V) {
+	var none V
+	for _, vec := range vecs {
+		if vec != none {
+			vec.Reset()
+		}
+	}
+}
+
+// ResetHandler returns a gin.HandlerFunc calling Reset on POST or DELETE, answering 204, for
+// the integration tests driving the service over HTTP. It answers 404 unless gin runs in
+// gin.TestMode, so it can't wipe the metrics of a deployed service
+func ResetHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if gin.Mode() != gin.TestMode {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodDelete:
+			Reset()
+			c.Status(http.StatusNoContent)
+		default:
+			c.Header("Allow", http.MethodPost+", "+http.MethodDelete)
+			c.AbortWithStatus(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReset(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(opts *PromOpts)
+	}{
+		{"default", func(opts *PromOpts) {}},
+		{"sharded", func(opts *PromOpts) { opts.ShardedRequestCount = true }},
+		{"summaries", func(opts *PromOpts) { opts.DurationType, opts.RequestSizeType = SummaryMetric, SummaryMetric }},
+		{"low overhead", func(opts *PromOpts) { opts.LowOverhead = true }},
+		{"every metric", func(opts *PromOpts) {
+			opts.SlowRequestThreshold = 1
+			opts.ApdexTarget = 1
+			opts.CountHandlerErrors, opts.CountPanics = true, true
+			opts.InFlightByRoute = true
+			opts.WebSocketMetrics, opts.StreamMetrics = true, true
+		}},
+		{"warm-up label", func(opts *PromOpts) { opts.WarmupPeriod, opts.WarmupMode = 1e12, WarmupLabel }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.MaxEndpointCardinality = 1
+			tt.opts(opts)
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			r.GET("/orders", listUsers)
+
+			serve(r, http.MethodGet, "/users")
+			serve(r, http.MethodGet, "/users")
+			Reset()
+			if count, err := testutil.GatherAndCount(reg, "service_http_request_count_total", "service_http_request_duration_seconds"); err != nil || count != 0 {
+				t.Fatalf("got %d series after the reset, want none: %v", count, err)
+			}
+
+			// the endpoint limit starts over
+			serve(r, http.MethodGet, "/orders")
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lvs := []string{"200", "/orders", http.MethodGet}
+			if opts.LowOverhead {
+				lvs[0] = "2xx"
+			}
+			if m.warm != nil {
+				// the warm-up requests have their own metrics
+				m = m.warm
+			}
+			var got float64
+			if m.reqCountSharded != nil {
+				got = m.reqCountSharded.WithLabelValues(lvs...).value()
+			} else {
+				got = testutil.ToFloat64(m.reqCount.WithLabelValues(lvs...))
+			}
+			if got != 1 {
+				t.Errorf("got %v requests after the reset, want 1", got)
+			}
+		})
+	}
+}
+
+func TestResetHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		method string
+		want   int
+	}{
+		{"post", gin.TestMode, http.MethodPost, http.StatusNoContent},
+		{"delete", gin.TestMode, http.MethodDelete, http.StatusNoContent},
+		{"get", gin.TestMode, http.MethodGet, http.StatusMethodNotAllowed},
+		{"release", gin.ReleaseMode, http.MethodPost, http.StatusNotFound},
+		{"debug", gin.DebugMode, http.MethodPost, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := gin.Mode()
+			defer gin.SetMode(mode)
+			gin.SetMode(tt.mode)
+
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			r.Any("/test/metrics/reset", ResetHandler())
+
+			serve(r, http.MethodGet, "/users")
+			if w := serve(r, tt.method, "/test/metrics/reset"); w.Code != tt.want {
+				t.Fatalf("got status %d, want %d", w.Code, tt.want)
+			}
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 1.0
+			if tt.want == http.StatusNoContent {
+				want = 0
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues("200", "/users", http.MethodGet)); got != want {
+				t.Errorf("got %v requests of /users, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package ginprom
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	selfNamespace = "ginprom"
+
+	// defaultScrapeInterval is the default scrape_interval of Prometheus
+	defaultScrapeInterval = time.Minute
+)
+
+// scrapeMetrics are the self-instrumentation of the scrapes served by PromHandler
+type scrapeMetrics struct {
+	count         prometheus.Counter
+	duration      prometheus.Histogram
+	size          prometheus.Gauge
+	inFlight      prometheus.Gauge
+	lastTimestamp prometheus.Gauge
+}
+
+// newScrapeMetrics returns the scrape metrics registered with r, the ones already
+// registered being reused
+func newScrapeMetrics(r *registration) *scrapeMetrics {
+	return &scrapeMetrics{
+		count: registerOrReuse(r, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: selfNamespace,
+			Name:      "scrapes_total",
+			Help:      "Total number of scrapes served by PromHandler.",
+		})),
+		duration: registerOrReuse(r, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: selfNamespace,
+			Name:      "scrape_duration_seconds",
+			Help:      "Time spent serving a scrape in seconds",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		})),
+		size: registerOrReuse(r, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: selfNamespace,
+			Name:      "scrape_size_bytes",
+			Help:      "Serialized size of the last scrape in bytes",
+		})),
+		inFlight: registerOrReuse(r, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: selfNamespace,
+			Name:      "scrapes_in_flight",
+			Help:      "Number of scrapes currently being served",
+		})),
+		lastTimestamp: registerOrReuse(r, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: selfNamespace,
+			Name:      "last_scrape_timestamp_seconds",
+			Help:      "Unix timestamp of the last scrape served by PromHandler",
+		})),
+	}
+}
+
+var (
+	// defaultScrapes are the scrape metrics of the default registerer
+	defaultScrapes            *scrapeMetrics
+	registerScrapeMetricsOnce sync.Once
+	registerScrapeMetricsErr  error
+
+	// lastScrape is the unix nano time of the last scrape, 0 if none happened
+	lastScrape int64
+)
+
+// registerScrapeMetrics registers the PromHandler self-instrumentation with the default
+// registerer once it is used
+func registerScrapeMetrics() (*scrapeMetrics, error) {
+	registerScrapeMetricsOnce.Do(func() {
+		r := &registration{}
+		defaultScrapes = newScrapeMetrics(r)
+		registerScrapeMetricsErr = r.finish()
+	})
+	return defaultScrapes, registerScrapeMetricsErr
+}
+
+// scrapeMetricsFor returns the scrape metrics registered with PromOpts.Registerer, shared
+// by the handlers of a registry
+func scrapeMetricsFor(promOpts *PromOpts) (*scrapeMetrics, error) {
+	if promOpts.Registerer == nil {
+		return registerScrapeMetrics()
+	}
+	r := promOpts.registration()
+	s := newScrapeMetrics(r)
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// observe records a finished scrape
+func (s *scrapeMetrics) observe(start time.Time, size int) {
+	if size < 0 {
+		size = 0
+	}
+	now := time.Now()
+	atomic.StoreInt64(&lastScrape, now.UnixNano())
+
+	s.count.Inc()
+	s.duration.Observe(now.Sub(start).Seconds())
+	s.size.Set(float64(size))
+	s.lastTimestamp.Set(float64(now.UnixNano()) / 1e9)
+}
+
+// LastScrape returns the time of the last scrape served by PromHandler,
+// the zero time if there was none
+func LastScrape() time.Time {
+	nano := atomic.LoadInt64(&lastScrape)
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
+
+// ScrapeWatcher is a Collector flagging when PromHandler hasn't served a scrape
+// for MissedIntervals scrape intervals
+type ScrapeWatcher struct {
+	interval time.Duration
+	missed   int
+	started  time.Time
+
+	mu       sync.Mutex
+	inGap    bool
+	onGap    []func(last time.Time)
+	onResume []func()
+
+	gap prometheus.Gauge
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewScrapeWatcher returns a started ScrapeWatcher expecting a scrape every interval,
+// one minute if not positive, it still needs to be registered
+func NewScrapeWatcher(interval time.Duration, missedIntervals int) *ScrapeWatcher {
+	if interval <= 0 {
+		interval = defaultScrapeInterval
+	}
+	if missedIntervals <= 0 {
+		missedIntervals = 1
+	}
+
+	w := &ScrapeWatcher{
+		interval: interval,
+		missed:   missedIntervals,
+		started:  time.Now(),
+		gap: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: selfNamespace,
+			Name:      "scrape_gap",
+			Help:      "1 if no scrape was served for the configured number of intervals",
+		}),
+		stop: make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+// Describe implements prometheus.Collector
+func (w *ScrapeWatcher) Describe(ch chan<- *prometheus.Desc) {
+	w.gap.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (w *ScrapeWatcher) Collect(ch chan<- prometheus.Metric) {
+	w.gap.Collect(ch)
+}
+
+// OnGap registers a callback fired when scrapes stop, last is the zero time if none happened
+func (w *ScrapeWatcher) OnGap(fn func(last time.Time)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.onGap = append(w.onGap, fn)
+}
+
+// OnResume registers a callback fired when scrapes resume after a gap
+func (w *ScrapeWatcher) OnResume(fn func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.onResume = append(w.onResume, fn)
+}
+
+// InGap reports whether scrapes are currently missing
+func (w *ScrapeWatcher) InGap() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.inGap
+}
+
+// Stop stops watching
+func (w *ScrapeWatcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+func (w *ScrapeWatcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.check(time.Now())
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *ScrapeWatcher) check(now time.Time) {
+	last := LastScrape()
+	since := w.started
+	if last.After(since) {
+		since = last
+	}
+	inGap := now.Sub(since) > time.Duration(w.missed)*w.interval
+
+	w.mu.Lock()
+	changed := inGap != w.inGap
+	w.inGap = inGap
+	onGap, onResume := w.onGap, w.onResume
+	w.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if inGap {
+		w.gap.Set(1)
+		for _, fn := range onGap {
+			fn(last)
+		}
+	} else {
+		w.gap.Set(0)
+		for _, fn := range onResume {
+			fn()
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPromHandlerInstrumentation(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "help"}))
+
+	r := gin.New()
+	r.GET("/metrics", PromHandler(promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+
+	before := testutil.ToFloat64(defaultScrapes.count)
+	tests := []struct {
+		name  string
+		count float64
+	}{
+		{"first scrape", 1},
+		{"second scrape", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/metrics")
+
+			if got := testutil.ToFloat64(defaultScrapes.count) - before; got != tt.count {
+				t.Errorf("got %v scrapes, want %v", got, tt.count)
+			}
+			if got := testutil.ToFloat64(defaultScrapes.size); got != float64(w.Body.Len()) {
+				t.Errorf("scrape size = %v, want %d", got, w.Body.Len())
+			}
+			if got := testutil.ToFloat64(defaultScrapes.inFlight); got != 0 {
+				t.Errorf("scrapes in flight = %v, want 0", got)
+			}
+		})
+	}
+}
+
+func TestPromHandlerFor(t *testing.T) {
+	opts := NewDefaultOpts()
+	reg := prometheus.NewRegistry()
+	opts.Registerer = reg
+	orders := prometheus.NewCounter(prometheus.CounterOpts{Name: "orders_total", Help: "help"})
+	reg.MustRegister(orders)
+	orders.(prometheus.ExemplarAdder).AddWithExemplar(1, prometheus.Labels{"trace_id": "abc123"})
+
+	r := gin.New()
+	r.GET("/metrics", PromHandlerFor(opts))
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantExemplar    bool
+	}{
+		{"openmetrics", "application/openmetrics-text; version=1.0.0", "application/openmetrics-text", true},
+		{"classic", "", "text/plain", false},
+		{"classic text", "text/plain;version=0.0.4", "text/plain", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantContentType) {
+				t.Errorf("got content type %q, want %s", got, tt.wantContentType)
+			}
+			if !strings.Contains(w.Body.String(), "orders_total 1") {
+				t.Errorf("got %s, want the counter", w.Body)
+			}
+			if got := strings.Contains(w.Body.String(), `trace_id="abc123"`); got != tt.wantExemplar {
+				t.Errorf("got the exemplar %v, want %v in %s", got, tt.wantExemplar, w.Body)
+			}
+		})
+	}
+}
+
+func TestPromHandlerForRegistries(t *testing.T) {
+	tests := []struct {
+		name      string
+		engines   int
+		shared    bool
+		wantCount float64
+	}{
+		{"one engine", 1, false, 1},
+		{"engines of their own registries", 2, false, 1},
+		{"engines sharing a registry", 2, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaults, err := registerScrapeMetrics()
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := testutil.ToFloat64(defaults.count)
+			shared := prometheus.NewRegistry()
+			var registries []*prometheus.Registry
+			for i := 0; i < tt.engines; i++ {
+				reg := shared
+				if !tt.shared {
+					reg = prometheus.NewRegistry()
+				}
+				registries = append(registries, reg)
+				opts := NewDefaultOpts()
+				opts.Registerer = reg
+				r := gin.New()
+				// a second engine of the same registry doesn't panic
+				m, err := New(r, &EngineOpts{PromOpts: opts})
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer m.Close()
+				serve(r, http.MethodGet, "/metrics")
+			}
+
+			for i, reg := range registries {
+				s, err := scrapeMetricsFor(&PromOpts{Registerer: reg})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := testutil.ToFloat64(s.count); got != tt.wantCount {
+					t.Errorf("got %v scrapes in the registry of engine %d, want %v", got, i, tt.wantCount)
+				}
+			}
+			if got := testutil.ToFloat64(defaults.count) - before; got != 0 {
+				t.Errorf("got %v scrapes in the default registry, want none", got)
+			}
+		})
+	}
+}
+
+func TestScrapeWatcherCheck(t *testing.T) {
+	saved := atomic.LoadInt64(&lastScrape)
+	defer atomic.StoreInt64(&lastScrape, saved)
+
+	w := NewScrapeWatcher(time.Hour, 2)
+	defer w.Stop()
+	start := time.Unix(1000, 0)
+	w.started = start
+
+	var gaps, resumes int
+	w.OnGap(func(time.Time) { gaps++ })
+	w.OnResume(func() { resumes++ })
+
+	atomic.StoreInt64(&lastScrape, 0)
+	tests := []struct {
+		name        string
+		scrapedAt   time.Duration
+		checkAt     time.Duration
+		wantGap     bool
+		wantGaps    int
+		wantResumes int
+	}{
+		{"within the allowed intervals", -1, time.Hour, false, 0, 0},
+		{"no scrape since start", -1, 3 * time.Hour, true, 1, 0},
+		{"still in the gap", -1, 4 * time.Hour, true, 1, 0},
+		{"scrape resumes", 5 * time.Hour, 5 * time.Hour, false, 1, 1},
+		{"second gap", 5 * time.Hour, 8 * time.Hour, true, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.scrapedAt >= 0 {
+				atomic.StoreInt64(&lastScrape, start.Add(tt.scrapedAt).UnixNano())
+			}
+			w.check(start.Add(tt.checkAt))
+
+			if w.InGap() != tt.wantGap {
+				t.Errorf("InGap() = %v, want %v", w.InGap(), tt.wantGap)
+			}
+			if gaps != tt.wantGaps || resumes != tt.wantResumes {
+				t.Errorf("got %d gaps %d resumes, want %d %d", gaps, resumes, tt.wantGaps, tt.wantResumes)
+			}
+			want := 0.0
+			if tt.wantGap {
+				want = 1
+			}
+			if got := testutil.ToFloat64(w); got != want {
+				t.Errorf("gap gauge = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewScrapeWatcherDefaultsInterval(t *testing.T) {
+	w := NewScrapeWatcher(0, 0)
+	defer w.Stop()
+
+	if w.interval != defaultScrapeInterval || w.missed != 1 {
+		t.Errorf("got interval %v missed %d, want %v 1", w.interval, w.missed, defaultScrapeInterval)
+	}
+}
@@ -0,0 +1,148 @@
+package ginprom
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SelfTestOpts describes the work done by the self-test handler
+type SelfTestOpts struct {
+	// Sleep is how long the handler waits, 10ms if not positive
+	Sleep time.Duration
+	// Allocate is how many bytes the handler allocates and fills, 64KiB if not positive
+	Allocate int
+	// Timeout is the duration over which a run fails, 1s if not positive
+	Timeout time.Duration
+	// Registerer registers the self-test metrics, prometheus.DefaultRegisterer if nil
+	Registerer prometheus.Registerer
+}
+
+// selfTestMetrics are the success and latency metrics of the self-test handlers
+type selfTestMetrics struct {
+	runs     *prometheus.CounterVec
+	duration prometheus.Histogram
+}
+
+// newSelfTestMetrics returns the self-test metrics registered with r, the ones already
+// registered being reused
+func newSelfTestMetrics(r *registration) *selfTestMetrics {
+	return &selfTestMetrics{
+		runs: registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: selfNamespace,
+			Name:      "selftest_runs_total",
+			Help:      "Total number of self-test runs by result.",
+		}, []string{"result"})),
+		duration: registerOrReuse(r, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: selfNamespace,
+			Name:      "selftest_duration_seconds",
+			Help:      "Time spent running the self-test in seconds",
+			Buckets:   []float64{.005, .01, .015, .02, .03, .05, .1, .25, .5, 1, 2.5},
+		})),
+	}
+}
+
+var (
+	// defaultSelfTest are the self-test metrics of the default registerer
+	defaultSelfTest             *selfTestMetrics
+	registerSelfTestMetricsOnce sync.Once
+	registerSelfTestMetricsErr  error
+)
+
+// registerSelfTestMetrics registers the self-test metrics with the default registerer
+// once a handler is created
+func registerSelfTestMetrics() (*selfTestMetrics, error) {
+	registerSelfTestMetricsOnce.Do(func() {
+		r := &registration{}
+		defaultSelfTest = newSelfTestMetrics(r)
+		registerSelfTestMetricsErr = r.finish()
+	})
+	return defaultSelfTest, registerSelfTestMetricsErr
+}
+
+// selfTestMetricsFor returns the self-test metrics registered with reg, the default
+// registerer if nil
+func selfTestMetricsFor(reg prometheus.Registerer) (*selfTestMetrics, error) {
+	if reg == nil {
+		return registerSelfTestMetrics()
+	}
+	r := &registration{reg: reg}
+	m := newSelfTestMetrics(r)
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SelfTestHandler returns a gin.HandlerFunc doing a known amount of work, sleeping and
+// allocating as opts says, and exporting its own success and latency metrics. Probed
+// regularly, it gives monitoring a constant baseline detecting breakages of the
+// instrumentation or of the scrape pipeline. It panics when its metrics conflict with
+// registered ones, see NewSelfTestHandler
+func SelfTestHandler(opts *SelfTestOpts) gin.HandlerFunc {
+	h, err := NewSelfTestHandler(opts)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// NewSelfTestHandler is like SelfTestHandler but returns an error when its metrics conflict
+// with the collectors registered on SelfTestOpts.Registerer
+func NewSelfTestHandler(opts *SelfTestOpts) (gin.HandlerFunc, error) {
+	o := SelfTestOpts{Sleep: 10 * time.Millisecond, Allocate: 64 << 10, Timeout: time.Second}
+	if opts != nil {
+		o.Registerer = opts.Registerer
+		if opts.Sleep > 0 {
+			o.Sleep = opts.Sleep
+		}
+		if opts.Allocate > 0 {
+			o.Allocate = opts.Allocate
+		}
+		if opts.Timeout > 0 {
+			o.Timeout = opts.Timeout
+		}
+	}
+
+	m, err := selfTestMetricsFor(o.Registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		time.Sleep(o.Sleep)
+		ok := selfTestAllocate(o.Allocate)
+		elapsed := time.Since(start)
+		m.duration.Observe(elapsed.Seconds())
+
+		switch {
+		case !ok:
+			m.runs.WithLabelValues("error").Inc()
+			c.String(http.StatusInternalServerError, "allocation check failed")
+		case elapsed > o.Timeout:
+			m.runs.WithLabelValues("timeout").Inc()
+			c.String(http.StatusInternalServerError, "took %v, over %v", elapsed, o.Timeout)
+		default:
+			m.runs.WithLabelValues("success").Inc()
+			c.String(http.StatusOK, "ok")
+		}
+	}, nil
+}
+
+// selfTestAllocate allocates and fills size bytes, reporting whether they read back
+func selfTestAllocate(size int) bool {
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	for i, b := range buf {
+		if b != byte(i) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSelfTestHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       *SelfTestOpts
+		wantStatus int
+		wantResult string
+		minElapsed time.Duration
+	}{
+		{"defaults", nil, http.StatusOK, "success", 10 * time.Millisecond},
+		{"custom work", &SelfTestOpts{Sleep: 5 * time.Millisecond, Allocate: 1 << 20}, http.StatusOK, "success", 5 * time.Millisecond},
+		{"timeout", &SelfTestOpts{Sleep: 20 * time.Millisecond, Timeout: time.Millisecond}, http.StatusInternalServerError, "timeout", 20 * time.Millisecond},
+		{"own registry", &SelfTestOpts{Registerer: prometheus.NewRegistry()}, http.StatusOK, "success", 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/selftest", SelfTestHandler(tt.opts))
+
+			var reg prometheus.Registerer
+			if tt.opts != nil {
+				reg = tt.opts.Registerer
+			}
+			m, err := selfTestMetricsFor(reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs := m.runs.WithLabelValues(tt.wantResult)
+			before := testutil.ToFloat64(runs)
+			start := time.Now()
+			w := serve(r, http.MethodGet, "/selftest")
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("the self-test took %v, want at least %v", elapsed, tt.minElapsed)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := testutil.ToFloat64(runs) - before; got != 1 {
+				t.Errorf("got %v %s runs, want 1", got, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestSelfTestAllocate(t *testing.T) {
+	for _, size := range []int{0, 1, 256, 64 << 10} {
+		if !selfTestAllocate(size) {
+			t.Errorf("the allocation of %d bytes doesn't read back", size)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package ginprom
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMetricsAddr = ":2112"
+	defaultMetricsPath = "/metrics"
+)
+
+// MetricsServerOpts configures a MetricsServer
+type MetricsServerOpts struct {
+	// Addr is the address listened to, :2112 if empty
+	Addr string
+	// Path is the path of the metrics, /metrics if empty
+	Path string
+	// Gatherer supplies the served metrics, prometheus.DefaultGatherer if nil, see PromOpts.Gatherer
+	Gatherer prometheus.Gatherer
+	// Compress gzips the metrics for the scrapers accepting it, see GzipHandler
+	Compress bool
+	// TLS serves the metrics over TLS when set, mutually authenticated with a client CA
+	TLS *MetricsServerTLS
+}
+
+// MetricsServer serves the metrics on their own port,
+// so the router of the API doesn't expose them
+type MetricsServer struct {
+	srv  *http.Server
+	ln   net.Listener
+	done chan struct{}
+	err  error
+}
+
+// StartMetricsServer listens to opts.Addr and serves the metrics until shut down,
+// the metrics being the only path served
+func StartMetricsServer(opts MetricsServerOpts) (*MetricsServer, error) {
+	if opts.Addr == "" {
+		opts.Addr = defaultMetricsAddr
+	}
+	if opts.Path == "" {
+		opts.Path = defaultMetricsPath
+	}
+	if opts.Gatherer == nil {
+		opts.Gatherer = prometheus.DefaultGatherer
+	}
+
+	var tlsConfig *tls.Config
+	if opts.TLS != nil {
+		var err error
+		if tlsConfig, err = opts.TLS.config(); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("ginprom: %w", err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	handler := OpenMetricsHandler(opts.Gatherer)
+	if opts.Compress {
+		handler = GzipHandler(handler)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(opts.Path, handler)
+	s := &MetricsServer{
+		srv: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		ln:   ln,
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		if err := s.srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			s.err = err
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the address listened to, with the port chosen when opts.Addr had none
+func (s *MetricsServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Shutdown stops the server once the scrapes in progress are served or ctx is done
+func (s *MetricsServer) Shutdown(ctx context.Context) error {
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	<-s.done
+	return s.err
+}
+
+// Gatherer returns the gatherer of the metrics registered with po,
+// prometheus.DefaultGatherer unless the Registerer gathers its own
+func (po *PromOpts) Gatherer() prometheus.Gatherer {
+	if g, ok := po.Registerer.(prometheus.Gatherer); ok {
+		return g
+	}
+	return prometheus.DefaultGatherer
+}
+
+// Gatherers returns the gatherer of the metrics of the middlewares of opts, each registry
+// gathered once, so the engines of their own registries share one metrics path or
+// MetricsServer. Their metrics need distinct namespaces or const labels, as the series
+// gathered from two registries are errors
+func Gatherers(opts ...*PromOpts) prometheus.Gatherer {
+	var gatherers prometheus.Gatherers
+	for _, o := range opts {
+		if o == nil {
+			o = &PromOpts{}
+		}
+		if g := o.Gatherer(); !containsGatherer(gatherers, g) {
+			gatherers = append(gatherers, g)
+		}
+	}
+	return gatherers
+}
+
+// containsGatherer reports whether g is one of gatherers, the gatherers which can't be
+// compared like prometheus.GathererFunc never being
+func containsGatherer(gatherers prometheus.Gatherers, g prometheus.Gatherer) bool {
+	if !reflect.TypeOf(g).Comparable() {
+		return false
+	}
+	for _, other := range gatherers {
+		if reflect.TypeOf(other) == reflect.TypeOf(g) && other == g {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package ginprom
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStartMetricsServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		compress bool
+		get      string
+		wantCode int
+	}{
+		{"default path", "", false, "/metrics", http.StatusOK},
+		{"custom path", "/internal/metrics", false, "/internal/metrics", http.StatusOK},
+		{"other path", "", false, "/api/users", http.StatusNotFound},
+		{"compressed", "", true, "/metrics", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/api/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+			serve(r, http.MethodGet, "/api/users")
+
+			s, err := StartMetricsServer(MetricsServerOpts{
+				Addr:     "127.0.0.1:0",
+				Path:     tt.path,
+				Gatherer: opts.Gatherer(),
+				Compress: tt.compress,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Shutdown(context.Background())
+
+			resp, err := http.Get("http://" + s.Addr() + tt.get)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			// the client asked for gzip and transparently decompressed the body
+			if resp.Uncompressed != tt.compress {
+				t.Errorf("got a gzipped body %v, want %v", resp.Uncompressed, tt.compress)
+			}
+			if tt.wantCode == http.StatusOK && !strings.Contains(string(body), `service_http_request_count_total{endpoint="/api/users"`) {
+				t.Errorf("the request metrics aren't served:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestMetricsServerShutdown(t *testing.T) {
+	s, err := StartMetricsServer(MetricsServerOpts{Addr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := http.Get("http://" + s.Addr() + "/metrics"); err == nil {
+		t.Error("the server still serves once shut down")
+	}
+}
+
+func TestStartMetricsServerAddrInUse(t *testing.T) {
+	s, err := StartMetricsServer(MetricsServerOpts{Addr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	if other, err := StartMetricsServer(MetricsServerOpts{Addr: s.Addr()}); err == nil {
+		other.Shutdown(context.Background())
+		t.Error("got no error listening to an address in use")
+	}
+}
+
+func TestPromOptsGatherer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tests := []struct {
+		name       string
+		registerer prometheus.Registerer
+		want       prometheus.Gatherer
+	}{
+		{"default", nil, prometheus.DefaultGatherer},
+		{"registry", reg, reg},
+		{"wrapped registerer", prometheus.WrapRegistererWithPrefix("app_", reg), prometheus.DefaultGatherer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &PromOpts{Registerer: tt.registerer}
+			if got := opts.Gatherer(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatherers(t *testing.T) {
+	a, b := prometheus.NewRegistry(), prometheus.NewRegistry()
+	a.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "a_total", Help: "help"}))
+	b.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "b_total", Help: "help"}))
+	fn := prometheus.GathererFunc(b.Gather)
+	tests := []struct {
+		name    string
+		opts    []*PromOpts
+		want    int
+		wantErr bool
+	}{
+		{"one", []*PromOpts{{Registerer: a}}, 1, false},
+		{"two", []*PromOpts{{Registerer: a}, {Registerer: b}}, 2, false},
+		{"same registry once", []*PromOpts{{Registerer: a}, {Registerer: a}, {Registerer: b}}, 2, false},
+		{"none", nil, 0, false},
+		// not comparable, gathered twice
+		{"gatherer func", []*PromOpts{{Registerer: a}, {Registerer: gathererRegisterer{b, fn}}, {Registerer: b}},
+			2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mfs, err := Gatherers(tt.opts...).Gather()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want an error %v", err, tt.wantErr)
+			}
+			if len(mfs) != tt.want {
+				t.Errorf("got %d families, want %d", len(mfs), tt.want)
+			}
+		})
+	}
+}
+
+// gathererRegisterer is a Registerer gathering with a GathererFunc
+type gathererRegisterer struct {
+	prometheus.Registerer
+	prometheus.GathererFunc
+}
@@ -0,0 +1,93 @@
+package ginprom
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// MetricsServerTLS serves the metrics of a MetricsServer over TLS, mutually authenticated
+// when ClientCAFile is set, for the scrapes of the zero trust networks
+type MetricsServerTLS struct {
+	// CertFile and KeyFile are the PEM files of the certificate and key of the server
+	CertFile string `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file"`
+	// ClientCAFile is the PEM file of the CAs of the scrapers, the server then requiring
+	// and verifying their client certificates
+	ClientCAFile string `yaml:"client_ca_file" json:"client_ca_file"`
+	// ClientSANs restrict the scrapers to the client certificates having one of them as
+	// a DNS name, URI like a SPIFFE ID, IP or email address, any verified one if empty
+	ClientSANs []string `yaml:"client_sans" json:"client_sans"`
+}
+
+// config returns the TLS configuration of t, an error when its files can't be loaded
+func (t *MetricsServerTLS) config() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("ginprom: metrics server certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if t.ClientCAFile == "" {
+		if len(t.ClientSANs) > 0 {
+			return nil, errors.New("ginprom: the client SANs of the metrics server need a client CA")
+		}
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(t.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("ginprom: metrics server client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("ginprom: metrics server client CA: no certificate in %s", t.ClientCAFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if len(t.ClientSANs) > 0 {
+		sans := t.ClientSANs
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			// the chain is verified by then, RequireAndVerifyClientCert having a leaf
+			if leaf := state.PeerCertificates[0]; !hasSAN(leaf, sans) {
+				return fmt.Errorf("ginprom: the client certificate of %q has none of the allowed SANs", leaf.Subject)
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+// hasSAN reports whether cert has one of sans as subject alternative name
+func hasSAN(cert *x509.Certificate, sans []string) bool {
+	for _, san := range sans {
+		for _, name := range cert.DNSNames {
+			if name == san {
+				return true
+			}
+		}
+		for _, uri := range cert.URIs {
+			if uri.String() == san {
+				return true
+			}
+		}
+		for _, email := range cert.EmailAddresses {
+			if email == san {
+				return true
+			}
+		}
+		if ip := net.ParseIP(san); ip != nil {
+			for _, certIP := range cert.IPAddresses {
+				if certIP.Equal(ip) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package ginprom
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate signed by a test CA, the CA signing itself
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+// newTestCert returns a certificate of the SANs of template signed by ca,
+// self-signed as a CA when ca is nil
+func newTestCert(t *testing.T, template *x509.Certificate, ca *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, tls: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+// writePEM writes the certificate and key of c in dir, returning their files
+func (c *testCert) writePEM(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestStartMetricsServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test ca"}}, nil)
+	caFile, _ := ca.writePEM(t, dir, "ca")
+	server := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "metrics"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+	}, ca)
+	certFile, keyFile := server.writePEM(t, dir, "server")
+	prometheusID, _ := url.Parse("spiffe://shop/prometheus")
+	scraper := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "prometheus"}, URIs: []*url.URL{prometheusID}}, ca)
+	other := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, DNSNames: []string{"other.shop"}}, ca)
+	stranger := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "prometheus"}, URIs: []*url.URL{prometheusID}},
+		newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other ca"}}, nil))
+
+	tests := []struct {
+		name       string
+		tls        MetricsServerTLS
+		clientCert *testCert
+		wantOK     bool
+	}{
+		{"tls", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile}, nil, true},
+		{"client certificate", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}, other, true},
+		{"no client certificate", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}, nil, false},
+		{"unknown client CA", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}, stranger, false},
+		{"allowed SAN", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile,
+			ClientSANs: []string{"other.example", "spiffe://shop/prometheus"}}, scraper, true},
+		{"allowed DNS SAN", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile,
+			ClientSANs: []string{"other.shop"}}, other, true},
+		{"other SAN", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile,
+			ClientSANs: []string{"spiffe://shop/prometheus"}}, other, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := StartMetricsServer(MetricsServerOpts{Addr: "127.0.0.1:0", TLS: &tt.tls})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Shutdown(context.Background())
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			clientTLS := &tls.Config{RootCAs: roots}
+			if tt.clientCert != nil {
+				clientTLS.Certificates = []tls.Certificate{tt.clientCert.tls}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			defer client.CloseIdleConnections()
+			resp, err := client.Get("https://" + s.Addr() + "/metrics")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if ok := err == nil && resp.StatusCode == http.StatusOK; ok != tt.wantOK {
+				t.Errorf("got served %v, want %v: %v", ok, tt.wantOK, err)
+			}
+		})
+	}
+}
+
+func TestStartMetricsServerTLSInvalid(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test ca"}}, nil)
+	certFile, keyFile := ca.writePEM(t, dir, "ca")
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		tls  MetricsServerTLS
+	}{
+		{"no certificate", MetricsServerTLS{}},
+		{"missing key", MetricsServerTLS{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.pem")}},
+		{"missing client CA", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(dir, "missing.pem")}},
+		{"empty client CA", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: empty}},
+		{"SANs without client CA", MetricsServerTLS{CertFile: certFile, KeyFile: keyFile, ClientSANs: []string{"prometheus"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if s, err := StartMetricsServer(MetricsServerOpts{Addr: "127.0.0.1:0", TLS: &tt.tls}); err == nil || s != nil {
+				t.Errorf("got %v, want an error", err)
+			}
+		})
+	}
+}
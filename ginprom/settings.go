@@ -0,0 +1,95 @@
+package ginprom
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Settings holds the filter rules, sample rates and slow request threshold of the
+// middlewares using it, changeable at runtime, see AdminHandler
+type Settings struct {
+	filters       *Filters
+	sampleRates   atomic.Pointer[map[string]int]
+	slowThreshold atomic.Int64
+}
+
+// NewSettings returns the Settings initialized with the filter rules, or Filters, the
+// SampleRates and the SlowRequestThreshold of promOpts, an error when a regex is invalid
+func NewSettings(promOpts *PromOpts) (*Settings, error) {
+	filters := promOpts.Filters
+	if filters == nil {
+		var err error
+		if filters, err = NewFilters(promOpts.filterRules()); err != nil {
+			return nil, err
+		}
+	}
+	s := newSettings(promOpts, filters)
+	if err := s.SetSampleRates(promOpts.SampleRates); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newSettings returns the Settings of promOpts using filters
+func newSettings(promOpts *PromOpts, filters *Filters) *Settings {
+	s := &Settings{filters: filters}
+	rates := make(map[string]int, len(promOpts.SampleRates))
+	for endpoint, rate := range promOpts.SampleRates {
+		rates[endpoint] = rate
+	}
+	s.sampleRates.Store(&rates)
+	s.SetSlowRequestThreshold(promOpts.SlowRequestThreshold)
+	return s
+}
+
+// staticSettings returns the Settings of a middleware created without PromOpts.Settings,
+// the invalid regexes excluding nothing like before the rules were reloadable
+func (po *PromOpts) staticSettings() *Settings {
+	filters := po.Filters
+	if filters == nil {
+		compiled, _ := compileFilters(po.filterRules())
+		filters = &Filters{}
+		filters.compiled.Store(compiled)
+	}
+	return newSettings(po, filters)
+}
+
+// Filters returns the filter rules of s
+func (s *Settings) Filters() *Filters {
+	return s.filters
+}
+
+// SampleRates returns the sample rates of s, see PromOpts.SampleRates
+func (s *Settings) SampleRates() map[string]int {
+	rates := *s.sampleRates.Load()
+	copied := make(map[string]int, len(rates))
+	for endpoint, rate := range rates {
+		copied[endpoint] = rate
+	}
+	return copied
+}
+
+// SetSampleRates swaps the sample rates of s for rates, an error when one is negative
+func (s *Settings) SetSampleRates(rates map[string]int) error {
+	copied := make(map[string]int, len(rates))
+	for endpoint, rate := range rates {
+		if rate < 0 {
+			return fmt.Errorf("ginprom: negative sample rate %d of %q", rate, endpoint)
+		}
+		copied[endpoint] = rate
+	}
+	s.sampleRates.Store(&copied)
+	return nil
+}
+
+// SlowRequestThreshold returns the slow request threshold of s, see PromOpts.SlowRequestThreshold
+func (s *Settings) SlowRequestThreshold() time.Duration {
+	return time.Duration(s.slowThreshold.Load())
+}
+
+// SetSlowRequestThreshold sets the slow request threshold of s, no request is slow
+// if d isn't positive
+func (s *Settings) SetSlowRequestThreshold(d time.Duration) {
+	s.slowThreshold.Store(int64(d))
+}
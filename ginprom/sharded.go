@@ -0,0 +1,117 @@
+package ginprom
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// paddedCounter keeps a counter shard on its own cache line
+type paddedCounter struct {
+	n uint64
+	_ [56]byte
+}
+
+// shardedCounter is a counter split in per-CPU shards summed when collected,
+// so concurrent increments don't contend on the same cache line
+type shardedCounter struct {
+	lvs    []string
+	shards []paddedCounter
+}
+
+// Inc increments a random shard
+func (c *shardedCounter) Inc() {
+	atomic.AddUint64(&c.shards[rand.Uint32()%uint32(len(c.shards))].n, 1)
+}
+
+func (c *shardedCounter) value() float64 {
+	var total uint64
+	for i := range c.shards {
+		total += atomic.LoadUint64(&c.shards[i].n)
+	}
+	return float64(total)
+}
+
+// shardedCounterVec is a Collector of sharded counters partitioned by labels, it costs
+// GOMAXPROCS cache lines per series so it suits the hottest counters only
+type shardedCounterVec struct {
+	desc   *prometheus.Desc
+	shards int
+
+	mu       sync.RWMutex
+	counters map[string]*shardedCounter
+}
+
+func newShardedCounterVec(opts prometheus.CounterOpts, labelNames []string) *shardedCounterVec {
+	return &shardedCounterVec{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help, labelNames, opts.ConstLabels,
+		),
+		shards:   runtime.GOMAXPROCS(0),
+		counters: make(map[string]*shardedCounter),
+	}
+}
+
+// WithLabelValues returns the counter of the label values, creating it if needed
+func (v *shardedCounterVec) WithLabelValues(lvs ...string) *shardedCounter {
+	key := strings.Join(lvs, "\xff")
+
+	v.mu.RLock()
+	c, ok := v.counters[key]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if c, ok = v.counters[key]; !ok {
+		c = &shardedCounter{
+			lvs:    append([]string(nil), lvs...),
+			shards: make([]paddedCounter, v.shards),
+		}
+		v.counters[key] = c
+	}
+	return c
+}
+
+// DeleteLabelValues deletes the counter of the label values, reporting whether it existed
+func (v *shardedCounterVec) DeleteLabelValues(lvs ...string) bool {
+	key := strings.Join(lvs, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	_, ok := v.counters[key]
+	delete(v.counters, key)
+	return ok
+}
+
+// Reset deletes the counters of v
+func (v *shardedCounterVec) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	clear(v.counters)
+}
+
+// Describe implements prometheus.Collector
+func (v *shardedCounterVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+// Collect implements prometheus.Collector
+func (v *shardedCounterVec) Collect(ch chan<- prometheus.Metric) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, c := range v.counters {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.CounterValue, c.value(), c.lvs...)
+	}
+}
@@ -0,0 +1,64 @@
+package ginprom
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestShardedCounterVec(t *testing.T) {
+	v := newShardedCounterVec(prometheus.CounterOpts{
+		Namespace:   "test",
+		Name:        "requests_total",
+		Help:        "Requests.",
+		ConstLabels: prometheus.Labels{"team": "a"},
+	}, []string{"code"})
+	v.shards = 4
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, failed := v.WithLabelValues("200"), v.WithLabelValues("500")
+			for j := 0; j < 1000; j++ {
+				ok.Inc()
+				if j%10 == 0 {
+					failed.Inc()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := `
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200",team="a"} 8000
+test_requests_total{code="500",team="a"} 800
+`
+	if err := testutil.CollectAndCompare(v, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricsShardedSeries(t *testing.T) {
+	m := &metrics{
+		reqCountSharded: newShardedCounterVec(prometheus.CounterOpts{Name: "count_total", Help: "count"}, labels),
+		reqDuration:     prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration", Help: "duration"}, labels),
+		reqSizeBytes:    prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "req", Help: "req"}, labels),
+		respSizeBytes:   prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "resp", Help: "resp"}, labels),
+	}
+
+	m.observe(200, "/sharded", "GET", nil, 0.1, 10, 20, "")
+	m.observe(200, "/sharded", "GET", nil, 0.1, 10, 20, "")
+	if got := m.reqCountSharded.WithLabelValues("200", "/sharded", "GET").value(); got != 2 {
+		t.Errorf("got %v requests, want 2", got)
+	}
+	if got := testutil.CollectAndCount(m.reqDuration); got != 1 {
+		t.Errorf("got %d duration series, want 1", got)
+	}
+}
@@ -0,0 +1,215 @@
+package ginprom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const sloResolution = 10 * time.Second
+
+// burnRateWindows are the windows of the multi-window multi-burn-rate alerts
+// described in the Google SRE workbook
+var burnRateWindows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour}
+
+// formatWindow formats a window for the window label, e.g. "5m" or "1h30m"
+func formatWindow(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// SLO represents a service level objective evaluated against recorded requests
+type SLO struct {
+	Name string
+	// Objective is the target ratio of good requests, e.g. 0.999
+	Objective float64
+	// Match selects the requests the SLO applies to, all requests if nil
+	Match func(o Observation) bool
+	// IsGood reports whether a request is good, non-5xx requests if nil
+	IsGood func(o Observation) bool
+}
+
+// isNotServerError is the default good predicate
+func isNotServerError(o Observation) bool {
+	return o.StatusCode < 500
+}
+
+// windowCounter counts good and total events in a ring of fixed-size buckets
+type windowCounter struct {
+	mu         sync.Mutex
+	resolution time.Duration
+	good       []float64
+	total      []float64
+	last       int64
+}
+
+func newWindowCounter(size, resolution time.Duration) *windowCounter {
+	n := int(size / resolution)
+	if n < 1 {
+		n = 1
+	}
+	return &windowCounter{
+		resolution: resolution,
+		good:       make([]float64, n),
+		total:      make([]float64, n),
+	}
+}
+
+func (w *windowCounter) slot(now time.Time) int64 {
+	return now.UnixNano() / int64(w.resolution)
+}
+
+// advance moves the ring forward to slot, clearing the expired buckets
+func (w *windowCounter) advance(slot int64) {
+	if slot <= w.last {
+		return
+	}
+	n := int64(len(w.total))
+	if slot-w.last >= n {
+		for i := range w.total {
+			w.good[i], w.total[i] = 0, 0
+		}
+	} else {
+		for s := w.last + 1; s <= slot; s++ {
+			w.good[s%n], w.total[s%n] = 0, 0
+		}
+	}
+	w.last = slot
+}
+
+func (w *windowCounter) add(good bool, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot := w.slot(now)
+	w.advance(slot)
+	i := slot % int64(len(w.total))
+	w.total[i]++
+	if good {
+		w.good[i]++
+	}
+}
+
+// sum returns the good and total counts of the last d
+func (w *windowCounter) sum(d time.Duration, now time.Time) (good, total float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot := w.slot(now)
+	w.advance(slot)
+	n := int64(len(w.total))
+	k := int64(d / w.resolution)
+	if k > n {
+		k = n
+	}
+	for s := slot - k + 1; s <= slot; s++ {
+		good += w.good[s%n]
+		total += w.total[s%n]
+	}
+	return good, total
+}
+
+type trackedSLO struct {
+	SLO
+	counter *windowCounter
+}
+
+// burnRate returns how fast the error budget is consumed over the last d,
+// 1 meaning the budget is exactly exhausted at the end of the SLO period
+func (t *trackedSLO) burnRate(d time.Duration) float64 {
+	good, total := t.counter.sum(d, time.Now())
+	if total == 0 {
+		return 0
+	}
+	return ((total - good) / total) / (1 - t.Objective)
+}
+
+// SLOTracker is an Observer and Collector exporting the 5m/1h/6h burn rates of its SLOs
+type SLOTracker struct {
+	slos       []*trackedSLO
+	collectors []prometheus.Collector
+}
+
+// NewSLOTracker returns a SLOTracker with burn-rate gauges for every SLO, it still
+// needs to be registered. SLOs need a unique name and an objective in (0, 1)
+func NewSLOTracker(slos ...SLO) (*SLOTracker, error) {
+	t := &SLOTracker{}
+	names := make(map[string]bool, len(slos))
+	longest := burnRateWindows[len(burnRateWindows)-1]
+
+	for _, slo := range slos {
+		if slo.Name == "" {
+			return nil, errors.New("ginprom: SLO name is required")
+		}
+		if names[slo.Name] {
+			return nil, fmt.Errorf("ginprom: duplicate SLO %q", slo.Name)
+		}
+		if slo.Objective <= 0 || slo.Objective >= 1 {
+			return nil, fmt.Errorf("ginprom: objective of SLO %q must be in (0, 1), got %v", slo.Name, slo.Objective)
+		}
+		names[slo.Name] = true
+
+		if slo.IsGood == nil {
+			slo.IsGood = isNotServerError
+		}
+		ts := &trackedSLO{
+			SLO:     slo,
+			counter: newWindowCounter(longest, sloResolution),
+		}
+		t.slos = append(t.slos, ts)
+
+		t.collectors = append(t.collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "slo_objective_ratio",
+			Help:        "Target ratio of good requests of the SLO",
+			ConstLabels: prometheus.Labels{"slo": slo.Name},
+		}, func() float64 { return ts.Objective }))
+
+		for _, window := range burnRateWindows {
+			d := window
+			t.collectors = append(t.collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "slo_burn_rate",
+				Help:        "Error budget burn rate of the SLO over the window",
+				ConstLabels: prometheus.Labels{"slo": slo.Name, "window": formatWindow(d)},
+			}, func() float64 { return ts.burnRate(d) }))
+		}
+	}
+
+	return t, nil
+}
+
+// Describe implements prometheus.Collector
+func (t *SLOTracker) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range t.collectors {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (t *SLOTracker) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range t.collectors {
+		c.Collect(ch)
+	}
+}
+
+// Observe implements Observer
+func (t *SLOTracker) Observe(o Observation) {
+	now := time.Now()
+	for _, ts := range t.slos {
+		if ts.Match != nil && !ts.Match(o) {
+			continue
+		}
+		ts.counter.add(ts.IsGood(o), now)
+	}
+}
@@ -0,0 +1,159 @@
+package ginprom
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWindowCounter(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		name      string
+		events    map[time.Duration]bool
+		at        time.Duration
+		window    time.Duration
+		wantGood  float64
+		wantTotal float64
+	}{
+		{
+			name:      "all events in the window",
+			events:    map[time.Duration]bool{0: true, 10 * time.Second: false},
+			at:        20 * time.Second,
+			window:    time.Minute,
+			wantGood:  1,
+			wantTotal: 2,
+		},
+		{
+			name:      "expired buckets are cleared",
+			events:    map[time.Duration]bool{0: true, 50 * time.Second: false},
+			at:        80 * time.Second,
+			window:    time.Minute,
+			wantGood:  0,
+			wantTotal: 1,
+		},
+		{
+			name:      "shorter window than the ring",
+			events:    map[time.Duration]bool{0: true, 30 * time.Second: true},
+			at:        35 * time.Second,
+			window:    10 * time.Second,
+			wantGood:  1,
+			wantTotal: 1,
+		},
+		{
+			name:      "ring fully expired",
+			events:    map[time.Duration]bool{0: true},
+			at:        time.Hour,
+			window:    time.Minute,
+			wantGood:  0,
+			wantTotal: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newWindowCounter(time.Minute, time.Second)
+			for offset, good := range tt.events {
+				w.add(good, start.Add(offset))
+			}
+			good, total := w.sum(tt.window, start.Add(tt.at))
+			if good != tt.wantGood || total != tt.wantTotal {
+				t.Errorf("sum() = %v, %v, want %v, %v", good, total, tt.wantGood, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestFormatWindow(t *testing.T) {
+	tests := map[time.Duration]string{
+		30 * time.Second:             "30s",
+		5 * time.Minute:              "5m",
+		time.Hour:                    "1h",
+		90 * time.Minute:             "1h30m",
+		time.Hour + 30*time.Second:   "1h0m30s",
+		6*time.Hour + 5*time.Minute:  "6h5m",
+		2*time.Minute + time.Second:  "2m1s",
+		100 * time.Millisecond:       "100ms",
+		24 * time.Hour:               "24h",
+		3*time.Hour + 20*time.Minute: "3h20m",
+	}
+
+	for d, want := range tests {
+		if got := formatWindow(d); got != want {
+			t.Errorf("formatWindow(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestNewSLOTrackerValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		slos []SLO
+	}{
+		{"empty name", []SLO{{Objective: 0.99}}},
+		{"duplicate name", []SLO{{Name: "a", Objective: 0.99}, {Name: "a", Objective: 0.9}}},
+		{"zero objective", []SLO{{Name: "a"}}},
+		{"objective of one", []SLO{{Name: "a", Objective: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSLOTracker(tt.slos...); err == nil {
+				t.Error("NewSLOTracker() returned no error")
+			}
+		})
+	}
+}
+
+func TestSLOTrackerBurnRate(t *testing.T) {
+	tracker, err := NewSLOTracker(SLO{
+		Name:      "api",
+		Objective: 0.9,
+		Match:     func(o Observation) bool { return o.Endpoint != "/healthz" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tracker)
+
+	for i := 0; i < 8; i++ {
+		tracker.Observe(Observation{Endpoint: "/", StatusCode: 200})
+	}
+	tracker.Observe(Observation{Endpoint: "/", StatusCode: 503})
+	tracker.Observe(Observation{Endpoint: "/", StatusCode: 500})
+	tracker.Observe(Observation{Endpoint: "/healthz", StatusCode: 500})
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "service_slo_burn_rate" {
+			continue
+		}
+		if len(mf.GetMetric()) != len(burnRateWindows) {
+			t.Fatalf("got %d windows, want %d", len(mf.GetMetric()), len(burnRateWindows))
+		}
+		for _, m := range mf.GetMetric() {
+			// 20% errors against a 10% budget
+			if got := m.GetGauge().GetValue(); math.Abs(got-2) > 1e-9 {
+				t.Errorf("burn rate %v = %v, want 2", m.GetLabel(), got)
+			}
+		}
+	}
+
+	expected := `
+# HELP service_slo_objective_ratio Target ratio of good requests of the SLO
+# TYPE service_slo_objective_ratio gauge
+service_slo_objective_ratio{slo="api"} 0.9
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "service_slo_objective_ratio"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,152 @@
+// Package statsd sends the requests recorded by the ginprom middleware over UDP in the
+// StatsD or DogStatsD format, for the environments collecting metrics with a StatsD
+// or Datadog agent rather than scraping:
+//
+//	observer, err := statsd.New(statsd.Opts{Addr: "127.0.0.1:8125", Format: statsd.DogStatsD})
+//	opts := ginprom.NewDefaultOpts()
+//	opts.ObserversOnly = true
+//	opts.Observers = []ginprom.Observer{observer}
+//	r.Use(ginprom.PromMiddleware(opts))
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ginmetric/ginprom"
+)
+
+// Format is the wire format of the metrics
+type Format int
+
+const (
+	// StatsD is the plain StatsD format, which has no tags so the labels are left out
+	StatsD Format = iota
+	// DogStatsD is the Datadog format, sending the labels as tags
+	DogStatsD
+)
+
+// Opts configures an Observer
+type Opts struct {
+	// Addr is the UDP address of the agent, like 127.0.0.1:8125
+	Addr string
+	// Prefix is prepended to the metric names, like "myapi."
+	Prefix string
+	Format Format
+	// Tags are added to every metric in the DogStatsD format, like "env:prod"
+	Tags []string
+	// OnError is called with the errors of the sends, if set
+	OnError func(err error)
+}
+
+// Observer is a ginprom.Observer sending a packet per request with its count,
+// duration timing and size histograms, sent as timings in plain StatsD
+type Observer struct {
+	conn    net.Conn
+	prefix  string
+	format  Format
+	tags    string
+	onError func(err error)
+
+	buffers sync.Pool
+}
+
+// New returns an Observer sending to opts.Addr
+func New(opts Opts) (*Observer, error) {
+	if opts.Addr == "" {
+		return nil, errors.New("statsd: the agent address is required")
+	}
+	if opts.Format != StatsD && opts.Format != DogStatsD {
+		return nil, fmt.Errorf("statsd: unknown format %d", opts.Format)
+	}
+	conn, err := net.Dial("udp", opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+
+	tags := make([]string, len(opts.Tags))
+	for i, tag := range opts.Tags {
+		tags[i] = sanitize(tag)
+	}
+	return &Observer{
+		conn:    conn,
+		prefix:  opts.Prefix,
+		format:  opts.Format,
+		tags:    strings.Join(tags, ","),
+		onError: opts.OnError,
+		buffers: sync.Pool{New: func() any { return new([]byte) }},
+	}, nil
+}
+
+// Observe implements ginprom.Observer
+func (o *Observer) Observe(obs ginprom.Observation) {
+	bp := o.buffers.Get().(*[]byte)
+	defer o.buffers.Put(bp)
+
+	b := (*bp)[:0]
+	b = o.appendMetric(b, "http_request_count", 1, "c", obs)
+	b = append(b, '\n')
+	b = o.appendMetric(b, "http_request_duration", float64(obs.Duration.Microseconds())/1000, "ms", obs)
+	b = append(b, '\n')
+	b = o.appendMetric(b, "http_request_size", obs.RequestSize, o.histogramType(), obs)
+	b = append(b, '\n')
+	b = o.appendMetric(b, "http_response_size", obs.ResponseSize, o.histogramType(), obs)
+	*bp = b
+
+	if _, err := o.conn.Write(b); err != nil && o.onError != nil {
+		o.onError(fmt.Errorf("statsd: %w", err))
+	}
+}
+
+// histogramType returns the metric type of the size distributions, h in DogStatsD and
+// the timers plain StatsD aggregates alike, as it has no histograms
+func (o *Observer) histogramType() string {
+	if o.format == DogStatsD {
+		return "h"
+	}
+	return "ms"
+}
+
+// appendMetric appends a line of the metric name to b
+func (o *Observer) appendMetric(b []byte, name string, value float64, typ string, obs ginprom.Observation) []byte {
+	b = append(b, o.prefix...)
+	b = append(b, name...)
+	b = append(b, ':')
+	b = strconv.AppendFloat(b, value, 'f', -1, 64)
+	b = append(b, '|')
+	b = append(b, typ...)
+	if o.format != DogStatsD {
+		return b
+	}
+
+	b = append(b, "|#status:"...)
+	b = append(b, sanitize(obs.Status)...)
+	b = append(b, ",endpoint:"...)
+	b = append(b, sanitize(obs.Endpoint)...)
+	b = append(b, ",method:"...)
+	b = append(b, sanitize(obs.Method)...)
+	if o.tags != "" {
+		b = append(b, ',')
+		b = append(b, o.tags...)
+	}
+	return b
+}
+
+// Close closes the connection to the agent
+func (o *Observer) Close() error {
+	return o.conn.Close()
+}
+
+// tagReplacer replaces the characters separating the fields and the lines of DogStatsD
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+
+func sanitize(s string) string {
+	if !strings.ContainsAny(s, ",|\n") {
+		return s
+	}
+	return tagReplacer.Replace(s)
+}
@@ -0,0 +1,135 @@
+package statsd
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ginmetric/ginprom"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestObserver(t *testing.T) {
+	obs := ginprom.Observation{
+		Status:       "200",
+		Endpoint:     "/users/:id",
+		Method:       http.MethodGet,
+		StatusCode:   http.StatusOK,
+		Duration:     12500 * time.Microsecond,
+		RequestSize:  120,
+		ResponseSize: 4,
+	}
+	tests := []struct {
+		name string
+		opts Opts
+		obs  ginprom.Observation
+		want []string
+	}{
+		{"statsd", Opts{Prefix: "myapi."}, obs, []string{
+			"myapi.http_request_count:1|c",
+			"myapi.http_request_duration:12.5|ms",
+			"myapi.http_request_size:120|ms",
+			"myapi.http_response_size:4|ms",
+		}},
+		{"dogstatsd", Opts{Format: DogStatsD, Tags: []string{"env:prod"}}, obs, []string{
+			"http_request_count:1|c|#status:200,endpoint:/users/:id,method:GET,env:prod",
+			"http_request_duration:12.5|ms|#status:200,endpoint:/users/:id,method:GET,env:prod",
+			"http_request_size:120|h|#status:200,endpoint:/users/:id,method:GET,env:prod",
+			"http_response_size:4|h|#status:200,endpoint:/users/:id,method:GET,env:prod",
+		}},
+		{"sanitized tags", Opts{Format: DogStatsD}, ginprom.Observation{Status: "200", Endpoint: "/a,b|c", Method: "GET"}, []string{
+			"http_request_count:1|c|#status:200,endpoint:/a_b_c,method:GET",
+			"http_request_duration:0|ms|#status:200,endpoint:/a_b_c,method:GET",
+			"http_request_size:0|h|#status:200,endpoint:/a_b_c,method:GET",
+			"http_response_size:0|h|#status:200,endpoint:/a_b_c,method:GET",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := listen(t)
+			tt.opts.Addr = agent.LocalAddr().String()
+			o, err := New(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer o.Close()
+
+			o.Observe(tt.obs)
+			if got := read(t, agent); got != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", got, strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestObserverMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	agent := listen(t)
+	o, err := New(Opts{Addr: agent.LocalAddr().String(), Format: DogStatsD})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	opts := ginprom.NewDefaultOpts()
+	opts.ObserversOnly = true
+	opts.Observers = []ginprom.Observer{o}
+	r := gin.New()
+	r.Use(ginprom.PromMiddleware(opts))
+	r.GET("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "user")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	got := read(t, agent)
+	if !strings.HasPrefix(got, "http_request_count:1|c|#status:200,endpoint:/users/:id,method:GET\n") ||
+		!strings.Contains(got, "http_response_size:4|h|") {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+	}{
+		{"no address", Opts{}},
+		{"unknown format", Opts{Addr: "127.0.0.1:8125", Format: Format(42)}},
+		{"invalid address", Opts{Addr: "not an address"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if o, err := New(tt.opts); err == nil {
+				o.Close()
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func listen(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func read(t *testing.T, conn *net.UDPConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
@@ -0,0 +1,87 @@
+package ginprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// streamMetrics are the metrics of the streamed responses, by endpoint
+type streamMetrics struct {
+	firstByte *prometheus.HistogramVec
+	active    *prometheus.GaugeVec
+	sent      *prometheus.CounterVec
+}
+
+// registerStreamMetrics registers the streaming metrics of promOpts with r
+func registerStreamMetrics(r *registration, promOpts *PromOpts) *streamMetrics {
+	constLabels := promOpts.constLabels()
+	labels := []string{"endpoint"}
+	buckets := promOpts.durationBuckets()
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	return &streamMetrics{
+		firstByte: registerOrReuse(r, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_stream_first_byte_seconds",
+			Help:        promOpts.help(MetricStreamFirstByte, "Time to the first byte of the streamed responses in seconds"),
+			Buckets:     buckets,
+		}, labels)),
+		active: registerOrReuse(r, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_streams",
+			Help:        promOpts.help(MetricStreams, "Number of responses currently streamed"),
+		}, labels)),
+		sent: registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "http_stream_sent_bytes_total",
+			Help:        promOpts.help(MetricStreamSent, "Total number of bytes sent by the streamed responses, counted on every flush."),
+		}, labels)),
+	}
+}
+
+// responseStream tracks a response once the handlers flush it, which makes it a stream
+type responseStream struct {
+	metrics  *streamMetrics
+	endpoint string
+	start    time.Time
+
+	// active and sent are set when the stream starts
+	active prometheus.Gauge
+	sent   prometheus.Counter
+	// counted is the bytes already added to sent
+	counted int64
+}
+
+// flushed records the bytes sent so far, starting the stream on the first flush
+func (s *responseStream) flushed(w *responseWriter) {
+	if s.metrics == nil {
+		return
+	}
+	if s.sent == nil {
+		s.active = s.metrics.active.WithLabelValues(s.endpoint)
+		s.sent = s.metrics.sent.WithLabelValues(s.endpoint)
+		s.metrics.firstByte.WithLabelValues(s.endpoint).Observe(w.timeToFirstByte(s.start).Seconds())
+		s.active.Inc()
+	}
+	if bytes := w.bytes; bytes > s.counted {
+		s.sent.Add(float64(bytes - s.counted))
+		s.counted = bytes
+	}
+}
+
+// end records the bytes sent since the last flush and ends the stream, if it started
+func (s *responseStream) end(w *responseWriter) {
+	if s.sent == nil {
+		return
+	}
+	s.flushed(w)
+	s.active.Dec()
+}
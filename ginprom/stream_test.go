@@ -0,0 +1,139 @@
+package ginprom
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStreamMetrics(t *testing.T) {
+	const path = "/events"
+
+	tests := []struct {
+		name    string
+		events  []string
+		flush   bool
+		enabled bool
+		// wantSent are the bytes counted after each event, while streamed
+		wantSent    []float64
+		wantStreams int
+	}{
+		{"streamed", []string{"a\n", "bc\n", "def\n"}, true, true, []float64{2, 5, 9}, 1},
+		{"not flushed", []string{"a\n", "bc\n"}, false, true, []float64{0, 0}, 0},
+		{"disabled", []string{"a\n"}, true, false, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.StreamMetrics = tt.enabled
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET(path, func(c *gin.Context) {
+				if !tt.flush {
+					for _, event := range tt.events {
+						io.WriteString(c.Writer, event)
+					}
+					return
+				}
+				i := 0
+				c.Stream(func(w io.Writer) bool {
+					if i > 0 && m.streams != nil {
+						// c.Stream flushed the previous event
+						sent := testutil.ToFloat64(m.streams.sent.WithLabelValues(path))
+						if sent != tt.wantSent[i-1] {
+							t.Errorf("got %v bytes sent after event %d, want %v", sent, i, tt.wantSent[i-1])
+						}
+						if got := testutil.ToFloat64(m.streams.active.WithLabelValues(path)); got != 1 {
+							t.Errorf("got %v streams while streamed, want 1", got)
+						}
+					}
+					if i == len(tt.events) {
+						return false
+					}
+					io.WriteString(w, tt.events[i])
+					i++
+					return true
+				})
+			})
+			// c.Stream needs the http.CloseNotifier of a server's writer
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			if m.streams == nil {
+				return
+			}
+			if got := testutil.ToFloat64(m.streams.active.WithLabelValues(path)); got != 0 {
+				t.Errorf("got %v streams once done, want 0", got)
+			}
+			if got, want := testutil.ToFloat64(m.streams.sent.WithLabelValues(path)), tt.wantSent[len(tt.wantSent)-1]; got != want {
+				t.Errorf("got %v bytes sent once done, want %v", got, want)
+			}
+			count, err := testutil.GatherAndCount(opts.Registerer.(prometheus.Gatherer), "service_http_stream_first_byte_seconds")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.wantStreams {
+				t.Errorf("got %d time to first byte series, want %d", count, tt.wantStreams)
+			}
+		})
+	}
+}
+
+func TestResponseStreamEnd(t *testing.T) {
+	opts := NewDefaultOpts()
+	opts.Registerer = prometheus.NewRegistry()
+	r := opts.registration()
+	metrics := registerStreamMetrics(r, opts)
+	if err := r.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	w := &responseWriter{now: func() time.Time { return start.Add(time.Second) }}
+	w.stream = responseStream{metrics: metrics, endpoint: "/end", start: start}
+	w.started()
+	w.bytes = 3
+	w.stream.flushed(w)
+	// written after the last flush, counted when the handlers return
+	w.bytes = 10
+	w.stream.end(w)
+
+	if got := testutil.ToFloat64(metrics.sent.WithLabelValues("/end")); got != 10 {
+		t.Errorf("got %v bytes sent, want 10", got)
+	}
+	if got := testutil.ToFloat64(metrics.active.WithLabelValues("/end")); got != 0 {
+		t.Errorf("got %v streams, want 0", got)
+	}
+	families, err := opts.Registerer.(prometheus.Gatherer).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "service_http_stream_first_byte_seconds" {
+			continue
+		}
+		if h := mf.GetMetric()[0].GetHistogram(); h.GetSampleCount() != 1 || h.GetSampleSum() != 1 {
+			t.Errorf("got %d time to first byte observations summing %v, want one of 1s", h.GetSampleCount(), h.GetSampleSum())
+		}
+		return
+	}
+	t.Error("the time to first byte isn't observed")
+}
@@ -0,0 +1,9 @@
+package ginprom
+
+import "crypto/tls"
+
+// tlsLabels returns the version and cipher suite labels of a TLS connection, like
+// "TLS 1.3" and "TLS_AES_128_GCM_SHA256", the unknown ones being hexadecimal codes
+func tlsLabels(state *tls.ConnectionState) (version, cipherSuite string) {
+	return tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)
+}
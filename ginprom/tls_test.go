@@ -0,0 +1,93 @@
+package ginprom
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTLSLabels(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       tls.ConnectionState
+		wantVersion string
+		wantSuite   string
+	}{
+		{"tls 1.3", tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256},
+			"TLS 1.3", "TLS_AES_128_GCM_SHA256"},
+		{"tls 1.0", tls.ConnectionState{Version: tls.VersionTLS10, CipherSuite: tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+			"TLS 1.0", "TLS_RSA_WITH_AES_128_CBC_SHA"},
+		{"unknown", tls.ConnectionState{Version: 0x0999, CipherSuite: 0x0999}, "0x0999", "0x0999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, suite := tlsLabels(&tt.state)
+			if version != tt.wantVersion || suite != tt.wantSuite {
+				t.Errorf("got %q %q, want %q %q", version, suite, tt.wantVersion, tt.wantSuite)
+			}
+		})
+	}
+}
+
+func TestPromMiddlewareTLS(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		tls       bool
+		wantCount int
+	}{
+		{"tls", true, true, 1},
+		{"plain", true, false, 0},
+		{"disabled", false, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.TLSMetrics = tt.enabled
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/secure", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			srv := httptest.NewUnstartedServer(r)
+			if tt.tls {
+				srv.StartTLS()
+			} else {
+				srv.Start()
+			}
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + "/secure")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			count, err := testutil.GatherAndCount(reg, "service_http_tls_requests_total")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.wantCount {
+				t.Fatalf("got %d TLS series, want %d", count, tt.wantCount)
+			}
+			if tt.wantCount == 0 {
+				return
+			}
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := resp.TLS
+			if got := testutil.ToFloat64(m.tlsRequests.WithLabelValues(tlsLabels(state))); got != 1 {
+				t.Errorf("got %v requests for %v, want 1", got, state)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package ginprom
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesSharings holds the seriesSharing of the request metrics, by duration vector
+var seriesSharings sync.Map
+
+// seriesSharing holds the metrics of the middlewares recording into the same request
+// metrics, reused from their registry, so their series are pruned together
+type seriesSharing struct {
+	mu      sync.Mutex
+	metrics []*metrics
+	// pruning is set while a ticker prunes the series
+	pruning bool
+	// ttl is the longest SeriesTTL of the middlewares in nanoseconds, zero unless one is set
+	ttl atomic.Int64
+}
+
+// shareSeries adds m to the middlewares recording into its request metrics, their series
+// being pruned once none of them saw them for ttl, if positive
+func shareSeries(m *metrics, ttl time.Duration) {
+	v, _ := seriesSharings.LoadOrStore(m.reqDuration, &seriesSharing{})
+	s := v.(*seriesSharing)
+	m.sharing = s
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, m)
+	if int64(ttl) > s.ttl.Load() {
+		s.ttl.Store(int64(ttl))
+	}
+	if ttl > 0 && !s.pruning {
+		s.pruning = true
+		goBackground(func(stop <-chan struct{}) {
+			s.pruneSeries(ttl, stop)
+			// a later middleware restarts the ticker
+			s.mu.Lock()
+			s.pruning = false
+			s.mu.Unlock()
+		})
+	}
+}
+
+// seen records the request of s when the series are pruned
+func (m *metrics) seen(s *requestSeries) *requestSeries {
+	if m.sharing != nil && m.sharing.ttl.Load() > 0 {
+		s.lastSeen.Store(time.Now().UnixNano())
+	}
+	return s
+}
+
+// pruneSeries prunes the series every half of ttl until stop is closed
+func (s *seriesSharing) pruneSeries(ttl time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.prune(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// labelValuesDeleter is a metric vector whose series can be deleted
+type labelValuesDeleter interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// cachedSeries is a request series cached by the metrics of a middleware
+type cachedSeries struct {
+	m *metrics
+	s *requestSeries
+}
+
+// prune deletes the request series none of the middlewares saw for the TTL before now,
+// from their caches too, the series of their endpoints from the other vectors once they
+// have none left, and frees their MaxEndpointCardinality slots. A request racing the
+// deletion of its series is lost
+func (s *seriesSharing) prune(now time.Time) {
+	s.mu.Lock()
+	all := append([]*metrics(nil), s.metrics...)
+	s.mu.Unlock()
+
+	cutoff := now.Add(-time.Duration(s.ttl.Load())).UnixNano()
+	cached := map[seriesKey][]cachedSeries{}
+	for _, m := range all {
+		m.children.Range(func(key, value any) bool {
+			k := key.(seriesKey)
+			cached[k] = append(cached[k], cachedSeries{m, value.(*requestSeries)})
+			return true
+		})
+	}
+
+	stale := map[string]bool{}
+	alive := map[string]bool{}
+	for key, series := range cached {
+		if seenSince(series, cutoff) {
+			alive[key.endpoint] = true
+			continue
+		}
+		stale[key.endpoint] = true
+		for _, c := range series {
+			if c.m.children.CompareAndDelete(key, c.s) {
+				c.m.deleteSeries(c.s)
+			}
+		}
+	}
+
+	for endpoint := range stale {
+		if alive[endpoint] {
+			continue
+		}
+		for _, m := range all {
+			m.deleteEndpoint(endpoint)
+		}
+	}
+}
+
+// seenSince reports whether one of series was seen since cutoff
+func seenSince(series []cachedSeries, cutoff int64) bool {
+	for _, c := range series {
+		if c.s.lastSeen.Load() >= cutoff {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteSeries deletes the request series s from the vectors of m
+func (m *metrics) deleteSeries(s *requestSeries) {
+	if m.reqCountSharded != nil {
+		m.reqCountSharded.DeleteLabelValues(s.lvs...)
+	} else {
+		m.reqCount.DeleteLabelValues(s.lvs...)
+	}
+	for _, vec := range []prometheus.ObserverVec{m.reqDuration, m.reqSizeBytes, m.respSizeBytes} {
+		// the histograms and summaries, nil when disabled
+		if vec, ok := vec.(labelValuesDeleter); ok {
+			vec.DeleteLabelValues(s.lvs...)
+		}
+	}
+}
+
+// deleteEndpoint deletes the series of endpoint from the other vectors of m and frees its
+// MaxEndpointCardinality slot
+func (m *metrics) deleteEndpoint(endpoint string) {
+	labels := prometheus.Labels{"endpoint": endpoint}
+	for _, vec := range []*prometheus.CounterVec{m.upgrades, m.slowRequests, m.reqErrors, m.apdex, m.handlerErrors, m.panics} {
+		if vec != nil {
+			vec.DeletePartialMatch(labels)
+		}
+	}
+	if _, ok := m.endpoints.LoadAndDelete(endpoint); ok {
+		m.endpointCount.Add(-1)
+	}
+}
@@ -0,0 +1,147 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsPrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		opts func(opts *PromOpts)
+		// idle is how long ago each endpoint was last seen
+		idle map[string]time.Duration
+		// want are the endpoints left
+		want []string
+	}{
+		{"fresh", func(opts *PromOpts) {}, map[string]time.Duration{"/a": time.Minute}, []string{"/a"}},
+		{"stale", func(opts *PromOpts) {}, map[string]time.Duration{"/a": 2 * time.Hour, "/b": time.Minute}, []string{"/b"}},
+		{"all stale", func(opts *PromOpts) {}, map[string]time.Duration{"/a": 2 * time.Hour, "/b": 3 * time.Hour}, nil},
+		{"sharded", func(opts *PromOpts) { opts.ShardedRequestCount = true },
+			map[string]time.Duration{"/a": 2 * time.Hour, "/b": time.Minute}, []string{"/b"}},
+		{"summaries", func(opts *PromOpts) { opts.DurationType = SummaryMetric },
+			map[string]time.Duration{"/a": 2 * time.Hour}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer Close()
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.SeriesTTL = time.Hour
+			opts.SlowRequestThreshold = time.Nanosecond
+			opts.MaxEndpointCardinality = 10
+			tt.opts(opts)
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for endpoint, idle := range tt.idle {
+				endpoint = m.endpointLabel(endpoint, opts.MaxEndpointCardinality)
+				m.observe(200, endpoint, http.MethodGet, nil, 0.1, 10, 10, "")
+				m.slowRequests.WithLabelValues(endpoint, http.MethodGet).Inc()
+				m.series(200, endpoint, http.MethodGet).lastSeen.Store(now.Add(-idle).UnixNano())
+			}
+
+			m.sharing.prune(now)
+			for _, name := range []string{"service_http_request_count_total", "service_http_request_duration_seconds",
+				"service_http_request_size_bytes", "service_http_slow_request_count_total"} {
+				if count, err := testutil.GatherAndCount(reg, name); err != nil || count != len(tt.want) {
+					t.Errorf("got %d series of %s, want %d: %v", count, name, len(tt.want), err)
+				}
+			}
+			if got := m.endpointCount.Load(); got != int64(len(tt.want)) {
+				t.Errorf("got %d endpoints counted, want %d", got, len(tt.want))
+			}
+			for _, endpoint := range tt.want {
+				if _, ok := m.endpoints.Load(endpoint); !ok {
+					t.Errorf("got %s pruned", endpoint)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsPruneShared(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		// idleA and idleB are how long ago each middleware last saw /x
+		idleA, idleB time.Duration
+		// want are the requests counted once b served two more
+		want float64
+	}{
+		{"seen by one", 2 * time.Hour, time.Minute, 4},
+		{"stale for both", 2 * time.Hour, 3 * time.Hour, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer Close()
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			opts.SeriesTTL = time.Hour
+			opts.MaxEndpointCardinality = 10
+			a, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for m, idle := range map[*metrics]time.Duration{a: tt.idleA, b: tt.idleB} {
+				m.observe(200, m.endpointLabel("/x", opts.MaxEndpointCardinality), http.MethodGet, nil, 0.1, 10, 10, "")
+				m.series(200, "/x", http.MethodGet).lastSeen.Store(now.Add(-idle).UnixNano())
+			}
+
+			a.sharing.prune(now)
+			for i := 0; i < 2; i++ {
+				b.observe(200, b.endpointLabel("/x", opts.MaxEndpointCardinality), http.MethodGet, nil, 0.1, 10, 10, "")
+			}
+			if count, err := testutil.GatherAndCount(reg, "service_http_request_count_total"); err != nil || count != 1 {
+				t.Fatalf("got %d series, want 1: %v", count, err)
+			}
+			if got := testutil.ToFloat64(b.reqCount.WithLabelValues("200", "/x", http.MethodGet)); got != tt.want {
+				t.Errorf("got %v requests, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsSeriesTTL(t *testing.T) {
+	defer Close()
+	reg := prometheus.NewRegistry()
+	opts := NewDefaultOpts()
+	opts.Registerer = reg
+	opts.SeriesTTL = 20 * time.Millisecond
+	r := gin.New()
+	r.Use(PromMiddleware(opts))
+	r.GET("/removed", listUsers)
+
+	serve(r, http.MethodGet, "/removed")
+	if count, err := testutil.GatherAndCount(reg, "service_http_request_count_total"); err != nil || count != 1 {
+		t.Fatalf("got %d series, want 1: %v", count, err)
+	}
+	waitFor(t, func() bool {
+		count, err := testutil.GatherAndCount(reg, "service_http_request_count_total")
+		return err == nil && count == 0
+	})
+	// the pruned series start over
+	serve(r, http.MethodGet, "/removed")
+	m, err := newMetrics(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(m.reqCount.WithLabelValues("200", "/removed", http.MethodGet)); got != 1 {
+		t.Errorf("got %v requests after the pruning, want 1", got)
+	}
+}
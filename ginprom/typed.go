@@ -0,0 +1,188 @@
+package ginprom
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelFields maps the fields of a label struct to label names. A field is named by its
+// `label` tag, fields tagged `label:"-"` and unexported fields are skipped
+type labelFields struct {
+	names  []string
+	fields []int
+	kinds  []reflect.Kind
+}
+
+func newLabelFields[T any]() (*labelFields, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("ginprom: labels must be a struct, got %s", t)
+	}
+
+	lf := &labelFields{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := field.Tag.Lookup("label")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if !ok || name == "" {
+			return nil, fmt.Errorf("ginprom: field %s.%s has no label tag", t, field.Name)
+		}
+
+		switch kind := field.Type.Kind(); kind {
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			lf.names = append(lf.names, name)
+			lf.fields = append(lf.fields, i)
+			lf.kinds = append(lf.kinds, kind)
+		default:
+			return nil, fmt.Errorf("ginprom: field %s.%s of type %s can't be a label", t, field.Name, field.Type)
+		}
+	}
+	return lf, nil
+}
+
+// values returns the label values of labels, in the order of names
+func (lf *labelFields) values(labels interface{}) []string {
+	v := reflect.ValueOf(labels)
+	values := make([]string, len(lf.fields))
+	for i, field := range lf.fields {
+		f := v.Field(field)
+		switch lf.kinds[i] {
+		case reflect.String:
+			values[i] = f.String()
+		case reflect.Bool:
+			values[i] = strconv.FormatBool(f.Bool())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			values[i] = strconv.FormatInt(f.Int(), 10)
+		default:
+			values[i] = strconv.FormatUint(f.Uint(), 10)
+		}
+	}
+	return values
+}
+
+// TypedCounter is a counter whose labels are the fields of T, so passing the wrong
+// labels fails at compile time instead of panicking in WithLabelValues
+type TypedCounter[T any] struct {
+	vec    *prometheus.CounterVec
+	labels *labelFields
+}
+
+// NewTypedCounter registers a counter labelled by the fields of T, see PromOpts.NewCounter,
+// promOpts defaults to NewDefaultOpts
+func NewTypedCounter[T any](promOpts *PromOpts, name, help string) (*TypedCounter[T], error) {
+	labels, err := newLabelFields[T]()
+	if err != nil {
+		return nil, err
+	}
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	vec, err := promOpts.NewCounter(name, help, labels.names...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedCounter[T]{vec: vec, labels: labels}, nil
+}
+
+// Inc increments the counter of labels by 1
+func (c *TypedCounter[T]) Inc(labels T) {
+	c.vec.WithLabelValues(c.labels.values(labels)...).Inc()
+}
+
+// Add adds v, which must not be negative, to the counter of labels
+func (c *TypedCounter[T]) Add(labels T, v float64) {
+	c.vec.WithLabelValues(c.labels.values(labels)...).Add(v)
+}
+
+// Vec returns the underlying vector
+func (c *TypedCounter[T]) Vec() *prometheus.CounterVec {
+	return c.vec
+}
+
+// TypedGauge is a gauge whose labels are the fields of T
+type TypedGauge[T any] struct {
+	vec    *prometheus.GaugeVec
+	labels *labelFields
+}
+
+// NewTypedGauge registers a gauge labelled by the fields of T, see PromOpts.NewGauge,
+// promOpts defaults to NewDefaultOpts
+func NewTypedGauge[T any](promOpts *PromOpts, name, help string) (*TypedGauge[T], error) {
+	labels, err := newLabelFields[T]()
+	if err != nil {
+		return nil, err
+	}
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	vec, err := promOpts.NewGauge(name, help, labels.names...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedGauge[T]{vec: vec, labels: labels}, nil
+}
+
+// Set sets the gauge of labels to v
+func (g *TypedGauge[T]) Set(labels T, v float64) {
+	g.vec.WithLabelValues(g.labels.values(labels)...).Set(v)
+}
+
+// Add adds v to the gauge of labels
+func (g *TypedGauge[T]) Add(labels T, v float64) {
+	g.vec.WithLabelValues(g.labels.values(labels)...).Add(v)
+}
+
+// Inc increments the gauge of labels by 1
+func (g *TypedGauge[T]) Inc(labels T) {
+	g.Add(labels, 1)
+}
+
+// Dec decrements the gauge of labels by 1
+func (g *TypedGauge[T]) Dec(labels T) {
+	g.Add(labels, -1)
+}
+
+// Vec returns the underlying vector
+func (g *TypedGauge[T]) Vec() *prometheus.GaugeVec {
+	return g.vec
+}
+
+// TypedHistogram is a histogram whose labels are the fields of T
+type TypedHistogram[T any] struct {
+	vec    *prometheus.HistogramVec
+	labels *labelFields
+}
+
+// NewTypedHistogram registers a histogram labelled by the fields of T, see PromOpts.NewHistogram,
+// promOpts defaults to NewDefaultOpts
+func NewTypedHistogram[T any](promOpts *PromOpts, name, help string, buckets []float64) (*TypedHistogram[T], error) {
+	labels, err := newLabelFields[T]()
+	if err != nil {
+		return nil, err
+	}
+	if promOpts == nil {
+		promOpts = NewDefaultOpts()
+	}
+	vec, err := promOpts.NewHistogram(name, help, buckets, labels.names...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedHistogram[T]{vec: vec, labels: labels}, nil
+}
+
+// Observe adds v to the histogram of labels
+func (h *TypedHistogram[T]) Observe(labels T, v float64) {
+	h.vec.WithLabelValues(h.labels.values(labels)...).Observe(v)
+}
+
+// Vec returns the underlying vector
+func (h *TypedHistogram[T]) Vec() *prometheus.HistogramVec {
+	return h.vec
+}
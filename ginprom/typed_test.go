@@ -0,0 +1,113 @@
+package ginprom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type orderLabels struct {
+	Channel  string `label:"channel"`
+	Retry    bool   `label:"retry"`
+	Attempts int    `label:"attempts"`
+	Internal string `label:"-"`
+	note     string
+}
+
+func TestLabelFields(t *testing.T) {
+	lf, err := newLabelFields[orderLabels]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"channel", "retry", "attempts"}; !reflect.DeepEqual(lf.names, want) {
+		t.Errorf("got names %v, want %v", lf.names, want)
+	}
+	got := lf.values(orderLabels{Channel: "web", Retry: true, Attempts: 2, Internal: "x", note: "y"})
+	if want := []string{"web", "true", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got values %v, want %v", got, want)
+	}
+}
+
+func TestLabelFieldsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		create  func() error
+		wantErr string
+	}{
+		{
+			name: "not a struct",
+			create: func() error {
+				_, err := newLabelFields[string]()
+				return err
+			},
+			wantErr: "must be a struct",
+		},
+		{
+			name: "missing tag",
+			create: func() error {
+				_, err := newLabelFields[struct{ Channel string }]()
+				return err
+			},
+			wantErr: "has no label tag",
+		},
+		{
+			name: "unsupported type",
+			create: func() error {
+				_, err := newLabelFields[struct {
+					Tags []string `label:"tags"`
+				}]()
+				return err
+			},
+			wantErr: "can't be a label",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.create()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTypedMetrics(t *testing.T) {
+	orders, err := NewTypedCounter[orderLabels](nil, "test_typed_orders_total", "Orders.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := orderLabels{Channel: "web", Attempts: 1}
+	before := testutil.ToFloat64(orders.Vec().WithLabelValues("web", "false", "1"))
+	orders.Inc(labels)
+	orders.Add(labels, 2)
+	if got := testutil.ToFloat64(orders.Vec().WithLabelValues("web", "false", "1")) - before; got != 3 {
+		t.Errorf("got counter %v, want 3", got)
+	}
+
+	type queueLabels struct {
+		Queue string `label:"queue"`
+	}
+	queue, err := NewTypedGauge[queueLabels](nil, "test_typed_queue_size", "Queue size.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Set(queueLabels{"mail"}, 5)
+	queue.Inc(queueLabels{"mail"})
+	queue.Dec(queueLabels{"mail"})
+	queue.Add(queueLabels{"mail"}, -2)
+	if got := testutil.ToFloat64(queue.Vec().WithLabelValues("mail")); got != 3 {
+		t.Errorf("got gauge %v, want 3", got)
+	}
+
+	latency, err := NewTypedHistogram[queueLabels](nil, "test_typed_job_seconds", "Job latency.", []float64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latency.Observe(queueLabels{"mail"}, 0.5)
+	if got := testutil.CollectAndCount(latency.Vec()); got != 1 {
+		t.Errorf("got %d histograms, want 1", got)
+	}
+}
@@ -0,0 +1,65 @@
+package ginprom
+
+import (
+	"fmt"
+	"time"
+)
+
+// DurationUnit is the unit of the request duration metric
+type DurationUnit int
+
+const (
+	// DurationSeconds observes the durations in seconds in http_request_duration_seconds,
+	// as the Prometheus conventions recommend
+	DurationSeconds DurationUnit = iota
+	// DurationMilliseconds observes the durations in milliseconds in
+	// http_request_duration_milliseconds, for the organizations standardized on them
+	DurationMilliseconds
+)
+
+// String returns the name of the unit, the suffix of the duration metric
+func (u DurationUnit) String() string {
+	switch u {
+	case DurationSeconds:
+		return "seconds"
+	case DurationMilliseconds:
+		return "milliseconds"
+	}
+	return fmt.Sprintf("DurationUnit(%d)", int(u))
+}
+
+// value returns d in the unit
+func (u DurationUnit) value(d time.Duration) float64 {
+	if u == DurationMilliseconds {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return d.Seconds()
+}
+
+// scale returns the buckets in seconds converted to the unit
+func (u DurationUnit) scale(buckets []float64) []float64 {
+	if u != DurationMilliseconds {
+		return buckets
+	}
+	scaled := make([]float64, len(buckets))
+	for i, bucket := range buckets {
+		scaled[i] = bucket * 1000
+	}
+	return scaled
+}
+
+// validateDurationUnit returns an error when DurationUnit is unknown
+func (po *PromOpts) validateDurationUnit() error {
+	if po.DurationUnit != DurationSeconds && po.DurationUnit != DurationMilliseconds {
+		return fmt.Errorf("ginprom: unknown duration unit %v", po.DurationUnit)
+	}
+	return nil
+}
+
+// unit returns the OpenMetrics unit of the built-in metric key
+func (po *PromOpts) unit(key string) string {
+	if key == MetricRequestDuration {
+		return po.DurationUnit.String()
+	}
+	return defaultUnits[key]
+}
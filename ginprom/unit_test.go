@@ -0,0 +1,129 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDurationUnitValue(t *testing.T) {
+	tests := []struct {
+		unit DurationUnit
+		d    time.Duration
+		want float64
+	}{
+		{DurationSeconds, 1500 * time.Millisecond, 1.5},
+		{DurationMilliseconds, 1500 * time.Millisecond, 1500},
+		{DurationMilliseconds, 250 * time.Microsecond, 0.25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.unit.String(), func(t *testing.T) {
+			if got := tt.unit.value(tt.d); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromOptsDurationUnit(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        func(opts *PromOpts)
+		wantName    string
+		wantBuckets []float64
+		wantErr     bool
+	}{
+		{"seconds", func(opts *PromOpts) { opts.DurationBuckets = []float64{0.1, 1} },
+			"service_http_request_duration_seconds", []float64{0.1, 1}, false},
+		{"milliseconds", func(opts *PromOpts) {
+			opts.DurationUnit, opts.DurationBuckets = DurationMilliseconds, []float64{0.1, 1}
+		}, "service_http_request_duration_milliseconds", []float64{100, 1000}, false},
+		{"milliseconds preset", func(opts *PromOpts) {
+			opts.DurationUnit, opts.DurationBucketPreset = DurationMilliseconds, BucketsBatch
+		}, "service_http_request_duration_milliseconds", DurationMilliseconds.scale(BucketPresets[BucketsBatch]), false},
+		{"renamed", func(opts *PromOpts) {
+			opts.DurationUnit = DurationMilliseconds
+			opts.Names = map[string]string{MetricRequestDuration: "latency_ms"}
+			opts.DurationBuckets = []float64{1}
+		}, "service_latency_ms", []float64{1000}, false},
+		{"unknown", func(opts *PromOpts) { opts.DurationUnit = 3 }, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := NewDefaultOpts()
+			opts.Registerer = reg
+			tt.opts(opts)
+			mw, err := NewPromMiddleware(opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want an error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			r := gin.New()
+			r.Use(mw)
+			r.GET("/slow", func(c *gin.Context) {
+				time.Sleep(2 * time.Millisecond)
+				c.Status(http.StatusOK)
+			})
+			serve(r, http.MethodGet, "/slow")
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mf := range families {
+				if mf.GetName() != tt.wantName {
+					continue
+				}
+				h := mf.GetMetric()[0].GetHistogram()
+				var buckets []float64
+				for _, b := range h.GetBucket() {
+					buckets = append(buckets, b.GetUpperBound())
+				}
+				if !reflect.DeepEqual(buckets, tt.wantBuckets) {
+					t.Errorf("got buckets %v, want %v", buckets, tt.wantBuckets)
+				}
+				// about 2ms, observed in the unit
+				min, max := 0.002, 1.0
+				if opts.DurationUnit == DurationMilliseconds {
+					min, max = 2, 1000
+				}
+				if sum := h.GetSampleSum(); sum < min || sum > max {
+					t.Errorf("got a duration of %v, want it in [%v, %v]", sum, min, max)
+				}
+				return
+			}
+			t.Errorf("got no %s metric", tt.wantName)
+		})
+	}
+}
+
+func TestDurationUnitOpenMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	opts := NewDefaultOpts()
+	opts.Registerer = reg
+	opts.Namespace = "unit_test"
+	opts.DurationUnit = DurationMilliseconds
+	r := gin.New()
+	r.Use(PromMiddleware(opts))
+	r.GET("/users", listUsers)
+	serve(r, http.MethodGet, "/users")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	OpenMetricsHandler(reg).ServeHTTP(w, req)
+	if want := "# UNIT unit_test_http_request_duration_milliseconds milliseconds"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("got no %q in\n%s", want, w.Body)
+	}
+}
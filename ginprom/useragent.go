@@ -0,0 +1,76 @@
+package ginprom
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the user agent classes of ClassifyUserAgent
+const (
+	BotUserAgent     = "bot"
+	MobileUserAgent  = "mobile"
+	BrowserUserAgent = "browser"
+	SDKUserAgent     = "sdk"
+	OtherUserAgent   = "other"
+	UnknownUserAgent = "unknown"
+)
+
+// botUserAgentTokens are the lower case tokens of the crawlers, monitors and link previews
+var botUserAgentTokens = []string{
+	"bot", "crawl", "spider", "slurp", "headless", "lighthouse", "facebookexternalhit",
+	"mediapartners", "preview", "pingdom", "uptime", "monitor",
+}
+
+// sdkUserAgentTokens are the lower case tokens of the HTTP libraries and command line tools
+var sdkUserAgentTokens = []string{
+	"curl/", "wget/", "go-http-client", "python-requests", "python-urllib", "aiohttp", "httpx",
+	"okhttp", "java/", "apache-httpclient", "axios", "node-fetch", "undici", "ruby",
+	"libwww-perl", "postmanruntime", "insomnia", "grpc-", "dart:io",
+}
+
+// mobileUserAgentTokens are the lower case tokens of the mobile browsers
+var mobileUserAgentTokens = []string{"mobi", "android", "iphone", "ipad", "ipod", "windows phone"}
+
+// IsBot reports whether userAgent is the one of a crawler, a monitor or a link preview
+func IsBot(userAgent string) bool {
+	return containsAny(strings.ToLower(userAgent), botUserAgentTokens)
+}
+
+// ClassifyUserAgent returns the class of userAgent: bot, sdk for the HTTP libraries
+// and tools like curl, mobile, browser, other, or unknown when it's empty
+func ClassifyUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return UnknownUserAgent
+	case containsAny(ua, botUserAgentTokens):
+		return BotUserAgent
+	case containsAny(ua, sdkUserAgentTokens):
+		return SDKUserAgent
+	case !strings.HasPrefix(ua, "mozilla/") && !strings.HasPrefix(ua, "opera/"):
+		return OtherUserAgent
+	case containsAny(ua, mobileUserAgentTokens):
+		return MobileUserAgent
+	default:
+		return BrowserUserAgent
+	}
+}
+
+// UserAgentClass returns a UserAgentLabelMappingFn labelling the requests with the class
+// classify returns for their User-Agent header, like ClassifyUserAgent
+func UserAgentClass(classify func(userAgent string) string) RequestLabelMappingFn {
+	return func(c *gin.Context) string {
+		return classify(c.Request.UserAgent())
+	}
+}
+
+// containsAny reports whether s contains one of tokens
+func containsAny(s string, tokens []string) bool {
+	for _, token := range tokens {
+		if strings.Contains(s, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package ginprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+		wantBot   bool
+	}{
+		{"empty", "", UnknownUserAgent, false},
+		{"chrome", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			BrowserUserAgent, false},
+		{"firefox", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", BrowserUserAgent, false},
+		{"iphone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			MobileUserAgent, false},
+		{"android", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			MobileUserAgent, false},
+		{"googlebot", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", BotUserAgent, true},
+		{"bingbot", "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", BotUserAgent, true},
+		{"headless chrome", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
+			BotUserAgent, true},
+		{"link preview", "facebookexternalhit/1.1", BotUserAgent, true},
+		{"curl", "curl/8.4.0", SDKUserAgent, false},
+		{"go", "Go-http-client/1.1", SDKUserAgent, false},
+		{"python", "python-requests/2.31.0", SDKUserAgent, false},
+		{"okhttp", "okhttp/4.12.0", SDKUserAgent, false},
+		{"other", "MyCustomApp/1.0", OtherUserAgent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyUserAgent(tt.userAgent); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if got := IsBot(tt.userAgent); got != tt.wantBot {
+				t.Errorf("got bot %v, want %v", got, tt.wantBot)
+			}
+		})
+	}
+}
+
+func TestPromOptsUserAgentLabel(t *testing.T) {
+	tests := []struct {
+		name      string
+		classify  func(userAgent string) string
+		opts      func(opts *PromOpts)
+		userAgent string
+		want      []string
+	}{
+		{"bot", ClassifyUserAgent, func(opts *PromOpts) {}, "Googlebot/2.1",
+			[]string{"200", "/users", http.MethodGet, BotUserAgent}},
+		{"custom classifier", func(userAgent string) string {
+			if strings.HasPrefix(userAgent, "acme-sdk/") {
+				return "acme"
+			}
+			return ClassifyUserAgent(userAgent)
+		}, func(opts *PromOpts) {}, "acme-sdk/1.2", []string{"200", "/users", http.MethodGet, "acme"}},
+		{"after the client", ClassifyUserAgent, func(opts *PromOpts) {
+			opts.ClientLabelMappingFn = func(c *gin.Context) string { return InternalClientValue }
+		}, "curl/8.4.0", []string{"200", "/users", http.MethodGet, InternalClientValue, SDKUserAgent}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.UserAgentLabelMappingFn = UserAgentClass(tt.classify)
+			tt.opts(opts)
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/users", listUsers)
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testutil.ToFloat64(m.reqCount.WithLabelValues(tt.want...)); got != 1 {
+				t.Errorf("got %v requests labelled %v, want 1", got, tt.want)
+			}
+		})
+	}
+}
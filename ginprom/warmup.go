@@ -0,0 +1,14 @@
+package ginprom
+
+// WarmupMode selects how the requests started during PromOpts.WarmupPeriod are recorded
+type WarmupMode int
+
+const (
+	// WarmupSuppress doesn't record the warm-up requests in the request metrics,
+	// the observers are still notified
+	WarmupSuppress WarmupMode = iota
+	// WarmupLabel records the warm-up requests with the warmup="true" label and
+	// the other requests with warmup="false", so deploy-time latencies stay visible
+	// without moving the alerts selecting warmup="false"
+	WarmupLabel
+)
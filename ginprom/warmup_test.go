@@ -0,0 +1,124 @@
+package ginprom
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// withPrivateRegistry swaps the default registry for a new one during the test,
+// the default registry refusing metrics with other labels under the same names
+func withPrivateRegistry(t *testing.T) *prometheus.Registry {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	registerer, gatherer := prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+	prometheus.DefaultRegisterer, prometheus.DefaultGatherer = reg, reg
+	t.Cleanup(func() {
+		prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registerer, gatherer
+	})
+	return reg
+}
+
+func TestPromMiddlewareWarmupSuppress(t *testing.T) {
+	tests := []struct {
+		name       string
+		period     time.Duration
+		wantCount  float64
+		wantWarmup bool
+	}{
+		{"warming up", time.Hour, 0, true},
+		{"warmed up", time.Nanosecond, 1, false},
+		{"no warm-up", 0, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warmup bool
+			opts := NewDefaultOpts()
+			opts.WarmupPeriod = tt.period
+			opts.Observers = []Observer{observerFunc(func(o Observation) { warmup = o.Warmup })}
+			r, m := newTestEngine(t, opts, "/warmup-suppress")
+			time.Sleep(time.Millisecond)
+
+			counter := m.reqCount.WithLabelValues("200", "/warmup-suppress", http.MethodGet)
+			before := testutil.ToFloat64(counter)
+			serve(r, http.MethodGet, "/warmup-suppress")
+			if got := testutil.ToFloat64(counter) - before; got != tt.wantCount {
+				t.Errorf("got %v requests, want %v", got, tt.wantCount)
+			}
+			if warmup != tt.wantWarmup {
+				t.Errorf("observed warm-up %v, want %v", warmup, tt.wantWarmup)
+			}
+		})
+	}
+}
+
+func TestPromMiddlewareWarmupLabel(t *testing.T) {
+	withPrivateRegistry(t)
+	path := "/warmup-label"
+
+	tests := []struct {
+		name       string
+		period     time.Duration
+		wantWarmup bool
+	}{
+		{"warming up", time.Hour, true},
+		{"warmed up", time.Nanosecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.WarmupPeriod = tt.period
+			opts.WarmupMode = WarmupLabel
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET(path, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			time.Sleep(time.Millisecond)
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.warm == nil {
+				t.Fatal("no warm-up metrics")
+			}
+			warm := m.warm.reqCount.WithLabelValues("200", path, http.MethodGet)
+			steady := m.reqCount.WithLabelValues("200", path, http.MethodGet)
+			beforeWarm, beforeSteady := testutil.ToFloat64(warm), testutil.ToFloat64(steady)
+			serve(r, http.MethodGet, path)
+
+			wantWarm, wantSteady := 0.0, 1.0
+			if tt.wantWarmup {
+				wantWarm, wantSteady = 1, 0
+			}
+			if got := testutil.ToFloat64(warm) - beforeWarm; got != wantWarm {
+				t.Errorf("got %v warm-up requests, want %v", got, wantWarm)
+			}
+			if got := testutil.ToFloat64(steady) - beforeSteady; got != wantSteady {
+				t.Errorf("got %v steady requests, want %v", got, wantSteady)
+			}
+
+			for counter, want := range map[prometheus.Counter]string{warm: "true", steady: "false"} {
+				var pb dto.Metric
+				if err := counter.Write(&pb); err != nil {
+					t.Fatal(err)
+				}
+				labels := map[string]string{}
+				for _, lp := range pb.GetLabel() {
+					labels[lp.GetName()] = lp.GetValue()
+				}
+				if labels["warmup"] != want {
+					t.Errorf("got labels %v, want warmup %q", labels, want)
+				}
+			}
+		})
+	}
+}
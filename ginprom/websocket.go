@@ -0,0 +1,101 @@
+package ginprom
+
+import (
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// websocketDurationBuckets cover WebSocket connections from a second to two hours
+var websocketDurationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200}
+
+// websocketMetrics are the metrics of the WebSocket connections, by endpoint
+type websocketMetrics struct {
+	active   *prometheus.GaugeVec
+	duration *prometheus.HistogramVec
+	sent     *prometheus.CounterVec
+	received *prometheus.CounterVec
+}
+
+// registerWebSocketMetrics registers the WebSocket metrics of promOpts with r
+func registerWebSocketMetrics(r *registration, promOpts *PromOpts) *websocketMetrics {
+	constLabels := promOpts.constLabels()
+	labels := []string{"endpoint"}
+	return &websocketMetrics{
+		active: registerOrReuse(r, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "websocket_connections",
+			Help:        promOpts.help(MetricWebSocketConns, "Number of WebSocket connections currently open"),
+		}, labels)),
+		duration: registerOrReuse(r, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "websocket_connection_duration_seconds",
+			Help:        promOpts.help(MetricWebSocketDuration, "WebSocket connection durations in seconds"),
+			Buckets:     websocketDurationBuckets,
+		}, labels)),
+		sent: registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "websocket_sent_bytes_total",
+			Help:        promOpts.help(MetricWebSocketSent, "Total number of bytes sent on the WebSocket connections."),
+		}, labels)),
+		received: registerOrReuse(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   promOpts.namespace(),
+			Subsystem:   promOpts.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "websocket_received_bytes_total",
+			Help:        promOpts.help(MetricWebSocketReceived, "Total number of bytes received on the WebSocket connections."),
+		}, labels)),
+	}
+}
+
+// websocketConn tracks a WebSocket connection in the metrics of its endpoint
+type websocketConn struct {
+	active   prometheus.Gauge
+	duration prometheus.Observer
+	sent     prometheus.Counter
+	received prometheus.Counter
+	start    time.Time
+}
+
+// conn returns the tracker of a WebSocket connection of endpoint
+func (m *websocketMetrics) conn(endpoint string) *websocketConn {
+	return &websocketConn{
+		active:   m.active.WithLabelValues(endpoint),
+		duration: m.duration.WithLabelValues(endpoint),
+		sent:     m.sent.WithLabelValues(endpoint),
+		received: m.received.WithLabelValues(endpoint),
+	}
+}
+
+// opened records the connection is open
+func (c *websocketConn) opened() {
+	c.start = time.Now()
+	c.active.Inc()
+}
+
+// closed records the connection is closed
+func (c *websocketConn) closed() {
+	c.active.Dec()
+	c.duration.Observe(time.Since(c.start).Seconds())
+}
+
+// countingReader counts the bytes read from a Reader into counter
+type countingReader struct {
+	io.Reader
+	counter prometheus.Counter
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if n > 0 {
+		r.counter.Add(float64(n))
+	}
+	return n, err
+}
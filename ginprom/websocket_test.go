@@ -0,0 +1,131 @@
+package ginprom
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWebSocketMetrics(t *testing.T) {
+	const (
+		path     = "/ws/:room"
+		response = "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"
+	)
+
+	tests := []struct {
+		name    string
+		upgrade string
+		// readConn reads the message from the connection instead of the buffered reader
+		readConn     bool
+		wantTracked  bool
+		wantSent     float64
+		wantReceived float64
+	}{
+		{"websocket", "websocket", false, true, float64(len(response) + 4), 4},
+		{"websocket read from the connection", "websocket", true, true, float64(len(response) + 4), 4},
+		{"other protocol", "mystery", false, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.WebSocketMetrics = true
+			closed := make(chan struct{})
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET(path, func(c *gin.Context) {
+				conn, rw, err := c.Writer.Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				go func() {
+					defer close(closed)
+					defer conn.Close()
+					rw.WriteString(response)
+					rw.Flush()
+					msg := make([]byte, 4)
+					if tt.readConn && rw.Reader.Buffered() == 0 {
+						_, err = io.ReadFull(conn, msg)
+					} else {
+						_, err = io.ReadFull(rw, msg)
+					}
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					rw.Write(msg)
+					rw.Flush()
+				}()
+			})
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			m, err := newMetrics(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			active := m.websockets.active.WithLabelValues(path)
+
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.Write([]byte("GET /ws/1 HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: " + tt.upgrade + "\r\n\r\n"))
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("got status %d", resp.StatusCode)
+			}
+			if tt.wantTracked {
+				waitFor(t, func() bool { return testutil.ToFloat64(active) == 1 })
+			}
+			conn.Write([]byte("ping"))
+			<-closed
+			if echo, _ := io.ReadAll(br); string(echo) != "ping" {
+				t.Errorf("got echo %q", echo)
+			}
+
+			if got := testutil.ToFloat64(active); got != 0 {
+				t.Errorf("got %v connections once closed, want 0", got)
+			}
+			if got := testutil.ToFloat64(m.websockets.sent.WithLabelValues(path)); got != tt.wantSent {
+				t.Errorf("got %v bytes sent, want %v", got, tt.wantSent)
+			}
+			if got := testutil.ToFloat64(m.websockets.received.WithLabelValues(path)); got != tt.wantReceived {
+				t.Errorf("got %v bytes received, want %v", got, tt.wantReceived)
+			}
+			count, err := testutil.GatherAndCount(opts.Registerer.(prometheus.Gatherer), "service_websocket_connection_duration_seconds")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{true: 1}[tt.wantTracked]; count != want {
+				t.Errorf("got %d duration series, want %d", count, want)
+			}
+		})
+	}
+}
+
+func TestWebSocketMetricsDisabled(t *testing.T) {
+	opts := NewDefaultOpts()
+	opts.Registerer = prometheus.NewRegistry()
+	m, err := newMetrics(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.websockets != nil {
+		t.Error("got the WebSocket metrics without PromOpts.WebSocketMetrics")
+	}
+}
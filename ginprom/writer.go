@@ -0,0 +1,221 @@
+package ginprom
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// responseWriter wraps the gin.ResponseWriter of a request to track what the
+// handlers send: the body bytes, when the response started and whether the
+// connection was hijacked
+type responseWriter struct {
+	gin.ResponseWriter
+
+	now        func() time.Time
+	bytes      int64
+	firstWrite time.Time
+	hijacked   bool
+	// conn is the hijacked connection, if any
+	conn *hijackedConn
+	// websocket tracks the connection once hijacked, if it upgrades to WebSocket
+	websocket *websocketConn
+	// stream tracks the response once flushed, if PromOpts.StreamMetrics is set
+	stream responseStream
+	// conns tracks the hijacked connections until they are closed
+	conns prometheus.Gauge
+}
+
+func (w *responseWriter) reset(rw gin.ResponseWriter, now func() time.Time, conns prometheus.Gauge) {
+	*w = responseWriter{ResponseWriter: rw, now: now, conns: conns}
+}
+
+// started records the time the response starts being sent
+func (w *responseWriter) started() {
+	if w.firstWrite.IsZero() {
+		w.firstWrite = w.now()
+	}
+}
+
+// Write implements http.ResponseWriter
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.started()
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.started()
+	n, err := w.ResponseWriter.WriteString(s)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// WriteHeaderNow implements gin.ResponseWriter
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.started()
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush implements http.Flusher
+func (w *responseWriter) Flush() {
+	w.started()
+	w.ResponseWriter.Flush()
+	w.stream.flushed(w)
+}
+
+// Hijack implements http.Hijacker, the bytes the handlers write through the hijacked
+// connection until they return are counted
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.Hijack()
+	if err != nil {
+		return conn, rw, err
+	}
+	w.started()
+	w.hijacked = true
+	w.conn = &hijackedConn{Conn: conn, conns: w.conns, websocket: w.websocket}
+	if w.conns != nil {
+		w.conns.Inc()
+	}
+	if w.websocket != nil {
+		w.websocket.opened()
+	}
+	// the buffered writer was flushed, it's replaced by one counting the bytes
+	reader := rw.Reader
+	if w.websocket != nil {
+		// the buffered reader reads the connection before it was wrapped
+		reader = bufio.NewReader(&countingReader{Reader: rw.Reader, counter: w.websocket.received})
+	}
+	rw = bufio.NewReadWriter(reader, bufio.NewWriter(w.conn))
+	return w.conn, rw, nil
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// bodyReader wraps the body of a request to count the bytes the handlers read
+type bodyReader struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (r *bodyReader) reset(body io.ReadCloser) {
+	*r = bodyReader{ReadCloser: body}
+}
+
+// Read implements io.Reader
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// hijackedConn counts the bytes written to a hijacked connection
+// and decrements the hijacked connections when closed
+type hijackedConn struct {
+	net.Conn
+	written   atomic.Int64
+	conns     prometheus.Gauge
+	websocket *websocketConn
+	once      sync.Once
+}
+
+// Read implements net.Conn
+func (c *hijackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.websocket != nil && n > 0 {
+		c.websocket.received.Add(float64(n))
+	}
+	return n, err
+}
+
+// Write implements net.Conn
+func (c *hijackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	if c.websocket != nil && n > 0 {
+		c.websocket.sent.Add(float64(n))
+	}
+	return n, err
+}
+
+// Close implements net.Conn
+func (c *hijackedConn) Close() error {
+	c.once.Do(func() {
+		if c.conns != nil {
+			c.conns.Dec()
+		}
+		if c.websocket != nil {
+			c.websocket.closed()
+		}
+	})
+	return c.Conn.Close()
+}
+
+// Size implements gin.ResponseWriter
+func (w *responseWriter) Size() int {
+	return int(w.size())
+}
+
+// size returns the bytes of the response, including the ones written to the hijacked connection
+func (w *responseWriter) size() int64 {
+	if w.conn != nil {
+		return w.bytes + w.conn.written.Load()
+	}
+	return w.bytes
+}
+
+// timeToFirstByte returns how long after start the response started, zero if it didn't
+func (w *responseWriter) timeToFirstByte(start time.Time) time.Duration {
+	if w.firstWrite.IsZero() || w.firstWrite.Before(start) {
+		return 0
+	}
+	return w.firstWrite.Sub(start)
+}
+
+// upgradeProtocols are the protocols of the upgrades labelled by name, others are "other"
+var upgradeProtocols = map[string]string{
+	"websocket": "websocket",
+	"h2c":       "h2c",
+}
+
+// upgradeProtocol returns the protocol the request asks to upgrade to, empty if it doesn't
+func upgradeProtocol(r *http.Request) string {
+	upgrade := false
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				upgrade = true
+			}
+		}
+	}
+	if !upgrade {
+		return ""
+	}
+
+	protocol := strings.TrimSpace(r.Header.Get("Upgrade"))
+	if protocol == "" {
+		return ""
+	}
+	// only the first protocol listed is considered, without its version
+	protocol, _, _ = strings.Cut(protocol, ",")
+	protocol, _, _ = strings.Cut(protocol, "/")
+	if name, ok := upgradeProtocols[strings.ToLower(strings.TrimSpace(protocol))]; ok {
+		return name
+	}
+	return "other"
+}
@@ -0,0 +1,337 @@
+package ginprom
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestResponseWriter(t *testing.T) {
+	tests := []struct {
+		name      string
+		write     func(w *responseWriter)
+		wantBytes int64
+		wantStart bool
+	}{
+		{"nothing", func(w *responseWriter) {}, 0, false},
+		{"status only", func(w *responseWriter) { w.WriteHeader(http.StatusNoContent) }, 0, false},
+		{"header sent", func(w *responseWriter) { w.WriteHeaderNow() }, 0, true},
+		{"write", func(w *responseWriter) { w.Write([]byte("hello")) }, 5, true},
+		{"write string", func(w *responseWriter) { w.WriteString("hello") }, 5, true},
+		{"several writes", func(w *responseWriter) {
+			w.Write([]byte("hello"))
+			w.WriteString(" world")
+		}, 11, true},
+		{"flush", func(w *responseWriter) { w.Flush() }, 0, true},
+		{"unwrap", func(w *responseWriter) {
+			if w.Unwrap() != w.ResponseWriter {
+				t.Error("Unwrap doesn't return the wrapped writer")
+			}
+		}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			start := time.Now()
+			w := &responseWriter{}
+			w.reset(c.Writer, time.Now, nil)
+			tt.write(w)
+
+			if w.bytes != tt.wantBytes || w.Size() != int(tt.wantBytes) {
+				t.Errorf("got %d bytes and size %d, want %d", w.bytes, w.Size(), tt.wantBytes)
+			}
+			if got := !w.firstWrite.IsZero(); got != tt.wantStart {
+				t.Errorf("got started %v, want %v", got, tt.wantStart)
+			}
+			if ttfb := w.timeToFirstByte(start); ttfb < 0 || !tt.wantStart && ttfb != 0 {
+				t.Errorf("got time to first byte %v", ttfb)
+			}
+		})
+	}
+}
+
+func TestPromMiddlewareResponseWriter(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      gin.HandlerFunc
+		wantSize     float64
+		wantTTFB     bool
+		wantHijacked bool
+	}{
+		{"body", func(c *gin.Context) { c.String(http.StatusOK, "hello") }, 5, true, false},
+		// gin sends the header after the middlewares returned
+		{"no body", func(c *gin.Context) { c.Status(http.StatusNoContent) }, 0, false, false},
+		{"delayed body", func(c *gin.Context) {
+			time.Sleep(10 * time.Millisecond)
+			c.String(http.StatusOK, "hello")
+		}, 5, true, false},
+		{"streamed", func(c *gin.Context) {
+			events := 0
+			c.Stream(func(w io.Writer) bool {
+				io.WriteString(w, "hello")
+				events++
+				return events < 2
+			})
+		}, 10, true, false},
+		{"hijacked", func(c *gin.Context) {
+			conn, rw, err := c.Writer.Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+			rw.Flush()
+		}, 57, true, true},
+		{"hijacked connection written", func(c *gin.Context) {
+			conn, _, err := c.Writer.Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello"))
+		}, 62, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observed := make(chan Observation, 1)
+			opts := NewDefaultOpts()
+			opts.Observers = []Observer{observerFunc(func(o Observation) { observed <- o })}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.GET("/response-writer", tt.handler)
+
+			// a real server, as hijacking needs a connection
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + "/response-writer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			var obs Observation
+			select {
+			case obs = <-observed:
+			case <-time.After(time.Second):
+				t.Fatal("the request isn't observed")
+			}
+
+			if obs.ResponseSize != tt.wantSize {
+				t.Errorf("got response size %v, want %v", obs.ResponseSize, tt.wantSize)
+			}
+			if got := obs.TimeToFirstByte > 0; got != tt.wantTTFB {
+				t.Errorf("got time to first byte %v", obs.TimeToFirstByte)
+			}
+			if obs.TimeToFirstByte > obs.Duration {
+				t.Errorf("time to first byte %v is after the duration %v", obs.TimeToFirstByte, obs.Duration)
+			}
+			if obs.Hijacked != tt.wantHijacked {
+				t.Errorf("got hijacked %v, want %v", obs.Hijacked, tt.wantHijacked)
+			}
+		})
+	}
+}
+
+func TestUpgradeProtocol(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection []string
+		upgrade    string
+		want       string
+	}{
+		{"no upgrade", nil, "", ""},
+		{"upgrade without connection", nil, "websocket", ""},
+		{"connection without upgrade", []string{"Upgrade"}, "", ""},
+		{"websocket", []string{"Upgrade"}, "websocket", "websocket"},
+		{"case insensitive", []string{"keep-alive, UPGRADE"}, "WebSocket", "websocket"},
+		{"several connection headers", []string{"keep-alive", "Upgrade"}, "websocket", "websocket"},
+		{"h2c", []string{"Upgrade, HTTP2-Settings"}, "h2c", "h2c"},
+		{"versioned", []string{"Upgrade"}, "IRC/6.9, websocket", "other"},
+		{"unknown", []string{"Upgrade"}, "mystery", "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, value := range tt.connection {
+				r.Header.Add("Connection", value)
+			}
+			if tt.upgrade != "" {
+				r.Header.Set("Upgrade", tt.upgrade)
+			}
+			if got := upgradeProtocol(r); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromMiddlewareUpgrades(t *testing.T) {
+	path := "/upgrade"
+	release := make(chan struct{})
+	hijacked := make(chan struct{})
+	r, m := newTestEngine(t, nil, "/unused")
+	r.GET(path, func(c *gin.Context) {
+		conn, rw, err := c.Writer.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		// the connection outlives the request until the handler's goroutine closes it
+		go func() {
+			<-release
+			conn.Close()
+			conn.Close()
+			close(hijacked)
+		}()
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		upgrade string
+		want    string
+	}{
+		{"websocket", "websocket", "websocket"},
+		{"unknown protocol", "mystery", "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release = make(chan struct{})
+			hijacked = make(chan struct{})
+			counter := m.upgrades.WithLabelValues(path, tt.want)
+			beforeCount := testutil.ToFloat64(counter)
+			beforeConns := testutil.ToFloat64(m.hijacked)
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", tt.upgrade)
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("got status %d", resp.StatusCode)
+			}
+
+			waitFor(t, func() bool { return testutil.ToFloat64(counter)-beforeCount == 1 })
+			if got := testutil.ToFloat64(m.hijacked) - beforeConns; got != 1 {
+				t.Errorf("got %v hijacked connections while open, want 1", got)
+			}
+			close(release)
+			<-hijacked
+			if got := testutil.ToFloat64(m.hijacked) - beforeConns; got != 0 {
+				t.Errorf("got %v hijacked connections once closed, want 0", got)
+			}
+		})
+	}
+}
+
+// waitFor waits for cond to hold, as the middleware records after the response is sent
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCalcRequestSize(t *testing.T) {
+	// GET HTTP/1.1 example.com, no header
+	const base = 3 + 8 + 11
+	tests := []struct {
+		name   string
+		target string
+		body   int64
+		want   int
+	}{
+		{"path", "/users", -1, base + len("/users")},
+		{"query", "/users?page=2", -1, base + len("/users?page=2")},
+		{"body", "/users", 5, base + len("/users") + 5},
+		{"no url", "", -1, base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Method: http.MethodGet, Proto: "HTTP/1.1", Host: "example.com", ContentLength: -1}
+			if tt.target != "" {
+				r.URL = httptest.NewRequest(http.MethodGet, tt.target, nil).URL
+			}
+			if got := calcRequestSize(r, tt.body); got != float64(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromMiddlewareRequestSize(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	tests := []struct {
+		name          string
+		contentLength bool
+		handler       gin.HandlerFunc
+		fromHeader    bool
+		wantBody      float64
+	}{
+		{"read", true, func(c *gin.Context) { io.Copy(io.Discard, c.Request.Body) }, false, 100},
+		{"chunked", false, func(c *gin.Context) { io.Copy(io.Discard, c.Request.Body) }, false, 100},
+		{"partly read", true, func(c *gin.Context) { io.CopyN(io.Discard, c.Request.Body, 10) }, false, 10},
+		{"unread", true, func(c *gin.Context) {}, false, 0},
+		{"content length", true, func(c *gin.Context) {}, true, 100},
+		{"chunked content length", false, func(c *gin.Context) { io.Copy(io.Discard, c.Request.Body) }, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var observed Observation
+			opts := NewDefaultOpts()
+			opts.Registerer = prometheus.NewRegistry()
+			opts.RequestSizeFromContentLength = tt.fromHeader
+			opts.Observers = []Observer{observerFunc(func(o Observation) { observed = o })}
+			r := gin.New()
+			r.Use(PromMiddleware(opts))
+			r.POST("/upload", func(c *gin.Context) {
+				tt.handler(c)
+				c.Status(http.StatusNoContent)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body))
+			if !tt.contentLength {
+				req.ContentLength = -1
+			}
+			original := req.Body
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if req.Body != original {
+				t.Error("the request body isn't restored")
+			}
+			// the size of the request without its body
+			base := calcRequestSize(req, 0)
+			if got := observed.RequestSize - base; got != tt.wantBody {
+				t.Errorf("got a body of %v bytes, want %v", got, tt.wantBody)
+			}
+		})
+	}
+}